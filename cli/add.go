@@ -24,12 +24,17 @@ It will ask you to type the secret at runtime, to avoid saving it to your
 shell history. If you need to pass in the contents of a file (such as TLS keys),
 you can pipe it's contents to stdin.
 Please be mindful of your bash history when piping in strings.
+
+A rotation policy can be set with --rotate-every, as a number of hours, days or
+weeks such as 90d. The stale command then reports the secret once it has not
+been rotated for that long.
 `
 
 const exampleAdd = `
 ejson-kms add password
 ejson-kms add password --path="secrets.json"
 ejson-kms add password --description="Nuclear launch code"
+ejson-kms add password --rotate-every=90d
 cat tls-cert.key | ejson-kms add tls_key
 `
 
@@ -45,10 +50,14 @@ func addCmd() *cobra.Command {
 	var (
 		storePath   = ".secrets.json"
 		description = ""
+		rotateEvery = ""
 	)
 
 	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
 	cmd.Flags().StringVar(&description, "description", description, "freeform description of the secret")
+	cmd.Flags().StringVar(&rotateEvery, "rotate-every", rotateEvery, "how often the secret must be rotated, such as 90d")
+
+	kmsOpts := addKMSFlags(cmd)
 
 	cmd.RunE = func(_ *cobra.Command, args []string) error {
 
@@ -67,6 +76,19 @@ func addCmd() *cobra.Command {
 			return errors.WrapPrefix(err, "Invalid name", 0)
 		}
 
+		if rotateEvery != "" {
+			rotateEvery, err = validRotationPeriod(rotateEvery)
+			if err != nil {
+				return errors.WrapPrefix(err, "Invalid rotation policy", 0)
+			}
+		}
+
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
 		store, err := model.Load(storePath)
 		if err != nil {
 			return errors.WrapPrefix(err, "Unable to load JSON", 0)
@@ -81,16 +103,36 @@ func addCmd() *cobra.Command {
 			return errors.WrapPrefix(err, "Unable to read from stdin", 0)
 		}
 
-		client, err := kmsDefaultClient()
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
 		if err != nil {
 			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
 		}
 
-		err = store.Add(client, plaintext, name, description)
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		store.Author = commandAuthor(ctx, store)
+
+		err = store.AddWithContext(ctx, provider, plaintext, name, description)
 		if err != nil {
 			return errors.WrapPrefix(err, "Unable to add secret", 0)
 		}
 
+		err = store.SetRotationPolicy(name, rotateEvery)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to set the rotation policy", 0)
+		}
+
 		err = store.Save(storePath)
 		if err != nil {
 			return errors.WrapPrefix(err, "Unable to save JSON", 0)
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docAddKMSKey = `
+add-kms-key: Add a master key able to decrypt a secrets file.
+
+The data key of each secret is wrapped by every master key of the file, and
+decryption tries each of them in order. Adding a key in another AWS region, or
+a break-glass local key created with keygen, keeps the secrets available if a
+single master key is unavailable or deleted. AWS KMS keys given as an ARN are
+called in the region of the ARN, other key IDs in the region of the
+environment.
+
+This command will decrypt all your secrets, and re-encrypt them with new data
+keys wrapped by all the master keys. If any secret fails to be decrypted or
+encrypted, the file is left untouched.
+`
+
+const exampleAddKMSKey = `
+ejson-kms add-kms-key arn:aws:kms:eu-west-1:123456789012:alias/MyAliasName
+ejson-kms add-kms-key file:///etc/ejson-kms/break-glass.key --path="secrets.json"
+`
+
+func addKMSKeyCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "add-kms-key KMS_KEY_ID",
+		Short:   "add a master key able to decrypt the secrets",
+		Long:    strings.TrimSpace(docAddKMSKey),
+		Example: strings.TrimSpace(exampleAddKMSKey),
+	}
+
+	var storePath = ".secrets.json"
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		kmsKeyID, err := utils.HasOneArgument(args)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid KMS Key ID", 0)
+		}
+
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+		}
+
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		err = store.AddKMSKeyWithContext(ctx, provider, kmsKeyID)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to add the KMS key", 0)
+		}
+
+		err = store.Save(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to save JSON", 0)
+		}
+
+		cmd.Printf("Exported new secrets file at: %s\n", storePath)
+		return nil
+
+	}
+
+	return cmd
+}
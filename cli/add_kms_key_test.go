@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// withTempKeyFiles runs the closure with the key IDs of new local master keys.
+func withTempKeyFiles(t *testing.T, count int, f func(keyIDs []string)) {
+
+	keyIDs := make([]string, count)
+	for i := range keyIDs {
+		withTempPath(t, func(keyPath string) {
+			keyID, err := kms.GenerateKeyFile(keyPath)
+			assert.NoError(t, err)
+			keyIDs[i] = keyID
+		})
+	}
+
+	defer func() {
+		for _, keyID := range keyIDs {
+			_ = os.Remove(keyID[len("file://"):])
+		}
+	}()
+
+	f(keyIDs)
+
+}
+
+func TestAddKMSKey(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := addKMSKeyCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("no argument", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := addKMSKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid KMS Key ID: No argument provided")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := addKMSKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath, testKmsKeyID2})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("with kms init error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := addKMSKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath, testKmsKeyID2})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withKMSDefaultClientError(t, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to initialize AWS client: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("with kms encrypt error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := addKMSKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath, testKmsKeyID2})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"Secret": &testName}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+			client.On("Encrypt", testKmsKeyID2, testKeyPlaintext, map[string]*string{"Secret": &testName}).Return("", errors.New("testing errors")).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), fmt.Sprintf("Unable to add the KMS key: Unable to encrypt secret: secret: %s: Unable to encrypt data key: testing errors", testKmsKeyID2))
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := addKMSKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath, testKmsKeyID2})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"Secret": &testName}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+			client.On("Encrypt", testKmsKeyID2, testKeyPlaintext, map[string]*string{"Secret": &testName}).Return(testKeyCiphertext2, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.KMSKeyID, testKmsKeyID)
+			assert.Equal(t, store.AdditionalKMSKeyIDs, []string{testKmsKeyID2})
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("with local keys", func(t *testing.T) {
+
+		withTempKeyFiles(t, 2, func(keyIDs []string) {
+			withTempPath(t, func(storePath string) {
+				defer os.Remove(storePath) // nolint: errcheck
+
+				withMockKmsClient(t, &mock_kms.Client{}, func() {
+
+					store := model.NewStore(keyIDs[0], map[string]*string{})
+					provider, err := defaultProvider(kms.DefaultRetryPolicy())
+					assert.NoError(t, err)
+					assert.NoError(t, store.Add(provider, "password", testName, ""))
+					assert.NoError(t, store.Save(storePath))
+
+					cmd := addKMSKeyCmd()
+					cmd.SetArgs([]string{"--path", storePath, keyIDs[1]})
+					cmd.SetOutput(&bytes.Buffer{})
+					assert.NoError(t, cmd.Execute())
+
+					// the first master key is lost
+					assert.NoError(t, os.Remove(keyIDs[0][len("file://"):]))
+
+					out := &bytes.Buffer{}
+					cmd = getCmd()
+					cmd.SetArgs([]string{"--path", storePath, testName})
+					cmd.SetOutput(out)
+					assert.NoError(t, cmd.Execute())
+					assert.Equal(t, out.String(), "password\n")
+
+				})
+
+			})
+		})
+
+	})
+
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/adrienkohlbecker/ejson-kms/kms"
 	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
 	"github.com/adrienkohlbecker/ejson-kms/model"
 	"github.com/stretchr/testify/assert"
@@ -60,6 +61,23 @@ func TestAdd(t *testing.T) {
 
 	})
 
+	t.Run("invalid rotation policy", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := addCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--rotate-every=3m", testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid rotation policy: Invalid rotation period 3m, expected a number of hours, days or weeks such as 90d")
+			}
+
+		})
+
+	})
+
 	t.Run("invalid json", func(t *testing.T) {
 
 		withTempStore(t, testDataInvalid, func(storePath string) {
@@ -179,7 +197,7 @@ func TestAdd(t *testing.T) {
 
 				store, err := model.Load(storePath)
 				assert.NoError(t, err)
-				items, err := store.ExportPlaintext(client)
+				items, err := store.ExportPlaintext(kms.NewAWSProvider(client))
 				assert.NoError(t, err)
 
 				item, ok := <-items
@@ -190,6 +208,40 @@ func TestAdd(t *testing.T) {
 				assert.Equal(t, item.Name, testName)
 				assert.Equal(t, item.Plaintext, "password")
 
+				secret := store.Find(testName)
+				assert.NotNil(t, secret.CreatedAt)
+				assert.Equal(t, secret.UpdatedAt, secret.CreatedAt)
+				assert.Equal(t, secret.UpdatedBy, testCallerARN)
+				assert.Equal(t, secret.Rotations, 0)
+
+			})
+
+		})
+
+	})
+
+	t.Run("with rotation policy", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := addCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--rotate-every=90d", testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"Secret": &testName}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+			withStdin(t, "password\n", func() {
+
+				withMockKmsClient(t, client, func() {
+					err := cmd.Execute()
+					assert.NoError(t, err)
+				})
+
+				store, err := model.Load(storePath)
+				assert.NoError(t, err)
+				assert.Equal(t, store.Find(testName).RotateEvery, "90d")
+
 			})
 
 		})
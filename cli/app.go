@@ -22,10 +22,34 @@ func App() *cobra.Command {
 	}
 
 	cmd.AddCommand(addCmd())
+	cmd.AddCommand(addKMSKeyCmd())
+	cmd.AddCommand(diffCmd())
+	cmd.AddCommand(editContextCmd())
+	cmd.AddCommand(execCmd())
 	cmd.AddCommand(exportCmd())
+	cmd.AddCommand(getCmd())
+	cmd.AddCommand(gitMergeDriverCmd())
+	cmd.AddCommand(gitSetupCmd())
+	cmd.AddCommand(gitTextconvCmd())
+	cmd.AddCommand(historyCmd())
+	cmd.AddCommand(importCmd())
 	cmd.AddCommand(initCmd())
+	cmd.AddCommand(keygenCmd())
+	cmd.AddCommand(listCmd())
+	cmd.AddCommand(migrateCmd())
+	cmd.AddCommand(removeCmd())
+	cmd.AddCommand(removeKMSKeyCmd())
+	cmd.AddCommand(renameCmd())
+	cmd.AddCommand(rollbackCmd())
+	cmd.AddCommand(rotateFileKeyCmd())
 	cmd.AddCommand(rotateKMSKeyCmd())
+	cmd.AddCommand(rotateMACKeyCmd())
 	cmd.AddCommand(rotateCmd())
+	cmd.AddCommand(setHistoryCmd())
+	cmd.AddCommand(setPaddingCmd())
+	cmd.AddCommand(setRotationCmd())
+	cmd.AddCommand(staleCmd())
+	cmd.AddCommand(verifyCmd())
 	cmd.AddCommand(versionCmd())
 
 	return cmd
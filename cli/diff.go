@@ -0,0 +1,331 @@
+package cli
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docDiff = `
+diff: Compare the values of the secrets of two secrets files.
+
+Encrypting the same value twice gives a different ciphertext, so comparing
+secrets files with git diff does not tell which values changed. This command
+decrypts the secrets of both files, and reports each secret by name as added,
+removed, changed or unchanged.
+
+Compare two files with "diff OLD NEW", or the secrets file given by --path
+with its version at a git revision with "diff --rev=REV".
+
+Values are never printed unless --show-values is given. A fingerprint of each
+value is shown instead: the first 12 hexadecimal characters of its HMAC-SHA256,
+keyed with a random key generated for each run. Fingerprints tell whether two
+values of the same output are equal without revealing them, but cannot be
+compared between runs, nor used to guess values.
+
+The command exits with a status code of 0 even if the files differ, unless
+--exit-code is given: it then exits with 1 when any secret was added, removed
+or changed, like git diff --exit-code.
+
+Two formats are available:
+
+  * table: human-readable output
+  * json:  machine-readable output
+`
+
+const exampleDiff = `
+ejson-kms diff old.json .secrets.json
+ejson-kms diff --rev=HEAD~1
+ejson-kms diff --rev=origin/main --path=secrets.json --show-values
+ejson-kms diff --rev=HEAD --exit-code || echo "secrets changed"
+`
+
+// diffOutput is the JSON representation of the diff command output
+type diffOutput struct {
+	Secrets []diffSecret `json:"secrets"`
+}
+
+type diffSecret struct {
+	Name           string  `json:"name"`
+	Status         string  `json:"status"`
+	OldFingerprint string  `json:"old_fingerprint,omitempty"`
+	NewFingerprint string  `json:"new_fingerprint,omitempty"`
+	OldValue       *string `json:"old_value,omitempty"`
+	NewValue       *string `json:"new_value,omitempty"`
+}
+
+func diffCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "diff [OLD NEW]",
+		Short:   "compare the decrypted secrets of two files or git revisions",
+		Long:    strings.TrimSpace(docDiff),
+		Example: strings.TrimSpace(exampleDiff),
+	}
+
+	var (
+		storePath   = ".secrets.json"
+		rev         = ""
+		format      = "table"
+		showValues  = false
+		exitCode    = false
+		concurrency = defaultConcurrency
+	)
+
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file compared with --rev")
+	cmd.Flags().StringVar(&rev, "rev", rev, "git revision to compare the secrets file with")
+	cmd.Flags().StringVar(&format, "format", format, "format of the generated output (table|json)")
+	cmd.Flags().BoolVar(&showValues, "show-values", showValues, "print the decrypted values instead of fingerprints")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", exitCode, "exit with a status code of 1 when the files differ")
+	cmd.Flags().IntVar(&concurrency, "concurrency", concurrency, "maximum number of secrets decrypted in parallel")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		oldPath := ""
+
+		if rev != "" {
+
+			if len(args) > 0 {
+				return errors.Errorf("Invalid files: No argument expected with --rev, use --path")
+			}
+
+			err := utils.ValidSecretsPath(storePath)
+			if err != nil {
+				return errors.WrapPrefix(err, "Invalid path", 0)
+			}
+
+		} else {
+
+			var err error
+			oldPath, storePath, err = utils.HasTwoArguments(args)
+			if err != nil {
+				return errors.WrapPrefix(err, "Invalid files", 0)
+			}
+
+			for _, path := range []string{oldPath, storePath} {
+				err = utils.ValidSecretsPath(path)
+				if err != nil {
+					return errors.WrapPrefix(err, "Invalid path", 0)
+				}
+			}
+
+		}
+
+		if format != "table" && format != "json" {
+			return errors.Errorf("Invalid formatter: Unknown format %s", format)
+		}
+
+		if concurrency < 1 {
+			return errors.Errorf("Invalid concurrency: must be at least 1")
+		}
+
+		fingerprintKey := make([]byte, sha256.Size)
+		_, err := io.ReadFull(rand.Reader, fingerprintKey)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to generate a fingerprint key", 0)
+		}
+
+		oldStore, err := loadOldStore(oldPath, rev, storePath)
+		if err != nil {
+			return err
+		}
+
+		newStore, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+		}
+
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, oldStore, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the old secrets file", 0)
+		}
+
+		err = kmsOpts.verifyStore(ctx, newStore, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the new secrets file", 0)
+		}
+
+		diff, err := oldStore.DiffWithContext(ctx, provider, newStore, concurrency)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to compare the secrets files", 0)
+		}
+
+		output := newDiffOutput(diff, fingerprintKey, showValues)
+
+		if format == "json" {
+			err = diffJSON(cmd.OutOrStdout(), output)
+		} else {
+			err = diffTable(cmd.OutOrStdout(), output, showValues)
+		}
+
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to write to output", 0)
+		}
+
+		if exitCode {
+			for _, item := range diff {
+				if item.Status != model.DiffUnchanged {
+					// the output already lists the differences
+					cmd.SilenceErrors = true
+					cmd.SilenceUsage = true
+					return &ExitError{Code: 1}
+				}
+			}
+		}
+
+		return nil
+
+	}
+
+	return cmd
+
+}
+
+// loadOldStore loads the old file compared by the diff command: the one at
+// oldPath, or the secrets file at a git revision.
+func loadOldStore(oldPath string, rev string, storePath string) (*model.Store, error) {
+
+	if rev == "" {
+
+		store, err := model.Load(oldPath)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		return store, nil
+
+	}
+
+	data, err := gitShow(rev, storePath)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := model.Parse(data, fmt.Sprintf("%s:%s", rev, storePath))
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to load JSON", 0)
+	}
+
+	return store, nil
+
+}
+
+// valueFingerprint identifies a value without revealing it: the first 12
+// hexadecimal characters of its HMAC-SHA256 with the given key. Unlike a plain
+// hash, it cannot be used to guess short or common values without the key.
+func valueFingerprint(key []byte, value string) string {
+
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(value))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:12]
+
+}
+
+func newDiffOutput(diff []*model.SecretDiff, fingerprintKey []byte, showValues bool) diffOutput {
+
+	output := diffOutput{
+		Secrets: make([]diffSecret, 0, len(diff)),
+	}
+
+	for _, item := range diff {
+
+		secret := diffSecret{Name: item.Name, Status: item.Status}
+
+		if item.Status != model.DiffAdded {
+			secret.OldFingerprint = valueFingerprint(fingerprintKey, item.OldPlaintext)
+			if showValues {
+				value := item.OldPlaintext
+				secret.OldValue = &value
+			}
+		}
+
+		if item.Status != model.DiffRemoved {
+			secret.NewFingerprint = valueFingerprint(fingerprintKey, item.NewPlaintext)
+			if showValues {
+				value := item.NewPlaintext
+				secret.NewValue = &value
+			}
+		}
+
+		output.Secrets = append(output.Secrets, secret)
+
+	}
+
+	return output
+
+}
+
+func diffJSON(w io.Writer, output diffOutput) error {
+
+	b, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		// Note: not covered by tests as no error can be hit with the current schema
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+
+}
+
+func diffTable(w io.Writer, output diffOutput, showValues bool) error {
+
+	if len(output.Secrets) == 0 {
+		_, err := fmt.Fprintln(w, "No secrets in either file")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "STATUS\tNAME\tOLD\tNEW")
+	for _, item := range output.Secrets {
+		oldValue, newValue := item.OldFingerprint, item.NewFingerprint
+		if showValues {
+			oldValue, newValue = quoteValue(item.OldValue), quoteValue(item.NewValue)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", item.Status, item.Name, orDash(oldValue), orDash(newValue))
+	}
+
+	return tw.Flush()
+
+}
+
+// quoteValue quotes a value for the table output, so that whitespace and
+// non-printable characters are visible.
+func quoteValue(value *string) string {
+
+	if value == nil {
+		return ""
+	}
+
+	return strconv.Quote(*value)
+
+}
@@ -0,0 +1,411 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	crypto_mock "github.com/adrienkohlbecker/ejson-kms/crypto/mock"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/go-errors/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// withGitRepo creates a temporary git repository with the given file
+// committed as .secrets.json, then replaced by the second file in the working
+// copy.
+func withGitRepo(t *testing.T, committed string, current string, f func(storePath string)) {
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "ejson-kms-tests")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	storePath := filepath.Join(dir, ".secrets.json")
+
+	git := func(args ...string) {
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+
+	copyFile := func(src string) {
+		data, err := ioutil.ReadFile(src)
+		assert.NoError(t, err)
+		assert.NoError(t, ioutil.WriteFile(storePath, data, 0644))
+	}
+
+	git("init", "-q")
+	copyFile(committed)
+	git("add", ".secrets.json")
+	git("commit", "-q", "-m", "Add secrets")
+	copyFile(current)
+
+	f(storePath)
+
+}
+
+func TestDiff(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{"--rev=HEAD", "--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("invalid files", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{testDataEmpty})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid files: Expected two arguments, got 1")
+		}
+
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{"does-not-exist", testDataEmpty})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("arguments with rev", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{"--rev=HEAD", testDataEmpty, testDataEmpty})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid files: No argument expected with --rev, use --path")
+		}
+
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{"--format=yaml", testDataEmpty, testDataEmpty})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid formatter: Unknown format yaml")
+		}
+
+	})
+
+	t.Run("invalid concurrency", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{"--concurrency=0", testDataEmpty, testDataEmpty})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid concurrency: must be at least 1")
+		}
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{testDataInvalid, testDataEmpty})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to load JSON: Unable to decode Store at ./testdata/invalid.json: unexpected end of JSON input")
+		}
+
+	})
+
+	t.Run("with kms init error", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{testDataEmpty, testDataEmpty})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		withKMSDefaultClientError(t, func() {
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Unable to initialize AWS client: testing errors")
+			}
+		})
+
+	})
+
+	t.Run("with kms error", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{testDataOneCredential, testDataWithHistory})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		client := &mock_kms.Client{}
+		client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return("", "", errors.New("testing errors"))
+
+		withMockKmsClient(t, client, func() {
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "Unable to compare the secrets files: Unable to decrypt the old secrets")
+			}
+		})
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{testDataOneCredential, testDataWithHistory})
+		out := &bytes.Buffer{}
+		cmd.SetOutput(out)
+
+		client := &mock_kms.Client{}
+		client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil)
+
+		crypto_mock.WithConstRandReader(testFingerprintKey, func() {
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+		})
+
+		assert.Equal(t, out.String(), "STATUS   NAME    OLD                NEW\nchanged  secret  hmac:01a0f78626f0  hmac:dbb558d80caf\n")
+
+	})
+
+	t.Run("fingerprints change on every run", func(t *testing.T) {
+
+		client := &mock_kms.Client{}
+		client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil)
+
+		outputs := make([]string, 0, 2)
+		for i := 0; i < 2; i++ {
+
+			cmd := diffCmd()
+			cmd.SetArgs([]string{testDataOneCredential, testDataOneCredential})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			outputs = append(outputs, out.String())
+
+		}
+
+		assert.NotEqual(t, outputs[0], outputs[1])
+
+	})
+
+	t.Run("fingerprint key error", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{testDataOneCredential, testDataWithHistory})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		crypto_mock.WithErrorRandReader("testing errors", func() {
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Unable to generate a fingerprint key: testing errors")
+			}
+		})
+
+	})
+
+	t.Run("show values", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{"--show-values", testDataEmpty, testDataOneCredential})
+		out := &bytes.Buffer{}
+		cmd.SetOutput(out)
+
+		client := &mock_kms.Client{}
+		client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil)
+
+		withMockKmsClient(t, client, func() {
+			err := cmd.Execute()
+			assert.NoError(t, err)
+		})
+
+		assert.Equal(t, out.String(), "STATUS  NAME    OLD  NEW\nadded   secret  -    \"abcdef\"\n")
+
+	})
+
+	t.Run("json", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{"--format=json", "--show-values", testDataOneCredential, testDataEmpty})
+		out := &bytes.Buffer{}
+		cmd.SetOutput(out)
+
+		client := &mock_kms.Client{}
+		client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil)
+
+		crypto_mock.WithConstRandReader(testFingerprintKey, func() {
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+		})
+
+		assert.Equal(t, out.String(), `{
+  "secrets": [
+    {
+      "name": "secret",
+      "status": "removed",
+      "old_fingerprint": "hmac:01a0f78626f0",
+      "old_value": "abcdef"
+    }
+  ]
+}
+`)
+
+	})
+
+	t.Run("empty files", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{"--exit-code", testDataEmpty, testDataEmpty})
+		out := &bytes.Buffer{}
+		cmd.SetOutput(out)
+
+		withMockKmsClient(t, &mock_kms.Client{}, func() {
+			err := cmd.Execute()
+			assert.NoError(t, err)
+		})
+
+		assert.Equal(t, out.String(), "No secrets in either file\n")
+
+	})
+
+	t.Run("exit code", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{"--exit-code", testDataOneCredential, testDataWithHistory})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		client := &mock_kms.Client{}
+		client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil)
+
+		withMockKmsClient(t, client, func() {
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err, &ExitError{Code: 1})
+			}
+		})
+
+	})
+
+	t.Run("unchanged with exit code", func(t *testing.T) {
+
+		cmd := diffCmd()
+		cmd.SetArgs([]string{"--exit-code", testDataOneCredential, testDataOneCredential})
+		out := &bytes.Buffer{}
+		cmd.SetOutput(out)
+
+		client := &mock_kms.Client{}
+		client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil)
+
+		crypto_mock.WithConstRandReader(testFingerprintKey, func() {
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+		})
+
+		assert.Equal(t, out.String(), "STATUS     NAME    OLD                NEW\nunchanged  secret  hmac:01a0f78626f0  hmac:01a0f78626f0\n")
+
+	})
+
+	t.Run("rev", func(t *testing.T) {
+
+		withGitRepo(t, testDataOneCredential, testDataWithHistory, func(storePath string) {
+
+			cmd := diffCmd()
+			cmd.SetArgs([]string{"--rev=HEAD", "--path", storePath})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil)
+
+			crypto_mock.WithConstRandReader(testFingerprintKey, func() {
+				withMockKmsClient(t, client, func() {
+					err := cmd.Execute()
+					assert.NoError(t, err)
+				})
+			})
+
+			assert.Equal(t, out.String(), "STATUS   NAME    OLD                NEW\nchanged  secret  hmac:01a0f78626f0  hmac:dbb558d80caf\n")
+
+		})
+
+	})
+
+	t.Run("unknown rev", func(t *testing.T) {
+
+		withGitRepo(t, testDataOneCredential, testDataWithHistory, func(storePath string) {
+
+			cmd := diffCmd()
+			cmd.SetArgs([]string{"--rev=does-not-exist", "--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), fmt.Sprintf("Unable to read %s at revision does-not-exist: fatal:", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("invalid json at rev", func(t *testing.T) {
+
+		withGitRepo(t, testDataInvalid, testDataEmpty, func(storePath string) {
+
+			cmd := diffCmd()
+			cmd.SetArgs([]string{"--rev=HEAD", "--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at HEAD:%s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+}
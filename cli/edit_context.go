@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docEditContext = `
+edit-context: Change the encryption context of a secrets file.
+
+Since the encryption context is authenticated by KMS, changing it requires
+decrypting every secret with the current context, and encrypting it again
+with the new one.
+
+If any secret fails to be decrypted or encrypted, the file is left untouched.
+
+The "Secret" key is reserved, as the name of each secret is added to the
+context automatically under this key.
+`
+
+const exampleEditContext = `
+ejson-kms edit-context --set="ENV=production"
+ejson-kms edit-context --set="KEY1=VALUE1,KEY2=VALUE2" --unset="OLD_KEY"
+ejson-kms edit-context --unset="ENV" --path="secrets.json"
+`
+
+func editContextCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "edit-context",
+		Short:   "change the encryption context of the secrets",
+		Long:    strings.TrimSpace(docEditContext),
+		Example: strings.TrimSpace(exampleEditContext),
+	}
+
+	var (
+		storePath = ".secrets.json"
+		rawSet    = make([]string, 0)
+		unset     = make([]string, 0)
+	)
+
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+	cmd.Flags().StringSliceVar(&rawSet, "set", rawSet, "key-value pairs to add or change in the encryption context (\"KEY1=VALUE1,KEY2=VALUE2\")")
+	cmd.Flags().StringSliceVar(&unset, "unset", unset, "keys to remove from the encryption context (\"KEY1,KEY2\")")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		set, err := utils.ValidEncryptionContext(rawSet)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid encryption context", 0)
+		}
+
+		if len(set) == 0 && len(unset) == 0 {
+			return errors.Errorf("No changes provided. Use --set or --unset")
+		}
+
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		newContext, err := editContext(store.EncryptionContext, set, unset)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid encryption context", 0)
+		}
+
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+		}
+
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		err = store.RotateEncryptionContextWithContext(ctx, provider, newContext)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to change the encryption context", 0)
+		}
+
+		err = store.Save(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to save JSON", 0)
+		}
+
+		cmd.Printf("Exported new secrets file at: %s\n", storePath)
+		return nil
+
+	}
+
+	return cmd
+
+}
+
+// editContext returns a copy of the given encryption context with the keys
+// in unset removed and the pairs in set added.
+func editContext(current map[string]*string, set map[string]*string, unset []string) (map[string]*string, error) {
+
+	newContext := make(map[string]*string)
+	for k, v := range current {
+		newContext[k] = v
+	}
+
+	for _, key := range unset {
+		if _, ok := newContext[key]; !ok {
+			return nil, errors.Errorf("Key %s is not part of the encryption context", key)
+		}
+		delete(newContext, key)
+	}
+
+	for k, v := range set {
+		if k == "Secret" {
+			return nil, errors.Errorf("Key Secret is reserved for the name of the secrets")
+		}
+		newContext[k] = v
+	}
+
+	return newContext, nil
+
+}
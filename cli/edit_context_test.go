@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditContext(t *testing.T) {
+
+	value := "production"
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := editContextCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("invalid set", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := editContextCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--set", "ENV"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid encryption context: Invalid format for encryption context")
+			}
+
+		})
+
+	})
+
+	t.Run("no changes", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := editContextCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "No changes provided. Use --set or --unset")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := editContextCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--set", "ENV=production"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("unset unknown key", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := editContextCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--unset", "ENV"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid encryption context: Key ENV is not part of the encryption context")
+			}
+
+		})
+
+	})
+
+	t.Run("reserved key", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := editContextCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--set", "Secret=foo"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid encryption context: Key Secret is reserved for the name of the secrets")
+			}
+
+		})
+
+	})
+
+	t.Run("with kms init error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := editContextCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--set", "ENV=production"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withKMSDefaultClientError(t, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to initialize AWS client: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("with kms encrypt error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			before, err := ioutil.ReadFile(storePath)
+			assert.NoError(t, err)
+
+			cmd := editContextCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--set", "ENV=production"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"ENV": &value, "Secret": &testName}).Return("", "", errors.New("testing errors")).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to change the encryption context: Unable to encrypt secret: secret: Unable to generate data key: testing errors")
+				}
+			})
+
+			after, err := ioutil.ReadFile(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, before, after)
+
+		})
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := editContextCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--set", "ENV=production"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"ENV": &value, "Secret": &testName}).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{"ENV": &value, "Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext2, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.EncryptionContext, map[string]*string{"ENV": &value})
+
+			items, err := store.ExportPlaintext(kms.NewAWSProvider(client))
+			assert.NoError(t, err)
+
+			item, ok := <-items
+			assert.True(t, ok)
+			assert.Equal(t, item.Name, testName)
+			assert.Equal(t, item.Plaintext, "abcdef")
+
+		})
+
+	})
+
+}
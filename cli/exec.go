@@ -0,0 +1,275 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/formatter"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docExec = `
+exec: Run a command with the decrypted secrets in its environment.
+
+Each secret in the file will be decrypted and added to the environment of the
+given command, with its name capitalized (as in the export command). The
+secrets are never written to standard out, and the parent shell environment is
+left untouched. Secrets are decrypted concurrently, with up to --concurrency
+parallel calls to KMS.
+
+Signals received by ejson-kms (such as SIGINT or SIGTERM) are forwarded to the
+command, and ejson-kms exits with the same status code. When the command is
+killed by a signal, the status code is 128 plus the signal number, as in
+shells.
+
+Use --only or --except to select which secrets are decrypted and exposed, and
+--prefix to namespace the generated variable names. With --no-override, variables already
+present in the environment keep their value, like the bash-ifnotset format.
+`
+
+const exampleExec = `
+ejson-kms exec -- ./server --port=8080
+ejson-kms exec --path=secrets.json --prefix=APP_ -- env
+ejson-kms exec --only=password,api_key -- ./script.sh
+ejson-kms exec --no-override -- ./server
+`
+
+// signals forwarded to the child process
+var execSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+func execCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "exec -- COMMAND [ARGS...]",
+		Short:   "run a command with the decrypted secrets in its environment",
+		Long:    strings.TrimSpace(docExec),
+		Example: strings.TrimSpace(exampleExec),
+	}
+
+	var (
+		storePath   = ".secrets.json"
+		prefix      = ""
+		only        = make([]string, 0)
+		except      = make([]string, 0)
+		noOverride  = false
+		concurrency = defaultConcurrency
+	)
+
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+	cmd.Flags().StringVar(&prefix, "prefix", prefix, "prefix added to the name of the environment variables")
+	cmd.Flags().StringSliceVar(&only, "only", only, "only expose the given secrets (\"NAME1,NAME2\")")
+	cmd.Flags().StringSliceVar(&except, "except", except, "expose all secrets except the given ones (\"NAME1,NAME2\")")
+	cmd.Flags().BoolVar(&noOverride, "no-override", noOverride, "do not override variables already set in the environment")
+	cmd.Flags().IntVar(&concurrency, "concurrency", concurrency, "maximum number of secrets decrypted in parallel")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		if len(args) == 0 {
+			return errors.Errorf("No command provided")
+		}
+
+		if concurrency < 1 {
+			return errors.Errorf("Invalid concurrency: must be at least 1")
+		}
+
+		filtered := append(append([]string{}, only...), except...)
+		for _, name := range filtered {
+			err = utils.ValidName(name)
+			if err != nil {
+				return errors.WrapPrefix(err, "Invalid name", 0)
+			}
+		}
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		for _, name := range filtered {
+			if !store.Contains(name) {
+				return errors.Errorf("No secret with the given name has been found: %s", name)
+			}
+		}
+
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+		}
+
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		// the other secrets are never decrypted
+		selected := *store
+		selected.Secrets = selectSecrets(store.Secrets, only, except)
+
+		items, wait := selected.StreamPlaintextWithContext(ctx, provider, concurrency)
+		env := execEnv(os.Environ(), items, prefix, noOverride)
+
+		err = wait()
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to export items", 0)
+		}
+
+		// interrupts are forwarded to the child from now on, relayed once it is
+		// running. They are caught before the handler of commandContext is
+		// removed, so that none of them kills this process in between.
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, execSignals...)
+		defer signal.Stop(signals)
+
+		stop()
+
+		child := exec.Command(args[0], args[1:]...) // nolint: gosec
+		child.Env = env
+		child.Stdin = os.Stdin
+		child.Stdout = cmd.OutOrStdout()
+		child.Stderr = os.Stderr
+
+		code, err := runForwardingSignals(child, signals)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to run command", 0)
+		}
+
+		if code != 0 {
+			// the child already reported its own failure
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+			return &ExitError{Code: code}
+		}
+
+		return nil
+
+	}
+
+	return cmd
+
+}
+
+// selectSecrets returns the secrets exposed to the child process: the ones
+// given with --only if any, without the ones given with --except.
+func selectSecrets(secrets []*model.Secret, only []string, except []string) []*model.Secret {
+
+	selected := make([]*model.Secret, 0, len(secrets))
+
+	for _, item := range secrets {
+
+		if len(only) > 0 && !containsString(only, item.Name) {
+			continue
+		}
+
+		if containsString(except, item.Name) {
+			continue
+		}
+
+		selected = append(selected, item)
+
+	}
+
+	return selected
+
+}
+
+// execEnv builds the environment of the child process from the parent
+// environment and the decrypted secrets.
+func execEnv(environ []string, items <-chan formatter.Item, prefix string, noOverride bool) []string {
+
+	existing := make(map[string]bool)
+	for _, pair := range environ {
+		existing[strings.SplitN(pair, "=", 2)[0]] = true
+	}
+
+	env := make([]string, len(environ))
+	copy(env, environ)
+
+	for item := range items {
+
+		key := prefix + strings.ToUpper(item.Name)
+		if noOverride && existing[key] {
+			continue
+		}
+
+		// os/exec only keeps the last value for duplicate keys
+		env = append(env, fmt.Sprintf("%s=%s", key, item.Plaintext))
+
+	}
+
+	return env
+
+}
+
+// runForwardingSignals starts the child process, relays the signals received
+// on the given channel to it until it exits, and returns its exit code.
+func runForwardingSignals(child *exec.Cmd, signals <-chan os.Signal) (int, error) {
+
+	err := child.Start()
+	if err != nil {
+		return 0, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				_ = child.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err = child.Wait()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			// terminated by a signal, reported as shells do
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return 0, nil
+
+}
+
+func containsString(values []string, value string) bool {
+
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+
+}
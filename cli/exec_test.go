@@ -0,0 +1,325 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/formatter"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExec(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := execCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist", "--", "true"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("no command", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := execCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "No command provided")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid concurrency", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := execCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--concurrency=0", "--", "env"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid concurrency: must be at least 1")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := execCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--only", "123_ABC", "--", "true"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid name: Invalid format for name: must be lowercase, can contain letters, digits and underscores, and cannot start with a number.")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := execCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--", "true"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("unknown name", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := execCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--except", "other", "--", "true"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "No secret with the given name has been found: other")
+			}
+
+		})
+
+	})
+
+	t.Run("with kms init error", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := execCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--", "true"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withKMSDefaultClientError(t, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to initialize AWS client: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("with kms decrypt error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := execCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--", "true"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return("", "", errors.New("testing errors")).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to export items: Unable to decrypt key ciphertext: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("command not found", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := execCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--", "./does-not-exist"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), "Unable to run command")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("exit code", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := execCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--", "sh", "-c", "exit 3"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err, &ExitError{Code: 3})
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("killed by a signal", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := execCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--", "sh", "-c", "kill -TERM $$"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err, &ExitError{Code: 143})
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("excluded secrets are not decrypted", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			out := &bytes.Buffer{}
+
+			cmd := execCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--except", "secret", "--", "sh", "-c", "echo \"${SECRET-unset}\""})
+			cmd.SetOutput(out)
+
+			// any call to Decrypt fails the test
+			client := &mock_kms.Client{}
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.NoError(t, err) {
+					assert.Equal(t, out.String(), "unset\n")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			out := &bytes.Buffer{}
+
+			cmd := execCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--prefix", "APP_", "--", "sh", "-c", "echo \"$APP_SECRET\""})
+			cmd.SetOutput(out)
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.NoError(t, err) {
+					assert.Equal(t, out.String(), "abcdef\n")
+				}
+			})
+
+		})
+
+	})
+
+}
+
+func TestExecEnv(t *testing.T) {
+
+	items := func() <-chan formatter.Item {
+		ch := make(chan formatter.Item, 2)
+		ch <- formatter.Item{Name: "secret", Plaintext: "password"}
+		ch <- formatter.Item{Name: "other", Plaintext: "value"}
+		close(ch)
+		return ch
+	}
+
+	environ := []string{"PATH=/bin", "SECRET=existing"}
+
+	t.Run("all", func(t *testing.T) {
+		env := execEnv(environ, items(), "", false)
+		assert.Equal(t, []string{"PATH=/bin", "SECRET=existing", "SECRET=password", "OTHER=value"}, env)
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		env := execEnv(environ, items(), "APP_", false)
+		assert.Equal(t, []string{"PATH=/bin", "SECRET=existing", "APP_SECRET=password", "APP_OTHER=value"}, env)
+	})
+
+	t.Run("no override", func(t *testing.T) {
+		env := execEnv(environ, items(), "", true)
+		assert.Equal(t, []string{"PATH=/bin", "SECRET=existing", "OTHER=value"}, env)
+	})
+
+}
+
+func TestSelectSecrets(t *testing.T) {
+
+	secrets := []*model.Secret{{Name: "secret"}, {Name: "other"}}
+
+	names := func(selected []*model.Secret) []string {
+		result := make([]string, 0, len(selected))
+		for _, item := range selected {
+			result = append(result, item.Name)
+		}
+		return result
+	}
+
+	t.Run("all", func(t *testing.T) {
+		assert.Equal(t, names(selectSecrets(secrets, nil, nil)), []string{"secret", "other"})
+	})
+
+	t.Run("only", func(t *testing.T) {
+		assert.Equal(t, names(selectSecrets(secrets, []string{"other"}, nil)), []string{"other"})
+	})
+
+	t.Run("except", func(t *testing.T) {
+		assert.Equal(t, names(selectSecrets(secrets, nil, []string{"other"})), []string{"secret"})
+	})
+
+}
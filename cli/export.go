@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"bytes"
 	"strings"
 
 	"github.com/go-errors/errors"
@@ -24,12 +25,17 @@ A number of formats are available:
   * bash-ifempty:  : ${SECRET:='password'}
   
 
+Secrets are decrypted concurrently, with up to --concurrency parallel calls to
+KMS. The output keeps the order of the secrets file, and nothing is output if
+any secret fails to be decrypted.
+
 Please be careful when exporting your secrets, do not save them to disk!
 `
 const exampleExport = `
 ejson-kms export
 ejson-kms export --format=json
 ejson-kms export --path=secrets.json --format=dotenv
+ejson-kms export --concurrency=20
 `
 
 func exportCmd() *cobra.Command {
@@ -42,12 +48,16 @@ func exportCmd() *cobra.Command {
 	}
 
 	var (
-		storePath = ".secrets.json"
-		format    = "bash"
+		storePath   = ".secrets.json"
+		format      = "bash"
+		concurrency = defaultConcurrency
 	)
 
 	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
 	cmd.Flags().StringVar(&format, "format", format, "format of the generated output (bash|dotenv|json|yaml|bash-ifnotset|bash-ifempty)")
+	cmd.Flags().IntVar(&concurrency, "concurrency", concurrency, "maximum number of secrets decrypted in parallel")
+
+	kmsOpts := addKMSFlags(cmd)
 
 	cmd.RunE = func(_ *cobra.Command, args []string) error {
 
@@ -56,6 +66,10 @@ func exportCmd() *cobra.Command {
 			return errors.WrapPrefix(err, "Invalid path", 0)
 		}
 
+		if concurrency < 1 {
+			return errors.Errorf("Invalid concurrency: must be at least 1")
+		}
+
 		store, err := model.Load(storePath)
 		if err != nil {
 			return errors.WrapPrefix(err, "Unable to load JSON", 0)
@@ -66,19 +80,43 @@ func exportCmd() *cobra.Command {
 			return errors.WrapPrefix(err, "Invalid formatter", 0)
 		}
 
-		client, err := kmsDefaultClient()
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
 		if err != nil {
 			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
 		}
 
-		items, err := store.ExportPlaintext(client)
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		items, wait := store.StreamPlaintextWithContext(ctx, provider, concurrency)
+
+		// the output is only written once every secret has been decrypted, to
+		// avoid partial exports
+		out := &bytes.Buffer{}
+		err = formatter(out, items)
+
+		waitErr := wait()
+		if waitErr != nil {
+			return errors.WrapPrefix(waitErr, "Unable to export items", 0)
+		}
+
 		if err != nil {
 			return errors.WrapPrefix(err, "Unable to export items", 0)
 		}
 
-		err = formatter(cmd.OutOrStdout(), items)
+		_, err = out.WriteTo(cmd.OutOrStdout())
 		if err != nil {
-			return errors.WrapPrefix(err, "Unable to export items", 0)
+			return errors.WrapPrefix(err, "Unable to write to output", 0)
 		}
 
 		return nil
@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"os"
 	"testing"
 
+	"github.com/adrienkohlbecker/ejson-kms/kms"
 	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -78,6 +82,111 @@ func TestExport(t *testing.T) {
 
 	})
 
+	t.Run("with timeout", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := exportCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--timeout=1ns"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to export items: Unable to decrypt secrets: context deadline exceeded")
+				}
+			})
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("invalid max retries", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := exportCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--max-retries=-1"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid retry policy: Invalid max retries: must be at least 0")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid retry environment", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := exportCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			assert.NoError(t, os.Setenv("EJSON_KMS_MAX_RETRIES", "many"))
+			defer os.Unsetenv("EJSON_KMS_MAX_RETRIES") // nolint: errcheck
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid retry policy: Invalid EJSON_KMS_MAX_RETRIES: expected a positive integer, got \"many\"")
+			}
+
+		})
+
+	})
+
+	t.Run("with kms throttling", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			out := &bytes.Buffer{}
+
+			cmd := exportCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--max-retries=1"})
+			cmd.SetOutput(out)
+
+			throttling := awserr.New("ThrottlingException", "Rate exceeded", nil)
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return("", "", throttling).Once()
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.NoError(t, err) {
+					assert.Equal(t, out.String(), "SECRET='abcdef'\n")
+				}
+			})
+
+			client.AssertExpectations(t)
+
+			cmd = exportCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--max-retries=0"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client = &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return("", "", throttling).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to export items: Unable to decrypt key ciphertext: ThrottlingException: Rate exceeded")
+				}
+			})
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
 	t.Run("with kms decrypt error", func(t *testing.T) {
 
 		withTempStore(t, testDataOneCredential, func(storePath string) {
@@ -100,6 +209,80 @@ func TestExport(t *testing.T) {
 
 	})
 
+	t.Run("with unknown key provider", func(t *testing.T) {
+
+		withTempStore(t, testDataUnknownScheme, func(storePath string) {
+
+			cmd := exportCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withMockKmsClient(t, &mock_kms.Client{}, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to export items: No key provider available for key ID unknown://ejson-kms-testing")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("invalid concurrency", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := exportCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--concurrency=0"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid concurrency: must be at least 1")
+			}
+
+		})
+
+	})
+
+	t.Run("many secrets", func(t *testing.T) {
+
+		withTempKeyFiles(t, 1, func(keyIDs []string) {
+			withTempPath(t, func(storePath string) {
+				defer os.Remove(storePath) // nolint: errcheck
+
+				withMockKmsClient(t, &mock_kms.Client{}, func() {
+
+					provider, err := defaultProvider(kms.DefaultRetryPolicy())
+					assert.NoError(t, err)
+
+					expected := ""
+					store := model.NewStore(keyIDs[0], map[string]*string{})
+					for i := 0; i < 30; i++ {
+						name := fmt.Sprintf("secret_%d", i)
+						assert.NoError(t, store.Add(provider, name, name, ""))
+						expected += fmt.Sprintf("SECRET_%d='secret_%d'\n", i, i)
+					}
+					assert.NoError(t, store.Save(storePath))
+
+					out := &bytes.Buffer{}
+
+					cmd := exportCmd()
+					cmd.SetArgs([]string{"--path", storePath, "--concurrency=8"})
+					cmd.SetOutput(out)
+
+					err = cmd.Execute()
+					if assert.NoError(t, err) {
+						assert.Equal(t, out.String(), expected)
+					}
+
+				})
+
+			})
+		})
+
+	})
+
 	t.Run("working", func(t *testing.T) {
 
 		withTempStore(t, testDataOneCredential, func(storePath string) {
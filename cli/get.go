@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docGet = `
+get: Print a single decrypted secret.
+
+Only the given secret is decrypted, with a single call to KMS. Its raw value is
+written to standard out, followed by a new line unless --no-newline is given.
+
+Use --base64 to encode the value (for binary data), and --output-file to write
+it to a file instead. The file is created with 0600 permissions, and contains
+the value only, without a new line.
+
+Use --version to print a previous value of the secret, kept in its history. See
+the "history" command to list the versions of a secret.
+
+Please be careful when printing your secrets, do not save them to disk!
+`
+
+const exampleGet = `
+ejson-kms get password
+ejson-kms get tls_key --output-file=tls.key
+ejson-kms get password --no-newline | pbcopy
+ejson-kms get password --base64 --path="secrets.json"
+ejson-kms get password --version=2
+`
+
+func getCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "get NAME",
+		Short:   "print a decrypted secret",
+		Long:    strings.TrimSpace(docGet),
+		Example: strings.TrimSpace(exampleGet),
+	}
+
+	var (
+		storePath  = ".secrets.json"
+		noNewline  = false
+		useBase64  = false
+		outputFile = ""
+		version    = 0
+	)
+
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+	cmd.Flags().BoolVar(&noNewline, "no-newline", noNewline, "do not print the trailing new line on standard out")
+	cmd.Flags().BoolVar(&useBase64, "base64", useBase64, "base64 encode the value")
+	cmd.Flags().StringVar(&outputFile, "output-file", outputFile, "write the value to the given file instead of standard out")
+	cmd.Flags().IntVar(&version, "version", version, "version of the secret to print, instead of the current one")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		name, err := utils.HasOneArgument(args)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid name", 0)
+		}
+
+		err = utils.ValidName(name)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid name", 0)
+		}
+
+		if version < 0 {
+			return errors.Errorf("Invalid version %d", version)
+		}
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		if !store.Contains(name) {
+			return errors.Errorf("No secret with the given name has been found")
+		}
+
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+		}
+
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		var plaintext string
+		if version != 0 {
+			plaintext, err = store.DecryptVersionWithContext(ctx, provider, name, version)
+		} else {
+			plaintext, err = store.DecryptWithContext(ctx, provider, name)
+		}
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to get secret", 0)
+		}
+
+		if useBase64 {
+			plaintext = base64.StdEncoding.EncodeToString([]byte(plaintext))
+		}
+
+		if outputFile == "" {
+			if !noNewline {
+				plaintext += "\n"
+			}
+			_, err = io.WriteString(cmd.OutOrStdout(), plaintext)
+			if err != nil {
+				return errors.WrapPrefix(err, "Unable to write to output", 0)
+			}
+			return nil
+		}
+
+		err = writePrivateFile(outputFile, plaintext)
+		if err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("Unable to write file at path %s", outputFile), 0)
+		}
+
+		return nil
+
+	}
+
+	return cmd
+
+}
+
+// writePrivateFile writes contents to the given path, ensuring the file is
+// only readable by its owner.
+func writePrivateFile(path string, contents string) (err error) {
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) // nolint: gosec
+	if err != nil {
+		return err
+	}
+	defer func() {
+		cerr := file.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+
+	// an existing file keeps its permissions when opened
+	err = file.Chmod(0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteString(contents)
+	return err
+
+}
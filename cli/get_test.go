@@ -0,0 +1,321 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := getCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("no argument", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := getCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid name: No argument provided")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := getCmd()
+			cmd.SetArgs([]string{"--path", storePath, "123_ABC"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid name: Invalid format for name: must be lowercase, can contain letters, digits and underscores, and cannot start with a number.")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := getCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("name does not exists", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := getCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "No secret with the given name has been found")
+			}
+
+		})
+
+	})
+
+	t.Run("with kms init error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := getCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withKMSDefaultClientError(t, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to initialize AWS client: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("with timeout", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := getCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--timeout=1ns", testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to get secret: Unable to decrypt secret: Unable to decrypt key ciphertext: context deadline exceeded")
+				}
+			})
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("with kms decrypt error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := getCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return("", "", errors.New("testing errors")).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to get secret: Unable to decrypt secret: Unable to decrypt key ciphertext: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	outputs := map[string][]string{
+		"abcdef\n":   {},
+		"abcdef":     {"--no-newline"},
+		"YWJjZGVm\n": {"--base64"},
+	}
+
+	for expected, flags := range outputs {
+
+		t.Run(fmt.Sprintf("working %v", flags), func(t *testing.T) {
+
+			withTempStore(t, testDataOneCredential, func(storePath string) {
+
+				out := &bytes.Buffer{}
+
+				cmd := getCmd()
+				cmd.SetArgs(append([]string{"--path", storePath, testName}, flags...))
+				cmd.SetOutput(out)
+
+				client := &mock_kms.Client{}
+				client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+				withMockKmsClient(t, client, func() {
+					err := cmd.Execute()
+					if assert.NoError(t, err) {
+						assert.Equal(t, out.String(), expected)
+					}
+				})
+
+			})
+
+		})
+
+	}
+
+	t.Run("output file", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			withTempPath(t, func(outputPath string) {
+
+				out := &bytes.Buffer{}
+
+				cmd := getCmd()
+				cmd.SetArgs([]string{"--path", storePath, testName, "--output-file", outputPath})
+				cmd.SetOutput(out)
+
+				client := &mock_kms.Client{}
+				client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+				withMockKmsClient(t, client, func() {
+					err := cmd.Execute()
+					assert.NoError(t, err)
+				})
+
+				assert.Equal(t, out.String(), "")
+
+				contents, err := ioutil.ReadFile(outputPath)
+				assert.NoError(t, err)
+				assert.Equal(t, string(contents), "abcdef")
+
+				stat, err := os.Stat(outputPath)
+				assert.NoError(t, err)
+				assert.Equal(t, stat.Mode().Perm(), os.FileMode(0600))
+
+				err = os.Remove(outputPath)
+				assert.NoError(t, err)
+
+			})
+
+		})
+
+	})
+
+	t.Run("output file error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := getCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "--output-file", os.TempDir()})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), "Unable to write file at path")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("invalid version", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := getCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "--version=-1"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid version -1")
+			}
+
+		})
+
+	})
+
+	for version, expected := range map[string]string{"1": "abcdef\n", "2": "ghijklm\n"} {
+
+		t.Run(fmt.Sprintf("with version %s", version), func(t *testing.T) {
+
+			withTempStore(t, testDataWithHistory, func(storePath string) {
+
+				out := &bytes.Buffer{}
+
+				cmd := getCmd()
+				cmd.SetArgs([]string{"--path", storePath, testName, "--version", version})
+				cmd.SetOutput(out)
+
+				client := &mock_kms.Client{}
+				client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+				withMockKmsClient(t, client, func() {
+					err := cmd.Execute()
+					if assert.NoError(t, err) {
+						assert.Equal(t, out.String(), expected)
+					}
+				})
+
+			})
+
+		})
+
+	}
+
+	t.Run("unknown version", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := getCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "--version=3"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withMockKmsClient(t, &mock_kms.Client{}, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to get secret: Unable to find version 3 of secret")
+				}
+			})
+
+		})
+
+	})
+
+}
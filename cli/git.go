@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-errors/errors"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+)
+
+// gitShow reads the contents of a file at a git revision. The path is
+// resolved relative to the current directory, not to the root of the
+// repository.
+func gitShow(rev string, path string) ([]byte, error) {
+
+	dir, file := filepath.Split(path)
+
+	data, err := runGit(dir, "show", fmt.Sprintf("%s:./%s", rev, file))
+	if err != nil {
+		return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to read %s at revision %s", path, rev), 0)
+	}
+
+	return data, nil
+
+}
+
+// runGit runs a git command in the given directory, the current one when
+// empty, and returns its output. The error holds the message of git, if any.
+func runGit(dir string, args ...string) ([]byte, error) {
+
+	if dir == "" {
+		dir = "."
+	}
+
+	stderr := &bytes.Buffer{}
+
+	git := exec.Command("git", args...) // nolint: gosec
+	git.Dir = dir
+	git.Stderr = stderr
+
+	data, err := git.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, errors.Errorf("%s", message)
+		}
+		return nil, err
+	}
+
+	return data, nil
+
+}
+
+// ignoreLockFile adds the lock file of the secrets file at the given path, see
+// model.Lock, to the .gitignore file of its directory, and returns the path of
+// the .gitignore file.
+func ignoreLockFile(storePath string) (string, error) {
+
+	dir, file := filepath.Split(storePath)
+
+	ignorePath := filepath.Join(dir, ".gitignore")
+	err := addLine(ignorePath, "/"+model.LockPath(file))
+	if err != nil {
+		return "", err
+	}
+
+	return ignorePath, nil
+
+}
+
+// inGitWorkTree reports whether the given directory, the current one when
+// empty, is in a git working copy. It is false when git is not installed.
+func inGitWorkTree(dir string) bool {
+
+	data, err := runGit(dir, "rev-parse", "--is-inside-work-tree")
+	return err == nil && strings.TrimSpace(string(data)) == "true"
+
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+)
+
+const docGitMergeDriver = `
+git-merge-driver: Merge secrets files for git.
+
+Git merges secrets files line by line, so two branches adding secrets conflict
+on the list of secrets. This command is a git merge driver merging them secret
+by secret instead: a secret added, changed or removed on a single side keeps
+that change. The merge fails only when the same secret was changed on both
+sides, or when the settings of the file were changed (see "diff" to compare
+the values of the secrets).
+
+Git gives the common ancestor, our version and their version of the file. The
+merged file replaces our version.
+
+When the file has a MAC, both versions are verified and the MAC of the merged
+file is computed again, which calls KMS. Otherwise, KMS is never called.
+
+Use the "git-setup" command to register the merge driver.
+`
+
+const exampleGitMergeDriver = `
+git config merge.ejson-kms.driver "ejson-kms git-merge-driver %O %A %B"
+`
+
+func gitMergeDriverCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "git-merge-driver BASE OURS THEIRS",
+		Short:   "merge secrets files secret by secret, for git",
+		Long:    strings.TrimSpace(docGitMergeDriver),
+		Example: strings.TrimSpace(exampleGitMergeDriver),
+	}
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		if len(args) != 3 {
+			return errors.Errorf("Invalid files: Expected three arguments, got %d", len(args))
+		}
+
+		basePath, oursPath, theirsPath := args[0], args[1], args[2]
+
+		base, err := loadMergeBase(basePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		ours, err := model.Load(oursPath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		theirs, err := model.Load(theirsPath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		err = kmsOpts.verifyMAC(ours)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify our secrets file", 0)
+		}
+
+		err = kmsOpts.verifyMAC(theirs)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify their secrets file", 0)
+		}
+
+		merged, err := model.Merge(base, ours, theirs)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to merge the secrets files", 0)
+		}
+
+		err = merged.Save(oursPath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to save JSON", 0)
+		}
+
+		return nil
+
+	}
+
+	return cmd
+
+}
+
+// loadMergeBase loads the common ancestor given by git. It is empty when both
+// sides added the file, which gives an empty store.
+func loadMergeBase(path string) (*model.Store, error) {
+
+	data, err := ioutil.ReadFile(path) // nolint: gosec
+	if err != nil {
+		return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to read file at %s", path), 0)
+	}
+
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return &model.Store{}, nil
+	}
+
+	return model.Parse(data, path)
+
+}
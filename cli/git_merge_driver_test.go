@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// withChangedStore copies a secrets file, and changes the copy with the given
+// function.
+func withChangedStore(t *testing.T, testdata string, change func(store *model.Store), f func(storePath string)) {
+
+	withTempStore(t, testdata, func(storePath string) {
+
+		store, err := model.Load(storePath)
+		assert.NoError(t, err)
+
+		change(store)
+		assert.NoError(t, store.Save(storePath))
+
+		f(storePath)
+
+	})
+
+}
+
+func TestGitMergeDriver(t *testing.T) {
+
+	addOther := func(store *model.Store) {
+		store.Secrets = append(store.Secrets, &model.Secret{Name: "other", Ciphertext: "EJK1;b3RoZXI=;b3RoZXI="})
+	}
+
+	t.Run("invalid files", func(t *testing.T) {
+
+		cmd := gitMergeDriverCmd()
+		cmd.SetArgs([]string{testDataEmpty, testDataEmpty})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid files: Expected three arguments, got 2")
+		}
+
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+
+		cmd := gitMergeDriverCmd()
+		cmd.SetArgs([]string{"does-not-exist", testDataEmpty, testDataEmpty})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to load JSON: Unable to read file at does-not-exist: open does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		cmd := gitMergeDriverCmd()
+		cmd.SetArgs([]string{testDataEmpty, testDataEmpty, testDataInvalid})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to load JSON: Unable to decode Store at ./testdata/invalid.json: unexpected end of JSON input")
+		}
+
+	})
+
+	describe := func(description string) func(store *model.Store) {
+		return func(store *model.Store) {
+			store.Secrets[0].Description = description
+		}
+	}
+
+	t.Run("working", func(t *testing.T) {
+
+		withChangedStore(t, testDataOneCredential, describe("Ours"), func(oursPath string) {
+			withChangedStore(t, testDataOneCredential, addOther, func(theirsPath string) {
+
+				cmd := gitMergeDriverCmd()
+				cmd.SetArgs([]string{testDataOneCredential, oursPath, theirsPath})
+				out := &bytes.Buffer{}
+				cmd.SetOutput(out)
+
+				err := cmd.Execute()
+				assert.NoError(t, err)
+				assert.Equal(t, out.String(), "")
+
+				merged, err := model.Load(oursPath)
+				assert.NoError(t, err)
+
+				if assert.Len(t, merged.Secrets, 2) {
+					assert.Equal(t, merged.Secrets[0].Description, "Ours")
+					assert.Equal(t, merged.Secrets[1].Name, "other")
+				}
+
+			})
+		})
+
+	})
+
+	t.Run("added on both sides", func(t *testing.T) {
+
+		withTempPath(t, func(basePath string) {
+			withTempStore(t, testDataOneCredential, func(oursPath string) {
+				withChangedStore(t, testDataOneCredential, addOther, func(theirsPath string) {
+
+					assert.NoError(t, ioutil.WriteFile(basePath, []byte{}, 0644))
+
+					cmd := gitMergeDriverCmd()
+					cmd.SetArgs([]string{basePath, oursPath, theirsPath})
+					cmd.SetOutput(&bytes.Buffer{})
+
+					err := cmd.Execute()
+					assert.NoError(t, err)
+
+					merged, err := model.Load(oursPath)
+					assert.NoError(t, err)
+					assert.Len(t, merged.Secrets, 2)
+
+				})
+			})
+		})
+
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+
+		withChangedStore(t, testDataOneCredential, describe("Ours"), func(oursPath string) {
+			withChangedStore(t, testDataOneCredential, describe("Theirs"), func(theirsPath string) {
+
+				cmd := gitMergeDriverCmd()
+				cmd.SetArgs([]string{testDataOneCredential, oursPath, theirsPath})
+				cmd.SetOutput(&bytes.Buffer{})
+
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to merge the secrets files: Conflicting changes to secrets: secret")
+				}
+
+				// our version is left untouched
+				ours, err := model.Load(oursPath)
+				assert.NoError(t, err)
+				assert.Equal(t, ours.Secrets[0].Description, "Ours")
+
+			})
+		})
+
+	})
+
+	t.Run("with a MAC", func(t *testing.T) {
+
+		withMACStore(t, func(basePath string, client *mock_kms.Client) {
+
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{}).Return(testKmsKeyID, testKeyPlaintext2, nil).Times(4)
+
+			withTempStore(t, basePath, func(oursPath string) {
+				withTempStore(t, basePath, func(theirsPath string) {
+
+					theirs, err := model.Load(theirsPath)
+					assert.NoError(t, err)
+					assert.NoError(t, theirs.Verify(kms.NewAWSProvider(client)))
+					addOther(theirs)
+					assert.NoError(t, theirs.Save(theirsPath))
+
+					cmd := gitMergeDriverCmd()
+					cmd.SetArgs([]string{basePath, oursPath, theirsPath})
+					cmd.SetOutput(&bytes.Buffer{})
+
+					withMockKmsClient(t, client, func() {
+						err := cmd.Execute()
+						assert.NoError(t, err)
+					})
+
+					merged, err := model.Load(oursPath)
+					assert.NoError(t, err)
+					assert.Len(t, merged.Secrets, 2)
+					assert.NoError(t, merged.Verify(kms.NewAWSProvider(client)))
+
+				})
+			})
+
+		})
+
+	})
+
+	t.Run("with a MAC and kms init error", func(t *testing.T) {
+
+		withMACStore(t, func(storePath string, _ *mock_kms.Client) {
+
+			cmd := gitMergeDriverCmd()
+			cmd.SetArgs([]string{storePath, storePath, storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withKMSDefaultClientError(t, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to verify our secrets file: Unable to initialize AWS client: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+}
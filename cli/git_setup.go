@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docGitSetup = `
+git-setup: Register the git integration of a secrets file.
+
+The secrets file is added to the .gitattributes file of its directory, with
+the "ejson-kms" diff and merge attributes, and the git configuration of the
+repository is updated to define them:
+
+  * diff.ejson-kms.textconv: "ejson-kms git-textconv", so that git diff and
+                             git log -p show names, descriptions and
+                             fingerprints instead of ciphertexts
+  * merge.ejson-kms.driver:  "ejson-kms git-merge-driver %O %A %B", so that
+                             git merge merges the file secret by secret
+
+The lock file taken by the commands modifying the secrets file, named after it
+with a .lock suffix, is added to the .gitignore file of its directory.
+
+The .gitattributes and .gitignore files should be committed, but the git
+configuration is not shared: every clone of the repository must run this
+command. Running it again is harmless.
+
+Use --command when ejson-kms is not in the PATH of git, such as
+--command=/usr/local/bin/ejson-kms.
+`
+
+const exampleGitSetup = `
+ejson-kms git-setup
+ejson-kms git-setup --path=config/secrets.json
+ejson-kms git-setup --command=/usr/local/bin/ejson-kms
+`
+
+// gitAttribute is the name of the git diff and merge attributes of secrets
+// files.
+const gitAttribute = "ejson-kms"
+
+func gitSetupCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "git-setup",
+		Short:   "register the git diff and merge integration",
+		Long:    strings.TrimSpace(docGitSetup),
+		Example: strings.TrimSpace(exampleGitSetup),
+	}
+
+	var (
+		storePath = ".secrets.json"
+		command   = "ejson-kms"
+	)
+
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+	cmd.Flags().StringVar(&command, "command", command, "command running ejson-kms, for git")
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		if command == "" {
+			return errors.Errorf("Invalid command: Empty argument")
+		}
+
+		dir, file := filepath.Split(storePath)
+
+		config := [][]string{
+			{fmt.Sprintf("diff.%s.textconv", gitAttribute), fmt.Sprintf("%s git-textconv", command)},
+			{fmt.Sprintf("merge.%s.name", gitAttribute), "ejson-kms secrets file"},
+			{fmt.Sprintf("merge.%s.driver", gitAttribute), fmt.Sprintf("%s git-merge-driver %%O %%A %%B", command)},
+		}
+
+		for _, pair := range config {
+			_, err = runGit(dir, "config", pair[0], pair[1])
+			if err != nil {
+				return errors.WrapPrefix(err, "Unable to configure git", 0)
+			}
+		}
+
+		attributesPath := filepath.Join(dir, ".gitattributes")
+		err = addLine(attributesPath, fmt.Sprintf("/%s diff=%s merge=%s", file, gitAttribute, gitAttribute))
+		if err != nil {
+			return err
+		}
+
+		ignorePath, err := ignoreLockFile(storePath)
+		if err != nil {
+			return err
+		}
+
+		cmd.Printf("Configured git for the secrets file at: %s\n", storePath)
+		cmd.Printf("Commit %s and %s to share the attributes, and run git-setup in every clone\n", attributesPath, ignorePath)
+		return nil
+
+	}
+
+	return cmd
+
+}
+
+// addLine appends a line to a file such as .gitattributes or .gitignore,
+// created if needed, unless the line is already present.
+func addLine(path string, line string) error {
+
+	data, err := ioutil.ReadFile(path) // nolint: gosec
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WrapPrefix(err, fmt.Sprintf("Unable to read file at %s", path), 0)
+	}
+
+	content := string(data)
+	for _, existing := range strings.Split(content, "\n") {
+		if strings.TrimSpace(existing) == line {
+			return nil
+		}
+	}
+
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += line + "\n"
+
+	err = ioutil.WriteFile(path, []byte(content), 0644) // nolint: gosec
+	if err != nil {
+		return errors.WrapPrefix(err, fmt.Sprintf("Unable to write file at %s", path), 0)
+	}
+
+	return nil
+
+}
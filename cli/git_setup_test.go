@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitSetup(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := gitSetupCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("invalid command", func(t *testing.T) {
+
+		cmd := gitSetupCmd()
+		cmd.SetArgs([]string{"--path", testDataEmpty, "--command="})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid command: Empty argument")
+		}
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		withGitRepo(t, testDataOneCredential, testDataOneCredential, func(storePath string) {
+
+			dir := filepath.Dir(storePath)
+			attributesPath := filepath.Join(dir, ".gitattributes")
+			ignorePath := filepath.Join(dir, ".gitignore")
+			assert.NoError(t, ioutil.WriteFile(attributesPath, []byte("*.sh text"), 0644))
+
+			for i := 0; i < 2; i++ {
+
+				cmd := gitSetupCmd()
+				cmd.SetArgs([]string{"--path", storePath, "--command=/usr/local/bin/ejson-kms"})
+				out := &bytes.Buffer{}
+				cmd.SetOutput(out)
+
+				err := cmd.Execute()
+				assert.NoError(t, err)
+				assert.Equal(t, out.String(), fmt.Sprintf("Configured git for the secrets file at: %s\nCommit %s and %s to share the attributes, and run git-setup in every clone\n", storePath, attributesPath, ignorePath))
+
+			}
+
+			attributes, err := ioutil.ReadFile(attributesPath)
+			assert.NoError(t, err)
+			assert.Equal(t, string(attributes), "*.sh text\n/.secrets.json diff=ejson-kms merge=ejson-kms\n")
+
+			ignore, err := ioutil.ReadFile(ignorePath)
+			assert.NoError(t, err)
+			assert.Equal(t, string(ignore), "/.secrets.json.lock\n")
+
+			// the lock file left by modifying commands is not untracked
+			lock, err := model.Lock(storePath)
+			assert.NoError(t, err)
+			assert.NoError(t, lock.Unlock())
+
+			status, err := runGit(dir, "status", "--porcelain", "--untracked-files=all")
+			assert.NoError(t, err)
+			assert.NotContains(t, string(status), ".lock")
+
+			expected := map[string]string{
+				"diff.ejson-kms.textconv": "/usr/local/bin/ejson-kms git-textconv",
+				"merge.ejson-kms.driver":  "/usr/local/bin/ejson-kms git-merge-driver %O %A %B",
+			}
+
+			for key, value := range expected {
+				config, err := runGit(dir, "config", "--get", key)
+				assert.NoError(t, err)
+				assert.Equal(t, strings.TrimSpace(string(config)), value)
+			}
+
+		})
+
+	})
+
+	t.Run("not a git repository", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := gitSetupCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			// the temporary directory is not in a git repository
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "Unable to configure git: ")
+			}
+
+		})
+
+	})
+
+}
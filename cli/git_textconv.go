@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docGitTextconv = `
+git-textconv: Print a secrets file in a form readable by git diff.
+
+Every change of a secret replaces its whole ciphertext, so git diff shows
+long base64 lines. This command prints the settings of the file, then the
+name, description and metadata of each secret along with a fingerprint of
+its ciphertext: the first 12 hexadecimal characters of its SHA-256. The
+fingerprint changes whenever the secret is encrypted again, without telling
+whether its value changed (see "diff" to compare values).
+
+Secrets are not decrypted, and KMS is never called. Files that cannot be
+parsed, such as files with merge conflicts, are printed as is.
+
+Use the "git-setup" command to register it as the textconv of the secrets
+file.
+`
+
+const exampleGitTextconv = `
+ejson-kms git-textconv .secrets.json
+git config diff.ejson-kms.textconv "ejson-kms git-textconv"
+`
+
+func gitTextconvCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "git-textconv FILE",
+		Short:   "print a secrets file readably, for git diff",
+		Long:    strings.TrimSpace(docGitTextconv),
+		Example: strings.TrimSpace(exampleGitTextconv),
+	}
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		path, err := utils.HasOneArgument(args)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid file", 0)
+		}
+
+		data, err := ioutil.ReadFile(path) // nolint: gosec
+		if err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("Unable to read file at %s", path), 0)
+		}
+
+		store, err := model.Parse(data, path)
+		if err != nil {
+			// git diff fails if its textconv fails, show the file as is instead
+			_, err = cmd.OutOrStdout().Write(data)
+		} else {
+			err = textconv(cmd.OutOrStdout(), store)
+		}
+
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to write to output", 0)
+		}
+
+		return nil
+
+	}
+
+	return cmd
+
+}
+
+// textconv writes one line for each setting of the store and each field of
+// its secrets, so that line-based diffs show which of them changed.
+func textconv(w io.Writer, store *model.Store) error {
+
+	pairs := make([]string, 0, len(store.EncryptionContext))
+	for key, value := range store.EncryptionContext {
+		if value == nil {
+			pairs = append(pairs, key)
+		} else {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", key, *value))
+		}
+	}
+	sort.Strings(pairs)
+
+	lines := []string{
+		fmt.Sprintf("kms_key_id: %s", store.KMSKeyID),
+		fmt.Sprintf("additional_kms_key_ids: %s", orDash(strings.Join(store.AdditionalKMSKeyIDs, ", "))),
+		fmt.Sprintf("encryption_context: %s", orDash(strings.Join(pairs, ","))),
+		fmt.Sprintf("file_key: %s", orDash(optionalFingerprint(store.FileKey))),
+		fmt.Sprintf("algorithm: %s", orDash(store.Algorithm)),
+		fmt.Sprintf("padding: %s", orDash(store.Padding)),
+		fmt.Sprintf("mac_key: %s", orDash(optionalFingerprint(store.MACKey))),
+		fmt.Sprintf("history_limit: %d", store.HistoryLimit),
+	}
+
+	for _, item := range store.Secrets {
+
+		updatedAt := ""
+		if item.UpdatedAt != nil {
+			updatedAt = item.UpdatedAt.Format(time.RFC3339)
+		}
+
+		lines = append(lines,
+			"",
+			fmt.Sprintf("secret %s", item.Name),
+			fmt.Sprintf("  description: %s", orDash(item.Description)),
+			fmt.Sprintf("  ciphertext: %s", fingerprint(item.Ciphertext)),
+			fmt.Sprintf("  updated_at: %s", orDash(updatedAt)),
+			fmt.Sprintf("  updated_by: %s", orDash(item.UpdatedBy)),
+			fmt.Sprintf("  rotations: %d", item.Rotations),
+			fmt.Sprintf("  rotate_every: %s", orDash(item.RotateEvery)),
+		)
+
+		for _, version := range item.History {
+			lines = append(lines, fmt.Sprintf("  history: version %d %s", version.Version, fingerprint(version.Ciphertext)))
+		}
+
+	}
+
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+
+}
+
+// fingerprint identifies a ciphertext: the first 12 hexadecimal characters of
+// its SHA-256. Ciphertexts are not secret, a plain hash is enough.
+func fingerprint(value string) string {
+
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])[:12]
+
+}
+
+// optionalFingerprint returns the fingerprint of a value, or an empty string
+// for an empty value.
+func optionalFingerprint(value string) string {
+
+	if value == "" {
+		return ""
+	}
+
+	return fingerprint(value)
+
+}
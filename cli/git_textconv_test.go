@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitTextconv(t *testing.T) {
+
+	t.Run("no argument", func(t *testing.T) {
+
+		cmd := gitTextconvCmd()
+		cmd.SetArgs([]string{})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid file: No argument provided")
+		}
+
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+
+		cmd := gitTextconvCmd()
+		cmd.SetArgs([]string{"does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to read file at does-not-exist: open does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		cmd := gitTextconvCmd()
+		cmd.SetArgs([]string{testDataInvalid})
+		out := &bytes.Buffer{}
+		cmd.SetOutput(out)
+
+		err := cmd.Execute()
+		assert.NoError(t, err)
+
+		expected, err := ioutil.ReadFile(testDataInvalid)
+		assert.NoError(t, err)
+		assert.Equal(t, out.String(), string(expected))
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		cmd := gitTextconvCmd()
+		cmd.SetArgs([]string{testDataWithHistory})
+		out := &bytes.Buffer{}
+		cmd.SetOutput(out)
+
+		err := cmd.Execute()
+		assert.NoError(t, err)
+		assert.Equal(t, out.String(), `kms_key_id: arn:aws:kms:eu-west-1:012345678912:alias/ejson-kms-testing
+additional_kms_key_ids: -
+encryption_context: -
+file_key: -
+algorithm: -
+padding: -
+mac_key: -
+history_limit: 3
+
+secret secret
+  description: -
+  ciphertext: sha256:62a7b28c65a2
+  updated_at: 2018-06-07T08:09:10Z
+  updated_by: bob
+  rotations: 1
+  rotate_every: -
+  history: version 1 sha256:05311014da04
+`)
+
+	})
+
+}
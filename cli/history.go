@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/crypto"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docHistory = `
+history: List the versions of a secret.
+
+Prints the current version of the secret and the previous versions kept in its
+history, newest first, with when and by whom each of them was set. A history is
+only kept for files created with "init --history", or after "set-history".
+
+Use "get --version" to print one of the versions, and "rollback" to restore it.
+
+Secrets are not decrypted, and KMS is never called: no AWS credentials are
+needed to use this command.
+
+Two formats are available:
+
+  * table: human-readable output
+  * json:  machine-readable output
+`
+
+const exampleHistory = `
+ejson-kms history password
+ejson-kms history password --format=json
+ejson-kms history password --path=secrets.json
+`
+
+// historyOutput is the JSON representation of the history command output
+type historyOutput struct {
+	Name     string           `json:"name"`
+	Versions []historyVersion `json:"versions"`
+}
+
+type historyVersion struct {
+	Version   int        `json:"version"`
+	Current   bool       `json:"current"`
+	Format    string     `json:"format"`
+	UpdatedAt *time.Time `json:"updated_at"`
+	UpdatedBy string     `json:"updated_by"`
+}
+
+func historyCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "history NAME",
+		Short:   "list the versions of a secret",
+		Long:    strings.TrimSpace(docHistory),
+		Example: strings.TrimSpace(exampleHistory),
+	}
+
+	var (
+		storePath = ".secrets.json"
+		format    = "table"
+	)
+
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+	cmd.Flags().StringVar(&format, "format", format, "format of the generated output (table|json)")
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		name, err := utils.HasOneArgument(args)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid name", 0)
+		}
+
+		err = utils.ValidName(name)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid name", 0)
+		}
+
+		if format != "table" && format != "json" {
+			return errors.Errorf("Invalid formatter: Unknown format %s", format)
+		}
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		item := store.Find(name)
+		if item == nil {
+			return errors.Errorf("No secret with the given name has been found")
+		}
+
+		output := newHistoryOutput(item)
+
+		if format == "json" {
+			err = historyJSON(cmd.OutOrStdout(), output)
+		} else {
+			err = historyTable(cmd.OutOrStdout(), output)
+		}
+
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to write to output", 0)
+		}
+
+		return nil
+
+	}
+
+	return cmd
+
+}
+
+func newHistoryOutput(item *model.Secret) historyOutput {
+
+	versions := item.Versions()
+
+	output := historyOutput{
+		Name:     item.Name,
+		Versions: make([]historyVersion, 0, len(versions)),
+	}
+
+	for i := len(versions) - 1; i >= 0; i-- {
+
+		format, err := crypto.FormatVersion(versions[i].Ciphertext)
+		if err != nil {
+			format = "unknown"
+		}
+
+		output.Versions = append(output.Versions, historyVersion{
+			Version:   versions[i].Version,
+			Current:   versions[i].Version == item.Version(),
+			Format:    format,
+			UpdatedAt: versions[i].UpdatedAt,
+			UpdatedBy: versions[i].UpdatedBy,
+		})
+
+	}
+
+	return output
+
+}
+
+func historyJSON(w io.Writer, output historyOutput) error {
+
+	b, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		// Note: not covered by tests as no error can be hit with the current schema
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+
+}
+
+func historyTable(w io.Writer, output historyOutput) error {
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "VERSION\tFORMAT\tUPDATED\tBY")
+	for _, item := range output.Versions {
+		version := fmt.Sprintf("%d", item.Version)
+		if item.Current {
+			version += " (current)"
+		}
+		updatedAt := ""
+		if item.UpdatedAt != nil {
+			updatedAt = item.UpdatedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", version, item.Format, orDash(updatedAt), orDash(item.UpdatedBy))
+	}
+
+	return tw.Flush()
+
+}
@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := historyCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("no argument", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := historyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid name: No argument provided")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := historyCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "--format=yaml"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid formatter: Unknown format yaml")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := historyCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("unknown name", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := historyCmd()
+			cmd.SetArgs([]string{"--path", storePath, "other"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "No secret with the given name has been found")
+			}
+
+		})
+
+	})
+
+	t.Run("table", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := historyCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			withKMSDefaultClientError(t, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+			assert.Equal(t, out.String(), `VERSION      FORMAT  UPDATED               BY
+2 (current)  EJK1    2018-06-07T08:09:10Z  bob
+1            EJK1    2017-01-02T03:04:05Z  alice
+`)
+
+		})
+
+	})
+
+	t.Run("without history", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := historyCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			err := cmd.Execute()
+			assert.NoError(t, err)
+			assert.Equal(t, out.String(), `VERSION      FORMAT  UPDATED  BY
+1 (current)  EJK1    -        -
+`)
+
+		})
+
+	})
+
+	t.Run("json", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := historyCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "--format=json"})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			err := cmd.Execute()
+			assert.NoError(t, err)
+			assert.Equal(t, out.String(), `{
+  "name": "secret",
+  "versions": [
+    {
+      "version": 2,
+      "current": true,
+      "format": "EJK1",
+      "updated_at": "2018-06-07T08:09:10Z",
+      "updated_by": "bob"
+    },
+    {
+      "version": 1,
+      "current": false,
+      "format": "EJK1",
+      "updated_at": "2017-01-02T03:04:05Z",
+      "updated_by": "alice"
+    }
+  ]
+}
+`)
+
+		})
+
+	})
+
+}
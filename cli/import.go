@@ -0,0 +1,298 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/ejson"
+	"github.com/adrienkohlbecker/ejson-kms/formatter"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docImport = `
+import: Import secrets from an existing dotenv, JSON, YAML or ejson file.
+
+The file is parsed with the given format, the inverse of the formats of the
+export command, or a file of Shopify's ejson:
+
+  * dotenv: KEY="value" lines, as well as single quoted and unquoted values,
+            comments and "export" prefixes
+  * json:   an object whose values are all strings
+  * yaml:   a mapping whose values are all scalars
+  * ejson:  an ejson file, decrypted with the private key found in --keydir
+            (/opt/ejson/keys, or $EJSON_KEYDIR when set)
+
+Use "-" to read the file from stdin.
+
+Keys are lower-cased to get the name of each secret, such as MY_SECRET to
+my_secret. Names must then be valid secret names (see the add command): all the
+invalid names are reported, and nothing is imported.
+
+Nested keys of ejson files are joined with underscores, such as
+database_password for {"database": {"password": ...}}. Keys prefixed with an
+underscore are not imported: their value is used as the description of the
+secret with the same name without the underscore, if any. Numbers, booleans
+and null values, which ejson does not encrypt, are skipped, as well as arrays.
+
+Each value is encrypted as a new secret. Importing a secret that already exists
+fails, unless --overwrite is given: it is then rotated to the imported value,
+unless the value is the same, and its description is replaced by the imported
+one, if any.
+
+Nothing is saved unless every secret has been imported.
+Please be mindful of your bash history when piping in strings, and remove the
+plaintext file once imported.
+`
+
+const exampleImport = `
+ejson-kms import .env
+ejson-kms import --format=json secrets.json --path=.secrets.json
+ejson-kms import --format=yaml secrets.yml --overwrite
+ejson-kms import --format=ejson secrets.ejson --keydir=./keys
+ejson-kms export --format=json --path=old.json | ejson-kms import --format=json -
+`
+
+func importCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "import FILE",
+		Short:   "import secrets from a dotenv, JSON, YAML or ejson file",
+		Long:    strings.TrimSpace(docImport),
+		Example: strings.TrimSpace(exampleImport),
+	}
+
+	var (
+		storePath = ".secrets.json"
+		format    = "dotenv"
+		overwrite = false
+		keydir    = ejson.DefaultKeydir
+	)
+
+	if value := os.Getenv("EJSON_KEYDIR"); value != "" {
+		keydir = value
+	}
+
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+	cmd.Flags().StringVar(&format, "format", format, "format of the imported file (dotenv|ejson|json|yaml)")
+	cmd.Flags().BoolVar(&overwrite, "overwrite", overwrite, "rotate the secrets that already exist instead of failing")
+	cmd.Flags().StringVar(&keydir, "keydir", keydir, "directory of the private keys of ejson files")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		inputPath, err := utils.HasOneArgument(args)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid file", 0)
+		}
+
+		parser, err := validParser(format, keydir)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid format", 0)
+		}
+
+		items, err := readImport(inputPath, parser)
+		if err != nil {
+			return err
+		}
+
+		items, err = normalizeImport(items)
+		if err != nil {
+			return err
+		}
+
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		if !overwrite {
+			existing := make([]string, 0)
+			for _, item := range items {
+				if store.Contains(item.Name) {
+					existing = append(existing, item.Name)
+				}
+			}
+			if len(existing) > 0 {
+				return errors.Errorf("Secrets with the same names already exist: %s. Use --overwrite to rotate them", strings.Join(existing, ", "))
+			}
+		}
+
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+		}
+
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		store.Author = commandAuthor(ctx, store)
+
+		report := make([]string, 0, len(items))
+		for _, item := range items {
+
+			if !store.Contains(item.Name) {
+
+				err = store.AddWithContext(ctx, provider, item.Plaintext, item.Name, item.Description)
+				if err != nil {
+					return errors.WrapPrefix(err, fmt.Sprintf("Unable to add secret %s", item.Name), 0)
+				}
+
+				report = append(report, fmt.Sprintf("Added secret: %s\n", item.Name))
+				continue
+
+			}
+
+			rotated, err := store.RotateIfChangedWithContext(ctx, provider, item.Name, item.Plaintext)
+			if err != nil {
+				return errors.WrapPrefix(err, fmt.Sprintf("Unable to rotate secret %s", item.Name), 0)
+			}
+
+			secret := store.Find(item.Name)
+			described := item.Description != "" && item.Description != secret.Description
+			if described {
+				secret.Description = item.Description
+			}
+
+			switch {
+			case rotated:
+				report = append(report, fmt.Sprintf("Rotated secret: %s\n", item.Name))
+			case described:
+				report = append(report, fmt.Sprintf("Updated description of secret: %s\n", item.Name))
+			default:
+				report = append(report, fmt.Sprintf("Unchanged secret: %s\n", item.Name))
+			}
+
+		}
+
+		err = store.Save(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to save JSON", 0)
+		}
+
+		for _, line := range report {
+			cmd.Print(line)
+		}
+
+		cmd.Printf("Exported new secrets file at: %s\n", storePath)
+		return nil
+
+	}
+
+	return cmd
+
+}
+
+// readImport parses the file at the given path, or stdin for "-".
+func readImport(path string, parser formatter.Parser) ([]formatter.Item, error) {
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+
+		f, err := os.Open(path) // nolint: gosec
+		if err != nil {
+			return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to read file at %s", path), 0)
+		}
+		defer f.Close() // nolint: errcheck
+
+		r = f
+
+	}
+
+	items, err := parser(r)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to parse %s", path), 0)
+	}
+
+	if len(items) == 0 {
+		return nil, errors.Errorf("No secrets found in %s", path)
+	}
+
+	return items, nil
+
+}
+
+// normalizeImport lower-cases the keys of the imported items into secret
+// names. All the keys that do not give valid names are reported at once.
+func normalizeImport(items []formatter.Item) ([]formatter.Item, error) {
+
+	normalized := make([]formatter.Item, 0, len(items))
+	invalid := make([]string, 0)
+	keys := make(map[string]string)
+
+	for _, item := range items {
+
+		name := strings.ToLower(item.Name)
+
+		if utils.ValidName(name) != nil {
+			invalid = append(invalid, item.Name)
+			continue
+		}
+
+		if other, ok := keys[name]; ok {
+			return nil, errors.Errorf("Keys %s and %s both give the secret name %s", other, item.Name, name)
+		}
+		keys[name] = item.Name
+
+		normalized = append(normalized, formatter.Item{Name: name, Plaintext: item.Plaintext, Description: item.Description})
+
+	}
+
+	if len(invalid) > 0 {
+		return nil, errors.Errorf("Invalid names: %s. Names can only contain letters, digits and underscores, and cannot start with a number", strings.Join(invalid, ", "))
+	}
+
+	return normalized, nil
+
+}
+
+// validParser parses the format string argument into a parser method.
+// Supported values are "dotenv", "ejson", "json" and "yaml". keydir is the
+// directory of the private keys of ejson, and is ignored by other formats.
+func validParser(format string, keydir string) (formatter.Parser, error) {
+
+	var ret formatter.Parser
+
+	switch format {
+	case "dotenv":
+		ret = formatter.ParseDotenv
+	case "ejson":
+		ret = ejson.Parser(keydir)
+	case "json":
+		ret = formatter.ParseJSON
+	case "yaml":
+		ret = formatter.ParseYAML
+	default:
+		return nil, errors.Errorf("Unknown format %s", format)
+	}
+
+	return ret, nil
+
+}
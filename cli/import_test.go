@@ -0,0 +1,498 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/ejson"
+	"github.com/adrienkohlbecker/ejson-kms/formatter"
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/go-errors/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImport(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := importCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("no argument", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := importCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid file: No argument provided")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := importCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--format=bash", "-"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid format: Unknown format bash")
+			}
+
+		})
+
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := importCmd()
+			cmd.SetArgs([]string{"--path", storePath, "does-not-exist"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Unable to read file at does-not-exist: open does-not-exist: no such file or directory")
+			}
+
+		})
+
+	})
+
+	errorCases := map[string]string{
+		"A":                      "Unable to parse -: Invalid line 1: expected KEY=VALUE",
+		"# nothing\n":            "No secrets found in -",
+		"MY-KEY=1\n1ABC=2\nOK=3": "Invalid names: MY-KEY, 1ABC. Names can only contain letters, digits and underscores, and cannot start with a number",
+		"FOO=1\nfoo=2":           "Keys FOO and foo both give the secret name foo",
+	}
+
+	for input, expected := range errorCases {
+
+		t.Run(fmt.Sprintf("invalid input %q", input), func(t *testing.T) {
+
+			withTempStore(t, testDataEmpty, func(storePath string) {
+
+				cmd := importCmd()
+				cmd.SetArgs([]string{"--path", storePath, "-"})
+				cmd.SetOutput(&bytes.Buffer{})
+
+				withStdin(t, input, func() {
+					err := cmd.Execute()
+					if assert.Error(t, err) {
+						assert.Equal(t, err.Error(), expected)
+					}
+				})
+
+			})
+
+		})
+
+	}
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := importCmd()
+			cmd.SetArgs([]string{"--path", storePath, "-"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withStdin(t, "SECRET=value\n", func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("existing secret", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := importCmd()
+			cmd.SetArgs([]string{"--path", storePath, "-"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withStdin(t, "SECRET=value\nOTHER=value\n", func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Secrets with the same names already exist: secret. Use --overwrite to rotate them")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("with kms init error", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := importCmd()
+			cmd.SetArgs([]string{"--path", storePath, "-"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withStdin(t, "SECRET=value\n", func() {
+				withKMSDefaultClientError(t, func() {
+					err := cmd.Execute()
+					if assert.Error(t, err) {
+						assert.Equal(t, err.Error(), "Unable to initialize AWS client: testing errors")
+					}
+				})
+			})
+
+		})
+
+	})
+
+	t.Run("with kms error", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := importCmd()
+			cmd.SetArgs([]string{"--path", storePath, "-"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			name := "first"
+			other := "second"
+			client := &mock_kms.Client{}
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"Secret": &name}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"Secret": &other}).Return("", "", errors.New("testing errors")).Once()
+
+			withStdin(t, "FIRST=1\nSECOND=2\n", func() {
+				withMockKmsClient(t, client, func() {
+					err := cmd.Execute()
+					if assert.Error(t, err) {
+						assert.Equal(t, err.Error(), "Unable to add secret second: Unable to generate data key: testing errors")
+					}
+				})
+			})
+
+			// nothing is saved
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Len(t, store.Secrets, 0)
+
+		})
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := importCmd()
+			cmd.SetArgs([]string{"--path", storePath, "-"})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			name := "my_secret"
+			other := "other"
+			client := &mock_kms.Client{}
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"Secret": &name}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"Secret": &other}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &name}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &other}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+			withStdin(t, "export MY_SECRET=\"my value\"\nother='x'\n", func() {
+				withMockKmsClient(t, client, func() {
+					err := cmd.Execute()
+					assert.NoError(t, err)
+				})
+			})
+
+			assert.Equal(t, out.String(), fmt.Sprintf("Added secret: my_secret\nAdded secret: other\nExported new secrets file at: %s\n", storePath))
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			items, err := store.ExportPlaintext(kms.NewAWSProvider(client))
+			assert.NoError(t, err)
+
+			item := <-items
+			assert.Equal(t, item.Name, "my_secret")
+			assert.Equal(t, item.Plaintext, "my value")
+			assert.Equal(t, store.Find("my_secret").UpdatedBy, testCallerARN)
+
+			item = <-items
+			assert.Equal(t, item.Name, "other")
+			assert.Equal(t, item.Plaintext, "x")
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("from a file", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			withTempPath(t, func(inputPath string) {
+				defer os.Remove(inputPath) // nolint: errcheck
+
+				err := ioutil.WriteFile(inputPath, []byte(`{"SECRET": "value"}`), 0600)
+				assert.NoError(t, err)
+
+				cmd := importCmd()
+				cmd.SetArgs([]string{"--path", storePath, "--format=json", inputPath})
+				cmd.SetOutput(&bytes.Buffer{})
+
+				client := &mock_kms.Client{}
+				client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"Secret": &testName}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+				withMockKmsClient(t, client, func() {
+					err := cmd.Execute()
+					assert.NoError(t, err)
+				})
+
+				store, err := model.Load(storePath)
+				assert.NoError(t, err)
+				assert.True(t, store.Contains(testName))
+
+			})
+
+		})
+
+	})
+
+	t.Run("from an ejson file", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := importCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--format=ejson", "--keydir", testDataEjsonKeydir, testDataEjson})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			client := &mock_kms.Client{}
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"Secret": &testName}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			assert.Equal(t, out.String(), fmt.Sprintf("Added secret: secret\nExported new secrets file at: %s\n", storePath))
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.Find(testName).Description, "Imported from ejson")
+
+			plaintext, err := store.Decrypt(kms.NewAWSProvider(client), testName)
+			assert.NoError(t, err)
+			assert.Equal(t, plaintext, "abcdef")
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("from an ejson file without its private key", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := importCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--format=ejson", "--keydir=does-not-exist", testDataEjson})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), fmt.Sprintf("Unable to parse %s: Unable to read private key at", testDataEjson))
+			}
+
+		})
+
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := importCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--format=yaml", "--overwrite", "-"})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil)
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"Secret": &testName}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+			withStdin(t, "secret: changed\n", func() {
+				withMockKmsClient(t, client, func() {
+					err := cmd.Execute()
+					assert.NoError(t, err)
+				})
+			})
+
+			// the secret is only decrypted once to compare and rotate it
+			client.AssertNumberOfCalls(t, "Decrypt", 1)
+
+			assert.Equal(t, out.String(), fmt.Sprintf("Rotated secret: secret\nExported new secrets file at: %s\n", storePath))
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			plaintext, err := store.Decrypt(kms.NewAWSProvider(client), testName)
+			assert.NoError(t, err)
+			assert.Equal(t, plaintext, "changed")
+			assert.Equal(t, store.Find(testName).Rotations, 1)
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("overwrite unchanged", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := importCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--overwrite", "-"})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+			withStdin(t, "SECRET=abcdef\n", func() {
+				withMockKmsClient(t, client, func() {
+					err := cmd.Execute()
+					assert.NoError(t, err)
+				})
+			})
+
+			assert.Equal(t, out.String(), fmt.Sprintf("Unchanged secret: secret\nExported new secrets file at: %s\n", storePath))
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.Find(testName).Rotations, 0)
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("overwrite description", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := importCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--format=ejson", "--keydir", testDataEjsonKeydir, "--overwrite", testDataEjson})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			assert.Equal(t, out.String(), fmt.Sprintf("Updated description of secret: secret\nExported new secrets file at: %s\n", storePath))
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.Find(testName).Description, "Imported from ejson")
+			assert.Equal(t, store.Find(testName).Rotations, 0)
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("overwrite with kms error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := importCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--overwrite", "-"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return("", "", errors.New("testing errors")).Once()
+
+			withStdin(t, "SECRET=changed\n", func() {
+				withMockKmsClient(t, client, func() {
+					err := cmd.Execute()
+					if assert.Error(t, err) {
+						assert.Contains(t, err.Error(), "Unable to rotate secret secret: Unable to decrypt secret")
+					}
+				})
+			})
+
+		})
+
+	})
+
+}
+
+func TestValidParser(t *testing.T) {
+
+	valid := map[string]formatter.Parser{
+		"dotenv": formatter.ParseDotenv,
+		"json":   formatter.ParseJSON,
+		"yaml":   formatter.ParseYAML,
+	}
+
+	for value, f := range valid {
+
+		t.Run(fmt.Sprintf("valid %s", value), func(t *testing.T) {
+
+			ret, err := validParser(value, ejson.DefaultKeydir)
+			assert.NoError(t, err)
+			assert.Equal(t, reflect.ValueOf(f).Pointer(), reflect.ValueOf(ret).Pointer())
+
+		})
+
+	}
+
+	t.Run("valid ejson", func(t *testing.T) {
+
+		ret, err := validParser("ejson", ejson.DefaultKeydir)
+		assert.NoError(t, err)
+		assert.NotNil(t, ret)
+
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+
+		_, err := validParser("bash", ejson.DefaultKeydir)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unknown format bash")
+		}
+
+	})
+
+}
@@ -1,11 +1,13 @@
 package cli
 
 import (
+	"path/filepath"
 	"strings"
 
 	"github.com/go-errors/errors"
 	"github.com/spf13/cobra"
 
+	"github.com/adrienkohlbecker/ejson-kms/crypto"
 	"github.com/adrienkohlbecker/ejson-kms/model"
 	"github.com/adrienkohlbecker/ejson-kms/utils"
 )
@@ -14,20 +16,47 @@ const docInit = `
 init: Create a new secrets file.
 
 You must provide an AWS KMS key ID, which can take multiple forms (see examples).
+For development and CI, you can instead use a local master key created by the
+keygen command, with a "file://" key ID. With HashiCorp Vault, use a
+"vault-transit://" key ID pointing to a key of the transit engine.
 
 Optionaly, you can add en encryption context to the generated file, in the form
 of key-value pairs. Note that the only way to modify this context afterwards is
 via the "edit-context" command.
 Manually editing it in the JSON file will render the file un-decipherable.
 
+With "--file-key", all the secrets of the file share a single data key, and
+decrypting them only needs a single call to KMS. See the "rotate-file-key"
+command to switch an existing file.
+
+With "--mac", the whole file is authenticated by a MAC, verified by every
+command calling KMS. See the "rotate-mac-key" command to enable it on an
+existing file.
+
+With "--padding", secrets are padded before encryption to hide their length.
+See the "set-padding" command for the available schemes.
+
+With "--history", the given number of previous values of each secret are kept
+when it is rotated, see the "history" and "rollback" commands.
+
 If a file exists at the destination, the command will exit. You can change the
 default destination path (.secrets.json) with the "--path" flag.
+
+In a git working copy, the lock file taken by the commands modifying the
+secrets file, named after it with a .lock suffix, is added to the .gitignore
+file of its directory.
 `
 
 const exampleInit = `
 ejson-kms init --kms-key-id="arn:aws:kms:us-east-1:123456789012:alias/MyAliasName"
 ejson-kms init --kms-key-id="alias/MyAliasName" --encryption-context="KEY1=VALUE1,KEY2=VALUE2"
 ejson-kms init --kms-key-id="12345678-1234-1234-1234-123456789012" --path="secrets.json"
+ejson-kms init --kms-key-id="file://.ejson-kms.key" --path=".secrets.dev.json"
+ejson-kms init --kms-key-id="vault-transit://transit/my-key"
+ejson-kms init --kms-key-id="alias/MyAliasName" --file-key
+ejson-kms init --kms-key-id="alias/MyAliasName" --padding=pow2
+ejson-kms init --kms-key-id="alias/MyAliasName" --mac
+ejson-kms init --kms-key-id="alias/MyAliasName" --history=5
 `
 
 func initCmd() *cobra.Command {
@@ -43,11 +72,21 @@ func initCmd() *cobra.Command {
 		kmsKeyID             = ""
 		storePath            = ".secrets.json"
 		rawEncryptionContext = make([]string, 0)
+		fileKey              = false
+		rawPadding           = "none"
+		mac                  = false
+		historyLimit         = 0
 	)
 
 	cmd.Flags().StringVar(&kmsKeyID, "kms-key-id", kmsKeyID, "KMS Key ID of your master encryption key for this file")
 	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the generated file")
 	cmd.Flags().StringSliceVar(&rawEncryptionContext, "encryption-context", rawEncryptionContext, "encryption context added to the data keys (\"KEY1=VALUE1,KEY2=VALUE2\")")
+	cmd.Flags().BoolVar(&fileKey, "file-key", fileKey, "use a single data key for all the secrets of the file")
+	cmd.Flags().StringVar(&rawPadding, "padding", rawPadding, "padding of the secrets to hide their length (none|pow2|block256)")
+	cmd.Flags().BoolVar(&mac, "mac", mac, "authenticate the whole file with a MAC")
+	cmd.Flags().IntVar(&historyLimit, "history", historyLimit, "number of previous values kept for each secret")
+
+	kmsOpts := addKMSFlags(cmd)
 
 	cmd.RunE = func(_ *cobra.Command, args []string) error {
 
@@ -61,11 +100,53 @@ func initCmd() *cobra.Command {
 			return errors.WrapPrefix(err, "Invalid encryption context", 0)
 		}
 
+		padding, err := crypto.ParsePadding(rawPadding)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid padding", 0)
+		}
+
 		if kmsKeyID == "" {
 			return errors.Errorf("No KMS Key ID provided")
 		}
 
 		store := model.NewStore(kmsKeyID, encryptionContext)
+		store.Padding = padding
+
+		err = store.SetHistoryLimit(historyLimit)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid history limit", 0)
+		}
+
+		if fileKey || mac {
+
+			policy, err := kmsOpts.retryPolicy()
+			if err != nil {
+				return errors.WrapPrefix(err, "Invalid retry policy", 0)
+			}
+
+			provider, err := defaultProvider(policy)
+			if err != nil {
+				return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+			}
+
+			ctx, stop := commandContext(kmsOpts.timeout)
+			defer stop()
+
+			if fileKey {
+				err = store.RotateFileKeyWithContext(ctx, provider)
+				if err != nil {
+					return errors.WrapPrefix(err, "Unable to generate the file key", 0)
+				}
+			}
+
+			if mac {
+				err = store.RotateMACKeyWithContext(ctx, provider)
+				if err != nil {
+					return errors.WrapPrefix(err, "Unable to generate the MAC key", 0)
+				}
+			}
+
+		}
 
 		err = store.Save(storePath)
 		if err != nil {
@@ -73,6 +154,18 @@ func initCmd() *cobra.Command {
 		}
 
 		cmd.Printf("Exported new secrets file at: %s\n", storePath)
+
+		if inGitWorkTree(filepath.Dir(storePath)) {
+
+			ignorePath, err := ignoreLockFile(storePath)
+			if err != nil {
+				return err
+			}
+
+			cmd.Printf("Added the lock file of the secrets file to: %s\n", ignorePath)
+
+		}
+
 		return nil
 
 	}
@@ -2,10 +2,17 @@ package cli
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/go-errors/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -87,4 +94,211 @@ func TestInit(t *testing.T) {
 
 	})
 
+	t.Run("in a git repository", func(t *testing.T) {
+
+		withGitRepo(t, testDataEmpty, testDataEmpty, func(storePath string) {
+
+			dir := filepath.Dir(storePath)
+			newPath := filepath.Join(dir, "new.json")
+			ignorePath := filepath.Join(dir, ".gitignore")
+
+			cmd := initCmd()
+			cmd.SetArgs([]string{"--path", newPath, "--kms-key-id", testKmsKeyID})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			err := cmd.Execute()
+			assert.NoError(t, err)
+			assert.Equal(t, out.String(), fmt.Sprintf("Exported new secrets file at: %s\nAdded the lock file of the secrets file to: %s\n", newPath, ignorePath))
+
+			ignore, err := ioutil.ReadFile(ignorePath)
+			assert.NoError(t, err)
+			assert.Equal(t, string(ignore), "/new.json.lock\n")
+
+		})
+
+	})
+
+	t.Run("with file key", func(t *testing.T) {
+
+		withTempPath(t, func(tempPath string) {
+			defer os.Remove(tempPath) // nolint: errcheck
+
+			cmd := initCmd()
+			cmd.SetArgs([]string{"--path", tempPath, "--kms-key-id", testKmsKeyID, "--file-key"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			store, err := model.Load(tempPath)
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(store.FileKey, "EJF1;"))
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("with file key and kms error", func(t *testing.T) {
+
+		withTempPath(t, func(tempPath string) {
+
+			cmd := initCmd()
+			cmd.SetArgs([]string{"--path", tempPath, "--kms-key-id", testKmsKeyID, "--file-key"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{}).Return("", "", errors.New("testing errors")).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to generate the file key: Unable to generate file key: Unable to generate data key: testing errors")
+				}
+			})
+
+			_, err := os.Stat(tempPath)
+			assert.True(t, os.IsNotExist(err))
+
+		})
+
+	})
+
+	t.Run("invalid padding", func(t *testing.T) {
+
+		withTempPath(t, func(tempPath string) {
+
+			cmd := initCmd()
+			cmd.SetArgs([]string{"--path", tempPath, "--kms-key-id", testKmsKeyID, "--padding", "pow3"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), `Invalid padding: Unknown padding "pow3", expected none, pow2 or block256`)
+			}
+
+		})
+
+	})
+
+	t.Run("with padding", func(t *testing.T) {
+
+		withTempPath(t, func(tempPath string) {
+			defer os.Remove(tempPath) // nolint: errcheck
+
+			cmd := initCmd()
+			cmd.SetArgs([]string{"--path", tempPath, "--kms-key-id", testKmsKeyID, "--padding", "block256"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			assert.NoError(t, err)
+
+			store, err := model.Load(tempPath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.Padding, "block256")
+
+		})
+
+	})
+
+	t.Run("invalid history limit", func(t *testing.T) {
+
+		withTempPath(t, func(tempPath string) {
+			defer os.Remove(tempPath) // nolint: errcheck
+
+			cmd := initCmd()
+			cmd.SetArgs([]string{"--path", tempPath, "--kms-key-id", testKmsKeyID, "--history=-1"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid history limit: Invalid history limit -1, expected a positive number")
+			}
+
+		})
+
+	})
+
+	t.Run("with history", func(t *testing.T) {
+
+		withTempPath(t, func(tempPath string) {
+			defer os.Remove(tempPath) // nolint: errcheck
+
+			cmd := initCmd()
+			cmd.SetArgs([]string{"--path", tempPath, "--kms-key-id", testKmsKeyID, "--history=5"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			assert.NoError(t, err)
+
+			store, err := model.Load(tempPath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.HistoryLimit, 5)
+
+		})
+
+	})
+
+	t.Run("with mac", func(t *testing.T) {
+
+		withTempPath(t, func(tempPath string) {
+			defer os.Remove(tempPath) // nolint: errcheck
+
+			cmd := initCmd()
+			cmd.SetArgs([]string{"--path", tempPath, "--kms-key-id", testKmsKeyID, "--mac"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			store, err := model.Load(tempPath)
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(store.MACKey, "EJH1;"))
+			assert.Equal(t, store.FileKey, "")
+			assert.NoError(t, store.Verify(kms.NewAWSProvider(client)))
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("with mac and kms error", func(t *testing.T) {
+
+		withTempPath(t, func(tempPath string) {
+
+			cmd := initCmd()
+			cmd.SetArgs([]string{"--path", tempPath, "--kms-key-id", testKmsKeyID, "--mac"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{}).Return("", "", errors.New("testing errors")).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to generate the MAC key: Unable to generate MAC key: Unable to generate data key: testing errors")
+				}
+			})
+
+			_, err := os.Stat(tempPath)
+			assert.True(t, os.IsNotExist(err))
+
+		})
+
+	})
+
 }
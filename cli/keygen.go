@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docKeygen = `
+keygen: Create a new local master key.
+
+The generated keyfile holds a random 256 bits master key, and is only readable
+by its owner. It can be used instead of AWS KMS to wrap the data keys of a
+secrets file, without any network access: this is intended for development
+and CI, not for production secrets.
+
+Use the printed key ID with the init command. The keyfile path is stored in the
+secrets file, relative to the working directory. Do not commit the keyfile!
+
+If a file exists at the destination, the command will exit.
+`
+
+const exampleKeygen = `
+ejson-kms keygen
+ejson-kms keygen --path="/etc/ejson-kms/master.key"
+`
+
+func keygenCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "keygen",
+		Short:   "create a new local master key",
+		Long:    strings.TrimSpace(docKeygen),
+		Example: strings.TrimSpace(exampleKeygen),
+	}
+
+	var keyPath = ".ejson-kms.key"
+	cmd.Flags().StringVar(&keyPath, "path", keyPath, "path of the generated keyfile")
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidNewSecretsPath(keyPath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		keyID, err := kms.GenerateKeyFile(keyPath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to generate master key", 0)
+		}
+
+		cmd.Printf("Exported new master key at: %s\n", keyPath)
+		cmd.Printf("Use it with: ejson-kms init --kms-key-id=\"%s\"\n", keyID)
+		return nil
+
+	}
+
+	return cmd
+
+}
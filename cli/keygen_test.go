@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeygen(t *testing.T) {
+
+	t.Run("existing path", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(keyPath string) {
+
+			cmd := keygenCmd()
+			cmd.SetArgs([]string{"--path", keyPath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Invalid path: A file already exists at %s", keyPath))
+			}
+
+		})
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		withTempPath(t, func(keyPath string) {
+			defer os.Remove(keyPath) // nolint: errcheck
+
+			out := &bytes.Buffer{}
+
+			cmd := keygenCmd()
+			cmd.SetArgs([]string{"--path", keyPath})
+			cmd.SetOutput(out)
+
+			err := cmd.Execute()
+			assert.NoError(t, err)
+			assert.Equal(t, out.String(), fmt.Sprintf("Exported new master key at: %s\nUse it with: ejson-kms init --kms-key-id=\"file://%s\"\n", keyPath, keyPath))
+
+			stat, err := os.Stat(keyPath)
+			if assert.NoError(t, err) {
+				assert.Equal(t, stat.Mode().Perm(), os.FileMode(0600))
+			}
+
+		})
+
+	})
+
+	t.Run("end to end", func(t *testing.T) {
+
+		withTempPath(t, func(keyPath string) {
+			defer os.Remove(keyPath) // nolint: errcheck
+
+			withTempPath(t, func(storePath string) {
+				defer os.Remove(storePath) // nolint: errcheck
+
+				// the AWS client is never called for file:// key IDs
+				withMockKmsClient(t, &mock_kms.Client{}, func() {
+
+					cmd := keygenCmd()
+					cmd.SetArgs([]string{"--path", keyPath})
+					cmd.SetOutput(&bytes.Buffer{})
+					assert.NoError(t, cmd.Execute())
+
+					cmd = initCmd()
+					cmd.SetArgs([]string{"--path", storePath, "--kms-key-id", "file://" + keyPath, "--encryption-context", "ENV=development"})
+					cmd.SetOutput(&bytes.Buffer{})
+					assert.NoError(t, cmd.Execute())
+
+					withStdin(t, "password\n", func() {
+						cmd = addCmd()
+						cmd.SetArgs([]string{"--path", storePath, testName})
+						cmd.SetOutput(&bytes.Buffer{})
+						assert.NoError(t, cmd.Execute())
+					})
+
+					out := &bytes.Buffer{}
+					cmd = getCmd()
+					cmd.SetArgs([]string{"--path", storePath, testName})
+					cmd.SetOutput(out)
+					assert.NoError(t, cmd.Execute())
+					assert.Equal(t, out.String(), "password\n")
+
+				})
+
+			})
+
+		})
+
+	})
+
+}
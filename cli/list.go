@@ -0,0 +1,259 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/crypto"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docList = `
+list: List the secrets in a secrets file.
+
+Prints the KMS key IDs and encryption context of the file, whether it uses a
+single file key, the algorithm of its EJK2 secrets, the padding of its secrets,
+whether it is authenticated by a MAC and how many previous values of each secret
+it keeps, along with the name, description and ciphertext format version of
+each secret.
+
+The metadata of each secret is also printed: when it was added, when and by
+whom it was last changed, and how many times it has been rotated. Secrets added
+by older versions of ejson-kms have no metadata. The JSON output also includes
+the rotation policy of each secret, see the "stale" command.
+
+Secrets are not decrypted, and KMS is never called: no AWS credentials are
+needed to use this command. For the same reason, the MAC of the file is not
+verified, see the "verify" command.
+
+Two formats are available:
+
+  * table: human-readable output
+  * json:  machine-readable output
+`
+
+const exampleList = `
+ejson-kms list
+ejson-kms list --format=json
+ejson-kms list --path=secrets.json
+`
+
+// listOutput is the JSON representation of the list command output
+type listOutput struct {
+	KMSKeyID            string            `json:"kms_key_id"`
+	AdditionalKMSKeyIDs []string          `json:"additional_kms_key_ids"`
+	FileKey             bool              `json:"file_key"`
+	Algorithm           string            `json:"algorithm"`
+	Padding             string            `json:"padding"`
+	MAC                 bool              `json:"mac"`
+	HistoryLimit        int               `json:"history_limit"`
+	EncryptionContext   map[string]string `json:"encryption_context"`
+	Secrets             []listSecret      `json:"secrets"`
+}
+
+type listSecret struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Format      string     `json:"format"`
+	CreatedAt   *time.Time `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+	UpdatedBy   string     `json:"updated_by"`
+	Rotations   int        `json:"rotations"`
+	RotateEvery string     `json:"rotate_every"`
+}
+
+func listCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "list the secrets without decrypting them",
+		Long:    strings.TrimSpace(docList),
+		Example: strings.TrimSpace(exampleList),
+	}
+
+	var (
+		storePath = ".secrets.json"
+		format    = "table"
+	)
+
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+	cmd.Flags().StringVar(&format, "format", format, "format of the generated output (table|json)")
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		if format != "table" && format != "json" {
+			return errors.Errorf("Invalid formatter: Unknown format %s", format)
+		}
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		output := newListOutput(store)
+
+		if format == "json" {
+			err = listJSON(cmd.OutOrStdout(), output)
+		} else {
+			err = listTable(cmd.OutOrStdout(), output)
+		}
+
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to write to output", 0)
+		}
+
+		return nil
+
+	}
+
+	return cmd
+
+}
+
+func newListOutput(store *model.Store) listOutput {
+
+	output := listOutput{
+		KMSKeyID:            store.KMSKeyID,
+		AdditionalKMSKeyIDs: make([]string, 0, len(store.AdditionalKMSKeyIDs)),
+		FileKey:             store.FileKey != "",
+		Algorithm:           store.Algorithm,
+		Padding:             store.Padding,
+		MAC:                 store.MACKey != "",
+		HistoryLimit:        store.HistoryLimit,
+		EncryptionContext:   make(map[string]string),
+		Secrets:             make([]listSecret, 0, len(store.Secrets)),
+	}
+
+	output.AdditionalKMSKeyIDs = append(output.AdditionalKMSKeyIDs, store.AdditionalKMSKeyIDs...)
+
+	for k, v := range store.EncryptionContext {
+		value := ""
+		if v != nil {
+			value = *v
+		}
+		output.EncryptionContext[k] = value
+	}
+
+	for _, item := range store.Secrets {
+
+		version, err := crypto.FormatVersion(item.Ciphertext)
+		if err != nil {
+			version = "unknown"
+		}
+
+		output.Secrets = append(output.Secrets, listSecret{
+			Name:        item.Name,
+			Description: item.Description,
+			Format:      version,
+			CreatedAt:   item.CreatedAt,
+			UpdatedAt:   item.UpdatedAt,
+			UpdatedBy:   item.UpdatedBy,
+			Rotations:   item.Rotations,
+			RotateEvery: item.RotateEvery,
+		})
+
+	}
+
+	return output
+
+}
+
+func listJSON(w io.Writer, output listOutput) error {
+
+	b, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		// Note: not covered by tests as no error can be hit with the current schema
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+
+}
+
+func listTable(w io.Writer, output listOutput) error {
+
+	keys := make([]string, 0, len(output.EncryptionContext))
+	for k := range output.EncryptionContext {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, output.EncryptionContext[k]))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "KMS key ID:\t%s\n", output.KMSKeyID)
+	for _, keyID := range output.AdditionalKMSKeyIDs {
+		fmt.Fprintf(tw, "Additional KMS key ID:\t%s\n", keyID)
+	}
+	if output.FileKey {
+		fmt.Fprintf(tw, "Data key:\tone file key for all secrets\n")
+	}
+	if output.Algorithm != "" {
+		fmt.Fprintf(tw, "Algorithm:\t%s\n", output.Algorithm)
+	}
+	if output.Padding != "" {
+		fmt.Fprintf(tw, "Padding:\t%s\n", output.Padding)
+	}
+	if output.MAC {
+		fmt.Fprintf(tw, "Integrity:\tauthenticated by a MAC\n")
+	}
+	if output.HistoryLimit > 0 {
+		fmt.Fprintf(tw, "History:\t%d previous values per secret\n", output.HistoryLimit)
+	}
+	fmt.Fprintf(tw, "Encryption context:\t%s\n", orDash(strings.Join(pairs, ",")))
+	fmt.Fprintf(tw, "Secrets:\t%d\n", len(output.Secrets))
+
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	if len(output.Secrets) == 0 {
+		return nil
+	}
+
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "")
+	fmt.Fprintln(tw, "NAME\tFORMAT\tUPDATED\tBY\tROTATIONS\tDESCRIPTION")
+	for _, item := range output.Secrets {
+		updatedAt := ""
+		if item.UpdatedAt != nil {
+			updatedAt = item.UpdatedAt.Format("2006-01-02")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", item.Name, item.Format, orDash(updatedAt), orDash(item.UpdatedBy), item.Rotations, orDash(item.Description))
+	}
+
+	return tw.Flush()
+
+}
+
+// orDash avoids printing empty cells in tables
+func orDash(value string) string {
+
+	if value == "" {
+		return "-"
+	}
+
+	return value
+
+}
@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestList(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := listCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("invalid formatter", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := listCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--format", "does-not-exist"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid formatter: Unknown format does-not-exist")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := listCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("empty", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			out := &bytes.Buffer{}
+
+			cmd := listCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(out)
+
+			err := cmd.Execute()
+			if assert.NoError(t, err) {
+				assert.Equal(t, out.String(), `KMS key ID:          arn:aws:kms:eu-west-1:012345678912:alias/ejson-kms-testing
+Encryption context:  -
+Secrets:             0
+`)
+			}
+
+		})
+
+	})
+
+	t.Run("table", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			out := &bytes.Buffer{}
+
+			cmd := listCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(out)
+
+			// any call to KMS would fail the test
+			withMockKmsClient(t, &mock_kms.Client{}, func() {
+				err := cmd.Execute()
+				if assert.NoError(t, err) {
+					assert.Equal(t, out.String(), `KMS key ID:          arn:aws:kms:eu-west-1:012345678912:alias/ejson-kms-testing
+Encryption context:  -
+Secrets:             1
+
+NAME    FORMAT  UPDATED  BY  ROTATIONS  DESCRIPTION
+secret  EJK1    -        -   0          -
+`)
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("json", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			out := &bytes.Buffer{}
+
+			cmd := listCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--format", "json"})
+			cmd.SetOutput(out)
+
+			err := cmd.Execute()
+			if assert.NoError(t, err) {
+				assert.Equal(t, out.String(), `{
+  "kms_key_id": "arn:aws:kms:eu-west-1:012345678912:alias/ejson-kms-testing",
+  "additional_kms_key_ids": [],
+  "file_key": false,
+  "algorithm": "",
+  "padding": "",
+  "mac": false,
+  "history_limit": 0,
+  "encryption_context": {},
+  "secrets": [
+    {
+      "name": "secret",
+      "description": "",
+      "format": "EJK1",
+      "created_at": null,
+      "updated_at": null,
+      "updated_by": "",
+      "rotations": 0,
+      "rotate_every": ""
+    }
+  ]
+}
+`)
+			}
+
+		})
+
+	})
+
+	t.Run("with metadata", func(t *testing.T) {
+
+		withTempStore(t, testDataWithMetadata, func(storePath string) {
+
+			out := &bytes.Buffer{}
+
+			cmd := listCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(out)
+
+			err := cmd.Execute()
+			if assert.NoError(t, err) {
+				assert.Equal(t, out.String(), `KMS key ID:          arn:aws:kms:eu-west-1:012345678912:alias/ejson-kms-testing
+Encryption context:  -
+Secrets:             1
+
+NAME    FORMAT  UPDATED     BY                                                ROTATIONS  DESCRIPTION
+secret  EJK1    2018-06-07  arn:aws:iam::012345678912:user/ejson-kms-testing  3          -
+`)
+			}
+
+			out.Reset()
+			cmd.SetArgs([]string{"--path", storePath, "--format", "json"})
+
+			err = cmd.Execute()
+			if assert.NoError(t, err) {
+				assert.Contains(t, out.String(), `      "created_at": "2017-01-02T03:04:05Z",
+      "updated_at": "2018-06-07T08:09:10Z",
+      "updated_by": "arn:aws:iam::012345678912:user/ejson-kms-testing",
+      "rotations": 3,
+      "rotate_every": "90d"
+`)
+			}
+
+		})
+
+	})
+
+}
@@ -1,11 +1,278 @@
 package cli
 
-import "github.com/adrienkohlbecker/ejson-kms/kms"
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+)
 
 var (
 	version string
 	sha1    string
 
 	// for mocking in tests
-	kmsDefaultClient = kms.DefaultClient
+	kmsNewClient       = kms.NewClient
+	kmsNewRegionClient = kms.NewRegionClient
+	kmsCallerIdentity  = kms.CallerIdentity
 )
+
+// defaultConcurrency is the default number of secrets decrypted in parallel
+const defaultConcurrency = 10
+
+// envRequireMAC is the environment variable requiring secrets files to have a
+// MAC, like the --require-mac flag.
+const envRequireMAC = "EJSON_KMS_REQUIRE_MAC"
+
+// defaultProvider returns the key providers available to ejson-kms. The
+// provider used for a secrets file is selected by the scheme of its key ID.
+// Failed calls to AWS KMS are retried with the given policy, and keys given as
+// an ARN are used through a client for their region.
+func defaultProvider(policy kms.RetryPolicy) (kms.KeyProvider, error) {
+
+	client, err := kmsNewClient(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	awsProvider := kms.NewAWSProvider(client)
+	awsProvider.RegionClient = func(region string) (kms.Client, error) {
+		return kmsNewRegionClient(policy, region)
+	}
+
+	return kms.Providers{awsProvider, kms.NewFileProvider(), kms.DefaultVaultProvider()}, nil
+
+}
+
+// commandAuthor returns the author recorded in the metadata of the secrets
+// added or rotated by a command: the AWS caller identity when the store uses an
+// AWS KMS key, and the current user otherwise, or if the identity is not
+// available.
+func commandAuthor(ctx context.Context, store *model.Store) string {
+
+	for _, keyID := range append([]string{store.KMSKeyID}, store.AdditionalKMSKeyIDs...) {
+
+		scheme := kms.Scheme(keyID)
+		if scheme != "" && scheme != kms.SchemeAWS {
+			continue
+		}
+
+		arn, err := kmsCallerIdentity(ctx)
+		if err == nil {
+			return arn
+		}
+
+		break
+
+	}
+
+	for _, name := range []string{"USER", "USERNAME"} {
+		if user := os.Getenv(name); user != "" {
+			return user
+		}
+	}
+
+	return ""
+
+}
+
+// kmsOptions holds the flags of the commands calling the key providers.
+type kmsOptions struct {
+	cmd *cobra.Command
+
+	timeout       time.Duration
+	maxRetries    int
+	retryDeadline time.Duration
+	requireMAC    bool
+}
+
+// addKMSFlags adds the flags configuring the calls to the key providers to
+// the given command.
+func addKMSFlags(cmd *cobra.Command) *kmsOptions {
+
+	defaults := kms.DefaultRetryPolicy()
+	opts := &kmsOptions{cmd: cmd, maxRetries: defaults.MaxRetries, retryDeadline: defaults.Deadline}
+
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", opts.timeout, "maximum duration of the calls to the key providers, such as \"30s\" (no timeout by default)")
+	cmd.Flags().IntVar(&opts.maxRetries, "max-retries", opts.maxRetries, "maximum number of retries of a throttled or failed call to AWS KMS (or set "+kms.EnvMaxRetries+")")
+	cmd.Flags().DurationVar(&opts.retryDeadline, "retry-deadline", opts.retryDeadline, "maximum duration of a call to AWS KMS, retries included (or set "+kms.EnvRetryDeadline+")")
+	cmd.Flags().BoolVar(&opts.requireMAC, "require-mac", opts.requireMAC, "fail if the secrets file has no MAC (or set "+envRequireMAC+")")
+
+	return opts
+
+}
+
+// retryPolicy returns the retry policy configured by the environment, and
+// overridden by the flags.
+func (o *kmsOptions) retryPolicy() (kms.RetryPolicy, error) {
+
+	policy, err := kms.RetryPolicyFromEnv()
+	if err != nil {
+		return kms.RetryPolicy{}, err
+	}
+
+	if o.cmd.Flags().Changed("max-retries") {
+		if o.maxRetries < 0 {
+			return kms.RetryPolicy{}, errors.Errorf("Invalid max retries: must be at least 0")
+		}
+		policy.MaxRetries = o.maxRetries
+	}
+
+	if o.cmd.Flags().Changed("retry-deadline") {
+		if o.retryDeadline < 0 {
+			return kms.RetryPolicy{}, errors.Errorf("Invalid retry deadline: must be positive")
+		}
+		policy.Deadline = o.retryDeadline
+	}
+
+	return policy, nil
+
+}
+
+// macRequired reports whether secrets files must have a MAC, as configured by
+// the environment and overridden by the flag.
+func (o *kmsOptions) macRequired() (bool, error) {
+
+	if o.cmd.Flags().Changed("require-mac") {
+		return o.requireMAC, nil
+	}
+
+	raw := os.Getenv(envRequireMAC)
+	if raw == "" {
+		return false, nil
+	}
+
+	required, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, errors.Errorf("Invalid value for %s: %s, expected true or false", envRequireMAC, raw)
+	}
+
+	return required, nil
+
+}
+
+// checkMAC returns an error if the store has no MAC while one is required.
+// Removing both the MAC and its key from a file cannot be detected from the
+// file alone, the requirement comes from the environment instead.
+func (o *kmsOptions) checkMAC(store *model.Store) error {
+
+	if store.MACKey != "" {
+		return nil
+	}
+
+	required, err := o.macRequired()
+	if err != nil {
+		return err
+	}
+
+	if required {
+		return errors.Errorf("The file has no MAC, but one is required by --require-mac or %s", envRequireMAC)
+	}
+
+	return nil
+
+}
+
+// verifyStore checks the MAC of the store, if it has one, before its secrets
+// are decrypted or modified. Stores without a MAC fail if one is required, and
+// are not checked otherwise.
+func (o *kmsOptions) verifyStore(ctx context.Context, store *model.Store, provider kms.KeyProvider) error {
+
+	err := o.checkMAC(store)
+	if err != nil {
+		return err
+	}
+
+	if store.MACKey == "" {
+		return nil
+	}
+
+	return store.VerifyWithContext(ctx, provider)
+
+}
+
+// verifyMAC is the same as verifyStore, for commands that do not otherwise call
+// the key providers: they are only initialized when the store has a MAC.
+func (o *kmsOptions) verifyMAC(store *model.Store) error {
+
+	err := o.checkMAC(store)
+	if err != nil {
+		return err
+	}
+
+	if store.MACKey == "" {
+		return nil
+	}
+
+	policy, err := o.retryPolicy()
+	if err != nil {
+		return errors.WrapPrefix(err, "Invalid retry policy", 0)
+	}
+
+	provider, err := defaultProvider(policy)
+	if err != nil {
+		return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+	}
+
+	ctx, stop := commandContext(o.timeout)
+	defer stop()
+
+	return store.VerifyWithContext(ctx, provider)
+
+}
+
+// commandContext returns the context used for the calls to the key providers
+// of a command. It is cancelled after the given timeout, if not zero, and on
+// the first interrupt signal. A second interrupt kills ejson-kms as usual.
+//
+// The returned function releases the associated resources, and must be called
+// once the command does not need the key providers anymore.
+func commandContext(timeout time.Duration) (context.Context, func()) {
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+
+	go func() {
+		select {
+		case <-signals:
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+
+}
+
+// ExitError is returned by commands that need ejson-kms to exit with a given
+// status code, such as exec propagating the status code of its child.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
@@ -1,13 +1,16 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/adrienkohlbecker/ejson-kms/kms"
+	"github.com/adrienkohlbecker/ejson-kms/model"
 	"github.com/go-errors/errors"
 	"github.com/stretchr/testify/assert"
 )
@@ -18,8 +21,13 @@ var (
 
 const (
 	testDataEmpty         = "./testdata/empty.json"
+	testDataWithHistory   = "./testdata/with_history.json"
 	testDataInvalid       = "./testdata/invalid.json"
 	testDataOneCredential = "./testdata/one_credential.json"
+	testDataUnknownScheme = "./testdata/unknown_provider.json"
+	testDataWithMetadata  = "./testdata/with_metadata.json"
+	testDataEjson         = "./testdata/secrets.ejson"
+	testDataEjsonKeydir   = "./testdata/ejson_keys"
 
 	testKmsKeyID       = "arn:aws:kms:eu-west-1:012345678912:alias/ejson-kms-testing"
 	testKeyPlaintext   = "-abcdefabcdefabcdefabcdefabcdef-"
@@ -27,6 +35,8 @@ const (
 	testKmsKeyID2      = "arn:aws:kms:eu-west-1:012345678912:alias/ejson-kms-testing-other"
 	testKeyPlaintext2  = "-012345678901234567890123456789-"
 	testKeyCiphertext2 = "anotherciphertextblob"
+	testCallerARN      = "arn:aws:iam::012345678912:user/ejson-kms-testing"
+	testFingerprintKey = "-fingerprintkeyfingerprintkey12-"
 )
 
 func withTempPath(t *testing.T, f func(storePath string)) {
@@ -139,26 +149,160 @@ func withStdinError(t *testing.T, f func()) {
 
 func withKMSDefaultClientError(t *testing.T, f func()) {
 
-	original := kmsDefaultClient
-	kmsDefaultClient = func() (kms.Client, error) {
+	original := kmsNewClient
+	kmsNewClient = func(policy kms.RetryPolicy) (kms.Client, error) {
 		return nil, errors.Errorf("testing errors")
 	}
 
 	f()
 
-	kmsDefaultClient = original
+	kmsNewClient = original
 
 }
 
 func withMockKmsClient(t *testing.T, other kms.Client, f func()) {
 
-	original := kmsDefaultClient
-	kmsDefaultClient = func() (kms.Client, error) {
-		return other, nil
+	original := kmsNewClient
+	kmsNewClient = func(policy kms.RetryPolicy) (kms.Client, error) {
+		return kms.NewRetryClient(other, policy), nil
+	}
+
+	originalRegion := kmsNewRegionClient
+	kmsNewRegionClient = func(policy kms.RetryPolicy, region string) (kms.Client, error) {
+		return kms.NewRetryClient(other, policy), nil
+	}
+
+	originalIdentity := kmsCallerIdentity
+	kmsCallerIdentity = func(ctx context.Context) (string, error) {
+		return testCallerARN, nil
 	}
 
 	f()
 
-	kmsDefaultClient = original
+	kmsNewClient = original
+	kmsNewRegionClient = originalRegion
+	kmsCallerIdentity = originalIdentity
+
+}
+
+func TestCommandContext(t *testing.T) {
+
+	t.Run("no timeout", func(t *testing.T) {
+
+		ctx, stop := commandContext(0)
+
+		_, ok := ctx.Deadline()
+		assert.False(t, ok)
+		assert.NoError(t, ctx.Err())
+
+		stop()
+		assert.Equal(t, ctx.Err(), context.Canceled)
+
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+
+		ctx, stop := commandContext(time.Nanosecond)
+		defer stop()
+
+		<-ctx.Done()
+		assert.Equal(t, ctx.Err(), context.DeadlineExceeded)
+
+	})
+
+	t.Run("interrupt", func(t *testing.T) {
+
+		ctx, stop := commandContext(0)
+		defer stop()
+
+		process, err := os.FindProcess(os.Getpid())
+		assert.NoError(t, err)
+		assert.NoError(t, process.Signal(os.Interrupt))
+
+		select {
+		case <-ctx.Done():
+			assert.Equal(t, ctx.Err(), context.Canceled)
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "context was not cancelled by the interrupt")
+		}
+
+	})
+
+}
+
+func TestCommandAuthor(t *testing.T) {
+
+	withUser := func(user string, f func()) {
+
+		original, ok := os.LookupEnv("USER")
+		assert.NoError(t, os.Setenv("USER", user))
+
+		f()
+
+		if ok {
+			assert.NoError(t, os.Setenv("USER", original))
+		} else {
+			assert.NoError(t, os.Unsetenv("USER"))
+		}
+
+	}
+
+	withIdentity := func(arn string, err error, f func()) {
+
+		original := kmsCallerIdentity
+		kmsCallerIdentity = func(ctx context.Context) (string, error) {
+			return arn, err
+		}
+
+		f()
+
+		kmsCallerIdentity = original
+
+	}
+
+	t.Run("aws key", func(t *testing.T) {
+
+		withUser("alice", func() {
+			withIdentity(testCallerARN, nil, func() {
+				store := model.NewStore(testKmsKeyID, nil)
+				assert.Equal(t, commandAuthor(context.Background(), store), testCallerARN)
+			})
+		})
+
+	})
+
+	t.Run("aws additional key", func(t *testing.T) {
+
+		withUser("alice", func() {
+			withIdentity(testCallerARN, nil, func() {
+				store := model.NewStore("file://.ejson-kms.key", nil)
+				store.AdditionalKMSKeyIDs = []string{testKmsKeyID}
+				assert.Equal(t, commandAuthor(context.Background(), store), testCallerARN)
+			})
+		})
+
+	})
+
+	t.Run("aws error", func(t *testing.T) {
+
+		withUser("alice", func() {
+			withIdentity("", errors.Errorf("testing errors"), func() {
+				store := model.NewStore(testKmsKeyID, nil)
+				assert.Equal(t, commandAuthor(context.Background(), store), "alice")
+			})
+		})
+
+	})
+
+	t.Run("other key provider", func(t *testing.T) {
+
+		withUser("alice", func() {
+			withIdentity(testCallerARN, nil, func() {
+				store := model.NewStore("file://.ejson-kms.key", nil)
+				assert.Equal(t, commandAuthor(context.Background(), store), "alice")
+			})
+		})
+
+	})
 
 }
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/crypto"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docMigrate = `
+migrate: Upgrade the secrets of a file to the EJK2 format.
+
+The EJK2 format records the algorithm used to encrypt each secret, and
+authenticates the name of the secret, the KMS key ID of the file and the format
+version along with the ciphertext: a ciphertext cannot be moved to another
+secret or another file without failing to decrypt.
+
+Two algorithms are available: "xchacha20-poly1305" (the default) and
+"aes-256-gcm". New secrets added to the file use the same algorithm.
+
+This command decrypts all your secrets, and re-encrypts them in the EJK2 format
+with new data keys. Run it again with another algorithm to switch to it.
+The original file will be overwritten.
+
+Note that older versions of ejson-kms cannot decrypt EJK2 secrets.
+`
+
+const exampleMigrate = `
+ejson-kms migrate
+ejson-kms migrate --algorithm=aes-256-gcm --path=secrets.json
+`
+
+func migrateCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "migrate",
+		Short:   "upgrades the secrets to the EJK2 format",
+		Long:    strings.TrimSpace(docMigrate),
+		Example: strings.TrimSpace(exampleMigrate),
+	}
+
+	var (
+		storePath = ".secrets.json"
+		algorithm = crypto.DefaultAlgorithm
+	)
+
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+	cmd.Flags().StringVar(&algorithm, "algorithm", algorithm, "encryption algorithm (xchacha20-poly1305, aes-256-gcm)")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		err = crypto.ValidAlgorithm(algorithm)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid algorithm", 0)
+		}
+
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+		}
+
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		err = store.MigrateWithContext(ctx, provider, algorithm)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to migrate the secrets", 0)
+		}
+
+		err = store.Save(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to save JSON", 0)
+		}
+
+		cmd.Printf("Exported new secrets file at: %s\n", storePath)
+		return nil
+
+	}
+
+	return cmd
+}
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/go-errors/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := migrateCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("invalid algorithm", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := migrateCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--algorithm", "rot13"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid algorithm: Unknown algorithm rot13, expected xchacha20-poly1305 or aes-256-gcm")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := migrateCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("with kms init error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := migrateCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withKMSDefaultClientError(t, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to initialize AWS client: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("with kms decrypt error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := migrateCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return("", "", errors.New("testing errors")).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to migrate the secrets: Unable to decrypt secret: secret: Unable to decrypt key ciphertext: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := migrateCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--algorithm", "aes-256-gcm"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"Secret": &testName}).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext2, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+
+			assert.Equal(t, store.Algorithm, "aes-256-gcm")
+			assert.True(t, strings.HasPrefix(store.Secrets[0].Ciphertext, "EJK2;aes-256-gcm;"))
+
+			items, err := store.ExportPlaintext(kms.NewAWSProvider(client))
+			assert.NoError(t, err)
+
+			item, ok := <-items
+			assert.True(t, ok)
+			_, ok = <-items
+			assert.False(t, ok)
+
+			assert.Equal(t, item.Name, testName)
+			assert.Equal(t, item.Plaintext, "abcdef")
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docRemove = `
+remove: Remove secrets from a secrets file.
+
+Every given name must exist in the file and be given only once, otherwise
+nothing is removed.
+
+Use --dry-run to list the secrets that would be removed without modifying
+the file.
+
+KMS is only called when the file has a MAC, to verify it and compute it again.
+`
+
+const exampleRemove = `
+ejson-kms remove password
+ejson-kms remove password api_key --path="secrets.json"
+ejson-kms remove password --dry-run
+`
+
+func removeCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "remove NAME [NAME...]",
+		Short:   "remove secrets",
+		Long:    strings.TrimSpace(docRemove),
+		Example: strings.TrimSpace(exampleRemove),
+	}
+
+	var (
+		storePath = ".secrets.json"
+		dryRun    = false
+	)
+
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", dryRun, "list the secrets that would be removed without modifying the file")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		err = utils.HasArguments(args)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid name", 0)
+		}
+
+		seen := make(map[string]bool)
+		for _, name := range args {
+			err = utils.ValidName(name)
+			if err != nil {
+				return errors.WrapPrefix(err, "Invalid name", 0)
+			}
+			if seen[name] {
+				return errors.Errorf("Invalid name: %s is given more than once", name)
+			}
+			seen[name] = true
+		}
+
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		for _, name := range args {
+			if !store.Contains(name) {
+				return errors.Errorf("No secret with the given name has been found: %s", name)
+			}
+		}
+
+		if dryRun {
+			for _, name := range args {
+				cmd.Printf("Would remove secret: %s\n", name)
+			}
+			return nil
+		}
+
+		err = kmsOpts.verifyMAC(store)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		for _, name := range args {
+			err = store.Remove(name)
+			if err != nil {
+				return errors.WrapPrefix(err, "Unable to remove secret", 0)
+			}
+		}
+
+		err = store.Save(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to save JSON", 0)
+		}
+
+		cmd.Printf("Exported new secrets file at: %s\n", storePath)
+		return nil
+
+	}
+
+	return cmd
+
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docRemoveKMSKey = `
+remove-kms-key: Remove a master key from a secrets file.
+
+This command will decrypt all your secrets, and re-encrypt them with new data
+keys wrapped by the remaining master keys only, so that the removed key cannot
+be used to decrypt them anymore. If any secret fails to be decrypted or
+encrypted, the file is left untouched.
+
+If the removed key is the main key of the file (kms_key_id), the first
+additional key takes its place. The last master key cannot be removed: use
+rotate-kms-key instead.
+`
+
+const exampleRemoveKMSKey = `
+ejson-kms remove-kms-key arn:aws:kms:eu-west-1:123456789012:alias/MyAliasName
+ejson-kms remove-kms-key file:///etc/ejson-kms/break-glass.key --path="secrets.json"
+`
+
+func removeKMSKeyCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "remove-kms-key KMS_KEY_ID",
+		Short:   "remove a master key from the secrets file",
+		Long:    strings.TrimSpace(docRemoveKMSKey),
+		Example: strings.TrimSpace(exampleRemoveKMSKey),
+	}
+
+	var storePath = ".secrets.json"
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		kmsKeyID, err := utils.HasOneArgument(args)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid KMS Key ID", 0)
+		}
+
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+		}
+
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		err = store.RemoveKMSKeyWithContext(ctx, provider, kmsKeyID)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to remove the KMS key", 0)
+		}
+
+		err = store.Save(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to save JSON", 0)
+		}
+
+		cmd.Printf("Exported new secrets file at: %s\n", storePath)
+		return nil
+
+	}
+
+	return cmd
+}
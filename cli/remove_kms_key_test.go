@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveKMSKey(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := removeKMSKeyCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("no argument", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := removeKMSKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid KMS Key ID: No argument provided")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := removeKMSKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath, testKmsKeyID})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("with kms init error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := removeKMSKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath, testKmsKeyID})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withKMSDefaultClientError(t, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to initialize AWS client: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("only key", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := removeKMSKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath, testKmsKeyID})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withMockKmsClient(t, &mock_kms.Client{}, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to remove the KMS key: Unable to remove the only KMS key")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("with local keys", func(t *testing.T) {
+
+		withTempKeyFiles(t, 2, func(keyIDs []string) {
+			withTempPath(t, func(storePath string) {
+				defer os.Remove(storePath) // nolint: errcheck
+
+				withMockKmsClient(t, &mock_kms.Client{}, func() {
+
+					store := model.NewStore(keyIDs[0], map[string]*string{})
+					provider, err := defaultProvider(kms.DefaultRetryPolicy())
+					assert.NoError(t, err)
+					assert.NoError(t, store.AddKMSKey(provider, keyIDs[1]))
+					assert.NoError(t, store.Add(provider, "password", testName, ""))
+					assert.NoError(t, store.Save(storePath))
+
+					cmd := removeKMSKeyCmd()
+					cmd.SetArgs([]string{"--path", storePath, keyIDs[0]})
+					cmd.SetOutput(&bytes.Buffer{})
+					assert.NoError(t, cmd.Execute())
+
+					store, err = model.Load(storePath)
+					assert.NoError(t, err)
+					assert.Equal(t, store.KMSKeyID, keyIDs[1])
+					assert.Nil(t, store.AdditionalKMSKeyIDs)
+
+					// the removed master key cannot decrypt the secret anymore
+					store.KMSKeyID = keyIDs[0]
+					_, err = store.Decrypt(provider, testName)
+					if assert.Error(t, err) {
+						assert.Contains(t, err.Error(), "Invalid master key or encryption context")
+					}
+
+					out := &bytes.Buffer{}
+					cmd = getCmd()
+					cmd.SetArgs([]string{"--path", storePath, testName})
+					cmd.SetOutput(out)
+					assert.NoError(t, cmd.Execute())
+					assert.Equal(t, out.String(), "password\n")
+
+				})
+
+			})
+		})
+
+	})
+
+}
@@ -0,0 +1,264 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/go-errors/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemove(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := removeCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("no argument", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := removeCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid name: No argument provided")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := removeCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "123_ABC"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid name: Invalid format for name: must be lowercase, can contain letters, digits and underscores, and cannot start with a number.")
+			}
+
+		})
+
+	})
+
+	t.Run("duplicate name", func(t *testing.T) {
+
+		for _, dryRun := range []string{"--dry-run=true", "--dry-run=false"} {
+
+			withTempStore(t, testDataOneCredential, func(storePath string) {
+
+				cmd := removeCmd()
+				cmd.SetArgs([]string{"--path", storePath, dryRun, testName, testName})
+				out := &bytes.Buffer{}
+				cmd.SetOutput(out)
+
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Invalid name: secret is given more than once")
+				}
+
+				assert.NotContains(t, out.String(), "Would remove secret")
+
+			})
+
+		}
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := removeCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("name does not exists", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := removeCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "other"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "No secret with the given name has been found: other")
+			}
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.True(t, store.Contains(testName))
+
+		})
+
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			out := &bytes.Buffer{}
+
+			cmd := removeCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--dry-run", testName})
+			cmd.SetOutput(out)
+
+			err := cmd.Execute()
+			if assert.NoError(t, err) {
+				assert.Equal(t, out.String(), "Would remove secret: secret\n")
+			}
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.True(t, store.Contains(testName))
+
+		})
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := removeCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			assert.NoError(t, err)
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.False(t, store.Contains(testName))
+			assert.Len(t, store.Secrets, 0)
+
+		})
+
+	})
+
+	t.Run("with mac", func(t *testing.T) {
+
+		withMACStore(t, func(storePath string, client *mock_kms.Client) {
+
+			cmd := removeCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{}).Return(testKmsKeyID, testKeyPlaintext2, nil).Twice()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Len(t, store.Secrets, 0)
+			assert.NoError(t, store.Verify(kms.NewAWSProvider(client)))
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("with mac and kms error", func(t *testing.T) {
+
+		withMACStore(t, func(storePath string, client *mock_kms.Client) {
+
+			cmd := removeCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{}).Return("", "", errors.New("testing errors")).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), "Unable to verify the secrets file: Unable to decrypt MAC key")
+				}
+			})
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.True(t, store.Contains(testName))
+
+		})
+
+	})
+
+	t.Run("waits for the lock", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			lock, err := model.Lock(storePath)
+			assert.NoError(t, err)
+
+			cmd := removeCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			done := make(chan error, 1)
+			go func() {
+				done <- cmd.Execute()
+			}()
+
+			select {
+			case <-done:
+				assert.Fail(t, "command did not wait for the lock")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.True(t, store.Contains(testName))
+
+			assert.NoError(t, lock.Unlock())
+
+			select {
+			case err := <-done:
+				assert.NoError(t, err)
+			case <-time.After(5 * time.Second):
+				assert.Fail(t, "command did not finish")
+			}
+
+			store, err = model.Load(storePath)
+			assert.NoError(t, err)
+			assert.False(t, store.Contains(testName))
+
+		})
+
+	})
+
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docRename = `
+rename: Rename a secret in a secrets file.
+
+The name of a secret is part of its encryption context, so manually editing it
+in the JSON file will render the secret un-decipherable.
+
+This command will decrypt the secret, and encrypt it again with a new data key
+under its new name. The description is kept as is.
+
+The new name must follow the same rules as the add command, and must not
+already be used in the file.
+`
+
+const exampleRename = `
+ejson-kms rename password db_password
+ejson-kms rename password db_password --path="secrets.json"
+`
+
+func renameCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "rename OLD_NAME NEW_NAME",
+		Short:   "rename a secret",
+		Long:    strings.TrimSpace(docRename),
+		Example: strings.TrimSpace(exampleRename),
+	}
+
+	var storePath = ".secrets.json"
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		name, newName, err := utils.HasTwoArguments(args)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid name", 0)
+		}
+
+		err = utils.ValidName(name)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid name", 0)
+		}
+
+		err = utils.ValidName(newName)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid new name", 0)
+		}
+
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		if !store.Contains(name) {
+			return errors.Errorf("No secret with the given name has been found. Use the `add` command")
+		}
+
+		if store.Contains(newName) {
+			return errors.Errorf("A secret with the new name already exists. Use the `remove` command first")
+		}
+
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+		}
+
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		err = store.RenameWithContext(ctx, provider, name, newName)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to rename secret", 0)
+		}
+
+		err = store.Save(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to save JSON", 0)
+		}
+
+		cmd.Printf("Exported new secrets file at: %s\n", storePath)
+		return nil
+
+	}
+
+	return cmd
+
+}
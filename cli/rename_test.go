@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRename(t *testing.T) {
+
+	newName := "new_secret"
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := renameCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("one argument", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := renameCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid name: Expected two arguments, got 1")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid new name", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := renameCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "123_ABC"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid new name: Invalid format for name: must be lowercase, can contain letters, digits and underscores, and cannot start with a number.")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := renameCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, newName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("name does not exists", func(t *testing.T) {
+
+		withTempStore(t, testDataEmpty, func(storePath string) {
+
+			cmd := renameCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, newName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "No secret with the given name has been found. Use the `add` command")
+			}
+
+		})
+
+	})
+
+	t.Run("new name exists", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := renameCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "A secret with the new name already exists. Use the `remove` command first")
+			}
+
+		})
+
+	})
+
+	t.Run("with kms init error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := renameCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, newName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withKMSDefaultClientError(t, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to initialize AWS client: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("with kms decrypt error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := renameCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, newName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return("", "", errors.New("testing errors")).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to rename secret: Unable to decrypt secret: Unable to decrypt key ciphertext: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := renameCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, newName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"Secret": &newName}).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{"Secret": &newName}).Return(testKmsKeyID, testKeyPlaintext2, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.False(t, store.Contains(testName))
+
+			items, err := store.ExportPlaintext(kms.NewAWSProvider(client))
+			assert.NoError(t, err)
+
+			item, ok := <-items
+			assert.True(t, ok)
+			assert.Equal(t, item.Name, newName)
+			assert.Equal(t, item.Plaintext, "abcdef")
+
+		})
+
+	})
+
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docRollback = `
+rollback: Restore a previous value of a secret.
+
+The value with the given version number is decrypted from the history of the
+secret, and encrypted again with a new data key as its new current version. The
+version being replaced is added to the history, so that a rollback can itself
+be rolled back.
+
+Rolling back to a version with the same value as the current one fails, since
+it would not change anything.
+
+Use the "history" command to list the versions of a secret. A history is only
+kept for files created with "init --history", or after "set-history".
+`
+
+const exampleRollback = `
+ejson-kms rollback password --to=3
+ejson-kms rollback password --to=3 --path="secrets.json"
+`
+
+func rollbackCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "rollback NAME --to=VERSION",
+		Short:   "restore a previous value of a secret",
+		Long:    strings.TrimSpace(docRollback),
+		Example: strings.TrimSpace(exampleRollback),
+	}
+
+	var (
+		storePath = ".secrets.json"
+		version   = 0
+	)
+
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+	cmd.Flags().IntVar(&version, "to", version, "version of the secret to restore")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		name, err := utils.HasOneArgument(args)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid name", 0)
+		}
+
+		err = utils.ValidName(name)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid name", 0)
+		}
+
+		if version < 1 {
+			return errors.Errorf("No version provided, use --to")
+		}
+
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		if !store.Contains(name) {
+			return errors.Errorf("No secret with the given name has been found")
+		}
+
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+		}
+
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		store.Author = commandAuthor(ctx, store)
+
+		err = store.RollbackWithContext(ctx, provider, name, version)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to roll back secret", 0)
+		}
+
+		err = store.Save(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to save JSON", 0)
+		}
+
+		cmd.Printf("Exported new secrets file at: %s\n", storePath)
+		return nil
+
+	}
+
+	return cmd
+
+}
@@ -0,0 +1,199 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/go-errors/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollback(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := rollbackCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := rollbackCmd()
+			cmd.SetArgs([]string{"--path", storePath, "123_ABC", "--to=1"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid name: Invalid format for name: must be lowercase, can contain letters, digits and underscores, and cannot start with a number.")
+			}
+
+		})
+
+	})
+
+	t.Run("no version", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := rollbackCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "No version provided, use --to")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := rollbackCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "--to=1"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("unknown name", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := rollbackCmd()
+			cmd.SetArgs([]string{"--path", storePath, "other", "--to=1"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "No secret with the given name has been found")
+			}
+
+		})
+
+	})
+
+	t.Run("with kms init error", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := rollbackCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "--to=1"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withKMSDefaultClientError(t, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to initialize AWS client: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("current version", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := rollbackCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "--to=2"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withMockKmsClient(t, &mock_kms.Client{}, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to roll back secret: Version 2 is already the current version of secret")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("with kms error", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := rollbackCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "--to=1"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return("", "", errors.New("testing errors")).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), "Unable to roll back secret: Unable to decrypt secret")
+				}
+			})
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.Find(testName).Version(), 2)
+
+		})
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := rollbackCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "--to=1"})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			client := &mock_kms.Client{}
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{"Secret": &testName}).Return(testKmsKeyID, testKeyPlaintext, nil)
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{"Secret": &testName}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+			assert.Equal(t, out.String(), fmt.Sprintf("Exported new secrets file at: %s\n", storePath))
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+
+			item := store.Find(testName)
+			assert.Equal(t, item.Version(), 3)
+			assert.Equal(t, item.UpdatedBy, testCallerARN)
+			assert.Len(t, item.History, 2)
+
+			plaintext, err := store.Decrypt(kms.NewAWSProvider(client), testName)
+			assert.NoError(t, err)
+			assert.Equal(t, plaintext, "abcdef")
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+}
@@ -39,6 +39,8 @@ func rotateCmd() *cobra.Command {
 	var storePath = ".secrets.json"
 	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
 
+	kmsOpts := addKMSFlags(cmd)
+
 	cmd.RunE = func(_ *cobra.Command, args []string) error {
 
 		err := utils.ValidSecretsPath(storePath)
@@ -56,6 +58,12 @@ func rotateCmd() *cobra.Command {
 			return errors.WrapPrefix(err, "Invalid name", 0)
 		}
 
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
 		store, err := model.Load(storePath)
 		if err != nil {
 			return errors.WrapPrefix(err, "Unable to load JSON", 0)
@@ -70,12 +78,27 @@ func rotateCmd() *cobra.Command {
 			return errors.WrapPrefix(err, "Unable to read from stdin", 0)
 		}
 
-		client, err := kmsDefaultClient()
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
 		if err != nil {
 			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
 		}
 
-		err = store.Rotate(client, name, plaintext)
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		store.Author = commandAuthor(ctx, store)
+
+		err = store.RotateWithContext(ctx, provider, name, plaintext)
 		if err != nil {
 			return errors.WrapPrefix(err, "Unable to rotate secret", 0)
 		}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docRotateFileKey = `
+rotate-file-key: Use a new file key to encrypt a secrets file.
+
+A file key is a single data key shared by all the secrets of a file, so that
+decrypting all of them only needs a single call to KMS, instead of one call per
+secret. The name of each secret is still authenticated, but is not part of the
+encryption context sent to KMS anymore.
+
+This command generates a new file key, decrypts all your secrets, and
+re-encrypts them with the new key. On a file where each secret has its own data
+key, this switches it to a file key, and the algorithm of files migrated to the
+EJK2 format is removed, since secrets sealed with a file key do not use it.
+The original file will be overwritten.
+`
+
+const exampleRotateFileKey = `
+ejson-kms rotate-file-key
+ejson-kms rotate-file-key --path=secrets.json
+`
+
+func rotateFileKeyCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "rotate-file-key",
+		Short:   "encrypts the secrets with a new file key",
+		Long:    strings.TrimSpace(docRotateFileKey),
+		Example: strings.TrimSpace(exampleRotateFileKey),
+	}
+
+	var storePath = ".secrets.json"
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+		}
+
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		err = store.RotateFileKeyWithContext(ctx, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to rotate the file key", 0)
+		}
+
+		err = store.Save(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to save JSON", 0)
+		}
+
+		cmd.Printf("Exported new secrets file at: %s\n", storePath)
+		return nil
+
+	}
+
+	return cmd
+}
@@ -34,6 +34,8 @@ func rotateKMSKeyCmd() *cobra.Command {
 	var storePath = ".secrets.json"
 	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
 
+	kmsOpts := addKMSFlags(cmd)
+
 	cmd.RunE = func(_ *cobra.Command, args []string) error {
 
 		err := utils.ValidSecretsPath(storePath)
@@ -46,17 +48,36 @@ func rotateKMSKeyCmd() *cobra.Command {
 			return errors.WrapPrefix(err, "Invalid new KMS Key ID", 0)
 		}
 
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
 		store, err := model.Load(storePath)
 		if err != nil {
 			return errors.WrapPrefix(err, "Unable to load JSON", 0)
 		}
 
-		client, err := kmsDefaultClient()
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
 		if err != nil {
 			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
 		}
 
-		err = store.RotateKMSKey(client, newKMSKeyID)
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		err = store.RotateKMSKeyWithContext(ctx, provider, newKMSKeyID)
 		if err != nil {
 			return errors.WrapPrefix(err, "Unable to rotate the KMS key", 0)
 		}
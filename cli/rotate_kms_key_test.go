@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/adrienkohlbecker/ejson-kms/kms"
 	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
 	"github.com/adrienkohlbecker/ejson-kms/model"
 	"github.com/stretchr/testify/assert"
@@ -124,7 +125,7 @@ func TestRotateKMSKey(t *testing.T) {
 
 			assert.Equal(t, store.KMSKeyID, testKmsKeyID2)
 
-			items, err := store.ExportPlaintext(client)
+			items, err := store.ExportPlaintext(kms.NewAWSProvider(client))
 			assert.NoError(t, err)
 
 			item, ok := <-items
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docRotateMACKey = `
+rotate-mac-key: Use a new key to authenticate a secrets file.
+
+The MAC of a file authenticates its whole content: the KMS key IDs, the
+encryption context and other settings, along with the ordered list of names,
+descriptions and ciphertexts of the secrets. It detects deleted secrets,
+secrets reverted to an older ciphertext, and modified settings, which the
+encryption of each secret cannot detect on its own.
+
+This command generates a new MAC key, wrapped by KMS. On a file without a MAC,
+this enables it. The MAC is then verified by every command calling KMS, and
+computed again each time the file is saved. See the "verify" command to check
+it explicitly.
+The original file will be overwritten.
+`
+
+const exampleRotateMACKey = `
+ejson-kms rotate-mac-key
+ejson-kms rotate-mac-key --path=secrets.json
+`
+
+func rotateMACKeyCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "rotate-mac-key",
+		Short:   "authenticates the file with a new MAC key",
+		Long:    strings.TrimSpace(docRotateMACKey),
+		Example: strings.TrimSpace(exampleRotateMACKey),
+	}
+
+	var storePath = ".secrets.json"
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+		}
+
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		// the MAC may be enabled by this command, so it cannot be required
+		if store.MACKey != "" {
+			err = store.VerifyWithContext(ctx, provider)
+			if err != nil {
+				return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+			}
+		}
+
+		err = store.RotateMACKeyWithContext(ctx, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to rotate the MAC key", 0)
+		}
+
+		err = store.Save(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to save JSON", 0)
+		}
+
+		cmd.Printf("Exported new secrets file at: %s\n", storePath)
+		return nil
+
+	}
+
+	return cmd
+
+}
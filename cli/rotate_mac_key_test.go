@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/go-errors/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateMACKey(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := rotateMACKeyCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := rotateMACKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("with kms init error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := rotateMACKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withKMSDefaultClientError(t, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to initialize AWS client: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("with kms generate error", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := rotateMACKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{}).Return("", "", errors.New("testing errors")).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to rotate the MAC key: Unable to generate MAC key: Unable to generate data key: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("enables the mac", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := rotateMACKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+			client.On("Decrypt", testKeyCiphertext, map[string]*string{}).Return(testKmsKeyID, testKeyPlaintext, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(store.MACKey, "EJH1;"))
+			assert.NotEmpty(t, store.MAC)
+			assert.NoError(t, store.Verify(kms.NewAWSProvider(client)))
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("rotates the mac key", func(t *testing.T) {
+
+		withMACStore(t, func(storePath string, client *mock_kms.Client) {
+
+			before, err := model.Load(storePath)
+			assert.NoError(t, err)
+
+			cmd := rotateMACKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{}).Return(testKmsKeyID, testKeyPlaintext2, nil).Once()
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			after, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.NotEqual(t, after.MACKey, before.MACKey)
+			assert.NotEqual(t, after.MAC, before.MAC)
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("with modified file", func(t *testing.T) {
+
+		withMACStore(t, func(storePath string, client *mock_kms.Client) {
+
+			contents, err := ioutil.ReadFile(storePath)
+			assert.NoError(t, err)
+
+			contents = bytes.Replace(contents, []byte(`"description": ""`), []byte(`"description": "modified"`), 1)
+			assert.NoError(t, ioutil.WriteFile(storePath, contents, 0644))
+
+			cmd := rotateMACKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{}).Return(testKmsKeyID, testKeyPlaintext2, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to verify the secrets file: The file has been modified since it was last saved: Invalid MAC")
+				}
+			})
+
+		})
+
+	})
+
+}
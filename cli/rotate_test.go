@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/adrienkohlbecker/ejson-kms/kms"
 	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
 	"github.com/adrienkohlbecker/ejson-kms/model"
 	"github.com/stretchr/testify/assert"
@@ -179,7 +180,7 @@ func TestRotate(t *testing.T) {
 
 				store, err := model.Load(storePath)
 				assert.NoError(t, err)
-				items, err := store.ExportPlaintext(client)
+				items, err := store.ExportPlaintext(kms.NewAWSProvider(client))
 				assert.NoError(t, err)
 
 				item, ok := <-items
@@ -190,6 +191,12 @@ func TestRotate(t *testing.T) {
 				assert.Equal(t, item.Name, testName)
 				assert.Equal(t, item.Plaintext, "password")
 
+				secret := store.Find(testName)
+				assert.Nil(t, secret.CreatedAt)
+				assert.NotNil(t, secret.UpdatedAt)
+				assert.Equal(t, secret.UpdatedBy, testCallerARN)
+				assert.Equal(t, secret.Rotations, 1)
+
 			})
 
 		})
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docSetHistory = `
+set-history: Change the number of previous values kept for each secret.
+
+When a secret is rotated, its previous value is kept in its history, encrypted
+with its own data key, up to the given number of values per secret. The oldest
+values are removed first. Use 0 to disable the history and remove it from the
+file.
+
+See the "history" command to list the versions of a secret, "get --version" to
+print one of them and "rollback" to restore it.
+
+The secrets are not decrypted. KMS is only called when the file has a MAC, to
+verify it and compute it again.
+`
+
+const exampleSetHistory = `
+ejson-kms set-history 5
+ejson-kms set-history 10 --path=secrets.json
+ejson-kms set-history 0
+`
+
+func setHistoryCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "set-history LIMIT",
+		Short:   "keeps previous values of the secrets",
+		Long:    strings.TrimSpace(docSetHistory),
+		Example: strings.TrimSpace(exampleSetHistory),
+	}
+
+	var storePath = ".secrets.json"
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		rawLimit, err := utils.HasOneArgument(args)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid history limit", 0)
+		}
+
+		limit, err := utils.ValidHistoryLimit(rawLimit)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid history limit", 0)
+		}
+
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		err = kmsOpts.verifyMAC(store)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		err = store.SetHistoryLimit(limit)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to change the history limit", 0)
+		}
+
+		err = store.Save(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to save JSON", 0)
+		}
+
+		cmd.Printf("Exported new secrets file at: %s\n", storePath)
+		return nil
+
+	}
+
+	return cmd
+
+}
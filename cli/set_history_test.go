@@ -0,0 +1,175 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/go-errors/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetHistory(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := setHistoryCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("no argument", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := setHistoryCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid history limit: No argument provided")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid limit", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := setHistoryCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--", "-1"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid history limit: Invalid history limit -1, expected a positive number")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := setHistoryCmd()
+			cmd.SetArgs([]string{"--path", storePath, "5"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := setHistoryCmd()
+			cmd.SetArgs([]string{"--path", storePath, "5"})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			withKMSDefaultClientError(t, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+			assert.Equal(t, out.String(), fmt.Sprintf("Exported new secrets file at: %s\n", storePath))
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.HistoryLimit, 5)
+
+		})
+
+	})
+
+	t.Run("disabling", func(t *testing.T) {
+
+		withTempStore(t, testDataWithHistory, func(storePath string) {
+
+			cmd := setHistoryCmd()
+			cmd.SetArgs([]string{"--path", storePath, "0"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			assert.NoError(t, err)
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.HistoryLimit, 0)
+			assert.Len(t, store.Find(testName).History, 0)
+
+		})
+
+	})
+
+	t.Run("with mac", func(t *testing.T) {
+
+		withMACStore(t, func(storePath string, client *mock_kms.Client) {
+
+			cmd := setHistoryCmd()
+			cmd.SetArgs([]string{"--path", storePath, "3"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{}).Return(testKmsKeyID, testKeyPlaintext2, nil).Twice()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.HistoryLimit, 3)
+			assert.NoError(t, store.Verify(kms.NewAWSProvider(client)))
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("with mac and kms error", func(t *testing.T) {
+
+		withMACStore(t, func(storePath string, client *mock_kms.Client) {
+
+			cmd := setHistoryCmd()
+			cmd.SetArgs([]string{"--path", storePath, "3"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{}).Return("", "", errors.New("testing errors")).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), "Unable to verify the secrets file: Unable to decrypt MAC key")
+				}
+			})
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.HistoryLimit, 0)
+
+		})
+
+	})
+
+}
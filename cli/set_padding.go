@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/crypto"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docSetPadding = `
+set-padding: Change the padding of the secrets in a secrets file.
+
+Without padding, the length of the encrypted secrets reveals the length of
+their plaintext: a 4 digit PIN is easy to tell apart from a 2048 bits key.
+Padding adds bytes to each plaintext before encryption, up to the size of its
+bucket, and is removed transparently on decryption.
+
+Three schemes are available:
+
+  * none:     secrets are not padded (the default)
+  * pow2:     secrets are padded to the next power of two, from 16 bytes
+  * block256: secrets are padded to the next multiple of 256 bytes
+
+This command decrypts all your secrets, and re-encrypts them with the given
+padding. New secrets added to the file use the same padding.
+The original file will be overwritten.
+
+Note that older versions of ejson-kms cannot decrypt padded secrets.
+`
+
+const exampleSetPadding = `
+ejson-kms set-padding pow2
+ejson-kms set-padding block256 --path=secrets.json
+ejson-kms set-padding none
+`
+
+func setPaddingCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "set-padding PADDING",
+		Short:   "pads the secrets to hide their length",
+		Long:    strings.TrimSpace(docSetPadding),
+		Example: strings.TrimSpace(exampleSetPadding),
+	}
+
+	var storePath = ".secrets.json"
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		rawPadding, err := utils.HasOneArgument(args)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid padding", 0)
+		}
+
+		padding, err := crypto.ParsePadding(rawPadding)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid padding", 0)
+		}
+
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+		}
+
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = kmsOpts.verifyStore(ctx, store, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		err = store.SetPaddingWithContext(ctx, provider, padding)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to change the padding", 0)
+		}
+
+		err = store.Save(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to save JSON", 0)
+		}
+
+		cmd.Printf("Exported new secrets file at: %s\n", storePath)
+		return nil
+
+	}
+
+	return cmd
+}
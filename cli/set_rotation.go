@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docSetRotation = `
+set-rotation: Set how often a secret must be rotated.
+
+The period is a number of hours, days or weeks, such as 12h, 90d or 2w. Once a
+secret has not been rotated for that long, it is reported by the stale
+command. Use none to remove the policy of a secret.
+
+The secret itself is not decrypted. KMS is only called when the file has a MAC,
+to verify it and compute it again.
+`
+
+const exampleSetRotation = `
+ejson-kms set-rotation password 90d
+ejson-kms set-rotation api_key 2w --path="secrets.json"
+ejson-kms set-rotation password none
+`
+
+func setRotationCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "set-rotation NAME PERIOD",
+		Short:   "sets how often a secret must be rotated",
+		Long:    strings.TrimSpace(docSetRotation),
+		Example: strings.TrimSpace(exampleSetRotation),
+	}
+
+	var storePath = ".secrets.json"
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		name, rawPeriod, err := utils.HasTwoArguments(args)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid arguments", 0)
+		}
+
+		err = utils.ValidName(name)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid name", 0)
+		}
+
+		period, err := validRotationPeriod(rawPeriod)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid rotation policy", 0)
+		}
+
+		lock, err := model.Lock(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to lock the secrets file", 0)
+		}
+		defer lock.Unlock() // nolint: errcheck
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		if !store.Contains(name) {
+			return errors.Errorf("No secret with the given name has been found")
+		}
+
+		err = kmsOpts.verifyMAC(store)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		err = store.SetRotationPolicy(name, period)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to set the rotation policy", 0)
+		}
+
+		err = store.Save(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to save JSON", 0)
+		}
+
+		cmd.Printf("Exported new secrets file at: %s\n", storePath)
+		return nil
+
+	}
+
+	return cmd
+
+}
+
+// validRotationPeriod parses the CLI form of a rotation policy: a number of
+// hours, days or weeks such as "90d", or "none" which is returned as an empty
+// policy.
+func validRotationPeriod(period string) (string, error) {
+
+	if period == "none" {
+		return "", nil
+	}
+
+	_, err := model.ParseRotationPeriod(period)
+	if err != nil {
+		return "", err
+	}
+
+	return period, nil
+
+}
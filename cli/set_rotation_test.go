@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/go-errors/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetRotation(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := setRotationCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("one argument", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := setRotationCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid arguments: Expected two arguments, got 1")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := setRotationCmd()
+			cmd.SetArgs([]string{"--path", storePath, "123_ABC", "90d"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid name: Invalid format for name: must be lowercase, can contain letters, digits and underscores, and cannot start with a number.")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid period", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := setRotationCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "3m"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid rotation policy: Invalid rotation period 3m, expected a number of hours, days or weeks such as 90d")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := setRotationCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "90d"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("unknown name", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := setRotationCmd()
+			cmd.SetArgs([]string{"--path", storePath, "other", "90d"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "No secret with the given name has been found")
+			}
+
+		})
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := setRotationCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "90d"})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			withKMSDefaultClientError(t, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+			assert.Equal(t, out.String(), fmt.Sprintf("Exported new secrets file at: %s\n", storePath))
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.Find(testName).RotateEvery, "90d")
+
+		})
+
+	})
+
+	t.Run("removing the policy", func(t *testing.T) {
+
+		withTempStore(t, testDataWithMetadata, func(storePath string) {
+
+			cmd := setRotationCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "none"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			assert.NoError(t, err)
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.Find(testName).RotateEvery, "")
+
+		})
+
+	})
+
+	t.Run("with mac", func(t *testing.T) {
+
+		withMACStore(t, func(storePath string, client *mock_kms.Client) {
+
+			cmd := setRotationCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "2w"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{}).Return(testKmsKeyID, testKeyPlaintext2, nil).Twice()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.Find(testName).RotateEvery, "2w")
+			assert.NoError(t, store.Verify(kms.NewAWSProvider(client)))
+
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("with mac and kms error", func(t *testing.T) {
+
+		withMACStore(t, func(storePath string, client *mock_kms.Client) {
+
+			cmd := setRotationCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName, "2w"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{}).Return("", "", errors.New("testing errors")).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), "Unable to verify the secrets file: Unable to decrypt MAC key")
+				}
+			})
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.Equal(t, store.Find(testName).RotateEvery, "")
+
+		})
+
+	})
+
+}
+
+func TestValidRotationPeriod(t *testing.T) {
+
+	valid := map[string]string{
+		"none": "",
+		"90d":  "90d",
+		"12h":  "12h",
+		"2w":   "2w",
+	}
+
+	for value, expected := range valid {
+
+		t.Run(fmt.Sprintf("valid %s", value), func(t *testing.T) {
+
+			ret, err := validRotationPeriod(value)
+			assert.NoError(t, err)
+			assert.Equal(t, ret, expected)
+
+		})
+
+	}
+
+	for _, value := range []string{"", "90", "0d", "3m"} {
+
+		t.Run(fmt.Sprintf("invalid %q", value), func(t *testing.T) {
+
+			_, err := validRotationPeriod(value)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "Invalid rotation period")
+			}
+
+		})
+
+	}
+
+}
@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docStale = `
+stale: List the secrets that are overdue for rotation.
+
+A secret is overdue once it has not been added or rotated for longer than its
+rotation policy, set with "add --rotate-every" or the "set-rotation" command.
+Secrets without a policy are never reported. Secrets added by older versions of
+ejson-kms have no metadata: they are reported as soon as they have a policy.
+
+The command exits with a status code of 1 when at least one secret is overdue,
+so that it can be used to fail a CI job or alert from a cron job.
+
+Secrets are not decrypted, and KMS is never called: no AWS credentials are
+needed to use this command.
+
+Two formats are available:
+
+  * table: human-readable output
+  * json:  machine-readable output
+`
+
+const exampleStale = `
+ejson-kms stale
+ejson-kms stale --format=json
+ejson-kms stale --path=secrets.json || notify-team
+`
+
+// staleOutput is the JSON representation of the stale command output
+type staleOutput struct {
+	Secrets []staleSecret `json:"secrets"`
+}
+
+type staleSecret struct {
+	Name        string     `json:"name"`
+	RotateEvery string     `json:"rotate_every"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+	DueAt       *time.Time `json:"due_at"`
+}
+
+func staleCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "stale",
+		Short:   "list the secrets overdue for rotation",
+		Long:    strings.TrimSpace(docStale),
+		Example: strings.TrimSpace(exampleStale),
+	}
+
+	var (
+		storePath = ".secrets.json"
+		format    = "table"
+	)
+
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+	cmd.Flags().StringVar(&format, "format", format, "format of the generated output (table|json)")
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		if format != "table" && format != "json" {
+			return errors.Errorf("Invalid formatter: Unknown format %s", format)
+		}
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		stale, err := store.Stale(time.Now())
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to list stale secrets", 0)
+		}
+
+		output, err := newStaleOutput(stale)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to list stale secrets", 0)
+		}
+
+		if format == "json" {
+			err = staleJSON(cmd.OutOrStdout(), output)
+		} else {
+			err = staleTable(cmd.OutOrStdout(), output)
+		}
+
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to write to output", 0)
+		}
+
+		if len(output.Secrets) > 0 {
+			// the output already lists the overdue secrets
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+			return &ExitError{Code: 1}
+		}
+
+		return nil
+
+	}
+
+	return cmd
+
+}
+
+func newStaleOutput(stale []*model.Secret) (staleOutput, error) {
+
+	output := staleOutput{
+		Secrets: make([]staleSecret, 0, len(stale)),
+	}
+
+	for _, item := range stale {
+
+		next, _, err := item.NextRotation()
+		if err != nil {
+			// Note: not covered by tests as Stale already validated the policy
+			return output, err
+		}
+
+		var dueAt *time.Time
+		if item.UpdatedAt != nil {
+			dueAt = &next
+		}
+
+		output.Secrets = append(output.Secrets, staleSecret{
+			Name:        item.Name,
+			RotateEvery: item.RotateEvery,
+			UpdatedAt:   item.UpdatedAt,
+			DueAt:       dueAt,
+		})
+
+	}
+
+	return output, nil
+
+}
+
+func staleJSON(w io.Writer, output staleOutput) error {
+
+	b, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		// Note: not covered by tests as no error can be hit with the current schema
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+
+}
+
+func staleTable(w io.Writer, output staleOutput) error {
+
+	if len(output.Secrets) == 0 {
+		_, err := fmt.Fprintln(w, "No secret is overdue for rotation")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "NAME\tROTATE EVERY\tUPDATED\tDUE")
+	for _, item := range output.Secrets {
+		updatedAt, dueAt := "", ""
+		if item.UpdatedAt != nil {
+			updatedAt = item.UpdatedAt.Format("2006-01-02")
+		}
+		if item.DueAt != nil {
+			dueAt = item.DueAt.Format("2006-01-02")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", item.Name, item.RotateEvery, orDash(updatedAt), orDash(dueAt))
+	}
+
+	return tw.Flush()
+
+}
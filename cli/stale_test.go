@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStale(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := staleCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := staleCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--format=yaml"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid formatter: Unknown format yaml")
+			}
+
+		})
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := staleCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			store.Find(testName).RotateEvery = "1y"
+			assert.NoError(t, store.Save(storePath))
+
+			cmd := staleCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err = cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Unable to list stale secrets: Invalid rotation policy for secret: Invalid rotation period 1y, expected a number of hours, days or weeks such as 90d")
+			}
+
+		})
+
+	})
+
+	t.Run("nothing overdue", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := staleCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			err := cmd.Execute()
+			assert.NoError(t, err)
+			assert.Equal(t, out.String(), "No secret is overdue for rotation\n")
+
+		})
+
+	})
+
+	t.Run("nothing overdue json", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := staleCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--format=json"})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			err := cmd.Execute()
+			assert.NoError(t, err)
+			assert.Equal(t, out.String(), "{\n  \"secrets\": []\n}\n")
+
+		})
+
+	})
+
+	t.Run("table", func(t *testing.T) {
+
+		withTempStore(t, testDataWithMetadata, func(storePath string) {
+
+			cmd := staleCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err, &ExitError{Code: 1})
+			}
+			assert.True(t, cmd.SilenceErrors)
+			assert.Equal(t, out.String(), `NAME    ROTATE EVERY  UPDATED     DUE
+secret  90d           2018-06-07  2018-09-05
+`)
+
+		})
+
+	})
+
+	t.Run("json", func(t *testing.T) {
+
+		withTempStore(t, testDataWithMetadata, func(storePath string) {
+
+			cmd := staleCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--format=json"})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err, &ExitError{Code: 1})
+			}
+			assert.Equal(t, out.String(), `{
+  "secrets": [
+    {
+      "name": "secret",
+      "rotate_every": "90d",
+      "updated_at": "2018-06-07T08:09:10Z",
+      "due_at": "2018-09-05T08:09:10Z"
+    }
+  ]
+}
+`)
+
+		})
+
+	})
+
+	t.Run("without metadata", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.NoError(t, store.SetRotationPolicy(testName, "90d"))
+			assert.NoError(t, store.Save(storePath))
+
+			cmd := staleCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			err = cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err, &ExitError{Code: 1})
+			}
+			assert.Equal(t, out.String(), `NAME    ROTATE EVERY  UPDATED  DUE
+secret  90d           -        -
+`)
+
+		})
+
+	})
+
+	t.Run("not yet due", func(t *testing.T) {
+
+		withTempStore(t, testDataWithMetadata, func(storePath string) {
+
+			store, err := model.Load(storePath)
+			assert.NoError(t, err)
+			assert.NoError(t, store.SetRotationPolicy(testName, "10000w"))
+			assert.NoError(t, store.Save(storePath))
+
+			cmd := staleCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			out := &bytes.Buffer{}
+			cmd.SetOutput(out)
+
+			err = cmd.Execute()
+			assert.NoError(t, err)
+			assert.Equal(t, out.String(), "No secret is overdue for rotation\n")
+
+		})
+
+	})
+
+}
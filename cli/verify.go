@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/adrienkohlbecker/ejson-kms/utils"
+)
+
+const docVerify = `
+verify: Check the MAC of a secrets file.
+
+The MAC authenticates the whole content of the file, and detects deleted
+secrets, secrets reverted to an older ciphertext, and modified settings. The
+MAC key is decrypted with KMS, but the secrets are not.
+
+The command fails if the file has been modified since it was last saved by
+ejson-kms, or if the file has no MAC. See the "rotate-mac-key" command to
+enable it.
+
+Every command calling KMS verifies the MAC of files having one. Removing both
+the MAC and its key cannot be detected from the file: use --require-mac, or
+set EJSON_KMS_REQUIRE_MAC=true, for commands to fail on files without a MAC.
+`
+
+const exampleVerify = `
+ejson-kms verify
+ejson-kms verify --path=secrets.json
+`
+
+func verifyCmd() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:     "verify",
+		Short:   "check the MAC of the file",
+		Long:    strings.TrimSpace(docVerify),
+		Example: strings.TrimSpace(exampleVerify),
+	}
+
+	var storePath = ".secrets.json"
+	cmd.Flags().StringVar(&storePath, "path", storePath, "path of the secrets file")
+
+	kmsOpts := addKMSFlags(cmd)
+
+	cmd.RunE = func(_ *cobra.Command, args []string) error {
+
+		err := utils.ValidSecretsPath(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid path", 0)
+		}
+
+		store, err := model.Load(storePath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to load JSON", 0)
+		}
+
+		policy, err := kmsOpts.retryPolicy()
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid retry policy", 0)
+		}
+
+		provider, err := defaultProvider(policy)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to initialize AWS client", 0)
+		}
+
+		ctx, stop := commandContext(kmsOpts.timeout)
+		defer stop()
+
+		err = store.VerifyWithContext(ctx, provider)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to verify the secrets file", 0)
+		}
+
+		cmd.Printf("Verified the MAC of the secrets file at: %s\n", storePath)
+		return nil
+
+	}
+
+	return cmd
+
+}
@@ -0,0 +1,290 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	mock_kms "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/adrienkohlbecker/ejson-kms/model"
+	"github.com/go-errors/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// withMACStore saves a secrets file with one credential and a MAC, and
+// returns a client able to decrypt its MAC key.
+func withMACStore(t *testing.T, f func(storePath string, client *mock_kms.Client)) {
+
+	withTempStore(t, testDataOneCredential, func(storePath string) {
+
+		client := &mock_kms.Client{}
+		client.On("GenerateDataKey", testKmsKeyID, map[string]*string{}).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+
+		store, err := model.Load(storePath)
+		assert.NoError(t, err)
+		assert.NoError(t, store.RotateMACKey(kms.NewAWSProvider(client)))
+		assert.NoError(t, store.Save(storePath))
+		client.AssertExpectations(t)
+
+		f(storePath, client)
+
+	})
+
+}
+
+func TestVerify(t *testing.T) {
+
+	t.Run("invalid path", func(t *testing.T) {
+
+		cmd := verifyCmd()
+		cmd.SetArgs([]string{"--path=does-not-exist"})
+		cmd.SetOutput(&bytes.Buffer{})
+
+		err := cmd.Execute()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid path: Unable to find secrets file at does-not-exist: stat does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		withTempStore(t, testDataInvalid, func(storePath string) {
+
+			cmd := verifyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Unable to load JSON: Unable to decode Store at %s: unexpected end of JSON input", storePath))
+			}
+
+		})
+
+	})
+
+	t.Run("with kms init error", func(t *testing.T) {
+
+		withMACStore(t, func(storePath string, _ *mock_kms.Client) {
+
+			cmd := verifyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withKMSDefaultClientError(t, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to initialize AWS client: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("without mac", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := verifyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withMockKmsClient(t, &mock_kms.Client{}, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to verify the secrets file: The file has no MAC")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("with kms decrypt error", func(t *testing.T) {
+
+		withMACStore(t, func(storePath string, client *mock_kms.Client) {
+
+			cmd := verifyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{}).Return("", "", errors.New("testing errors")).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to verify the secrets file: Unable to decrypt MAC key: Unable to decrypt data key with any master key: arn:aws:kms:eu-west-1:012345678912:alias/ejson-kms-testing: Unable to decrypt key ciphertext: testing errors")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("working", func(t *testing.T) {
+
+		withMACStore(t, func(storePath string, client *mock_kms.Client) {
+
+			out := &bytes.Buffer{}
+
+			cmd := verifyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(out)
+
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{}).Return(testKmsKeyID, testKeyPlaintext2, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+			assert.Equal(t, out.String(), fmt.Sprintf("Verified the MAC of the secrets file at: %s\n", storePath))
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("with modified file", func(t *testing.T) {
+
+		withMACStore(t, func(storePath string, client *mock_kms.Client) {
+
+			contents, err := ioutil.ReadFile(storePath)
+			assert.NoError(t, err)
+
+			contents = bytes.Replace(contents, []byte(`"description": ""`), []byte(`"description": "modified"`), 1)
+			assert.NoError(t, ioutil.WriteFile(storePath, contents, 0644))
+
+			cmd := verifyCmd()
+			cmd.SetArgs([]string{"--path", storePath})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{}).Return(testKmsKeyID, testKeyPlaintext2, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to verify the secrets file: The file has been modified since it was last saved: Invalid MAC")
+				}
+			})
+
+		})
+
+	})
+
+}
+
+func TestRequireMAC(t *testing.T) {
+
+	t.Run("flag", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := getCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--require-mac", testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			withMockKmsClient(t, &mock_kms.Client{}, func() {
+				err := cmd.Execute()
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to verify the secrets file: The file has no MAC, but one is required by --require-mac or EJSON_KMS_REQUIRE_MAC")
+				}
+			})
+
+		})
+
+	})
+
+	t.Run("environment", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			assert.NoError(t, os.Setenv("EJSON_KMS_REQUIRE_MAC", "true"))
+			defer os.Unsetenv("EJSON_KMS_REQUIRE_MAC") // nolint: errcheck
+
+			cmd := removeCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Unable to verify the secrets file: The file has no MAC, but one is required by --require-mac or EJSON_KMS_REQUIRE_MAC")
+			}
+
+			// the flag takes precedence
+			cmd = removeCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--require-mac=false", testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err = cmd.Execute()
+			assert.NoError(t, err)
+
+		})
+
+	})
+
+	t.Run("invalid environment", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			assert.NoError(t, os.Setenv("EJSON_KMS_REQUIRE_MAC", "maybe"))
+			defer os.Unsetenv("EJSON_KMS_REQUIRE_MAC") // nolint: errcheck
+
+			cmd := removeCmd()
+			cmd.SetArgs([]string{"--path", storePath, testName})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			err := cmd.Execute()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Unable to verify the secrets file: Invalid value for EJSON_KMS_REQUIRE_MAC: maybe, expected true or false")
+			}
+
+		})
+
+	})
+
+	t.Run("with a MAC", func(t *testing.T) {
+
+		withMACStore(t, func(storePath string, client *mock_kms.Client) {
+
+			cmd := verifyCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--require-mac"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client.On("Decrypt", testKeyCiphertext2, map[string]*string{}).Return(testKmsKeyID, testKeyPlaintext2, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+		})
+
+	})
+
+	t.Run("enabling the MAC", func(t *testing.T) {
+
+		withTempStore(t, testDataOneCredential, func(storePath string) {
+
+			cmd := rotateMACKeyCmd()
+			cmd.SetArgs([]string{"--path", storePath, "--require-mac"})
+			cmd.SetOutput(&bytes.Buffer{})
+
+			client := &mock_kms.Client{}
+			client.On("GenerateDataKey", testKmsKeyID, map[string]*string{}).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+
+			withMockKmsClient(t, client, func() {
+				err := cmd.Execute()
+				assert.NoError(t, err)
+			})
+
+		})
+
+	})
+
+}
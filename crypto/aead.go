@@ -0,0 +1,127 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"github.com/go-errors/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Algorithms available for the EJK2 format.
+const (
+	// AlgorithmXChaCha20Poly1305 is XChaCha20-Poly1305 with a random 192 bits
+	// nonce
+	AlgorithmXChaCha20Poly1305 = "xchacha20-poly1305"
+
+	// AlgorithmAES256GCM is AES-256-GCM with a random 96 bits nonce
+	AlgorithmAES256GCM = "aes-256-gcm"
+)
+
+// DefaultAlgorithm is the algorithm used when migrating to the EJK2 format
+// without choosing one.
+const DefaultAlgorithm = AlgorithmXChaCha20Poly1305
+
+// ValidAlgorithm returns an error if the given algorithm is not available for
+// the EJK2 format.
+func ValidAlgorithm(algorithm string) error {
+
+	switch algorithm {
+	case AlgorithmXChaCha20Poly1305, AlgorithmAES256GCM:
+		return nil
+	}
+
+	return errors.Errorf("Unknown algorithm %s, expected %s or %s", algorithm, AlgorithmXChaCha20Poly1305, AlgorithmAES256GCM)
+
+}
+
+// newAEAD returns an instance of the given algorithm using the given key.
+func newAEAD(algorithm string, key []byte) (cipher.AEAD, error) {
+
+	err := ValidAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) != keySize {
+		return nil, errors.Errorf("Expected key size of %d, got %d", keySize, len(key))
+	}
+
+	var aead cipher.AEAD
+	if algorithm == AlgorithmAES256GCM {
+		var block cipher.Block
+		block, err = aes.NewCipher(key)
+		if err == nil {
+			aead, err = cipher.NewGCM(block)
+		}
+	} else {
+		aead, err = chacha20poly1305.NewX(key)
+	}
+
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to initialize cipher", 0)
+	}
+
+	return aead, nil
+
+}
+
+// sealBytes pads a plaintext with the given scheme, encrypts it with the
+// given algorithm, and authenticates the additional data. A random nonce is
+// generated for each call. The return value is the nonce + ciphertext in a
+// single byte slice.
+func sealBytes(algorithm string, key []byte, plaintext []byte, additionalData []byte, padding string) ([]byte, error) {
+
+	aead, err := newAEAD(algorithm, key)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	plaintext, err = pad(padding, plaintext)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return []byte{}, errors.WrapPrefix(err, "Unable to generate nonce", 0)
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+
+}
+
+// openBytes decrypts a ciphertext sealed by sealBytes, and removes its
+// padding. It fails if the additional data is not the one given for
+// encryption.
+func openBytes(algorithm string, key []byte, bytes []byte, additionalData []byte, padding string) ([]byte, error) {
+
+	aead, err := newAEAD(algorithm, key)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	if len(bytes) < aead.NonceSize()+aead.Overhead() {
+		return []byte{}, errors.Errorf("Invalid ciphertext")
+	}
+
+	nonce := bytes[:aead.NonceSize()]
+
+	plaintext, err := aead.Open(nil, nonce, bytes[aead.NonceSize():], additionalData)
+	if err != nil {
+		return []byte{}, errors.Errorf("Unable to decrypt ciphertext")
+	}
+
+	return unpad(padding, plaintext)
+
+}
+
+// additionalData returns the data authenticated along with an EJK2 secret:
+// the versioning field (with the padding scheme), the algorithm, the ID of the
+// master key of the file and the name of the secret.
+func additionalData(version string, algorithm string, kmsKeyID string, name string) []byte {
+	return lengthPrefixed(version, algorithm, kmsKeyID, name)
+}
@@ -0,0 +1,108 @@
+package crypto
+
+import (
+	"testing"
+
+	crypto_mock "github.com/adrienkohlbecker/ejson-kms/crypto/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidAlgorithm(t *testing.T) {
+
+	assert.NoError(t, ValidAlgorithm(AlgorithmXChaCha20Poly1305))
+	assert.NoError(t, ValidAlgorithm(AlgorithmAES256GCM))
+
+	err := ValidAlgorithm("")
+	if assert.Error(t, err) {
+		assert.Equal(t, err.Error(), "Unknown algorithm , expected xchacha20-poly1305 or aes-256-gcm")
+	}
+
+}
+
+func TestSealBytes(t *testing.T) {
+
+	keyBytes := []byte("-abcdefabcdefabcdefabcdefabcdef-")
+
+	t.Run("working", func(t *testing.T) {
+
+		for _, algorithm := range []string{AlgorithmXChaCha20Poly1305, AlgorithmAES256GCM} {
+
+			ciphertext, err := sealBytes(algorithm, keyBytes, []byte("plaintext"), []byte("data"), PaddingNone)
+			assert.NoError(t, err)
+
+			plaintext, err := openBytes(algorithm, keyBytes, ciphertext, []byte("data"), PaddingNone)
+			assert.NoError(t, err)
+			assert.Equal(t, plaintext, []byte("plaintext"))
+
+		}
+
+	})
+
+	t.Run("incorrect key size", func(t *testing.T) {
+
+		_, err := sealBytes(AlgorithmAES256GCM, []byte("abcdef"), []byte("plaintext"), nil, PaddingNone)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Expected key size of 32, got 6")
+		}
+
+	})
+
+	t.Run("nonce error", func(t *testing.T) {
+
+		crypto_mock.WithErrorRandReader("testing error", func() {
+
+			_, err := sealBytes(AlgorithmXChaCha20Poly1305, keyBytes, []byte("plaintext"), nil, PaddingNone)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "Unable to generate nonce")
+			}
+
+		})
+
+	})
+
+}
+
+func TestOpenBytes(t *testing.T) {
+
+	keyBytes := []byte("-abcdefabcdefabcdefabcdefabcdef-")
+
+	ciphertext, err := sealBytes(AlgorithmAES256GCM, keyBytes, []byte("a longer plaintext"), []byte("data"), PaddingNone)
+	assert.NoError(t, err)
+
+	t.Run("other additional data", func(t *testing.T) {
+
+		_, err := openBytes(AlgorithmAES256GCM, keyBytes, ciphertext, []byte("other"), PaddingNone)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt ciphertext")
+		}
+
+	})
+
+	t.Run("other algorithm", func(t *testing.T) {
+
+		_, err := openBytes(AlgorithmXChaCha20Poly1305, keyBytes, ciphertext, []byte("data"), PaddingNone)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt ciphertext")
+		}
+
+	})
+
+	t.Run("too short", func(t *testing.T) {
+
+		_, err := openBytes(AlgorithmAES256GCM, keyBytes, ciphertext[:12], []byte("data"), PaddingNone)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid ciphertext")
+		}
+
+	})
+
+}
+
+func TestAdditionalData(t *testing.T) {
+
+	assert.Equal(t, additionalData("EJK2", "a", "b", "c"), []byte("\x00\x00\x00\x04EJK2\x00\x00\x00\x01a\x00\x00\x00\x01b\x00\x00\x00\x01c"))
+
+	// values are not simply concatenated
+	assert.NotEqual(t, additionalData(AEADMagicPrefix, AlgorithmAES256GCM, "key", "ab"), additionalData(AEADMagicPrefix, AlgorithmAES256GCM, "keya", "b"))
+
+}
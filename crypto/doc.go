@@ -1,7 +1,8 @@
 // Package crypto implements cryptography for secrets.
 //
-// Under the hood, it leverages AWS KMS for master key management and key wrapping,
-// and nacl/secretbox for encryption and authentication.
+// Under the hood, it leverages a kms.KeyProvider (AWS KMS by default) for master
+// key management and key wrapping, and nacl/secretbox for encryption and
+// authentication.
 //
 // Secret encryption
 //
@@ -35,4 +36,65 @@
 //    ^-- versionning field allowing algorithm changes in the future
 //          ^-- base64 encoded encrypted data key
 //                    ^-- base64 encoded [random nonce, encrypted secret]
+//
+// Multiple master keys
+//
+// When a Cipher has additional master keys, the data key generated by the
+// first master key is also wrapped by each of the others, and the secret is
+// encoded with every wrapped data key and the ID of its master key:
+//
+//   "EJM1;a2V5MQ==:abcdef...,a2V5Mg==:ghijkl...;foobar..."
+//         ^-- base64 encoded master key ID
+//                  ^-- base64 encoded encrypted data key
+//
+// Decryption tries each wrapped data key in order, skipping master keys that
+// are not part of the Cipher, until one succeeds.
+//
+// EJK2 format
+//
+// When the Cipher has an Algorithm, secrets are encrypted with it instead of
+// nacl/secretbox, and the algorithm is recorded in the ciphertext:
+//
+//   "EJK2;xchacha20-poly1305;a2V5MQ==:abcdef...;foobar..."
+//         ^-- algorithm, xchacha20-poly1305 or aes-256-gcm
+//                            ^-- master key IDs and encrypted data keys
+//                                             ^-- base64 encoded [random nonce, encrypted secret]
+//
+// The format version, the algorithm, the master key ID of the Cipher and the
+// name of the secret given to EncryptSecret are authenticated as additional
+// data, and must be the same for DecryptSecret to succeed.
+//
+// Padding
+//
+// When the Cipher has a Padding, plaintexts are padded before encryption to
+// hide their length, and the scheme is appended to the versioning field:
+//
+//   "EJK1+pow2;abcdef...;foobar..."
+//
+// The padding is removed on decryption, whatever the Padding of the Cipher.
+// The scheme is authenticated: EJK2 secrets and file keys include it in their
+// additional data, and EJK1 and EJM1 secrets are sealed with a key derived
+// from the data key and the scheme.
+//
+// File key
+//
+// A FileKey is a single data key shared by all the secrets of a file. It is
+// generated by GenerateFileKey and encoded with every wrapped data key:
+//
+//   "EJF1;a2V5MQ==:abcdef...,a2V5Mg==:ghijkl..."
+//
+// Secrets are then sealed with XChaCha20-Poly1305, with the name of the secret
+// as additional data:
+//
+//   "EJS1;foobar..."
+//         ^-- base64 encoded [random nonce, encrypted secret]
+//
+// MAC key
+//
+// A MACKey authenticates the whole content of a secrets file with
+// HMAC-SHA256. It is generated by GenerateMACKey and encoded like a file key:
+//
+//   "EJH1;a2V5MQ==:abcdef..."
+//
+// Sum returns the base64 encoded MAC of the given data, and Verify checks it.
 package crypto
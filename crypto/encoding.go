@@ -12,42 +12,225 @@ import (
 // It will allow versioning the algorithm in the future.
 const MagicPrefix = "EJK1"
 
+// MultiKeyMagicPrefix is prepended to ciphertexts whose data key is wrapped by
+// several master keys.
+const MultiKeyMagicPrefix = "EJM1"
+
+// AEADMagicPrefix is prepended to ciphertexts encrypted with an explicit
+// algorithm, which authenticate the name of the secret and the master key of
+// the file as additional data.
+const AEADMagicPrefix = "EJK2"
+
 // encrypted is a struct representation of a encrypted secret.
 // It contains the ciphertext of both the secret and the data key.
+//
+// When the data key is wrapped by several master keys, wrappedKeys holds each
+// wrapping and keyCiphertext is empty. The algorithm is only set for the EJK2
+// format, which always uses wrappedKeys. The padding scheme of the plaintext,
+// if any, is appended to the versioning field of every format.
 type encrypted struct {
+	algorithm     string
+	padding       string
 	ciphertext    []byte
 	keyCiphertext []byte
+	wrappedKeys   []wrappedKey
+}
+
+// wrappedKey is a data key wrapped by the master key with the given ID.
+type wrappedKey struct {
+	keyID         string
+	keyCiphertext []byte
 }
 
 // encode takes a raw message and encodes it for the JSON representation.
 // The format is:
 //
 //   magicPrefix + ";" + base64(keyCiphertext) + ";" + base64(ciphertext)
+//
+// or, with several master keys:
+//
+//   multiKeyMagicPrefix + ";" + base64(keyID1) + ":" + base64(keyCiphertext1) + "," + ... + ";" + base64(ciphertext)
+//
+// or, with an algorithm:
+//
+//   aeadMagicPrefix + ";" + algorithm + ";" + base64(keyID1) + ":" + base64(keyCiphertext1) + "," + ... + ";" + base64(ciphertext)
+//
+// With a padding scheme, it is appended to the prefix, such as "EJK1+pow2".
 func (encoded *encrypted) encode() string {
-	return fmt.Sprintf("%s;%s;%s", MagicPrefix, base64.StdEncoding.EncodeToString(encoded.keyCiphertext), base64.StdEncoding.EncodeToString(encoded.ciphertext))
+
+	if encoded.algorithm != "" {
+		return fmt.Sprintf("%s;%s;%s;%s", versionField(AEADMagicPrefix, encoded.padding), encoded.algorithm, encodeWrappedKeys(encoded.wrappedKeys), base64.StdEncoding.EncodeToString(encoded.ciphertext))
+	}
+
+	if len(encoded.wrappedKeys) == 0 {
+		return fmt.Sprintf("%s;%s;%s", versionField(MagicPrefix, encoded.padding), base64.StdEncoding.EncodeToString(encoded.keyCiphertext), base64.StdEncoding.EncodeToString(encoded.ciphertext))
+	}
+
+	return fmt.Sprintf("%s;%s;%s", versionField(MultiKeyMagicPrefix, encoded.padding), encodeWrappedKeys(encoded.wrappedKeys), base64.StdEncoding.EncodeToString(encoded.ciphertext))
+
+}
+
+// encodeWrappedKeys encodes a list of key IDs and data key ciphertexts, as
+// used by the multi-key format.
+func encodeWrappedKeys(wrappedKeys []wrappedKey) string {
+
+	keys := make([]string, len(wrappedKeys))
+	for i, key := range wrappedKeys {
+		keys[i] = fmt.Sprintf("%s:%s", base64.StdEncoding.EncodeToString([]byte(key.keyID)), base64.StdEncoding.EncodeToString(key.keyCiphertext))
+	}
+
+	return strings.Join(keys, ",")
+
 }
 
 // decode takes a string from the JSON representation and decodes the
-// ciphertext and keyCiphertext, while validating the format.
+// ciphertext and keyCiphertext, while validating the format. The format is
+// selected by the versioning field.
 func decode(encoded string) (*encrypted, error) {
+
 	values := strings.Split(encoded, ";")
-	if len(values) != 3 {
+	version, padding := splitVersionField(values[0])
+
+	var (
+		decoded *encrypted
+		err     error
+	)
+
+	switch version {
+	case MagicPrefix:
+		decoded, err = decodeSingleKey(encoded, values)
+	case MultiKeyMagicPrefix:
+		decoded, err = decodeMultiKey(encoded, values)
+	case AEADMagicPrefix:
+		decoded, err = decodeAEAD(encoded, values)
+	default:
 		return &encrypted{}, errors.Errorf("Invalid format for encoded string %s", encoded)
 	}
 
-	if values[0] != MagicPrefix {
+	if err != nil {
+		return &encrypted{}, err
+	}
+
+	err = ValidPadding(padding)
+	if err != nil {
+		return &encrypted{}, err
+	}
+
+	decoded.padding = padding
+	return decoded, nil
+
+}
+
+// decodeSingleKey decodes the EJK1 format.
+func decodeSingleKey(encoded string, values []string) (*encrypted, error) {
+
+	if len(values) != 3 {
 		return &encrypted{}, errors.Errorf("Invalid format for encoded string %s", encoded)
 	}
 
+	ciphertext, err := base64.StdEncoding.DecodeString(values[2])
+	if err != nil {
+		return &encrypted{}, errors.WrapPrefix(err, "Unable to base64 decode ciphertext", 0)
+	}
+
 	keyCiphertext, err := base64.StdEncoding.DecodeString(values[1])
 	if err != nil {
 		return &encrypted{}, errors.WrapPrefix(err, "Unable to base64 decode keyCiphertext", 0)
 	}
 
+	return &encrypted{keyCiphertext: keyCiphertext, ciphertext: ciphertext}, nil
+
+}
+
+// decodeMultiKey decodes the EJM1 format.
+func decodeMultiKey(encoded string, values []string) (*encrypted, error) {
+
+	if len(values) != 3 {
+		return &encrypted{}, errors.Errorf("Invalid format for encoded string %s", encoded)
+	}
+
 	ciphertext, err := base64.StdEncoding.DecodeString(values[2])
 	if err != nil {
 		return &encrypted{}, errors.WrapPrefix(err, "Unable to base64 decode ciphertext", 0)
 	}
 
-	return &encrypted{keyCiphertext: keyCiphertext, ciphertext: ciphertext}, nil
+	wrappedKeys, err := decodeWrappedKeys(values[1])
+	if err != nil {
+		return &encrypted{}, err
+	}
+
+	return &encrypted{wrappedKeys: wrappedKeys, ciphertext: ciphertext}, nil
+
+}
+
+// decodeAEAD decodes the EJK2 format.
+func decodeAEAD(encoded string, values []string) (*encrypted, error) {
+
+	if len(values) != 4 {
+		return &encrypted{}, errors.Errorf("Invalid format for encoded string %s", encoded)
+	}
+
+	err := ValidAlgorithm(values[1])
+	if err != nil {
+		return &encrypted{}, err
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(values[3])
+	if err != nil {
+		return &encrypted{}, errors.WrapPrefix(err, "Unable to base64 decode ciphertext", 0)
+	}
+
+	wrappedKeys, err := decodeWrappedKeys(values[2])
+	if err != nil {
+		return &encrypted{}, err
+	}
+
+	return &encrypted{algorithm: values[1], wrappedKeys: wrappedKeys, ciphertext: ciphertext}, nil
+
+}
+
+// decodeWrappedKeys decodes the list of key IDs and data key ciphertexts of
+// the multi-key format.
+func decodeWrappedKeys(encoded string) ([]wrappedKey, error) {
+
+	wrappedKeys := make([]wrappedKey, 0)
+
+	for _, value := range strings.Split(encoded, ",") {
+
+		parts := strings.Split(value, ":")
+		if len(parts) != 2 {
+			return nil, errors.Errorf("Invalid format for wrapped key %s", value)
+		}
+
+		keyID, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "Unable to base64 decode keyID", 0)
+		}
+
+		keyCiphertext, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "Unable to base64 decode keyCiphertext", 0)
+		}
+
+		wrappedKeys = append(wrappedKeys, wrappedKey{keyID: string(keyID), keyCiphertext: keyCiphertext})
+
+	}
+
+	return wrappedKeys, nil
+
+}
+
+// FormatVersion returns the version of an encoded ciphertext, such as "EJK1",
+// without decrypting it. The padding scheme is not included. An error is
+// returned for unknown formats.
+func FormatVersion(encoded string) (string, error) {
+
+	version, _ := splitVersionField(strings.SplitN(encoded, ";", 2)[0])
+	switch version {
+	case MagicPrefix, MultiKeyMagicPrefix, AEADMagicPrefix, SealedMagicPrefix:
+		return version, nil
+	}
+
+	return "", errors.Errorf("Unknown format for encoded string")
+
 }
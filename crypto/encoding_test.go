@@ -8,10 +8,25 @@ import (
 
 func TestEncode(t *testing.T) {
 
-	encrypted := &encrypted{keyCiphertext: []byte("keyCiphertext"), ciphertext: []byte("ciphertext")}
-	out := encrypted.encode()
+	single := &encrypted{keyCiphertext: []byte("keyCiphertext"), ciphertext: []byte("ciphertext")}
+	out := single.encode()
 	assert.Equal(t, out, "EJK1;a2V5Q2lwaGVydGV4dA==;Y2lwaGVydGV4dA==")
 
+	multiKey := &encrypted{
+		wrappedKeys: []wrappedKey{{keyID: "key1", keyCiphertext: []byte("keyCiphertext")}, {keyID: "key2", keyCiphertext: []byte("other")}},
+		ciphertext:  []byte("ciphertext"),
+	}
+	out = multiKey.encode()
+	assert.Equal(t, out, "EJM1;a2V5MQ==:a2V5Q2lwaGVydGV4dA==,a2V5Mg==:b3RoZXI=;Y2lwaGVydGV4dA==")
+
+	aead := &encrypted{
+		algorithm:   AlgorithmAES256GCM,
+		wrappedKeys: []wrappedKey{{keyID: "key1", keyCiphertext: []byte("keyCiphertext")}},
+		ciphertext:  []byte("ciphertext"),
+	}
+	out = aead.encode()
+	assert.Equal(t, out, "EJK2;aes-256-gcm;a2V5MQ==:a2V5Q2lwaGVydGV4dA==;Y2lwaGVydGV4dA==")
+
 }
 
 func TestDecode(t *testing.T) {
@@ -26,6 +41,70 @@ func TestDecode(t *testing.T) {
 
 	})
 
+	t.Run("valid multi-key", func(t *testing.T) {
+
+		input := "EJM1;a2V5MQ==:a2V5Q2lwaGVydGV4dA==,a2V5Mg==:b3RoZXI=;Y2lwaGVydGV4dA=="
+		encrypted, err := decode(input)
+		assert.NoError(t, err)
+		assert.Equal(t, encrypted.ciphertext, []byte("ciphertext"))
+		assert.Equal(t, encrypted.wrappedKeys, []wrappedKey{{keyID: "key1", keyCiphertext: []byte("keyCiphertext")}, {keyID: "key2", keyCiphertext: []byte("other")}})
+
+	})
+
+	t.Run("valid aead", func(t *testing.T) {
+
+		input := "EJK2;xchacha20-poly1305;a2V5MQ==:a2V5Q2lwaGVydGV4dA==;Y2lwaGVydGV4dA=="
+		encrypted, err := decode(input)
+		assert.NoError(t, err)
+		assert.Equal(t, encrypted.algorithm, "xchacha20-poly1305")
+		assert.Equal(t, encrypted.ciphertext, []byte("ciphertext"))
+		assert.Equal(t, encrypted.wrappedKeys, []wrappedKey{{keyID: "key1", keyCiphertext: []byte("keyCiphertext")}})
+
+	})
+
+	t.Run("invalid aead", func(t *testing.T) {
+
+		_, err := decode("EJK2;a2V5MQ==:a2V5Q2lwaGVydGV4dA==;Y2lwaGVydGV4dA==")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Invalid format for encoded string")
+		}
+
+		_, err = decode("EJK2;rot13;a2V5MQ==:a2V5Q2lwaGVydGV4dA==;Y2lwaGVydGV4dA==")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unknown algorithm rot13, expected xchacha20-poly1305 or aes-256-gcm")
+		}
+
+		_, err = decode("EJK2;aes-256-gcm;a2V5MQ==;Y2lwaGVydGV4dA==")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Invalid format for wrapped key")
+		}
+
+		_, err = decode("EJK2;aes-256-gcm;a2V5MQ==:a2V5Q2lwaGVydGV4dA==;@@@")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to base64 decode ciphertext")
+		}
+
+	})
+
+	t.Run("invalid multi-key", func(t *testing.T) {
+
+		_, err := decode("EJM1;a2V5MQ==;Y2lwaGVydGV4dA==")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Invalid format for wrapped key")
+		}
+
+		_, err = decode("EJM1;@@@:a2V5Q2lwaGVydGV4dA==;Y2lwaGVydGV4dA==")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to base64 decode keyID")
+		}
+
+		_, err = decode("EJM1;a2V5MQ==:@@@;Y2lwaGVydGV4dA==")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to base64 decode keyCiphertext")
+		}
+
+	})
+
 	t.Run("invalid format", func(t *testing.T) {
 
 		_, err := decode("")
@@ -65,3 +144,32 @@ func TestDecode(t *testing.T) {
 	})
 
 }
+
+func TestFormatVersion(t *testing.T) {
+
+	t.Run("valid", func(t *testing.T) {
+
+		version, err := FormatVersion("EJK1;a2V5Q2lwaGVydGV4dA==;Y2lwaGVydGV4dA==")
+		assert.NoError(t, err)
+		assert.Equal(t, version, "EJK1")
+
+		version, err = FormatVersion("EJM1;a2V5MQ==:a2V5Q2lwaGVydGV4dA==;Y2lwaGVydGV4dA==")
+		assert.NoError(t, err)
+		assert.Equal(t, version, "EJM1")
+
+		version, err = FormatVersion("EJK2;aes-256-gcm;a2V5MQ==:a2V5Q2lwaGVydGV4dA==;Y2lwaGVydGV4dA==")
+		assert.NoError(t, err)
+		assert.Equal(t, version, "EJK2")
+
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+
+		_, err := FormatVersion("abc;def;ghi")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unknown format for encoded string")
+		}
+
+	})
+
+}
@@ -0,0 +1,184 @@
+package crypto
+
+import (
+	"context"
+	"crypto/cipher"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+// FileKeyMagicPrefix is prepended to the encoded data key shared by all the
+// secrets of a file, see FileKey.
+const FileKeyMagicPrefix = "EJF1"
+
+// SealedMagicPrefix is prepended to ciphertexts sealed with a FileKey.
+const SealedMagicPrefix = "EJS1"
+
+// FileKey is a data key shared by all the secrets of a file, so that a single
+// call to the key provider is needed to decrypt all of them.
+//
+// Secrets are sealed with XChaCha20-Poly1305 and a random 192 bits nonce. The
+// name of the secret is authenticated as additional data, so that a
+// ciphertext cannot be swapped with the one of another secret.
+type FileKey struct {
+	// _hidden is a dummy hidden key to force the use of explicit keys when
+	// initializing the struct. Allows adding keys in the future without
+	// breaking code
+	_hidden struct{}
+
+	// Padding is the scheme used by Seal to pad plaintexts, see Cipher.Padding
+	Padding string
+
+	aead cipher.AEAD
+}
+
+// GenerateFileKey generates a new data key to be shared by all the secrets of
+// a file. It returns the key, and its encoded form wrapped by each master key
+// of the Cipher, to be stored in the file.
+//
+// The encryption context is used for the wrapping of the data key: it must
+// be given as is to DecryptFileKey.
+func (c *Cipher) GenerateFileKey(encryptionContext map[string]*string) (*FileKey, string, error) {
+	return c.GenerateFileKeyWithContext(context.Background(), encryptionContext)
+}
+
+// GenerateFileKeyWithContext is the same as GenerateFileKey, with the ability
+// to cancel the calls to the key provider or set a deadline with the given
+// context.
+func (c *Cipher) GenerateFileKeyWithContext(ctx context.Context, encryptionContext map[string]*string) (*FileKey, string, error) {
+
+	key, wrappedKeys, err := c.generateDataKey(ctx, encryptionContext)
+	if err != nil {
+		return nil, "", err
+	}
+
+	fileKey, err := newFileKey(key.Plaintext)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return fileKey, fmt.Sprintf("%s;%s", FileKeyMagicPrefix, encodeWrappedKeys(wrappedKeys)), nil
+
+}
+
+// DecryptFileKey unwraps an encoded file key with any master key of the
+// Cipher.
+func (c *Cipher) DecryptFileKey(encoded string, encryptionContext map[string]*string) (*FileKey, error) {
+	return c.DecryptFileKeyWithContext(context.Background(), encoded, encryptionContext)
+}
+
+// DecryptFileKeyWithContext is the same as DecryptFileKey, with the ability to
+// cancel the calls to the key provider or set a deadline with the given
+// context.
+func (c *Cipher) DecryptFileKeyWithContext(ctx context.Context, encoded string, encryptionContext map[string]*string) (*FileKey, error) {
+
+	values := strings.Split(encoded, ";")
+	if len(values) != 2 || values[0] != FileKeyMagicPrefix {
+		return nil, errors.Errorf("Invalid format for encoded file key %s", encoded)
+	}
+
+	wrappedKeys, err := decodeWrappedKeys(values[1])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := c.decryptDataKey(ctx, &encrypted{wrappedKeys: wrappedKeys}, encryptionContext)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFileKey(key.Plaintext)
+
+}
+
+// newFileKey returns a FileKey using the given data key.
+func newFileKey(key []byte) (*FileKey, error) {
+
+	aead, err := newAEAD(AlgorithmXChaCha20Poly1305, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileKey{aead: aead}, nil
+
+}
+
+// Seal encrypts the plaintext of the secret with the given name, and returns
+// the encoded ciphertext. The format is:
+//
+//   SealedMagicPrefix + ";" + base64(nonce + ciphertext)
+//
+// With a padding scheme, it is appended to the prefix, such as "EJS1+pow2",
+// and authenticated along with the name.
+func (k *FileKey) Seal(plaintext string, name string) (string, error) {
+
+	padded, err := pad(k.Padding, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := randomNonce()
+	if err != nil {
+		return "", err
+	}
+
+	version := versionField(SealedMagicPrefix, k.Padding)
+	ciphertext := k.aead.Seal(nonce[:], nonce[:], padded, sealedAdditionalData(version, k.Padding, name))
+
+	return fmt.Sprintf("%s;%s", version, base64.StdEncoding.EncodeToString(ciphertext)), nil
+
+}
+
+// Open decrypts the encoded ciphertext of the secret with the given name, and
+// removes its padding. It fails if the ciphertext was sealed for another
+// secret.
+func (k *FileKey) Open(encoded string, name string) (string, error) {
+
+	values := strings.Split(encoded, ";")
+	version, padding := splitVersionField(values[0])
+	if len(values) != 2 || version != SealedMagicPrefix {
+		return "", errors.Errorf("Invalid format for encoded string %s", encoded)
+	}
+
+	err := ValidPadding(padding)
+	if err != nil {
+		return "", err
+	}
+
+	bytes, err := base64.StdEncoding.DecodeString(values[1])
+	if err != nil {
+		return "", errors.WrapPrefix(err, "Unable to base64 decode ciphertext", 0)
+	}
+
+	if len(bytes) < nonceSize {
+		return "", errors.Errorf("Invalid ciphertext")
+	}
+
+	plaintext, err := k.aead.Open(nil, bytes[:nonceSize], bytes[nonceSize:], sealedAdditionalData(values[0], padding, name))
+	if err != nil {
+		return "", errors.Errorf("Unable to decrypt ciphertext")
+	}
+
+	plaintext, err = unpad(padding, plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+
+}
+
+// sealedAdditionalData returns the data authenticated along with a secret
+// sealed by a FileKey: its name, and the versioning field when padded.
+func sealedAdditionalData(version string, padding string, name string) []byte {
+
+	if padding == PaddingNone {
+		return []byte(name)
+	}
+
+	return lengthPrefixed(version, name)
+
+}
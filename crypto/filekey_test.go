@@ -0,0 +1,262 @@
+package crypto
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	crypto_mock "github.com/adrienkohlbecker/ejson-kms/crypto/mock"
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	kms_mock "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testFileKey = "EJF1;bXkta2V5LWlk:Y2lwaGVydGV4dGJsb2I="
+	testSealed  = "EJS1;YWJjZGVmYWJjZGVmYWJjZGVmYWJjZGVm2p5TzBzrQe8uYwYPhsy8hTTJF6o2Bg=="
+)
+
+func TestFileKeyDummy(t *testing.T) {
+	_ = FileKey{_hidden: struct{}{}}
+}
+
+func TestGenerateFileKey(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+		key, encoded, err := cipher.GenerateFileKey(testContext)
+		if assert.NoError(t, err) {
+			assert.Equal(t, encoded, testFileKey)
+			assert.NotNil(t, key)
+		}
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("with additional keys", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+		client.On("Encrypt", testKeyID2, testKeyPlaintext, testContext).Return("otherciphertextblob", nil).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID, testKeyID2)
+		_, encoded, err := cipher.GenerateFileKey(testContext)
+		if assert.NoError(t, err) {
+			assert.Equal(t, encoded, testFileKey+",bXktb3RoZXIta2V5:b3RoZXJjaXBoZXJ0ZXh0YmxvYg==")
+		}
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("with aws error", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return("", "", errors.New("testing errors")).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+		_, _, err := cipher.GenerateFileKey(testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to generate data key: testing errors")
+		}
+
+	})
+
+}
+
+func TestDecryptFileKey(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+		key, err := cipher.DecryptFileKey(testFileKey, testContext)
+		if assert.NoError(t, err) {
+			plaintext, err := key.Open(testSealed, "secret")
+			assert.NoError(t, err)
+			assert.Equal(t, plaintext, testPlaintext)
+		}
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+
+		cipher := NewCipher(kms.NewAWSProvider(&kms_mock.Client{}), testKeyID)
+
+		_, err := cipher.DecryptFileKey(testCiphertext, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid format for encoded file key "+testCiphertext)
+		}
+
+		_, err = cipher.DecryptFileKey("EJF1;abc", testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid format for wrapped key abc")
+		}
+
+	})
+
+	t.Run("not wrapped by the master key", func(t *testing.T) {
+
+		cipher := NewCipher(kms.NewAWSProvider(&kms_mock.Client{}), testKeyID2)
+
+		_, err := cipher.DecryptFileKey(testFileKey, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt data key: not wrapped by any master key of this file")
+		}
+
+	})
+
+	t.Run("invalid key size", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, "notlongenough", nil).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+		_, err := cipher.DecryptFileKey(testFileKey, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Expected key size of 32, got 13")
+		}
+
+	})
+
+}
+
+func TestFileKeySeal(t *testing.T) {
+
+	key, err := newFileKey([]byte(testKeyPlaintext))
+	assert.NoError(t, err)
+
+	t.Run("constant nonce", func(t *testing.T) {
+
+		crypto_mock.WithConstRandReader(testConstantNonce, func() {
+			sealed, err := key.Seal(testPlaintext, "secret")
+			assert.NoError(t, err)
+			assert.Equal(t, sealed, testSealed)
+		})
+
+	})
+
+	t.Run("random nonce", func(t *testing.T) {
+
+		first, err := key.Seal(testPlaintext, "secret")
+		assert.NoError(t, err)
+
+		second, err := key.Seal(testPlaintext, "secret")
+		assert.NoError(t, err)
+
+		assert.NotEqual(t, first, second)
+		assert.True(t, strings.HasPrefix(first, "EJS1;"))
+
+		version, err := FormatVersion(first)
+		assert.NoError(t, err)
+		assert.Equal(t, version, SealedMagicPrefix)
+
+	})
+
+	t.Run("with rand error", func(t *testing.T) {
+
+		crypto_mock.WithErrorRandReader("testing errors", func() {
+			_, err := key.Seal(testPlaintext, "secret")
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Unable to generate nonce: testing errors")
+			}
+		})
+
+	})
+
+}
+
+func TestFileKeyOpen(t *testing.T) {
+
+	key, err := newFileKey([]byte(testKeyPlaintext))
+	assert.NoError(t, err)
+
+	t.Run("working", func(t *testing.T) {
+
+		plaintext, err := key.Open(testSealed, "secret")
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, testPlaintext)
+
+	})
+
+	t.Run("other secret name", func(t *testing.T) {
+
+		_, err := key.Open(testSealed, "other")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt ciphertext")
+		}
+
+	})
+
+	t.Run("other key", func(t *testing.T) {
+
+		other, err := newFileKey([]byte("-012345678901234567890123456789-"))
+		assert.NoError(t, err)
+
+		_, err = other.Open(testSealed, "secret")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt ciphertext")
+		}
+
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+
+		_, err := key.Open(testCiphertext, "secret")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid format for encoded string "+testCiphertext)
+		}
+
+		_, err = key.Open("EJS1;@@@", "secret")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to base64 decode ciphertext")
+		}
+
+		_, err = key.Open("EJS1;YWJj", "secret")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid ciphertext")
+		}
+
+	})
+
+}
+
+func TestFileKeyPadding(t *testing.T) {
+
+	key, err := newFileKey([]byte(testKeyPlaintext))
+	assert.NoError(t, err)
+	key.Padding = PaddingPowerOfTwo
+
+	short, err := key.Seal("1234", "secret")
+	assert.NoError(t, err)
+	long, err := key.Seal("0123456789", "secret")
+	assert.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(short, "EJS1+pow2;"))
+	assert.Equal(t, len(short), len(long))
+
+	// the padding is removed regardless of the padding of the key
+	key.Padding = PaddingNone
+
+	plaintext, err := key.Open(short, "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, "1234")
+
+	// the padding scheme is authenticated
+	_, err = key.Open(strings.Replace(short, "pow2", "block256", 1), "secret")
+	if assert.Error(t, err) {
+		assert.Equal(t, err.Error(), "Unable to decrypt ciphertext")
+	}
+
+	_, err = key.Open(strings.Replace(short, "pow2", "pow3", 1), "secret")
+	if assert.Error(t, err) {
+		assert.Equal(t, err.Error(), "Unknown padding pow3, expected pow2 or block256")
+	}
+
+}
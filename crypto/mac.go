@@ -0,0 +1,127 @@
+package crypto
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+// MACKeyMagicPrefix is prepended to the encoded key used to authenticate a
+// whole secrets file, see MACKey.
+const MACKeyMagicPrefix = "EJH1"
+
+// MACKey is a key authenticating the whole content of a secrets file with
+// HMAC-SHA256, so that deleting a secret, reverting it to an older ciphertext
+// or changing the metadata of the file can be detected.
+type MACKey struct {
+	// _hidden is a dummy hidden key to force the use of explicit keys when
+	// initializing the struct. Allows adding keys in the future without
+	// breaking code
+	_hidden struct{}
+
+	key []byte
+}
+
+// GenerateMACKey generates a new key authenticating a secrets file. It returns
+// the key, and its encoded form wrapped by each master key of the Cipher, to
+// be stored in the file.
+//
+// The encryption context is used for the wrapping of the key: it must be
+// given as is to DecryptMACKey.
+func (c *Cipher) GenerateMACKey(encryptionContext map[string]*string) (*MACKey, string, error) {
+	return c.GenerateMACKeyWithContext(context.Background(), encryptionContext)
+}
+
+// GenerateMACKeyWithContext is the same as GenerateMACKey, with the ability to
+// cancel the calls to the key provider or set a deadline with the given
+// context.
+func (c *Cipher) GenerateMACKeyWithContext(ctx context.Context, encryptionContext map[string]*string) (*MACKey, string, error) {
+
+	key, wrappedKeys, err := c.generateDataKey(ctx, encryptionContext)
+	if err != nil {
+		return nil, "", err
+	}
+
+	macKey, err := newMACKey(key.Plaintext)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return macKey, fmt.Sprintf("%s;%s", MACKeyMagicPrefix, encodeWrappedKeys(wrappedKeys)), nil
+
+}
+
+// DecryptMACKey unwraps an encoded MAC key with any master key of the Cipher.
+func (c *Cipher) DecryptMACKey(encoded string, encryptionContext map[string]*string) (*MACKey, error) {
+	return c.DecryptMACKeyWithContext(context.Background(), encoded, encryptionContext)
+}
+
+// DecryptMACKeyWithContext is the same as DecryptMACKey, with the ability to
+// cancel the calls to the key provider or set a deadline with the given
+// context.
+func (c *Cipher) DecryptMACKeyWithContext(ctx context.Context, encoded string, encryptionContext map[string]*string) (*MACKey, error) {
+
+	values := strings.Split(encoded, ";")
+	if len(values) != 2 || values[0] != MACKeyMagicPrefix {
+		return nil, errors.Errorf("Invalid format for encoded MAC key %s", encoded)
+	}
+
+	wrappedKeys, err := decodeWrappedKeys(values[1])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := c.decryptDataKey(ctx, &encrypted{wrappedKeys: wrappedKeys}, encryptionContext)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMACKey(key.Plaintext)
+
+}
+
+// newMACKey returns a MACKey using the given data key.
+func newMACKey(key []byte) (*MACKey, error) {
+
+	if len(key) != keySize {
+		return nil, errors.Errorf("Expected key size of %d, got %d", keySize, len(key))
+	}
+
+	return &MACKey{key: key}, nil
+
+}
+
+// Sum returns the base64 encoded MAC of the given data.
+func (k *MACKey) Sum(data []byte) string {
+
+	mac := hmac.New(sha256.New, k.key)
+	_, _ = mac.Write(data)
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+}
+
+// Verify returns an error if the given MAC, as returned by Sum, does not
+// authenticate the data.
+func (k *MACKey) Verify(data []byte, encoded string) error {
+
+	expected, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return errors.WrapPrefix(err, "Unable to base64 decode MAC", 0)
+	}
+
+	mac := hmac.New(sha256.New, k.key)
+	_, _ = mac.Write(data)
+
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return errors.Errorf("Invalid MAC")
+	}
+
+	return nil
+
+}
@@ -0,0 +1,175 @@
+package crypto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	kms_mock "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testMACKey  = "EJH1;bXkta2V5LWlk:Y2lwaGVydGV4dGJsb2I="
+	testMACData = `{"secrets":[]}`
+	testMAC     = "jxrwQoD0rLMzRbwoWIDwYeVGA4f/jpu0MX+ZMgG97fQ="
+)
+
+func TestMACKeyDummy(t *testing.T) {
+	_ = MACKey{_hidden: struct{}{}}
+}
+
+func TestGenerateMACKey(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+		key, encoded, err := cipher.GenerateMACKey(testContext)
+		if assert.NoError(t, err) {
+			assert.Equal(t, encoded, testMACKey)
+			assert.Equal(t, key.Sum([]byte(testMACData)), testMAC)
+		}
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("with additional keys", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+		client.On("Encrypt", testKeyID2, testKeyPlaintext, testContext).Return("otherciphertextblob", nil).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID, testKeyID2)
+		_, encoded, err := cipher.GenerateMACKey(testContext)
+		if assert.NoError(t, err) {
+			assert.Equal(t, encoded, testMACKey+",bXktb3RoZXIta2V5:b3RoZXJjaXBoZXJ0ZXh0YmxvYg==")
+		}
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("with aws error", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return("", "", errors.New("testing errors")).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+		_, _, err := cipher.GenerateMACKey(testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to generate data key: testing errors")
+		}
+
+	})
+
+}
+
+func TestDecryptMACKey(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+		key, err := cipher.DecryptMACKey(testMACKey, testContext)
+		if assert.NoError(t, err) {
+			assert.NoError(t, key.Verify([]byte(testMACData), testMAC))
+		}
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+
+		cipher := NewCipher(kms.NewAWSProvider(&kms_mock.Client{}), testKeyID)
+
+		_, err := cipher.DecryptMACKey(testFileKey, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid format for encoded MAC key "+testFileKey)
+		}
+
+		_, err = cipher.DecryptMACKey("EJH1;abc", testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid format for wrapped key abc")
+		}
+
+	})
+
+	t.Run("not wrapped by the master key", func(t *testing.T) {
+
+		cipher := NewCipher(kms.NewAWSProvider(&kms_mock.Client{}), testKeyID2)
+
+		_, err := cipher.DecryptMACKey(testMACKey, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt data key: not wrapped by any master key of this file")
+		}
+
+	})
+
+	t.Run("invalid key size", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, "notlongenough", nil).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+		_, err := cipher.DecryptMACKey(testMACKey, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Expected key size of 32, got 13")
+		}
+
+	})
+
+}
+
+func TestMACKeyVerify(t *testing.T) {
+
+	key, err := newMACKey([]byte(testKeyPlaintext))
+	assert.NoError(t, err)
+
+	t.Run("working", func(t *testing.T) {
+		assert.NoError(t, key.Verify([]byte(testMACData), testMAC))
+	})
+
+	t.Run("modified data", func(t *testing.T) {
+
+		err := key.Verify([]byte(`{"secrets":[{}]}`), testMAC)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid MAC")
+		}
+
+	})
+
+	t.Run("other key", func(t *testing.T) {
+
+		other, err := newMACKey([]byte("-012345678901234567890123456789-"))
+		assert.NoError(t, err)
+
+		err = other.Verify([]byte(testMACData), testMAC)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid MAC")
+		}
+
+	})
+
+	t.Run("empty MAC", func(t *testing.T) {
+
+		err := key.Verify([]byte(testMACData), "")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid MAC")
+		}
+
+	})
+
+	t.Run("invalid base64", func(t *testing.T) {
+
+		err := key.Verify([]byte(testMACData), "=")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to base64 decode MAC: illegal base64 data at input byte 0")
+		}
+
+	})
+
+}
@@ -1,7 +1,12 @@
 package crypto
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	"github.com/adrienkohlbecker/ejson-kms/kms"
+	"github.com/go-errors/errors"
 )
 
 // Cipher is a struct containing the configuration for crypto operations on
@@ -12,59 +17,180 @@ type Cipher struct {
 	// breaking code
 	_hidden struct{}
 
-	// Client is the AWS KMS client
-	Client kms.Client
+	// Provider wraps and unwraps the data keys
+	Provider kms.KeyProvider
 
 	// KMSKeyID is the ID of the master key to use for key wrapping
 	KMSKeyID string
+
+	// AdditionalKMSKeyIDs are the IDs of other master keys wrapping the same
+	// data keys. Any of the master keys can be used for decryption.
+	AdditionalKMSKeyIDs []string
+
+	// Algorithm selects the EJK2 format for encryption, using the given
+	// algorithm such as AlgorithmXChaCha20Poly1305. When empty, secrets are
+	// encrypted in the EJK1 or EJM1 format with nacl/secretbox. Decryption
+	// supports every format, regardless of this value.
+	Algorithm string
+
+	// Padding is the scheme used to pad plaintexts before encryption, such as
+	// PaddingPowerOfTwo, to hide their length. It is recorded in each
+	// ciphertext, so decryption supports every scheme regardless of this value.
+	Padding string
 }
 
-// NewCipher returns an initialized Cipher.
-func NewCipher(client kms.Client, kmsKeyID string) *Cipher {
+// NewCipher returns an initialized Cipher. Data keys are generated by the
+// master key kmsKeyID, and also wrapped by each of additionalKMSKeyIDs.
+func NewCipher(provider kms.KeyProvider, kmsKeyID string, additionalKMSKeyIDs ...string) *Cipher {
 	return &Cipher{
-		Client:   client,
-		KMSKeyID: kmsKeyID,
+		Provider:            provider,
+		KMSKeyID:            kmsKeyID,
+		AdditionalKMSKeyIDs: additionalKMSKeyIDs,
 	}
 }
 
 // Encrypt is the main entrypoint for encrypting secrets.
 //
 // It takes the plaintext to encrypt, and returns the encrypted
-// and string-encoded ciphertext.
-func (c *Cipher) Encrypt(plaintext string, context map[string]*string) (string, error) {
+// and string-encoded ciphertext. It is the same as EncryptSecret with an
+// empty name.
+func (c *Cipher) Encrypt(plaintext string, encryptionContext map[string]*string) (string, error) {
+	return c.EncryptSecretWithContext(context.Background(), "", plaintext, encryptionContext)
+}
+
+// EncryptWithContext is the same as Encrypt, with the ability to cancel the
+// calls to the key provider or set a deadline with the given context.
+func (c *Cipher) EncryptWithContext(ctx context.Context, plaintext string, encryptionContext map[string]*string) (string, error) {
+	return c.EncryptSecretWithContext(ctx, "", plaintext, encryptionContext)
+}
+
+// EncryptSecret encrypts the plaintext of the secret with the given name. With
+// an Algorithm, the name is authenticated along with the ciphertext, and the
+// same name must be given to DecryptSecret.
+func (c *Cipher) EncryptSecret(name string, plaintext string, encryptionContext map[string]*string) (string, error) {
+	return c.EncryptSecretWithContext(context.Background(), name, plaintext, encryptionContext)
+}
 
-	key, err := kms.GenerateDataKey(c.Client, c.KMSKeyID, context)
+// EncryptSecretWithContext is the same as EncryptSecret, with the ability to
+// cancel the calls to the key provider or set a deadline with the given
+// context.
+func (c *Cipher) EncryptSecretWithContext(ctx context.Context, name string, plaintext string, encryptionContext map[string]*string) (string, error) {
+
+	if c.Algorithm != "" {
+		err := ValidAlgorithm(c.Algorithm)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err := ValidPadding(c.Padding)
 	if err != nil {
 		return "", err
 	}
 
-	ciphertext, err := encryptBytes(key.Plaintext, []byte(plaintext))
+	key, wrappedKeys, err := c.generateDataKey(ctx, encryptionContext)
 	if err != nil {
 		return "", err
 	}
 
-	encrypted := &encrypted{keyCiphertext: key.Ciphertext, ciphertext: ciphertext}
+	if c.Algorithm != "" {
+
+		version := versionField(AEADMagicPrefix, c.Padding)
+		ciphertext, err := sealBytes(c.Algorithm, key.Plaintext, []byte(plaintext), additionalData(version, c.Algorithm, c.KMSKeyID, name), c.Padding)
+		if err != nil {
+			return "", err
+		}
+
+		encrypted := &encrypted{algorithm: c.Algorithm, padding: c.Padding, wrappedKeys: wrappedKeys, ciphertext: ciphertext}
+		return encrypted.encode(), nil
+
+	}
+
+	ciphertext, err := encryptBytes(key.Plaintext, []byte(plaintext), c.Padding)
+	if err != nil {
+		return "", err
+	}
+
+	if len(c.AdditionalKMSKeyIDs) == 0 {
+		encrypted := &encrypted{padding: c.Padding, keyCiphertext: key.Ciphertext, ciphertext: ciphertext}
+		return encrypted.encode(), nil
+	}
+
+	encrypted := &encrypted{padding: c.Padding, wrappedKeys: wrappedKeys, ciphertext: ciphertext}
 	return encrypted.encode(), nil
 
 }
 
+// generateDataKey generates a new data key with the first master key, and
+// wraps it with each of the additional master keys. It returns the data key,
+// along with every wrapping.
+func (c *Cipher) generateDataKey(ctx context.Context, encryptionContext map[string]*string) (kms.DataKey, []wrappedKey, error) {
+
+	key, err := c.Provider.GenerateDataKey(ctx, c.KMSKeyID, encryptionContext)
+	if err != nil {
+		return kms.DataKey{}, nil, err
+	}
+
+	wrappedKeys := []wrappedKey{{keyID: c.KMSKeyID, keyCiphertext: key.Ciphertext}}
+	for _, keyID := range c.AdditionalKMSKeyIDs {
+
+		wrapped, err := c.Provider.EncryptDataKey(ctx, keyID, key.Plaintext, encryptionContext)
+		if err != nil {
+			return kms.DataKey{}, nil, errors.WrapPrefix(err, keyID, 0)
+		}
+
+		wrappedKeys = append(wrappedKeys, wrappedKey{keyID: keyID, keyCiphertext: wrapped.Ciphertext})
+
+	}
+
+	return key, wrappedKeys, nil
+
+}
+
 // Decrypt is the main entrypoint for encrypting secrets.
 //
 // It takes the string-encoded ciphertext and returns the decoded
-// and decrypted plaintext.
-func (c *Cipher) Decrypt(encoded string, context map[string]*string) (string, error) {
+// and decrypted plaintext. It is the same as DecryptSecret with an empty
+// name.
+func (c *Cipher) Decrypt(encoded string, encryptionContext map[string]*string) (string, error) {
+	return c.DecryptSecretWithContext(context.Background(), "", encoded, encryptionContext)
+}
+
+// DecryptWithContext is the same as Decrypt, with the ability to cancel the
+// calls to the key provider or set a deadline with the given context.
+func (c *Cipher) DecryptWithContext(ctx context.Context, encoded string, encryptionContext map[string]*string) (string, error) {
+	return c.DecryptSecretWithContext(ctx, "", encoded, encryptionContext)
+}
+
+// DecryptSecret decrypts the ciphertext of the secret with the given name. For
+// the EJK2 format, decryption fails if the ciphertext was encrypted for another
+// secret, or with another master key as KMSKeyID.
+func (c *Cipher) DecryptSecret(name string, encoded string, encryptionContext map[string]*string) (string, error) {
+	return c.DecryptSecretWithContext(context.Background(), name, encoded, encryptionContext)
+}
+
+// DecryptSecretWithContext is the same as DecryptSecret, with the ability to
+// cancel the calls to the key provider or set a deadline with the given
+// context.
+func (c *Cipher) DecryptSecretWithContext(ctx context.Context, name string, encoded string, encryptionContext map[string]*string) (string, error) {
 
 	encrypted, err := decode(encoded)
 	if err != nil {
 		return "", err
 	}
 
-	key, err := kms.DecryptDataKey(c.Client, encrypted.keyCiphertext, context)
+	key, err := c.decryptDataKey(ctx, encrypted, encryptionContext)
 	if err != nil {
 		return "", err
 	}
 
-	plaintext, err := decryptBytes(key.Plaintext, encrypted.ciphertext)
+	var plaintext []byte
+	if encrypted.algorithm != "" {
+		version := versionField(AEADMagicPrefix, encrypted.padding)
+		plaintext, err = openBytes(encrypted.algorithm, key.Plaintext, encrypted.ciphertext, additionalData(version, encrypted.algorithm, c.KMSKeyID, name), encrypted.padding)
+	} else {
+		plaintext, err = decryptBytes(key.Plaintext, encrypted.ciphertext, encrypted.padding)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -72,3 +198,58 @@ func (c *Cipher) Decrypt(encoded string, context map[string]*string) (string, er
 	return string(plaintext), nil
 
 }
+
+// decryptDataKey unwraps the data key of an encrypted secret. With several
+// master keys, each wrapping is tried in order until one succeeds. Only the
+// master keys of the Cipher are used.
+func (c *Cipher) decryptDataKey(ctx context.Context, encrypted *encrypted, encryptionContext map[string]*string) (kms.DataKey, error) {
+
+	if len(encrypted.wrappedKeys) == 0 {
+		return c.Provider.DecryptDataKey(ctx, c.KMSKeyID, encrypted.keyCiphertext, encryptionContext)
+	}
+
+	failures := make([]string, 0)
+	for _, wrapped := range encrypted.wrappedKeys {
+
+		if !c.hasKey(wrapped.keyID) {
+			continue
+		}
+
+		key, err := c.Provider.DecryptDataKey(ctx, wrapped.keyID, wrapped.keyCiphertext, encryptionContext)
+		if err == nil {
+			return key, nil
+		}
+
+		// other master keys would fail the same way
+		if ctx.Err() != nil {
+			return kms.DataKey{}, err
+		}
+
+		failures = append(failures, fmt.Sprintf("%s: %s", wrapped.keyID, err))
+
+	}
+
+	if len(failures) == 0 {
+		return kms.DataKey{}, errors.Errorf("Unable to decrypt data key: not wrapped by any master key of this file")
+	}
+
+	return kms.DataKey{}, errors.Errorf("Unable to decrypt data key with any master key: %s", strings.Join(failures, "; "))
+
+}
+
+// hasKey reports whether the given key ID is one of the master keys.
+func (c *Cipher) hasKey(keyID string) bool {
+
+	if keyID == c.KMSKeyID {
+		return true
+	}
+
+	for _, additional := range c.AdditionalKMSKeyIDs {
+		if keyID == additional {
+			return true
+		}
+	}
+
+	return false
+
+}
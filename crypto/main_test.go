@@ -1,17 +1,23 @@
 package crypto
 
 import (
+	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	crypto_mock "github.com/adrienkohlbecker/ejson-kms/crypto/mock"
+	"github.com/adrienkohlbecker/ejson-kms/kms"
 	kms_mock "github.com/adrienkohlbecker/ejson-kms/kms/mock"
 	"github.com/stretchr/testify/assert"
 )
 
 var testContext = map[string]*string{"ABC": nil}
 
-const testKeyID = "my-key-id"
+const (
+	testKeyID  = "my-key-id"
+	testKeyID2 = "my-other-key"
+)
 
 const (
 	testKeyPlaintext  = "-abcdefabcdefabcdefabcdefabcdef-"
@@ -19,6 +25,12 @@ const (
 	testConstantNonce = "abcdefabcdefabcdefabcdef"
 	testPlaintext     = "abcdef"
 	testCiphertext    = "EJK1;Y2lwaGVydGV4dGJsb2I=;YWJjZGVmYWJjZGVmYWJjZGVmYWJjZGVmlPmP6IWfK7WJMuXVi8aQ7TZu8vCkVA=="
+	testName          = "my_secret"
+)
+
+const (
+	testCiphertextXChaCha = "EJK2;xchacha20-poly1305;bXkta2V5LWlk:Y2lwaGVydGV4dGJsb2I=;YWJjZGVmYWJjZGVmYWJjZGVmYWJjZGVm2p5TzBzrNGWNoeRlE+ai3LDpxW1lFw=="
+	testCiphertextAESGCM  = "EJK2;aes-256-gcm;bXkta2V5LWlk:Y2lwaGVydGV4dGJsb2I=;YWJjZGVmYWJjZGVmeMgqwyhkZI7z8Pp2eCRBp1HycJhcEA=="
 )
 
 func TestDummy(t *testing.T) {
@@ -34,7 +46,7 @@ func TestEncrypt(t *testing.T) {
 
 		crypto_mock.WithConstRandReader(testConstantNonce, func() {
 
-			cipher := NewCipher(client, testKeyID)
+			cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
 			encoded, err := cipher.Encrypt(testPlaintext, testContext)
 			assert.NoError(t, err)
 			assert.Equal(t, encoded, testCiphertext)
@@ -48,7 +60,7 @@ func TestEncrypt(t *testing.T) {
 		client := &kms_mock.Client{}
 		client.On("GenerateDataKey", testKeyID, testContext).Return("", "", errors.New("testing errors")).Once()
 
-		cipher := NewCipher(client, testKeyID)
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
 		_, err := cipher.Encrypt(testPlaintext, testContext)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "Unable to generate data key")
@@ -62,7 +74,7 @@ func TestEncrypt(t *testing.T) {
 
 		crypto_mock.WithErrorRandReader("testing error", func() {
 
-			cipher := NewCipher(client, testKeyID)
+			cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
 			_, err := cipher.Encrypt(testPlaintext, testContext)
 			assert.Error(t, err)
 			assert.Contains(t, err.Error(), "Unable to generate nonce")
@@ -79,7 +91,7 @@ func TestDecrypt(t *testing.T) {
 		client := &kms_mock.Client{}
 		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
 
-		cipher := NewCipher(client, testKeyID)
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
 		plaintext, err := cipher.Decrypt(testCiphertext, testContext)
 		if assert.NoError(t, err) {
 			assert.Equal(t, plaintext, testPlaintext)
@@ -92,7 +104,7 @@ func TestDecrypt(t *testing.T) {
 		client := &kms_mock.Client{}
 		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
 
-		cipher := NewCipher(client, testKeyID)
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
 		_, err := cipher.Decrypt("abc", testContext)
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "Invalid format for encoded string")
@@ -105,7 +117,7 @@ func TestDecrypt(t *testing.T) {
 		client := &kms_mock.Client{}
 		client.On("Decrypt", testKeyCiphertext, testContext).Return("", "", errors.New("testing errors")).Once()
 
-		cipher := NewCipher(client, testKeyID)
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
 		_, err := cipher.Decrypt(testCiphertext, testContext)
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "Unable to decrypt key ciphertext")
@@ -118,7 +130,7 @@ func TestDecrypt(t *testing.T) {
 		client := &kms_mock.Client{}
 		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, "notlongenough", nil).Once()
 
-		cipher := NewCipher(client, testKeyID)
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
 		_, err := cipher.Decrypt(testCiphertext, testContext)
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "Expected key size of 32, got 13")
@@ -127,3 +139,403 @@ func TestDecrypt(t *testing.T) {
 	})
 
 }
+
+func TestWithContext(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	t.Run("encrypt", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+		_, err := cipher.EncryptWithContext(ctx, testPlaintext, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to generate data key: context canceled")
+		}
+
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("decrypt", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+		_, err := cipher.DecryptWithContext(ctx, testCiphertext, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt key ciphertext: context canceled")
+		}
+
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("decrypt does not try other master keys", func(t *testing.T) {
+
+		encoded := "EJM1;bXkta2V5LWlk:Y2lwaGVydGV4dGJsb2I=,bXktb3RoZXIta2V5:b3RoZXJjaXBoZXJ0ZXh0YmxvYg==;YWJjZGVmYWJjZGVmYWJjZGVmYWJjZGVmlPmP6IWfK7WJMuXVi8aQ7TZu8vCkVA=="
+
+		client := &kms_mock.Client{}
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID, testKeyID2)
+		_, err := cipher.DecryptWithContext(ctx, encoded, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt key ciphertext: context canceled")
+		}
+
+		client.AssertExpectations(t)
+
+	})
+
+}
+
+func TestMultiKey(t *testing.T) {
+
+	t.Run("encrypt", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+		client.On("Encrypt", testKeyID2, testKeyPlaintext, testContext).Return("otherciphertextblob", nil).Once()
+
+		crypto_mock.WithConstRandReader(testConstantNonce, func() {
+
+			cipher := NewCipher(kms.NewAWSProvider(client), testKeyID, testKeyID2)
+			encoded, err := cipher.Encrypt(testPlaintext, testContext)
+			assert.NoError(t, err)
+			assert.Equal(t, encoded, "EJM1;bXkta2V5LWlk:Y2lwaGVydGV4dGJsb2I=,bXktb3RoZXIta2V5:b3RoZXJjaXBoZXJ0ZXh0YmxvYg==;YWJjZGVmYWJjZGVmYWJjZGVmYWJjZGVmlPmP6IWfK7WJMuXVi8aQ7TZu8vCkVA==")
+
+		})
+
+	})
+
+	t.Run("encrypt error", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+		client.On("Encrypt", testKeyID2, testKeyPlaintext, testContext).Return("", errors.New("testing errors")).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID, testKeyID2)
+		_, err := cipher.Encrypt(testPlaintext, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "my-other-key: Unable to encrypt data key: testing errors")
+		}
+
+	})
+
+	encoded := "EJM1;bXkta2V5LWlk:Y2lwaGVydGV4dGJsb2I=,bXktb3RoZXIta2V5:b3RoZXJjaXBoZXJ0ZXh0YmxvYg==;YWJjZGVmYWJjZGVmYWJjZGVmYWJjZGVmlPmP6IWfK7WJMuXVi8aQ7TZu8vCkVA=="
+
+	t.Run("decrypt with the first key", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID, testKeyID2)
+		plaintext, err := cipher.Decrypt(encoded, testContext)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, testPlaintext)
+
+	})
+
+	t.Run("decrypt falls back to the next key", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return("", "", errors.New("testing errors")).Once()
+		client.On("Decrypt", "otherciphertextblob", testContext).Return(testKeyID2, testKeyPlaintext, nil).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID, testKeyID2)
+		plaintext, err := cipher.Decrypt(encoded, testContext)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, testPlaintext)
+
+	})
+
+	t.Run("decrypt ignores unknown keys", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", "otherciphertextblob", testContext).Return(testKeyID2, testKeyPlaintext, nil).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID2)
+		plaintext, err := cipher.Decrypt(encoded, testContext)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, testPlaintext)
+
+		cipher = NewCipher(kms.NewAWSProvider(client), "unknown-key")
+		_, err = cipher.Decrypt(encoded, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt data key: not wrapped by any master key of this file")
+		}
+
+	})
+
+	t.Run("decrypt error", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return("", "", errors.New("testing errors")).Once()
+		client.On("Decrypt", "otherciphertextblob", testContext).Return("", "", errors.New("other errors")).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID, testKeyID2)
+		_, err := cipher.Decrypt(encoded, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt data key with any master key: my-key-id: Unable to decrypt key ciphertext: testing errors; my-other-key: Unable to decrypt key ciphertext: other errors")
+		}
+
+	})
+
+}
+
+func TestEncryptSecret(t *testing.T) {
+
+	t.Run("xchacha20-poly1305", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+		crypto_mock.WithConstRandReader(testConstantNonce, func() {
+
+			cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+			cipher.Algorithm = AlgorithmXChaCha20Poly1305
+			encoded, err := cipher.EncryptSecret(testName, testPlaintext, testContext)
+			assert.NoError(t, err)
+			assert.Equal(t, encoded, testCiphertextXChaCha)
+
+		})
+
+	})
+
+	t.Run("aes-256-gcm", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+		crypto_mock.WithConstRandReader(testConstantNonce, func() {
+
+			cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+			cipher.Algorithm = AlgorithmAES256GCM
+			encoded, err := cipher.EncryptSecret(testName, testPlaintext, testContext)
+			assert.NoError(t, err)
+			assert.Equal(t, encoded, testCiphertextAESGCM)
+
+		})
+
+	})
+
+	t.Run("without algorithm", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+		crypto_mock.WithConstRandReader(testConstantNonce, func() {
+
+			cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+			encoded, err := cipher.EncryptSecret(testName, testPlaintext, testContext)
+			assert.NoError(t, err)
+			assert.Equal(t, encoded, testCiphertext)
+
+		})
+
+	})
+
+	t.Run("unknown algorithm", func(t *testing.T) {
+
+		cipher := NewCipher(kms.NewAWSProvider(&kms_mock.Client{}), testKeyID)
+		cipher.Algorithm = "rot13"
+		_, err := cipher.EncryptSecret(testName, testPlaintext, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unknown algorithm rot13, expected xchacha20-poly1305 or aes-256-gcm")
+		}
+
+	})
+
+}
+
+func TestDecryptSecret(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		for _, encoded := range []string{testCiphertextXChaCha, testCiphertextAESGCM, testCiphertext} {
+
+			client := &kms_mock.Client{}
+			client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+			cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+			plaintext, err := cipher.DecryptSecret(testName, encoded, testContext)
+			if assert.NoError(t, err) {
+				assert.Equal(t, plaintext, testPlaintext)
+			}
+
+		}
+
+	})
+
+	t.Run("with another name", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+		_, err := cipher.DecryptSecret("other_secret", testCiphertextXChaCha, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt ciphertext")
+		}
+
+	})
+
+	t.Run("with another master key", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		// the data key is still wrapped by testKeyID, but the file now
+		// claims testKeyID2 as its master key
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID2, testKeyID)
+		_, err := cipher.DecryptSecret(testName, testCiphertextAESGCM, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt ciphertext")
+		}
+
+	})
+
+	t.Run("without name", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+		_, err := cipher.Decrypt(testCiphertextXChaCha, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt ciphertext")
+		}
+
+	})
+
+}
+
+func TestPadding(t *testing.T) {
+
+	t.Run("hides the length", func(t *testing.T) {
+
+		for _, algorithm := range []string{"", AlgorithmXChaCha20Poly1305} {
+
+			client := &kms_mock.Client{}
+			client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Twice()
+			client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+			cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+			cipher.Algorithm = algorithm
+			cipher.Padding = PaddingBlock256
+
+			pin, err := cipher.EncryptSecret(testName, "1234", testContext)
+			assert.NoError(t, err)
+			key, err := cipher.EncryptSecret(testName, strings.Repeat("k", 200), testContext)
+			assert.NoError(t, err)
+
+			assert.Equal(t, len(pin), len(key))
+			assert.True(t, strings.Contains(pin, "+block256;"))
+
+			plaintext, err := cipher.DecryptSecret(testName, pin, testContext)
+			assert.NoError(t, err)
+			assert.Equal(t, plaintext, "1234")
+
+		}
+
+	})
+
+	t.Run("format", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+		crypto_mock.WithConstRandReader(testConstantNonce, func() {
+
+			cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+			cipher.Padding = PaddingPowerOfTwo
+			encoded, err := cipher.Encrypt(testPlaintext, testContext)
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(encoded, "EJK1+pow2;Y2lwaGVydGV4dGJsb2I=;"))
+
+			version, err := FormatVersion(encoded)
+			assert.NoError(t, err)
+			assert.Equal(t, version, MagicPrefix)
+
+		})
+
+	})
+
+	t.Run("authenticated with EJK2", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+		cipher.Algorithm = AlgorithmAES256GCM
+		cipher.Padding = PaddingPowerOfTwo
+
+		encoded, err := cipher.EncryptSecret(testName, testPlaintext, testContext)
+		assert.NoError(t, err)
+
+		_, err = cipher.DecryptSecret(testName, strings.Replace(encoded, "EJK2+pow2", "EJK2+block256", 1), testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt ciphertext")
+		}
+
+	})
+
+	t.Run("authenticated with EJK1 and EJM1", func(t *testing.T) {
+
+		for _, additional := range [][]string{nil, {testKeyID2}} {
+
+			client := &kms_mock.Client{}
+			client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil)
+			client.On("Encrypt", testKeyID2, testKeyPlaintext, testContext).Return("otherciphertextblob", nil)
+			client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil)
+
+			cipher := NewCipher(kms.NewAWSProvider(client), testKeyID)
+			cipher.AdditionalKMSKeyIDs = additional
+
+			cipher.Padding = PaddingPowerOfTwo
+			padded, err := cipher.Encrypt(testPlaintext, testContext)
+			assert.NoError(t, err)
+
+			cipher.Padding = PaddingNone
+			unpadded, err := cipher.Encrypt(testPlaintext, testContext)
+			assert.NoError(t, err)
+
+			version, _ := FormatVersion(padded)
+			tampered := []string{
+				strings.Replace(padded, version+"+pow2;", version+";", 1),
+				strings.Replace(padded, version+"+pow2;", version+"+block256;", 1),
+				strings.Replace(unpadded, version+";", version+"+pow2;", 1),
+			}
+
+			for _, encoded := range tampered {
+				_, err = cipher.Decrypt(encoded, testContext)
+				if assert.Error(t, err, encoded) {
+					assert.Equal(t, err.Error(), "Unable to decrypt ciphertext")
+				}
+			}
+
+		}
+
+	})
+
+	t.Run("unknown padding", func(t *testing.T) {
+
+		cipher := NewCipher(kms.NewAWSProvider(&kms_mock.Client{}), testKeyID)
+		cipher.Padding = "pow3"
+
+		_, err := cipher.Encrypt(testPlaintext, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unknown padding pow3, expected pow2 or block256")
+		}
+
+		_, err = decode("EJK1+pow3;YWJj;YWJj")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unknown padding pow3, expected pow2 or block256")
+		}
+
+	})
+
+}
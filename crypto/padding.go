@@ -0,0 +1,161 @@
+package crypto
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+// Padding schemes hiding the length of secrets. The plaintext is followed by
+// a 0x80 byte and as many zero bytes as needed to reach the size of its bucket
+// (ISO/IEC 7816-4 padding), which is removed on decryption.
+const (
+	// PaddingNone does not pad plaintexts, their length is not hidden
+	PaddingNone = ""
+
+	// PaddingPowerOfTwo pads plaintexts to the next power of two, with a
+	// minimum of 16 bytes
+	PaddingPowerOfTwo = "pow2"
+
+	// PaddingBlock256 pads plaintexts to the next multiple of 256 bytes
+	PaddingBlock256 = "block256"
+)
+
+// minPowerOfTwoSize is the smallest bucket of PaddingPowerOfTwo
+const minPowerOfTwoSize = 16
+
+// paddingSeparator separates the padding scheme from the version in the
+// versioning field of a ciphertext, such as "EJK1+pow2"
+const paddingSeparator = "+"
+
+// ValidPadding returns an error if the given padding scheme is unknown.
+func ValidPadding(padding string) error {
+
+	switch padding {
+	case PaddingNone, PaddingPowerOfTwo, PaddingBlock256:
+		return nil
+	}
+
+	return errors.Errorf("Unknown padding %s, expected %s or %s", padding, PaddingPowerOfTwo, PaddingBlock256)
+
+}
+
+// ParsePadding parses the name of a padding scheme as given on the command
+// line: "none", "pow2" or "block256". "none" is returned as PaddingNone.
+func ParsePadding(name string) (string, error) {
+
+	switch name {
+	case "none":
+		return PaddingNone, nil
+	case PaddingPowerOfTwo, PaddingBlock256:
+		return name, nil
+	}
+
+	return "", errors.Errorf("Unknown padding %q, expected none, %s or %s", name, PaddingPowerOfTwo, PaddingBlock256)
+
+}
+
+// paddedSize returns the size of the bucket holding length bytes.
+func paddedSize(padding string, length int) int {
+
+	switch padding {
+	case PaddingPowerOfTwo:
+		size := minPowerOfTwoSize
+		for size < length {
+			size <<= 1
+		}
+		return size
+	case PaddingBlock256:
+		return (length + 255) / 256 * 256
+	}
+
+	return length
+
+}
+
+// pad pads the plaintext with the given scheme.
+func pad(padding string, plaintext []byte) ([]byte, error) {
+
+	err := ValidPadding(padding)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	if padding == PaddingNone {
+		return plaintext, nil
+	}
+
+	padded := make([]byte, paddedSize(padding, len(plaintext)+1))
+	copy(padded, plaintext)
+	padded[len(plaintext)] = 0x80
+
+	return padded, nil
+
+}
+
+// unpad removes the padding added by pad with the given scheme.
+func unpad(padding string, padded []byte) ([]byte, error) {
+
+	err := ValidPadding(padding)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	if padding == PaddingNone {
+		return padded, nil
+	}
+
+	i := len(padded) - 1
+	for i >= 0 && padded[i] == 0x00 {
+		i--
+	}
+
+	if i < 0 || padded[i] != 0x80 || len(padded) != paddedSize(padding, i+1) {
+		return []byte{}, errors.Errorf("Invalid padding")
+	}
+
+	return padded[:i], nil
+
+}
+
+// versionField returns the versioning field of a ciphertext, with the padding
+// scheme appended to the version if any.
+func versionField(version string, padding string) string {
+
+	if padding == PaddingNone {
+		return version
+	}
+
+	return version + paddingSeparator + padding
+
+}
+
+// splitVersionField returns the version and padding scheme of a versioning
+// field.
+func splitVersionField(field string) (string, string) {
+
+	values := strings.SplitN(field, paddingSeparator, 2)
+	if len(values) == 1 {
+		return values[0], PaddingNone
+	}
+
+	return values[0], values[1]
+
+}
+
+// lengthPrefixed concatenates the given values, each prefixed by its length,
+// so that different values cannot produce the same result.
+func lengthPrefixed(values ...string) []byte {
+
+	data := make([]byte, 0)
+	for _, value := range values {
+		length := make([]byte, 4)
+		binary.BigEndian.PutUint32(length, uint32(len(value)))
+		data = append(data, length...)
+		data = append(data, value...)
+	}
+
+	return data
+
+}
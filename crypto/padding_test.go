@@ -0,0 +1,159 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidPadding(t *testing.T) {
+
+	assert.NoError(t, ValidPadding(PaddingNone))
+	assert.NoError(t, ValidPadding(PaddingPowerOfTwo))
+	assert.NoError(t, ValidPadding(PaddingBlock256))
+
+	err := ValidPadding("pow3")
+	if assert.Error(t, err) {
+		assert.Equal(t, err.Error(), "Unknown padding pow3, expected pow2 or block256")
+	}
+
+}
+
+func TestParsePadding(t *testing.T) {
+
+	valid := map[string]string{
+		"none":     PaddingNone,
+		"pow2":     PaddingPowerOfTwo,
+		"block256": PaddingBlock256,
+	}
+
+	for name, expected := range valid {
+		padding, err := ParsePadding(name)
+		assert.NoError(t, err)
+		assert.Equal(t, padding, expected)
+	}
+
+	_, err := ParsePadding("pow3")
+	if assert.Error(t, err) {
+		assert.Equal(t, err.Error(), `Unknown padding "pow3", expected none, pow2 or block256`)
+	}
+
+	_, err = ParsePadding("")
+	if assert.Error(t, err) {
+		assert.Equal(t, err.Error(), `Unknown padding "", expected none, pow2 or block256`)
+	}
+
+}
+
+func TestPaddedSize(t *testing.T) {
+
+	assert.Equal(t, paddedSize(PaddingNone, 5), 5)
+
+	assert.Equal(t, paddedSize(PaddingPowerOfTwo, 1), 16)
+	assert.Equal(t, paddedSize(PaddingPowerOfTwo, 16), 16)
+	assert.Equal(t, paddedSize(PaddingPowerOfTwo, 17), 32)
+	assert.Equal(t, paddedSize(PaddingPowerOfTwo, 1000), 1024)
+
+	assert.Equal(t, paddedSize(PaddingBlock256, 1), 256)
+	assert.Equal(t, paddedSize(PaddingBlock256, 256), 256)
+	assert.Equal(t, paddedSize(PaddingBlock256, 257), 512)
+
+}
+
+func TestPad(t *testing.T) {
+
+	t.Run("none", func(t *testing.T) {
+
+		padded, err := pad(PaddingNone, []byte("1234"))
+		assert.NoError(t, err)
+		assert.Equal(t, padded, []byte("1234"))
+
+	})
+
+	t.Run("power of two", func(t *testing.T) {
+
+		padded, err := pad(PaddingPowerOfTwo, []byte("1234"))
+		assert.NoError(t, err)
+		assert.Equal(t, padded, []byte("1234\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"))
+
+		// a full bucket needs room for the 0x80 byte
+		padded, err = pad(PaddingPowerOfTwo, bytes.Repeat([]byte("a"), 16))
+		assert.NoError(t, err)
+		assert.Equal(t, len(padded), 32)
+
+	})
+
+	t.Run("block256", func(t *testing.T) {
+
+		short, err := pad(PaddingBlock256, []byte("1234"))
+		assert.NoError(t, err)
+		long, err := pad(PaddingBlock256, bytes.Repeat([]byte("a"), 200))
+		assert.NoError(t, err)
+		assert.Equal(t, len(short), 256)
+		assert.Equal(t, len(long), 256)
+
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+
+		_, err := pad("pow3", []byte("1234"))
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unknown padding pow3, expected pow2 or block256")
+		}
+
+	})
+
+}
+
+func TestUnpad(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		for _, padding := range []string{PaddingNone, PaddingPowerOfTwo, PaddingBlock256} {
+			for _, plaintext := range [][]byte{{}, []byte("1234"), []byte("ends with zeros\x00\x00"), bytes.Repeat([]byte("a"), 300)} {
+
+				padded, err := pad(padding, plaintext)
+				assert.NoError(t, err)
+
+				unpadded, err := unpad(padding, padded)
+				assert.NoError(t, err)
+				assert.Equal(t, unpadded, plaintext)
+
+			}
+		}
+
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+
+		for _, padded := range [][]byte{
+			{},
+			[]byte("no padding at all"),
+			[]byte("1234\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"),
+			[]byte("1234\x80\x00\x00"),
+		} {
+			_, err := unpad(PaddingPowerOfTwo, padded)
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Invalid padding")
+			}
+		}
+
+	})
+
+}
+
+func TestVersionField(t *testing.T) {
+
+	assert.Equal(t, versionField("EJK1", PaddingNone), "EJK1")
+	assert.Equal(t, versionField("EJK1", PaddingPowerOfTwo), "EJK1+pow2")
+
+	version, padding := splitVersionField("EJK1")
+	assert.Equal(t, version, "EJK1")
+	assert.Equal(t, padding, "")
+
+	version, padding = splitVersionField("EJK2+block256")
+	assert.Equal(t, version, "EJK2")
+	assert.Equal(t, padding, "block256")
+
+}
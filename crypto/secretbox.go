@@ -1,7 +1,9 @@
 package crypto
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"io"
 
 	"github.com/go-errors/errors"
@@ -35,15 +37,42 @@ func randomNonce() ([nonceSize]byte, error) {
 
 }
 
-// encryptBytes uses nacl/secretbox to encrypt a plaintext. A random nonce
-// is generated for each call. The return value is the nonce + ciphertext
-// in a single byte slice.
-func encryptBytes(keyBytes []byte, plaintext []byte) ([]byte, error) {
+// paddingKey returns the key sealing a plaintext padded with the given scheme.
+// Secretbox has no additional data, so the scheme is bound to the key instead:
+// padded plaintexts are sealed with an HMAC-SHA256 of the scheme under the
+// data key, and decryption fails when the scheme is removed from, added to or
+// changed in the versioning field of the ciphertext. Plaintexts without
+// padding are sealed with the data key, as before padding was introduced.
+func paddingKey(key [keySize]byte, padding string) [keySize]byte {
+
+	if padding == PaddingNone {
+		return key
+	}
+
+	mac := hmac.New(sha256.New, key[:])
+	_, _ = mac.Write(lengthPrefixed("ejson-kms padding", padding))
+
+	var derived [keySize]byte
+	copy(derived[:], mac.Sum(nil))
+	return derived
+
+}
+
+// encryptBytes uses nacl/secretbox to encrypt a plaintext, padded with the
+// given scheme and sealed with the key of that scheme (see paddingKey). A
+// random nonce is generated for each call. The return value is the nonce +
+// ciphertext in a single byte slice.
+func encryptBytes(keyBytes []byte, plaintext []byte, padding string) ([]byte, error) {
 
 	if len(keyBytes) != keySize {
 		return []byte{}, errors.Errorf("Expected key size of %d, got %d", keySize, len(keyBytes))
 	}
 
+	plaintext, err := pad(padding, plaintext)
+	if err != nil {
+		return []byte{}, err
+	}
+
 	var key [keySize]byte
 	copy(key[:], keyBytes[:keySize])
 
@@ -52,15 +81,17 @@ func encryptBytes(keyBytes []byte, plaintext []byte) ([]byte, error) {
 		return []byte{}, err
 	}
 
+	key = paddingKey(key, padding)
 	ciphertext := secretbox.Seal(nonce[:], plaintext, &nonce, &key)
 
 	return ciphertext, nil
 
 }
 
-// decryptBytes uses nacl/secretbox to decrypt a ciphertext. The input must
-// take the form nonce + ciphertext in a single byte slice.
-func decryptBytes(keyBytes []byte, bytes []byte) ([]byte, error) {
+// decryptBytes uses nacl/secretbox to decrypt a ciphertext with the key of the
+// given padding scheme, and removes the padding. The input must take the form
+// nonce + ciphertext in a single byte slice.
+func decryptBytes(keyBytes []byte, bytes []byte, padding string) ([]byte, error) {
 
 	if len(keyBytes) != keySize {
 		return []byte{}, errors.Errorf("Expected key size of %d, got %d", keySize, len(keyBytes))
@@ -78,11 +109,17 @@ func decryptBytes(keyBytes []byte, bytes []byte) ([]byte, error) {
 
 	ciphertext := bytes[nonceSize:]
 
+	err := ValidPadding(padding)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	key = paddingKey(key, padding)
 	plaintext, ok := secretbox.Open([]byte{}, ciphertext, &nonce, &key)
 	if !ok {
 		return []byte{}, errors.Errorf("Unable to decrypt ciphertext")
 	}
 
-	return plaintext, nil
+	return unpad(padding, plaintext)
 
 }
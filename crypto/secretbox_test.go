@@ -38,7 +38,7 @@ func TestEncryptBytes(t *testing.T) {
 
 		keyBytes := []byte("-abcdefabcdefabcdefabcdefabcdef-")
 		plaintext := []byte("plaintext")
-		ciphertext, err := encryptBytes(keyBytes, plaintext)
+		ciphertext, err := encryptBytes(keyBytes, plaintext, PaddingNone)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, ciphertext)
 
@@ -48,7 +48,7 @@ func TestEncryptBytes(t *testing.T) {
 
 		keyBytes := []byte("abcdef")
 		plaintext := []byte("plaintext")
-		_, err := encryptBytes(keyBytes, plaintext)
+		_, err := encryptBytes(keyBytes, plaintext, PaddingNone)
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "Expected key size of 32, got 6")
 		}
@@ -61,7 +61,7 @@ func TestEncryptBytes(t *testing.T) {
 
 			keyBytes := []byte("-abcdefabcdefabcdefabcdefabcdef-")
 			plaintext := []byte("plaintext")
-			_, err := encryptBytes(keyBytes, plaintext)
+			_, err := encryptBytes(keyBytes, plaintext, PaddingNone)
 			if assert.Error(t, err) {
 				assert.Contains(t, err.Error(), "Unable to generate nonce")
 			}
@@ -79,7 +79,7 @@ func TestDecryptBytes(t *testing.T) {
 		ciphertext := []byte("fV\x12,\x18\x9cd\xc2\xcbp/\xf1e\xd9}\xd6%j\x05Q\xc7\x1e\xf5\x99\xf8f\xe1\x99=G\x8dp\xb0\xf7\xca\xc8++Կ\x06\xe7i'\xa0\xb6}x\xa6")
 		keyBytes := []byte("-abcdefabcdefabcdefabcdefabcdef-")
 
-		plaintext, err := decryptBytes(keyBytes, ciphertext)
+		plaintext, err := decryptBytes(keyBytes, ciphertext, PaddingNone)
 		assert.NoError(t, err)
 		assert.Equal(t, plaintext, []byte(plaintext))
 
@@ -90,7 +90,7 @@ func TestDecryptBytes(t *testing.T) {
 		ciphertext := []byte("fV\x12,\x18\x9cd\xc2\xcbp/\xf1e\xd9}\xd6%j\x05Q\xc7\x1e\xf5\x99\xf8f\xe1\x99=G\x8dp\xb0\xf7\xca\xc8++Կ\x06\xe7i'\xa0\xb6}x\xa6")
 		keyBytes := []byte("abcdef")
 
-		_, err := decryptBytes(keyBytes, ciphertext)
+		_, err := decryptBytes(keyBytes, ciphertext, PaddingNone)
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "Expected key size of 32, got 6")
 		}
@@ -102,7 +102,7 @@ func TestDecryptBytes(t *testing.T) {
 		ciphertext := []byte("abcdef")
 		keyBytes := []byte("-abcdefabcdefabcdefabcdefabcdef-")
 
-		_, err := decryptBytes(keyBytes, ciphertext)
+		_, err := decryptBytes(keyBytes, ciphertext, PaddingNone)
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "Invalid ciphertext")
 		}
@@ -114,7 +114,7 @@ func TestDecryptBytes(t *testing.T) {
 		ciphertext := []byte("-abcdefabcdefabcdefabcdefabcdef-")
 		keyBytes := []byte("-abcdefabcdefabcdefabcdefabcdef-")
 
-		_, err := decryptBytes(keyBytes, ciphertext)
+		_, err := decryptBytes(keyBytes, ciphertext, PaddingNone)
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "Unable to decrypt ciphertext")
 		}
@@ -0,0 +1,21 @@
+// Package ejson reads the secrets files of Shopify's ejson
+// (https://github.com/Shopify/ejson), to migrate them to ejson-kms.
+//
+// An ejson file is a JSON document whose string values are encrypted with
+// NaCl box, for the public key found in its "_public_key" field. The
+// matching private key is read from a directory of keys, named after the
+// public key, such as /opt/ejson/keys.
+//
+// Example
+//
+//   // {
+//   //   "_public_key": "25e5...",
+//   //   "database": {
+//   //     "password": "EJ[1:...]",
+//   //     "_password": "Password of the database"
+//   //   }
+//   // }
+//   items, err := ejson.Parse(f, ejson.DefaultKeydir)
+//   items[0].Name        // "database_password"
+//   items[0].Description // "Password of the database"
+package ejson
@@ -0,0 +1,271 @@
+package ejson
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+
+	"github.com/adrienkohlbecker/ejson-kms/formatter"
+)
+
+// DefaultKeydir is the directory in which ejson looks for private keys.
+const DefaultKeydir = "/opt/ejson/keys"
+
+// publicKeyField is the field of an ejson file holding its public key.
+const publicKeyField = "_public_key"
+
+// keySize is the size of the NaCl box keys, and nonceSize of the nonces.
+const (
+	keySize   = 32
+	nonceSize = 24
+)
+
+// encryptedFormat matches the values encrypted by ejson:
+// EJ[1:<ephemeral public key>:<nonce>:<box>], all base64 encoded.
+var encryptedFormat = regexp.MustCompile(`^EJ\[1:([A-Za-z0-9+/=]+):([A-Za-z0-9+/=]+):([A-Za-z0-9+/=]+)\]$`)
+
+// invalidNameCharacters matches the characters not allowed in secret names.
+var invalidNameCharacters = regexp.MustCompile(`[^a-z0-9_]`)
+
+// Parse reads an ejson file, and decrypts its values with the private key
+// found in keydir. Its signature is that of formatter.Parser once keydir is
+// given, see Parser.
+//
+// Nested keys are flattened into secret names, joined with underscores and
+// lower-cased, with any other invalid character replaced by an underscore:
+// {"database": {"Password": ...}} gives database_password.
+//
+// Keys prefixed with an underscore are left in plaintext by ejson, and are not
+// imported. The value of such a key is used as the description of the secret
+// with the same name without the underscore in the same object, if any.
+//
+// Numbers, booleans and null values are not encrypted by ejson, and are
+// skipped along with arrays.
+//
+// Secrets are returned sorted by name.
+func Parse(r io.Reader, keydir string) ([]formatter.Item, error) {
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to read input", 0)
+	}
+
+	values := make(map[string]interface{})
+	err = json.Unmarshal(b, &values)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to parse JSON", 0)
+	}
+
+	privateKey, err := findPrivateKey(values, keydir)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{privateKey: privateKey, paths: make(map[string]string)}
+
+	err = p.walk(values, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(p.items, func(i, j int) bool { return p.items[i].Name < p.items[j].Name })
+	return p.items, nil
+
+}
+
+// Parser returns a formatter.Parser reading ejson files with the private keys
+// found in keydir, see Parse.
+func Parser(keydir string) formatter.Parser {
+	return func(r io.Reader) ([]formatter.Item, error) {
+		return Parse(r, keydir)
+	}
+}
+
+// parser holds the state of a call to Parse.
+type parser struct {
+	privateKey *[keySize]byte
+
+	// items are the decrypted secrets.
+	items []formatter.Item
+
+	// paths maps each secret name to the key it was found at, to report
+	// keys giving the same name.
+	paths map[string]string
+}
+
+// walk decrypts the values of an object, and of the objects nested in it.
+// path is the dotted path of the object in the file, and prefix the secret
+// name it gives.
+func (p *parser) walk(values map[string]interface{}, path string, prefix string) error {
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+
+		if strings.HasPrefix(key, "_") {
+			continue
+		}
+
+		keyPath := path + key
+		name := prefix + invalidNameCharacters.ReplaceAllString(strings.ToLower(key), "_")
+
+		switch value := values[key].(type) {
+		case map[string]interface{}:
+
+			err := p.walk(value, keyPath+".", name+"_")
+			if err != nil {
+				return err
+			}
+
+		case string:
+
+			if other, ok := p.paths[name]; ok {
+				return errors.Errorf("Keys %s and %s both give the secret name %s", other, keyPath, name)
+			}
+			p.paths[name] = keyPath
+
+			plaintext, err := p.decrypt(keyPath, value)
+			if err != nil {
+				return err
+			}
+
+			// the public key of the file is not the description of a public_key
+			// secret
+			description := ""
+			if path != "" || "_"+key != publicKeyField {
+				description, _ = values["_"+key].(string)
+			}
+
+			p.items = append(p.items, formatter.Item{Name: name, Plaintext: plaintext, Description: description})
+
+		}
+
+	}
+
+	return nil
+
+}
+
+// decrypt opens a value encrypted by ejson.
+func (p *parser) decrypt(path string, value string) (string, error) {
+
+	matches := encryptedFormat.FindStringSubmatch(value)
+	if matches == nil {
+		return "", errors.Errorf("Value of %s is not encrypted by ejson", path)
+	}
+
+	var (
+		publicKey [keySize]byte
+		nonce     [nonceSize]byte
+	)
+
+	err := decodeBase64(publicKey[:], matches[1])
+	if err != nil {
+		return "", errors.WrapPrefix(err, fmt.Sprintf("Invalid public key in value of %s", path), 0)
+	}
+
+	err = decodeBase64(nonce[:], matches[2])
+	if err != nil {
+		return "", errors.WrapPrefix(err, fmt.Sprintf("Invalid nonce in value of %s", path), 0)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(matches[3])
+	if err != nil {
+		return "", errors.WrapPrefix(err, fmt.Sprintf("Invalid ciphertext in value of %s", path), 0)
+	}
+
+	plaintext, ok := box.Open(nil, ciphertext, &nonce, &publicKey, p.privateKey)
+	if !ok {
+		return "", errors.Errorf("Unable to decrypt value of %s", path)
+	}
+
+	return string(plaintext), nil
+
+}
+
+// findPrivateKey reads the private key matching the public key of an ejson
+// file from keydir.
+func findPrivateKey(values map[string]interface{}, keydir string) (*[keySize]byte, error) {
+
+	encoded, ok := values[publicKeyField].(string)
+	if !ok {
+		return nil, errors.Errorf("Unable to find %s, expected an ejson file", publicKeyField)
+	}
+
+	var publicKey [keySize]byte
+	err := decodeHex(publicKey[:], encoded)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, fmt.Sprintf("Invalid %s %s", publicKeyField, encoded), 0)
+	}
+
+	path := filepath.Join(keydir, encoded)
+	b, err := ioutil.ReadFile(path) // nolint: gosec
+	if err != nil {
+		return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to read private key at %s", path), 0)
+	}
+
+	var privateKey [keySize]byte
+	err = decodeHex(privateKey[:], strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, errors.WrapPrefix(err, fmt.Sprintf("Invalid private key at %s", path), 0)
+	}
+
+	var derived [keySize]byte
+	curve25519.ScalarBaseMult(&derived, &privateKey)
+	if subtle.ConstantTimeCompare(derived[:], publicKey[:]) != 1 {
+		return nil, errors.Errorf("Private key at %s does not match %s", path, publicKeyField)
+	}
+
+	return &privateKey, nil
+
+}
+
+// decodeHex decodes a hex string of exactly the size of dst.
+func decodeHex(dst []byte, encoded string) error {
+
+	b, err := hex.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+
+	if len(b) != len(dst) {
+		return errors.Errorf("Expected %d bytes, got %d", len(dst), len(b))
+	}
+
+	copy(dst, b)
+	return nil
+
+}
+
+// decodeBase64 decodes a base64 string of exactly the size of dst.
+func decodeBase64(dst []byte, encoded string) error {
+
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+
+	if len(b) != len(dst) {
+		return errors.Errorf("Expected %d bytes, got %d", len(dst), len(b))
+	}
+
+	copy(dst, b)
+	return nil
+
+}
@@ -0,0 +1,204 @@
+package ejson
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adrienkohlbecker/ejson-kms/formatter"
+)
+
+const (
+	testKeydir    = "./testdata/keys"
+	testPublicKey = "25e5241b7fa5c65fba5da0ffab0383c3f5a52faa53712df44e09a0850cf02479"
+
+	testEncrypted      = "EJ[1:tOa8cTh9L0TVZqt+n2pTxph9P4wgCeacjM+RN9C2ohs=:TN2R+WkBLGsKqjQswTleQYMvIissCwU5:hhjynuA09/nnWI2QvPG9QM1cQ+74Ow==]"
+	testEncryptedOther = "EJ[1:tOa8cTh9L0TVZqt+n2pTxph9P4wgCeacjM+RN9C2ohs=:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA:fmTbHasqWuJPLZpuiNew9E0=]"
+)
+
+// testParse parses an ejson file with the given fields besides the public key.
+func testParse(fields string) ([]formatter.Item, error) {
+	return Parse(strings.NewReader(fmt.Sprintf(`{"_public_key": "%s", %s}`, testPublicKey, fields)), testKeydir)
+}
+
+func TestParse(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		f, err := os.Open("./testdata/secrets.ejson")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer f.Close() // nolint: errcheck
+
+		items, err := Parser(testKeydir)(f)
+		assert.NoError(t, err)
+		assert.Equal(t, items, []formatter.Item{
+			{Name: "api_key", Plaintext: "abcdef", Description: "Key of the payments API"},
+			{Name: "database_password", Plaintext: "p@ss\"word\n", Description: "Password of the production database"},
+			{Name: "environment_my_token", Plaintext: "ghijklm"},
+		})
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		_, err := Parse(strings.NewReader("{"), testKeydir)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to parse JSON: unexpected end of JSON input")
+		}
+
+	})
+
+	t.Run("no public key", func(t *testing.T) {
+
+		_, err := Parse(strings.NewReader(`{"secret": "value"}`), testKeydir)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to find _public_key, expected an ejson file")
+		}
+
+	})
+
+	t.Run("invalid public key", func(t *testing.T) {
+
+		_, err := Parse(strings.NewReader(`{"_public_key": "abcd"}`), testKeydir)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid _public_key abcd: Expected 32 bytes, got 2")
+		}
+
+	})
+
+	t.Run("missing private key", func(t *testing.T) {
+
+		_, err := Parse(strings.NewReader(fmt.Sprintf(`{"_public_key": "%s"}`, testPublicKey)), "does-not-exist")
+		if assert.Error(t, err) {
+			path := filepath.Join("does-not-exist", testPublicKey)
+			assert.Equal(t, err.Error(), fmt.Sprintf("Unable to read private key at %s: open %s: no such file or directory", path, path))
+		}
+
+	})
+
+	t.Run("invalid private key", func(t *testing.T) {
+
+		withKeydir(t, "abcd", func(keydir string) {
+
+			_, err := Parse(strings.NewReader(fmt.Sprintf(`{"_public_key": "%s"}`, testPublicKey)), keydir)
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Invalid private key at %s: Expected 32 bytes, got 2", filepath.Join(keydir, testPublicKey)))
+			}
+
+		})
+
+	})
+
+	t.Run("mismatched private key", func(t *testing.T) {
+
+		withKeydir(t, strings.Repeat("00", 32), func(keydir string) {
+
+			_, err := Parse(strings.NewReader(fmt.Sprintf(`{"_public_key": "%s"}`, testPublicKey)), keydir)
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Private key at %s does not match _public_key", filepath.Join(keydir, testPublicKey)))
+			}
+
+		})
+
+	})
+
+	t.Run("not encrypted", func(t *testing.T) {
+
+		_, err := testParse(`"database": {"password": "value"}`)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Value of database.password is not encrypted by ejson")
+		}
+
+	})
+
+	t.Run("invalid encrypted value", func(t *testing.T) {
+
+		_, err := testParse(`"secret": "EJ[1:YWJj:YWJj:YWJj]"`)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid public key in value of secret: Expected 32 bytes, got 3")
+		}
+
+		_, err = testParse(`"secret": "EJ[1:tOa8cTh9L0TVZqt+n2pTxph9P4wgCeacjM+RN9C2ohs=:YWJj:YWJj]"`)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid nonce in value of secret: Expected 24 bytes, got 3")
+		}
+
+		_, err = testParse(`"secret": "EJ[1:tOa8cTh9L0TVZqt+n2pTxph9P4wgCeacjM+RN9C2ohs=:TN2R+WkBLGsKqjQswTleQYMvIissCwU5:YWJ]"`)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid ciphertext in value of secret: illegal base64 data at input byte 0")
+		}
+
+	})
+
+	t.Run("encrypted for another key", func(t *testing.T) {
+
+		_, err := testParse(fmt.Sprintf(`"secret": "%s"`, testEncryptedOther))
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt value of secret")
+		}
+
+	})
+
+	t.Run("other values", func(t *testing.T) {
+
+		items, err := testParse(fmt.Sprintf(`"secret": "%s", "port": 5432, "debug": true, "hosts": ["a", "b"], "replica": null`, testEncrypted))
+		assert.NoError(t, err)
+		assert.Equal(t, items, []formatter.Item{{Name: "secret", Plaintext: "abcdef"}})
+
+	})
+
+	t.Run("public key secret", func(t *testing.T) {
+
+		items, err := testParse(fmt.Sprintf(`"public_key": "%s", "nested": {"_public_key": "described", "public_key": "%s"}`, testEncrypted, testEncrypted))
+		assert.NoError(t, err)
+		assert.Equal(t, items, []formatter.Item{
+			{Name: "nested_public_key", Plaintext: "abcdef", Description: "described"},
+			{Name: "public_key", Plaintext: "abcdef"},
+		})
+
+	})
+
+	t.Run("same names", func(t *testing.T) {
+
+		_, err := testParse(fmt.Sprintf(`"database": {"password": "%s"}, "database_password": "%s"`, testEncrypted, testEncrypted))
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Keys database.password and database_password both give the secret name database_password")
+		}
+
+	})
+
+	t.Run("plaintext keys", func(t *testing.T) {
+
+		items, err := testParse(`"_comment": "value", "_nested": {"secret": "value"}, "_port": 5432`)
+		assert.NoError(t, err)
+		assert.Len(t, items, 0)
+
+	})
+
+}
+
+// withKeydir creates a temporary keydir holding the given private key for
+// testPublicKey.
+func withKeydir(t *testing.T, privateKey string, f func(keydir string)) {
+
+	keydir, err := ioutil.TempDir("", "ejson-kms-tests")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(keydir) // nolint: errcheck
+
+	err = ioutil.WriteFile(filepath.Join(keydir, testPublicKey), []byte(privateKey), 0600)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	f(keydir)
+
+}
@@ -1,6 +1,9 @@
 // Package formatter is a collection of functions used to format secrets for
 // output. Currently formatters for Bash, JSON and Dotenv are implemented.
 //
+// Parsers read the output of the Dotenv, JSON and YAML formatters back, to
+// import existing secrets.
+//
 // Example
 //
 // Here is how to use the formatters:
@@ -19,4 +22,10 @@
 //       // { "secret": "password" }
 //       formatter.JSON(os.Stdout, items)
 //  }
+//
+// And how to use the parsers:
+//
+//   // SECRET="password"
+//   items, err := formatter.ParseDotenv(os.Stdin)
+//   items[0].Name // "SECRET"
 package formatter
@@ -1,10 +1,13 @@
 package formatter
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
+
+	"github.com/go-errors/errors"
 )
 
 // Dotenv implements the Formatter interface.
@@ -34,3 +37,122 @@ func Dotenv(w io.Writer, creds <-chan Item) error {
 	return nil
 
 }
+
+// ParseDotenv implements the Parser interface.
+//
+// It reads secrets written by the Dotenv formatter, along with the common
+// forms found in hand-written files:
+//
+//   # comments and blank lines are ignored
+//   export MY_SECRET="quoted as a \"Go\" string\n"
+//   ANOTHER_ONE='single quoted, without escape sequences'
+//   UNQUOTED=value # trailing comments are ignored
+//
+// Secrets are returned in the order of the input. A key cannot be given twice.
+func ParseDotenv(r io.Reader) ([]Item, error) {
+
+	items := make([]Item, 0)
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for number := 1; scanner.Scan(); number++ {
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+
+		separator := strings.Index(line, "=")
+		if separator < 0 {
+			return nil, errors.Errorf("Invalid line %d: expected KEY=VALUE", number)
+		}
+
+		key := strings.TrimSpace(line[:separator])
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, errors.Errorf("Invalid line %d: expected KEY=VALUE", number)
+		}
+
+		value, err := parseDotenvValue(strings.TrimSpace(line[separator+1:]))
+		if err != nil {
+			return nil, errors.WrapPrefix(err, fmt.Sprintf("Invalid line %d", number), 0)
+		}
+
+		if seen[key] {
+			return nil, errors.Errorf("Invalid line %d: duplicate key %s", number, key)
+		}
+		seen[key] = true
+
+		items = append(items, Item{Name: key, Plaintext: value})
+
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to read input", 0)
+	}
+
+	return items, nil
+
+}
+
+// parseDotenvValue returns the value of a dotenv line, after the equal sign.
+func parseDotenvValue(raw string) (string, error) {
+
+	if raw == "" {
+		return "", nil
+	}
+
+	var value, rest string
+
+	switch raw[0] {
+	case '"':
+
+		end := 1
+		for end < len(raw) && raw[end] != '"' {
+			if raw[end] == '\\' {
+				end++
+			}
+			end++
+		}
+
+		if end >= len(raw) {
+			return "", errors.Errorf("Unterminated double quoted value")
+		}
+
+		var err error
+		value, err = strconv.Unquote(raw[:end+1])
+		if err != nil {
+			return "", errors.Errorf("Invalid double quoted value %s", raw[:end+1])
+		}
+		rest = raw[end+1:]
+
+	case '\'':
+
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", errors.Errorf("Unterminated single quoted value")
+		}
+
+		value, rest = raw[1:end+1], raw[end+2:]
+
+	default:
+
+		value = raw
+		if comment := strings.Index(raw, " #"); comment >= 0 {
+			value = strings.TrimSpace(raw[:comment])
+		}
+
+	}
+
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", errors.Errorf("Unexpected characters after quoted value: %s", rest)
+	}
+
+	return value, nil
+
+}
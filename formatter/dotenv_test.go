@@ -1,7 +1,71 @@
 package formatter
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func TestDotenv(t *testing.T) {
 	testFormatter(t, Dotenv, "./testdata/dotenv")
 }
+
+func TestParseDotenv(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+		testParser(t, ParseDotenv, "./testdata/dotenv", []Item{
+			{Name: "MY_SECRET", Plaintext: "my value"},
+			{Name: "ANOTHER_ONE", Plaintext: "string with \"double\" and 'single' quotes"},
+			{Name: "FOOBAR", Plaintext: "string\nwith\nnewlines"},
+		})
+	})
+
+	t.Run("hand-written", func(t *testing.T) {
+
+		input := `
+# database settings
+export DB_PASSWORD="p@ss\u00e9" # rotated monthly
+DB_USER = 'admin "root"'
+DB_HOST=db.internal # primary
+DB_NAME=my#db
+EMPTY=
+`
+
+		items, err := ParseDotenv(strings.NewReader(input))
+		assert.NoError(t, err)
+		assert.Equal(t, items, []Item{
+			{Name: "DB_PASSWORD", Plaintext: "p@ss\u00e9"},
+			{Name: "DB_USER", Plaintext: `admin "root"`},
+			{Name: "DB_HOST", Plaintext: "db.internal"},
+			{Name: "DB_NAME", Plaintext: "my#db"},
+			{Name: "EMPTY", Plaintext: ""},
+		})
+
+	})
+
+	invalid := map[string]string{
+		"A":               "Invalid line 1: expected KEY=VALUE",
+		"=value":          "Invalid line 1: expected KEY=VALUE",
+		"MY KEY=value":    "Invalid line 1: expected KEY=VALUE",
+		`A="unterminated`: "Invalid line 1: Unterminated double quoted value",
+		`A="\q"`:          `Invalid line 1: Invalid double quoted value "\q"`,
+		"A='unterminated": "Invalid line 1: Unterminated single quoted value",
+		`A="value" extra`: "Invalid line 1: Unexpected characters after quoted value: extra",
+		"A=1\n\nA=2":      "Invalid line 3: duplicate key A",
+	}
+
+	for input, expected := range invalid {
+
+		t.Run("invalid "+input, func(t *testing.T) {
+
+			_, err := ParseDotenv(strings.NewReader(input))
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), expected)
+			}
+
+		})
+
+	}
+
+}
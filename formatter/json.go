@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 
 	"github.com/go-errors/errors"
 )
@@ -40,3 +41,24 @@ func JSON(w io.Writer, creds <-chan Item) error {
 	return nil
 
 }
+
+// ParseJSON implements the Parser interface.
+//
+// It reads secrets written by the JSON formatter: an object whose values are
+// all strings. Secrets are returned sorted by name.
+func ParseJSON(r io.Reader) ([]Item, error) {
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to read input", 0)
+	}
+
+	values := make(map[string]string)
+	err = json.Unmarshal(b, &values)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to parse JSON", 0)
+	}
+
+	return sortedItems(values), nil
+
+}
@@ -1,7 +1,41 @@
 package formatter
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func TestJSON(t *testing.T) {
 	testFormatter(t, JSON, "./testdata/json.json")
 }
+
+func TestParseJSON(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+		testParser(t, ParseJSON, "./testdata/json.json", testItems)
+	})
+
+	t.Run("empty object", func(t *testing.T) {
+
+		items, err := ParseJSON(strings.NewReader("{}"))
+		assert.NoError(t, err)
+		assert.Len(t, items, 0)
+
+	})
+
+	for _, input := range []string{"", "[]", `{"a": 1}`, `{"a": {"b": "c"}}`} {
+
+		t.Run("invalid "+input, func(t *testing.T) {
+
+			_, err := ParseJSON(strings.NewReader(input))
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "Unable to parse JSON")
+			}
+
+		})
+
+	}
+
+}
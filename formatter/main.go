@@ -2,6 +2,7 @@ package formatter
 
 import (
 	"io"
+	"sort"
 )
 
 // Item is a parameter given to formatters, with the secret name
@@ -9,9 +10,32 @@ import (
 type Item struct {
 	Name      string
 	Plaintext string
+
+	// Description is only set by parsers of formats able to store one, such
+	// as ejson. It is ignored by formatters.
+	Description string
 }
 
 // Formatter is the interface implemented by formatters.
 //
 // It takes any Writer and a channel of Items (to ease parallelization of KMS calls)
 type Formatter func(w io.Writer, creds <-chan Item) error
+
+// Parser is the interface implemented by parsers, the inverse of formatters.
+//
+// It reads the secrets written by the corresponding formatter, and returns
+// them with their names as found in the input.
+type Parser func(r io.Reader) ([]Item, error)
+
+// sortedItems returns the items of a map, sorted by name.
+func sortedItems(values map[string]string) []Item {
+
+	items := make([]Item, 0, len(values))
+	for name, plaintext := range values {
+		items = append(items, Item{Name: name, Plaintext: plaintext})
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items
+
+}
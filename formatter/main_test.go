@@ -3,6 +3,7 @@ package formatter
 import (
 	"bytes"
 	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -36,3 +37,24 @@ func testFormatter(t *testing.T, formatter Formatter, dataPath string) {
 	assert.Equal(t, string(expected), string(exported))
 
 }
+
+func testParser(t *testing.T, parser Parser, dataPath string, expected []Item) {
+
+	f, err := os.Open(dataPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close() // nolint: errcheck
+
+	items, err := parser(f)
+	assert.NoError(t, err)
+	assert.Equal(t, items, expected)
+
+}
+
+// testItems are the items written by testFormatter, sorted by name
+var testItems = []Item{
+	{Name: "another_one", Plaintext: "string with \"double\" and 'single' quotes"},
+	{Name: "foobar", Plaintext: "string\nwith\nnewlines"},
+	{Name: "my_secret", Plaintext: "my value"},
+}
@@ -3,6 +3,7 @@ package formatter
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
 
 	"github.com/go-errors/errors"
 	"gopkg.in/yaml.v2"
@@ -35,3 +36,24 @@ func YAML(w io.Writer, creds <-chan Item) error {
 	return nil
 
 }
+
+// ParseYAML implements the Parser interface.
+//
+// It reads secrets written by the YAML formatter: a mapping whose values are
+// all scalars, kept as written. Secrets are returned sorted by name.
+func ParseYAML(r io.Reader) ([]Item, error) {
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to read input", 0)
+	}
+
+	values := make(map[string]string)
+	err = yaml.Unmarshal(b, &values)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to parse YAML", 0)
+	}
+
+	return sortedItems(values), nil
+
+}
@@ -1,7 +1,41 @@
 package formatter
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func TestYAML(t *testing.T) {
 	testFormatter(t, YAML, "./testdata/yaml.yaml")
 }
+
+func TestParseYAML(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+		testParser(t, ParseYAML, "./testdata/yaml.yaml", testItems)
+	})
+
+	t.Run("scalars", func(t *testing.T) {
+
+		items, err := ParseYAML(strings.NewReader("port: 5432\nenabled: true\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, items, []Item{{Name: "enabled", Plaintext: "true"}, {Name: "port", Plaintext: "5432"}})
+
+	})
+
+	for _, input := range []string{"- a\n- b\n", "a:\n  b: c\n", "a: [b]\n"} {
+
+		t.Run("invalid "+input, func(t *testing.T) {
+
+			_, err := ParseYAML(strings.NewReader(input))
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "Unable to parse YAML")
+			}
+
+		})
+
+	}
+
+}
@@ -3,23 +3,16 @@ module github.com/adrienkohlbecker/ejson-kms
 go 1.16
 
 require (
-	github.com/aws/aws-sdk-go v1.4.11-0.20160916202804-b2dc98bb584e
+	github.com/aws/aws-sdk-go v1.44.0
 	github.com/cpuguy83/go-md2man v1.0.6 // indirect
-	github.com/davecgh/go-spew v0.0.0-20151105211317-5215b55f46b2 // indirect
 	github.com/go-errors/errors v1.0.2-0.20180813162953-d98b870cc4e0
-	github.com/go-ini/ini v1.39.0 // indirect
 	github.com/howeyc/gopass v0.0.0-20160912125546-26c6e1184fd5
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
-	github.com/jmespath/go-jmespath v0.0.0-20151117175822-3433f3ea46d9 // indirect
-	github.com/pmezard/go-difflib v0.0.0-20151028094244-d8ed2627bdf0 // indirect
 	github.com/russross/blackfriday v0.0.0-20160716153403-93622da34e54 // indirect
 	github.com/shurcooL/sanitized_anchor_name v0.0.0-20170918181015-86672fcb3f95 // indirect
-	github.com/smartystreets/goconvey v1.6.4 // indirect
 	github.com/spf13/cobra v0.0.0-20160830174925-9c28e4bbd74e
 	github.com/spf13/pflag v0.0.0-20160915153101-c7e63cf4530b // indirect
-	github.com/stretchr/objx v0.0.0-20140526180921-cbeaeb16a013 // indirect
 	github.com/stretchr/testify v1.1.4-0.20160615092844-d77da356e56a
 	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
-	gopkg.in/ini.v1 v1.62.0 // indirect
-	gopkg.in/yaml.v2 v2.2.2
+	gopkg.in/yaml.v2 v2.2.8
 )
@@ -1,4 +1,17 @@
-// Package kms implements a client to AWS KMS.
+// Package kms implements a client to AWS KMS, and the KeyProvider interface
+// used to plug other master key backends.
+//
+// Key providers
+//
+// A KeyProvider generates data keys wrapped by a master key, and unwraps them.
+// The provider to use is selected by the scheme of the key ID stored in the
+// secrets file, such as "awskms://alias/MyAliasName". Key IDs without a scheme
+// are handled by AWS KMS. FileProvider uses a master key stored in a local
+// keyfile instead, for "file://" key IDs, and VaultProvider uses the transit
+// engine of HashiCorp Vault for "vault-transit://" key IDs.
+//
+//   provider := kms.Providers{kms.NewAWSProvider(client), kms.NewFileProvider()}
+//   provider.GenerateDataKey(ctx, "awskms://alias/MyAliasName", encryptionContext)
 //
 // Example
 //
@@ -9,4 +22,21 @@
 //   => kms.DataKey{Ciphertext: "abcd...", Plaintext: "foo..."}
 //   kms.DecryptDataKey(client, key.Ciphertext, encryptionContext)
 //   => kms.DataKey{Ciphertext: "abcd...", Plaintext: "foo..."}
+//
+// Each function has a WithContext variant, to set a deadline or cancel the
+// call to AWS KMS:
+//
+//   ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+//   defer cancel()
+//   kms.DecryptDataKeyWithContext(ctx, client, key.Ciphertext, encryptionContext)
+//
+// Retries
+//
+// Clients returned by DefaultClient and NewClient retry calls failing with a
+// throttling or transient error, with a jittered exponential backoff. Any
+// other Client can be wrapped the same way:
+//
+//   policy := kms.DefaultRetryPolicy()
+//   policy.MaxRetries = 10
+//   client = kms.NewRetryClient(client, policy)
 package kms
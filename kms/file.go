@@ -0,0 +1,219 @@
+package kms
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+// SchemeFile is the scheme of key IDs pointing to a local keyfile, such as
+// "file://.ejson-kms.key".
+const SchemeFile = "file"
+
+const (
+	masterKeySize    = 32
+	dataKeySize      = 32
+	fileKeyVersion   = byte(1)
+	fileKeyNonceSize = 12
+)
+
+// FileProvider implements KeyProvider using a 256 bits master key stored in a
+// local keyfile. It does not need any network access, which makes it suitable
+// for development and CI.
+//
+// Data keys are wrapped with AES-256-GCM, and the encryption context is
+// authenticated as additional data: like with AWS KMS, the exact same context
+// must be given to decrypt a data key.
+//
+// The key ID is the path of the keyfile prefixed by "file://". Relative paths
+// are resolved from the working directory.
+type FileProvider struct {
+	// _hidden is a dummy hidden key to force the use of explicit keys when
+	// initializing the struct. Allows adding keys in the future without
+	// breaking code
+	_hidden struct{}
+}
+
+// NewFileProvider returns a KeyProvider backed by local keyfiles.
+func NewFileProvider() *FileProvider {
+	return &FileProvider{}
+}
+
+// GenerateDataKey implements KeyProvider
+func (p *FileProvider) GenerateDataKey(ctx context.Context, keyID string, encryptionContext map[string]*string) (DataKey, error) {
+
+	if ctx.Err() != nil {
+		return DataKey{}, errors.WrapPrefix(ctx.Err(), "Unable to generate data key", 0)
+	}
+
+	aead, err := fileAEAD(keyID)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to generate data key", 0)
+	}
+
+	additionalData, err := canonicalContext(encryptionContext)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to generate data key", 0)
+	}
+
+	plaintext := make([]byte, dataKeySize)
+	_, err = io.ReadFull(rand.Reader, plaintext)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to generate data key", 0)
+	}
+
+	ciphertext, err := fileSeal(aead, plaintext, additionalData)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to generate data key", 0)
+	}
+
+	return DataKey{Ciphertext: ciphertext, Plaintext: plaintext}, nil
+
+}
+
+// EncryptDataKey implements KeyProvider
+func (p *FileProvider) EncryptDataKey(ctx context.Context, keyID string, plaintext []byte, encryptionContext map[string]*string) (DataKey, error) {
+
+	if ctx.Err() != nil {
+		return DataKey{}, errors.WrapPrefix(ctx.Err(), "Unable to encrypt data key", 0)
+	}
+
+	aead, err := fileAEAD(keyID)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to encrypt data key", 0)
+	}
+
+	additionalData, err := canonicalContext(encryptionContext)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to encrypt data key", 0)
+	}
+
+	ciphertext, err := fileSeal(aead, plaintext, additionalData)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to encrypt data key", 0)
+	}
+
+	return DataKey{Ciphertext: ciphertext, Plaintext: plaintext}, nil
+
+}
+
+// DecryptDataKey implements KeyProvider
+func (p *FileProvider) DecryptDataKey(ctx context.Context, keyID string, ciphertext []byte, encryptionContext map[string]*string) (DataKey, error) {
+
+	if ctx.Err() != nil {
+		return DataKey{}, errors.WrapPrefix(ctx.Err(), "Unable to decrypt key ciphertext", 0)
+	}
+
+	aead, err := fileAEAD(keyID)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to decrypt key ciphertext", 0)
+	}
+
+	additionalData, err := canonicalContext(encryptionContext)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to decrypt key ciphertext", 0)
+	}
+
+	if len(ciphertext) < 1+fileKeyNonceSize || ciphertext[0] != fileKeyVersion {
+		return DataKey{}, errors.Errorf("Unable to decrypt key ciphertext: Invalid format")
+	}
+
+	nonce := ciphertext[1 : 1+fileKeyNonceSize]
+	plaintext, err := aead.Open(nil, nonce, ciphertext[1+fileKeyNonceSize:], additionalData)
+	if err != nil {
+		return DataKey{}, errors.Errorf("Unable to decrypt key ciphertext: Invalid master key or encryption context")
+	}
+
+	return DataKey{Ciphertext: ciphertext, Plaintext: plaintext}, nil
+
+}
+
+// Handles implements KeyProvider. It handles key IDs with the "file" scheme.
+func (p *FileProvider) Handles(keyID string) bool {
+	return Scheme(keyID) == SchemeFile
+}
+
+// GenerateKeyFile creates a new random master key, and writes it to a new
+// keyfile at the given path, only readable by its owner. It returns the key
+// ID to use in secrets files.
+func GenerateKeyFile(path string) (string, error) {
+
+	key := make([]byte, masterKeySize)
+	_, err := io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return "", errors.WrapPrefix(err, "Unable to generate master key", 0)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600) // nolint: gosec
+	if err != nil {
+		return "", errors.WrapPrefix(err, fmt.Sprintf("Unable to create keyfile at %s", path), 0)
+	}
+
+	_, err = file.WriteString(base64.StdEncoding.EncodeToString(key) + "\n")
+	cerr := file.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", errors.WrapPrefix(err, fmt.Sprintf("Unable to write keyfile at %s", path), 0)
+	}
+
+	return SchemeFile + "://" + path, nil
+
+}
+
+// fileAEAD reads the master key from the keyfile the key ID points to, and
+// returns the AES-GCM instance used to wrap data keys.
+func fileAEAD(keyID string) (cipher.AEAD, error) {
+
+	path := trimScheme(keyID, SchemeFile)
+
+	contents, err := ioutil.ReadFile(path) // nolint: gosec
+	if err != nil {
+		return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to read keyfile at %s", path), 0)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil || len(key) != masterKeySize {
+		return nil, errors.Errorf("Invalid keyfile at %s: expected a base64 encoded 256 bits key", path)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to initialize cipher", 0)
+	}
+
+	return cipher.NewGCM(block)
+
+}
+
+// fileSeal wraps a data key with a random nonce, prefixed by the format
+// version.
+func fileSeal(aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, error) {
+
+	nonce := make([]byte, fileKeyNonceSize)
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to generate nonce", 0)
+	}
+
+	ciphertext := append([]byte{fileKeyVersion}, nonce...)
+	return aead.Seal(ciphertext, nonce, plaintext, additionalData), nil
+
+}
+
+// canonicalContext encodes the encryption context deterministically, to be
+// authenticated along with the data key. encoding/json sorts map keys.
+func canonicalContext(encryptionContext map[string]*string) ([]byte, error) {
+	return json.Marshal(encryptionContext)
+}
@@ -0,0 +1,212 @@
+package kms
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withTempKeyFile(t *testing.T, f func(keyID string)) {
+
+	dir, err := ioutil.TempDir("", "ejson-kms")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	keyID, err := GenerateKeyFile(filepath.Join(dir, "master.key"))
+	assert.NoError(t, err)
+
+	f(keyID)
+
+}
+
+func TestGenerateKeyFile(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		dir, err := ioutil.TempDir("", "ejson-kms")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		path := filepath.Join(dir, "master.key")
+
+		keyID, err := GenerateKeyFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, keyID, "file://"+path)
+
+		stat, err := os.Stat(path)
+		if assert.NoError(t, err) {
+			assert.Equal(t, stat.Mode().Perm(), os.FileMode(0600))
+		}
+
+		_, err = fileAEAD(keyID)
+		assert.NoError(t, err)
+
+	})
+
+	t.Run("existing file", func(t *testing.T) {
+
+		file, err := ioutil.TempFile("", "ejson-kms")
+		assert.NoError(t, err)
+		defer os.Remove(file.Name()) // nolint: errcheck
+		assert.NoError(t, file.Close())
+
+		_, err = GenerateKeyFile(file.Name())
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to create keyfile at")
+		}
+
+	})
+
+}
+
+func TestFileProvider(t *testing.T) {
+
+	value := "production"
+	encryptionContext := map[string]*string{"ENV": &value, "Secret": nil}
+
+	t.Run("handles", func(t *testing.T) {
+
+		provider := NewFileProvider()
+
+		assert.True(t, provider.Handles("file://master.key"))
+		assert.False(t, provider.Handles("awskms://"+testKeyID))
+		assert.False(t, provider.Handles(testKeyID))
+
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+
+		withTempKeyFile(t, func(keyID string) {
+
+			provider := NewFileProvider()
+
+			key, err := provider.GenerateDataKey(context.Background(), keyID, encryptionContext)
+			assert.NoError(t, err)
+			assert.Len(t, key.Plaintext, 32)
+
+			decrypted, err := provider.DecryptDataKey(context.Background(), keyID, key.Ciphertext, encryptionContext)
+			assert.NoError(t, err)
+			assert.Equal(t, decrypted.Plaintext, key.Plaintext)
+			assert.Equal(t, decrypted.Ciphertext, key.Ciphertext)
+
+		})
+
+	})
+
+	t.Run("encrypt existing data key", func(t *testing.T) {
+
+		withTempKeyFile(t, func(keyID string) {
+
+			provider := NewFileProvider()
+			plaintext := []byte("-abcdefabcdefabcdefabcdefabcdef-")
+
+			key, err := provider.EncryptDataKey(context.Background(), keyID, plaintext, encryptionContext)
+			assert.NoError(t, err)
+			assert.Equal(t, key.Plaintext, plaintext)
+
+			decrypted, err := provider.DecryptDataKey(context.Background(), keyID, key.Ciphertext, encryptionContext)
+			assert.NoError(t, err)
+			assert.Equal(t, decrypted.Plaintext, plaintext)
+
+		})
+
+	})
+
+	t.Run("different encryption context", func(t *testing.T) {
+
+		withTempKeyFile(t, func(keyID string) {
+
+			provider := NewFileProvider()
+
+			key, err := provider.GenerateDataKey(context.Background(), keyID, encryptionContext)
+			assert.NoError(t, err)
+
+			other := "staging"
+			_, err = provider.DecryptDataKey(context.Background(), keyID, key.Ciphertext, map[string]*string{"ENV": &other, "Secret": nil})
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Unable to decrypt key ciphertext: Invalid master key or encryption context")
+			}
+
+		})
+
+	})
+
+	t.Run("different master key", func(t *testing.T) {
+
+		withTempKeyFile(t, func(keyID string) {
+			withTempKeyFile(t, func(otherKeyID string) {
+
+				provider := NewFileProvider()
+
+				key, err := provider.GenerateDataKey(context.Background(), keyID, encryptionContext)
+				assert.NoError(t, err)
+
+				_, err = provider.DecryptDataKey(context.Background(), otherKeyID, key.Ciphertext, encryptionContext)
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "Unable to decrypt key ciphertext: Invalid master key or encryption context")
+				}
+
+			})
+		})
+
+	})
+
+	t.Run("invalid ciphertext", func(t *testing.T) {
+
+		withTempKeyFile(t, func(keyID string) {
+
+			_, err := NewFileProvider().DecryptDataKey(context.Background(), keyID, []byte(testKeyCiphertext), encryptionContext)
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Unable to decrypt key ciphertext: Invalid format")
+			}
+
+		})
+
+	})
+
+	t.Run("missing keyfile", func(t *testing.T) {
+
+		_, err := NewFileProvider().GenerateDataKey(context.Background(), "file://does-not-exist", encryptionContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to generate data key: Unable to read keyfile at does-not-exist: open does-not-exist: no such file or directory")
+		}
+
+	})
+
+	t.Run("invalid keyfile", func(t *testing.T) {
+
+		file, err := ioutil.TempFile("", "ejson-kms")
+		assert.NoError(t, err)
+		defer os.Remove(file.Name()) // nolint: errcheck
+		_, err = file.WriteString("not a key\n")
+		assert.NoError(t, err)
+		assert.NoError(t, file.Close())
+
+		_, err = NewFileProvider().DecryptDataKey(context.Background(), "file://"+file.Name(), []byte(testKeyCiphertext), encryptionContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt key ciphertext: Invalid keyfile at "+file.Name()+": expected a base64 encoded 256 bits key")
+		}
+
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		withTempKeyFile(t, func(keyID string) {
+
+			_, err := NewFileProvider().DecryptDataKey(ctx, keyID, []byte(testKeyCiphertext), encryptionContext)
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Unable to decrypt key ciphertext: context canceled")
+			}
+
+		})
+
+	})
+
+}
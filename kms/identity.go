@@ -0,0 +1,41 @@
+package kms
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/go-errors/errors"
+)
+
+// identityClient is the subset of sts.STS used by CallerIdentity.
+type identityClient interface {
+	GetCallerIdentityWithContext(aws.Context, *sts.GetCallerIdentityInput, ...request.Option) (*sts.GetCallerIdentityOutput, error)
+}
+
+// CallerIdentity returns the ARN of the AWS identity whose credentials are
+// read from the environment, such as "arn:aws:iam::123456789012:user/alice".
+func CallerIdentity(ctx context.Context) (string, error) {
+
+	sess, err := session.NewSession()
+	if err != nil {
+		return "", errors.WrapPrefix(err, "Unable to create AWS session", 0)
+	}
+
+	return callerIdentity(ctx, sts.New(sess))
+
+}
+
+// callerIdentity returns the ARN of the identity calling the given client.
+func callerIdentity(ctx context.Context, client identityClient) (string, error) {
+
+	resp, err := client.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", errors.WrapPrefix(err, "Unable to get AWS caller identity", 0)
+	}
+
+	return aws.StringValue(resp.Arn), nil
+
+}
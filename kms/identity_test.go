@@ -0,0 +1,48 @@
+package kms
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeIdentityClient struct {
+	arn string
+	err error
+}
+
+func (c *fakeIdentityClient) GetCallerIdentityWithContext(ctx aws.Context, input *sts.GetCallerIdentityInput, opts ...request.Option) (*sts.GetCallerIdentityOutput, error) {
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	return &sts.GetCallerIdentityOutput{Arn: aws.String(c.arn)}, nil
+
+}
+
+func TestCallerIdentity(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		arn, err := callerIdentity(context.Background(), &fakeIdentityClient{arn: "arn:aws:iam::123456789012:user/alice"})
+		assert.NoError(t, err)
+		assert.Equal(t, arn, "arn:aws:iam::123456789012:user/alice")
+
+	})
+
+	t.Run("with aws error", func(t *testing.T) {
+
+		_, err := callerIdentity(context.Background(), &fakeIdentityClient{err: errors.New("testing errors")})
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to get AWS caller identity: testing errors")
+		}
+
+	})
+
+}
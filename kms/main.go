@@ -1,7 +1,13 @@
 package kms
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/go-errors/errors"
@@ -22,19 +28,157 @@ type DataKey struct {
 // Client is the interface that is implemented by kms.KMS.
 type Client interface {
 	GenerateDataKey(*kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error)
+	Encrypt(*kms.EncryptInput) (*kms.EncryptOutput, error)
 	Decrypt(*kms.DecryptInput) (*kms.DecryptOutput, error)
+	GenerateDataKeyWithContext(aws.Context, *kms.GenerateDataKeyInput, ...request.Option) (*kms.GenerateDataKeyOutput, error)
+	EncryptWithContext(aws.Context, *kms.EncryptInput, ...request.Option) (*kms.EncryptOutput, error)
+	DecryptWithContext(aws.Context, *kms.DecryptInput, ...request.Option) (*kms.DecryptOutput, error)
+}
+
+// AWSProvider implements KeyProvider using AWS KMS.
+type AWSProvider struct {
+	// _hidden is a dummy hidden key to force the use of explicit keys when
+	// initializing the struct. Allows adding keys in the future without
+	// breaking code
+	_hidden struct{}
+
+	// Client is the AWS KMS client
+	Client Client
+
+	// RegionClient returns an AWS KMS client for the given region. When set,
+	// it is used for the master keys identified by an ARN, so that a file can
+	// use keys in several regions. Other key IDs, such as alias names, use
+	// Client and the region of its session.
+	RegionClient func(region string) (Client, error)
+
+	// regionClients caches the clients returned by RegionClient
+	regionClients map[string]Client
+	mu            sync.Mutex
+}
+
+// NewAWSProvider returns a KeyProvider backed by the given AWS KMS client.
+func NewAWSProvider(client Client) *AWSProvider {
+	return &AWSProvider{Client: client}
+}
+
+// GenerateDataKey implements KeyProvider, see GenerateDataKey.
+func (p *AWSProvider) GenerateDataKey(ctx context.Context, keyID string, encryptionContext map[string]*string) (DataKey, error) {
+
+	client, err := p.client(keyID)
+	if err != nil {
+		return DataKey{}, err
+	}
+
+	return GenerateDataKeyWithContext(ctx, client, trimScheme(keyID, SchemeAWS), encryptionContext)
+
+}
+
+// EncryptDataKey implements KeyProvider, see EncryptDataKey.
+func (p *AWSProvider) EncryptDataKey(ctx context.Context, keyID string, plaintext []byte, encryptionContext map[string]*string) (DataKey, error) {
+
+	client, err := p.client(keyID)
+	if err != nil {
+		return DataKey{}, err
+	}
+
+	return EncryptDataKeyWithContext(ctx, client, trimScheme(keyID, SchemeAWS), plaintext, encryptionContext)
+
+}
+
+// DecryptDataKey implements KeyProvider, see DecryptDataKey. AWS KMS stores
+// the key ID in the wrapped data key, the given one only selects the region.
+func (p *AWSProvider) DecryptDataKey(ctx context.Context, keyID string, ciphertext []byte, encryptionContext map[string]*string) (DataKey, error) {
+
+	client, err := p.client(keyID)
+	if err != nil {
+		return DataKey{}, err
+	}
+
+	return DecryptDataKeyWithContext(ctx, client, ciphertext, encryptionContext)
+
+}
+
+// Handles implements KeyProvider. AWS KMS handles key IDs with the "awskms"
+// scheme, and key IDs without any scheme.
+func (p *AWSProvider) Handles(keyID string) bool {
+	scheme := Scheme(keyID)
+	return scheme == "" || scheme == SchemeAWS
+}
+
+// client returns the client for the region of the given key ID.
+func (p *AWSProvider) client(keyID string) (Client, error) {
+
+	region := KeyRegion(keyID)
+	if region == "" || p.RegionClient == nil {
+		return p.Client, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if client, ok := p.regionClients[region]; ok {
+		return client, nil
+	}
+
+	client, err := p.RegionClient(region)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to create AWS client for region %s", region), 0)
+	}
+
+	if p.regionClients == nil {
+		p.regionClients = make(map[string]Client)
+	}
+	p.regionClients[region] = client
+
+	return client, nil
+
+}
+
+// KeyRegion returns the AWS region of a key ID given as an ARN, such as
+// "eu-west-1" for "arn:aws:kms:eu-west-1:123456789012:alias/MyAliasName". It
+// returns an empty string for other key IDs, which do not specify a region.
+func KeyRegion(keyID string) string {
+
+	parts := strings.SplitN(trimScheme(keyID, SchemeAWS), ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "kms" {
+		return ""
+	}
+
+	return parts[3]
+
 }
 
 // DefaultClient creates a new AWS session (reads credentials and settings from
-// the environment), and returns a ready-to-use KMS instance.
+// the environment), and returns a ready-to-use KMS instance. Failed calls are
+// retried following DefaultRetryPolicy.
 func DefaultClient() (Client, error) {
+	return NewClient(DefaultRetryPolicy())
+}
+
+// NewClient is the same as DefaultClient, with failed calls retried following
+// the given policy. The retries of the AWS SDK are disabled in favor of the
+// policy.
+func NewClient(policy RetryPolicy) (Client, error) {
+
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to create AWS session", 0)
+	}
+
+	return NewRetryClient(kms.New(sess, aws.NewConfig().WithMaxRetries(0)), policy), nil
+
+}
+
+// NewRegionClient is the same as NewClient, for the given region instead of
+// the region of the environment. See AWSProvider.RegionClient.
+func NewRegionClient(policy RetryPolicy, region string) (Client, error) {
 
 	sess, err := session.NewSession()
 	if err != nil {
 		return nil, errors.WrapPrefix(err, "Unable to create AWS session", 0)
 	}
 
-	return kms.New(sess), nil
+	return NewRetryClient(kms.New(sess, aws.NewConfig().WithMaxRetries(0).WithRegion(region)), policy), nil
 
 }
 
@@ -47,6 +191,12 @@ func DefaultClient() (Client, error) {
 // the key, logged through AWS CloudTrail (if enabled), and must be provided
 // as is for each future use of the data key.
 func GenerateDataKey(client Client, kmsKeyID string, encryptionContext map[string]*string) (DataKey, error) {
+	return GenerateDataKeyWithContext(context.Background(), client, kmsKeyID, encryptionContext)
+}
+
+// GenerateDataKeyWithContext is the same as GenerateDataKey, with the ability
+// to cancel the request or set a deadline with the given context.
+func GenerateDataKeyWithContext(ctx context.Context, client Client, kmsKeyID string, encryptionContext map[string]*string) (DataKey, error) {
 
 	params := &kms.GenerateDataKeyInput{
 		KeyId:             aws.String(kmsKeyID),
@@ -55,7 +205,7 @@ func GenerateDataKey(client Client, kmsKeyID string, encryptionContext map[strin
 		KeySpec:           aws.String("AES_256"), // to generate a 32 bytes key for secretbox
 	}
 
-	resp, err := client.GenerateDataKey(params)
+	resp, err := client.GenerateDataKeyWithContext(ctx, params)
 	if err != nil {
 		return DataKey{}, errors.WrapPrefix(err, "Unable to generate data key", 0)
 	}
@@ -64,9 +214,44 @@ func GenerateDataKey(client Client, kmsKeyID string, encryptionContext map[strin
 
 }
 
+// EncryptDataKey wraps an existing data key with the given KMS master key, so
+// that the same data key can be decrypted by several master keys.
+//
+// The encryptionContext must be provided as is for each future use of the
+// data key, like with GenerateDataKey.
+func EncryptDataKey(client Client, kmsKeyID string, plaintext []byte, encryptionContext map[string]*string) (DataKey, error) {
+	return EncryptDataKeyWithContext(context.Background(), client, kmsKeyID, plaintext, encryptionContext)
+}
+
+// EncryptDataKeyWithContext is the same as EncryptDataKey, with the ability
+// to cancel the request or set a deadline with the given context.
+func EncryptDataKeyWithContext(ctx context.Context, client Client, kmsKeyID string, plaintext []byte, encryptionContext map[string]*string) (DataKey, error) {
+
+	params := &kms.EncryptInput{
+		KeyId:             aws.String(kmsKeyID),
+		Plaintext:         plaintext,
+		EncryptionContext: encryptionContext,
+		GrantTokens:       []*string{},
+	}
+
+	resp, err := client.EncryptWithContext(ctx, params)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to encrypt data key", 0)
+	}
+
+	return DataKey{Ciphertext: resp.CiphertextBlob, Plaintext: plaintext}, nil
+
+}
+
 // DecryptDataKey takes an encrypted data key and associated encryptionContext,
 // and returns the key plaintext (along with the ciphertext for consistency).
 func DecryptDataKey(client Client, ciphertext []byte, encryptionContext map[string]*string) (DataKey, error) {
+	return DecryptDataKeyWithContext(context.Background(), client, ciphertext, encryptionContext)
+}
+
+// DecryptDataKeyWithContext is the same as DecryptDataKey, with the ability
+// to cancel the request or set a deadline with the given context.
+func DecryptDataKeyWithContext(ctx context.Context, client Client, ciphertext []byte, encryptionContext map[string]*string) (DataKey, error) {
 
 	params := &kms.DecryptInput{
 		CiphertextBlob:    ciphertext,
@@ -74,7 +259,7 @@ func DecryptDataKey(client Client, ciphertext []byte, encryptionContext map[stri
 		GrantTokens:       []*string{},
 	}
 
-	resp, err := client.Decrypt(params)
+	resp, err := client.DecryptWithContext(ctx, params)
 	if err != nil {
 		return DataKey{}, errors.WrapPrefix(err, "Unable to decrypt key ciphertext", 0)
 	}
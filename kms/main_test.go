@@ -1,6 +1,7 @@
 package kms
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
@@ -20,6 +21,11 @@ const (
 
 func TestDummy(t *testing.T) {
 	_ = DataKey{_hidden: struct{}{}}
+	_ = AWSProvider{_hidden: struct{}{}}
+	_ = FileProvider{_hidden: struct{}{}}
+	_ = VaultProvider{_hidden: struct{}{}}
+	_ = RetryPolicy{_hidden: struct{}{}}
+	_ = RetryClient{_hidden: struct{}{}}
 }
 
 func TestDefaultClient(t *testing.T) {
@@ -29,6 +35,7 @@ func TestDefaultClient(t *testing.T) {
 		s, err := DefaultClient()
 		if assert.NoError(t, err) {
 			assert.Implements(t, new(Client), s)
+			assert.Equal(t, s.(*RetryClient).Policy, DefaultRetryPolicy())
 		}
 
 	})
@@ -90,6 +97,39 @@ func TestGenerateDataKey(t *testing.T) {
 
 }
 
+func TestEncryptDataKey(t *testing.T) {
+
+	t.Run("without AWS error", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Encrypt", testKeyID, testKeyPlaintext, testContext).Return(testKeyCiphertext, nil).Once()
+
+		expected := DataKey{
+			Ciphertext: []byte(testKeyCiphertext),
+			Plaintext:  []byte(testKeyPlaintext),
+		}
+
+		key, err := EncryptDataKey(client, testKeyID, []byte(testKeyPlaintext), testContext)
+		assert.NoError(t, err)
+		assert.Equal(t, key, expected)
+
+	})
+
+	t.Run("with AWS error", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Encrypt", testKeyID, testKeyPlaintext, testContext).Return("", errors.New("testing errors")).Once()
+
+		_, err := EncryptDataKey(client, testKeyID, []byte(testKeyPlaintext), testContext)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to encrypt data key")
+			assert.Contains(t, err.Error(), "testing errors")
+		}
+
+	})
+
+}
+
 func TestDecryptDataKey(t *testing.T) {
 
 	t.Run("without AWS error", func(t *testing.T) {
@@ -122,3 +162,158 @@ func TestDecryptDataKey(t *testing.T) {
 	})
 
 }
+
+func TestDataKeyWithContext(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := &kms_mock.Client{}
+
+	_, err := GenerateDataKeyWithContext(ctx, client, testKeyID, testContext)
+	if assert.Error(t, err) {
+		assert.Equal(t, err.Error(), "Unable to generate data key: context canceled")
+	}
+
+	_, err = EncryptDataKeyWithContext(ctx, client, testKeyID, []byte(testKeyPlaintext), testContext)
+	if assert.Error(t, err) {
+		assert.Equal(t, err.Error(), "Unable to encrypt data key: context canceled")
+	}
+
+	_, err = DecryptDataKeyWithContext(ctx, client, []byte(testKeyCiphertext), testContext)
+	if assert.Error(t, err) {
+		assert.Equal(t, err.Error(), "Unable to decrypt key ciphertext: context canceled")
+	}
+
+	client.AssertExpectations(t)
+
+}
+
+func TestAWSProvider(t *testing.T) {
+
+	t.Run("handles", func(t *testing.T) {
+
+		provider := NewAWSProvider(&kms_mock.Client{})
+
+		assert.True(t, provider.Handles(testKeyID))
+		assert.True(t, provider.Handles("awskms://"+testKeyID))
+		assert.False(t, provider.Handles("file://"+testKeyID))
+
+	})
+
+	t.Run("generate data key", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Twice()
+
+		provider := NewAWSProvider(client)
+
+		expected := DataKey{
+			Ciphertext: []byte(testKeyCiphertext),
+			Plaintext:  []byte(testKeyPlaintext),
+		}
+
+		key, err := provider.GenerateDataKey(context.Background(), testKeyID, testContext)
+		assert.NoError(t, err)
+		assert.Equal(t, key, expected)
+
+		key, err = provider.GenerateDataKey(context.Background(), "awskms://"+testKeyID, testContext)
+		assert.NoError(t, err)
+		assert.Equal(t, key, expected)
+
+	})
+
+	t.Run("encrypt data key", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Encrypt", testKeyID, testKeyPlaintext, testContext).Return(testKeyCiphertext, nil).Once()
+
+		provider := NewAWSProvider(client)
+
+		key, err := provider.EncryptDataKey(context.Background(), "awskms://"+testKeyID, []byte(testKeyPlaintext), testContext)
+		assert.NoError(t, err)
+		assert.Equal(t, key.Ciphertext, []byte(testKeyCiphertext))
+
+	})
+
+	t.Run("decrypt data key", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		provider := NewAWSProvider(client)
+
+		key, err := provider.DecryptDataKey(context.Background(), testKeyID, []byte(testKeyCiphertext), testContext)
+		assert.NoError(t, err)
+		assert.Equal(t, key.Plaintext, []byte(testKeyPlaintext))
+
+	})
+
+	t.Run("region clients", func(t *testing.T) {
+
+		keyID := "arn:aws:kms:eu-west-1:123456789012:alias/MyAliasName"
+
+		regional := &kms_mock.Client{}
+		regional.On("Encrypt", keyID, testKeyPlaintext, testContext).Return(testKeyCiphertext, nil).Once()
+		regional.On("Decrypt", testKeyCiphertext, testContext).Return(keyID, testKeyPlaintext, nil).Once()
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		regions := make([]string, 0)
+
+		provider := NewAWSProvider(client)
+		provider.RegionClient = func(region string) (Client, error) {
+			regions = append(regions, region)
+			return regional, nil
+		}
+
+		_, err := provider.EncryptDataKey(context.Background(), "awskms://"+keyID, []byte(testKeyPlaintext), testContext)
+		assert.NoError(t, err)
+
+		_, err = provider.DecryptDataKey(context.Background(), keyID, []byte(testKeyCiphertext), testContext)
+		assert.NoError(t, err)
+
+		_, err = provider.DecryptDataKey(context.Background(), "alias/MyAliasName", []byte(testKeyCiphertext), testContext)
+		assert.NoError(t, err)
+
+		assert.Equal(t, regions, []string{"eu-west-1"})
+		regional.AssertExpectations(t)
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("region client error", func(t *testing.T) {
+
+		provider := NewAWSProvider(&kms_mock.Client{})
+		provider.RegionClient = func(region string) (Client, error) {
+			return nil, errors.New("testing errors")
+		}
+
+		_, err := provider.GenerateDataKey(context.Background(), "arn:aws:kms:eu-west-1:123456789012:alias/MyAliasName", testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to create AWS client for region eu-west-1: testing errors")
+		}
+
+	})
+
+}
+
+func TestKeyRegion(t *testing.T) {
+
+	assert.Equal(t, KeyRegion("arn:aws:kms:us-east-1:123456789012:key/12345678-1234-1234-1234-123456789012"), "us-east-1")
+	assert.Equal(t, KeyRegion("awskms://arn:aws:kms:eu-west-1:123456789012:alias/MyAliasName"), "eu-west-1")
+	assert.Equal(t, KeyRegion("12345678-1234-1234-1234-123456789012"), "")
+	assert.Equal(t, KeyRegion("alias/MyAliasName"), "")
+	assert.Equal(t, KeyRegion("file:///etc/ejson-kms/break-glass.key"), "")
+
+}
+
+func TestNewRegionClient(t *testing.T) {
+
+	client, err := NewRegionClient(DefaultRetryPolicy(), "eu-west-1")
+	if assert.NoError(t, err) {
+		assert.Implements(t, new(Client), client)
+	}
+
+}
@@ -1,6 +1,8 @@
 package mock
 
 import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/stretchr/testify/mock"
 )
@@ -29,6 +31,25 @@ func (m *Client) GenerateDataKey(params *kms.GenerateDataKeyInput) (*kms.Generat
 	}, args.Error(2)
 }
 
+// Encrypt is meant to replace kms.Encrypt
+//
+//   client := &mock.Client{}
+//   client.On("Encrypt", testKeyID, testKeyPlaintext, testContext).Return(testKeyCiphertext, nil)
+//
+func (m *Client) Encrypt(params *kms.EncryptInput) (*kms.EncryptOutput, error) {
+
+	if len(params.GrantTokens) > 0 {
+		panic("unexpected arguments to Encrypt")
+	}
+
+	args := m.Called(*params.KeyId, string(params.Plaintext), params.EncryptionContext)
+	return &kms.EncryptOutput{
+		CiphertextBlob: []byte(args.String(0)),
+		KeyId:          params.KeyId,
+	}, args.Error(1)
+
+}
+
 // Decrypt is meant to replace kms.Decrypt
 //
 //   client := &mock.Client{}
@@ -48,3 +69,39 @@ func (m *Client) Decrypt(params *kms.DecryptInput) (*kms.DecryptOutput, error) {
 	}, args.Error(2)
 
 }
+
+// GenerateDataKeyWithContext is meant to replace kms.GenerateDataKeyWithContext.
+// It fails if the context is done, and otherwise behaves like GenerateDataKey.
+func (m *Client) GenerateDataKeyWithContext(ctx aws.Context, params *kms.GenerateDataKeyInput, opts ...request.Option) (*kms.GenerateDataKeyOutput, error) {
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return m.GenerateDataKey(params)
+
+}
+
+// EncryptWithContext is meant to replace kms.EncryptWithContext.
+// It fails if the context is done, and otherwise behaves like Encrypt.
+func (m *Client) EncryptWithContext(ctx aws.Context, params *kms.EncryptInput, opts ...request.Option) (*kms.EncryptOutput, error) {
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return m.Encrypt(params)
+
+}
+
+// DecryptWithContext is meant to replace kms.DecryptWithContext.
+// It fails if the context is done, and otherwise behaves like Decrypt.
+func (m *Client) DecryptWithContext(ctx aws.Context, params *kms.DecryptInput, opts ...request.Option) (*kms.DecryptOutput, error) {
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return m.Decrypt(params)
+
+}
@@ -0,0 +1,116 @@
+package kms
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+// SchemeAWS is the scheme of AWS KMS key IDs. Key IDs without any scheme are
+// also handled by AWS KMS, for compatibility with existing secrets files.
+const SchemeAWS = "awskms"
+
+// KeyProvider is the interface implemented by master key backends.
+//
+// A provider wraps and unwraps data keys with a master key it manages, given
+// the ID of that key. The key ID is the value stored in secrets files, and its
+// scheme (such as "awskms://") selects the provider. Calls must give up when
+// ctx is done.
+type KeyProvider interface {
+	// GenerateDataKey creates a 256 bits data key. It returns both the
+	// plaintext of the key and its version wrapped by the master key.
+	//
+	// The encryptionContext must be authenticated, and provided as is to
+	// decrypt the data key.
+	GenerateDataKey(ctx context.Context, keyID string, encryptionContext map[string]*string) (DataKey, error)
+
+	// EncryptDataKey wraps an existing data key with the given master key, so
+	// that a data key generated by another master key can also be decrypted
+	// with this one.
+	EncryptDataKey(ctx context.Context, keyID string, plaintext []byte, encryptionContext map[string]*string) (DataKey, error)
+
+	// DecryptDataKey unwraps a data key previously returned by GenerateDataKey
+	// or EncryptDataKey.
+	DecryptDataKey(ctx context.Context, keyID string, ciphertext []byte, encryptionContext map[string]*string) (DataKey, error)
+
+	// Handles reports whether the key ID identifies a master key managed by
+	// this provider.
+	Handles(keyID string) bool
+}
+
+// Providers is a KeyProvider dispatching each call to the first provider
+// handling the given key ID.
+type Providers []KeyProvider
+
+// GenerateDataKey implements KeyProvider
+func (p Providers) GenerateDataKey(ctx context.Context, keyID string, encryptionContext map[string]*string) (DataKey, error) {
+
+	provider, err := p.find(keyID)
+	if err != nil {
+		return DataKey{}, err
+	}
+
+	return provider.GenerateDataKey(ctx, keyID, encryptionContext)
+
+}
+
+// EncryptDataKey implements KeyProvider
+func (p Providers) EncryptDataKey(ctx context.Context, keyID string, plaintext []byte, encryptionContext map[string]*string) (DataKey, error) {
+
+	provider, err := p.find(keyID)
+	if err != nil {
+		return DataKey{}, err
+	}
+
+	return provider.EncryptDataKey(ctx, keyID, plaintext, encryptionContext)
+
+}
+
+// DecryptDataKey implements KeyProvider
+func (p Providers) DecryptDataKey(ctx context.Context, keyID string, ciphertext []byte, encryptionContext map[string]*string) (DataKey, error) {
+
+	provider, err := p.find(keyID)
+	if err != nil {
+		return DataKey{}, err
+	}
+
+	return provider.DecryptDataKey(ctx, keyID, ciphertext, encryptionContext)
+
+}
+
+// Handles implements KeyProvider
+func (p Providers) Handles(keyID string) bool {
+	_, err := p.find(keyID)
+	return err == nil
+}
+
+func (p Providers) find(keyID string) (KeyProvider, error) {
+
+	for _, provider := range p {
+		if provider.Handles(keyID) {
+			return provider, nil
+		}
+	}
+
+	return nil, errors.Errorf("No key provider available for key ID %s", keyID)
+
+}
+
+// Scheme returns the scheme of a key ID, such as "awskms" for
+// "awskms://alias/MyAliasName", or an empty string if there is none.
+func Scheme(keyID string) string {
+
+	parts := strings.SplitN(keyID, "://", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+
+	return parts[0]
+
+}
+
+// trimScheme removes the given scheme from a key ID, if present.
+func trimScheme(keyID string, scheme string) string {
+	return strings.TrimPrefix(keyID, scheme+"://")
+}
@@ -0,0 +1,72 @@
+package kms
+
+import (
+	"context"
+	"testing"
+
+	kms_mock "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheme(t *testing.T) {
+
+	assert.Equal(t, Scheme("awskms://alias/MyAliasName"), "awskms")
+	assert.Equal(t, Scheme("file:///etc/ejson-kms/master.key"), "file")
+	assert.Equal(t, Scheme("arn:aws:kms:us-east-1:123456789012:alias/MyAliasName"), "")
+	assert.Equal(t, Scheme("12345678-1234-1234-1234-123456789012"), "")
+
+}
+
+func TestProviders(t *testing.T) {
+
+	t.Run("dispatch", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+		client.On("Encrypt", testKeyID, testKeyPlaintext, testContext).Return(testKeyCiphertext, nil).Once()
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		providers := Providers{NewAWSProvider(client)}
+
+		assert.True(t, providers.Handles("awskms://"+testKeyID))
+
+		key, err := providers.GenerateDataKey(context.Background(), "awskms://"+testKeyID, testContext)
+		assert.NoError(t, err)
+		assert.Equal(t, key.Plaintext, []byte(testKeyPlaintext))
+
+		key, err = providers.EncryptDataKey(context.Background(), "awskms://"+testKeyID, []byte(testKeyPlaintext), testContext)
+		assert.NoError(t, err)
+		assert.Equal(t, key.Ciphertext, []byte(testKeyCiphertext))
+
+		key, err = providers.DecryptDataKey(context.Background(), "awskms://"+testKeyID, []byte(testKeyCiphertext), testContext)
+		assert.NoError(t, err)
+		assert.Equal(t, key.Plaintext, []byte(testKeyPlaintext))
+
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("no provider", func(t *testing.T) {
+
+		providers := Providers{NewAWSProvider(&kms_mock.Client{})}
+
+		assert.False(t, providers.Handles("unknown://key"))
+
+		_, err := providers.GenerateDataKey(context.Background(), "unknown://key", testContext)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "No key provider available for key ID unknown://key")
+		}
+
+		_, err = providers.EncryptDataKey(context.Background(), "unknown://key", []byte(testKeyPlaintext), testContext)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "No key provider available for key ID unknown://key")
+		}
+
+		_, err = providers.DecryptDataKey(context.Background(), "unknown://key", []byte(testKeyCiphertext), testContext)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "No key provider available for key ID unknown://key")
+		}
+
+	})
+
+}
@@ -0,0 +1,268 @@
+package kms
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/go-errors/errors"
+)
+
+const (
+	// EnvMaxRetries is the environment variable overriding the maximum number
+	// of retries of the default retry policy
+	EnvMaxRetries = "EJSON_KMS_MAX_RETRIES"
+
+	// EnvRetryDeadline is the environment variable overriding the total
+	// deadline of the default retry policy, such as "30s"
+	EnvRetryDeadline = "EJSON_KMS_RETRY_DEADLINE"
+)
+
+// RetryPolicy configures how failed calls to AWS KMS are retried.
+//
+// Retries are spaced by an exponential backoff with full jitter: the n-th
+// retry waits a random duration between zero and BaseDelay * 2^(n-1), capped
+// to MaxDelay.
+type RetryPolicy struct {
+	// _hidden is a dummy hidden key to force the use of explicit keys when
+	// initializing the struct. Allows adding keys in the future without
+	// breaking code
+	_hidden struct{}
+
+	// MaxRetries is the maximum number of retries after the first attempt
+	MaxRetries int
+
+	// BaseDelay is the upper bound of the delay before the first retry
+	BaseDelay time.Duration
+
+	// MaxDelay is the maximum delay between two attempts
+	MaxDelay time.Duration
+
+	// Deadline is the maximum total duration of a call, retries included. No
+	// retry is made that would start after the deadline. Zero means no
+	// deadline.
+	Deadline time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used by DefaultClient.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: 5,
+		BaseDelay:  100 * time.Millisecond,
+		MaxDelay:   5 * time.Second,
+		Deadline:   30 * time.Second,
+	}
+}
+
+// RetryPolicyFromEnv returns the default retry policy, with the maximum number
+// of retries and the deadline overridden by the EJSON_KMS_MAX_RETRIES and
+// EJSON_KMS_RETRY_DEADLINE environment variables, if set.
+func RetryPolicyFromEnv() (RetryPolicy, error) {
+
+	policy := DefaultRetryPolicy()
+
+	if value := os.Getenv(EnvMaxRetries); value != "" {
+		maxRetries, err := strconv.Atoi(value)
+		if err != nil || maxRetries < 0 {
+			return RetryPolicy{}, errors.Errorf("Invalid %s: expected a positive integer, got %q", EnvMaxRetries, value)
+		}
+		policy.MaxRetries = maxRetries
+	}
+
+	if value := os.Getenv(EnvRetryDeadline); value != "" {
+		deadline, err := time.ParseDuration(value)
+		if err != nil || deadline < 0 {
+			return RetryPolicy{}, errors.Errorf("Invalid %s: expected a positive duration such as \"30s\", got %q", EnvRetryDeadline, value)
+		}
+		policy.Deadline = deadline
+	}
+
+	return policy, nil
+
+}
+
+// backoff returns a random delay to wait before the given retry, starting
+// at 1.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+
+	ceiling := p.MaxDelay
+	if retry <= 32 {
+		exp := p.BaseDelay << uint(retry-1)
+		if exp > 0 && exp < ceiling {
+			ceiling = exp
+		}
+	}
+
+	if ceiling <= 0 {
+		return 0
+	}
+
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return time.Duration(jitter.Int63n(int64(ceiling) + 1))
+
+}
+
+var (
+	jitterMu sync.Mutex
+	jitter   = rand.New(rand.NewSource(time.Now().UnixNano())) // nolint: gosec
+)
+
+// IsRetryable returns whether a failed call to AWS KMS is worth retrying:
+// throttling, internal errors of KMS, unavailable keys, timeouts and network
+// errors are. Errors that would fail the same way again, such as denied
+// access or an invalid ciphertext, are not, and neither are cancellations.
+func IsRetryable(err error) bool {
+
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+
+	switch aerr.Code() {
+	case kms.ErrCodeInternalException, kms.ErrCodeDependencyTimeoutException, kms.ErrCodeKeyUnavailableException:
+		return true
+	}
+
+	return request.IsErrorThrottle(err) || request.IsErrorRetryable(err)
+
+}
+
+// RetryClient implements Client by retrying the failed calls of another
+// Client, following a RetryPolicy.
+type RetryClient struct {
+	// _hidden is a dummy hidden key to force the use of explicit keys when
+	// initializing the struct. Allows adding keys in the future without
+	// breaking code
+	_hidden struct{}
+
+	// Client is the client whose calls are retried
+	Client Client
+
+	// Policy configures the retries
+	Policy RetryPolicy
+}
+
+// NewRetryClient returns a Client retrying the failed calls of the given
+// client. Clients of the AWS SDK already retry some errors on their own, set
+// their MaxRetries to 0 to only use the given policy.
+func NewRetryClient(client Client, policy RetryPolicy) *RetryClient {
+	return &RetryClient{Client: client, Policy: policy}
+}
+
+// GenerateDataKey implements Client
+func (c *RetryClient) GenerateDataKey(params *kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error) {
+	return c.GenerateDataKeyWithContext(aws.BackgroundContext(), params)
+}
+
+// Encrypt implements Client
+func (c *RetryClient) Encrypt(params *kms.EncryptInput) (*kms.EncryptOutput, error) {
+	return c.EncryptWithContext(aws.BackgroundContext(), params)
+}
+
+// Decrypt implements Client
+func (c *RetryClient) Decrypt(params *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	return c.DecryptWithContext(aws.BackgroundContext(), params)
+}
+
+// GenerateDataKeyWithContext implements Client
+func (c *RetryClient) GenerateDataKeyWithContext(ctx aws.Context, params *kms.GenerateDataKeyInput, opts ...request.Option) (*kms.GenerateDataKeyOutput, error) {
+
+	var resp *kms.GenerateDataKeyOutput
+	err := c.retry(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.Client.GenerateDataKeyWithContext(ctx, params, opts...)
+		return err
+	})
+
+	return resp, err
+
+}
+
+// EncryptWithContext implements Client
+func (c *RetryClient) EncryptWithContext(ctx aws.Context, params *kms.EncryptInput, opts ...request.Option) (*kms.EncryptOutput, error) {
+
+	var resp *kms.EncryptOutput
+	err := c.retry(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.Client.EncryptWithContext(ctx, params, opts...)
+		return err
+	})
+
+	return resp, err
+
+}
+
+// DecryptWithContext implements Client
+func (c *RetryClient) DecryptWithContext(ctx aws.Context, params *kms.DecryptInput, opts ...request.Option) (*kms.DecryptOutput, error) {
+
+	var resp *kms.DecryptOutput
+	err := c.retry(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.Client.DecryptWithContext(ctx, params, opts...)
+		return err
+	})
+
+	return resp, err
+
+}
+
+// retry calls the given function until it succeeds, fails with an error that
+// is not retryable, or the policy gives up.
+func (c *RetryClient) retry(ctx context.Context, call func(ctx context.Context) error) error {
+
+	if c.Policy.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Policy.Deadline)
+		defer cancel()
+	}
+
+	for attempt := 1; ; attempt++ {
+
+		err := call(ctx)
+		if err == nil || !IsRetryable(err) || ctx.Err() != nil {
+			return giveUp(err, attempt)
+		}
+
+		if attempt > c.Policy.MaxRetries {
+			return giveUp(err, attempt)
+		}
+
+		delay := c.Policy.backoff(attempt)
+
+		deadline, ok := ctx.Deadline()
+		if ok && time.Now().Add(delay).After(deadline) {
+			return giveUp(err, attempt)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return giveUp(err, attempt)
+		}
+
+	}
+
+}
+
+// giveUp adds the number of attempts to the error of the last one, if there
+// were retries.
+func giveUp(err error, attempts int) error {
+
+	if err == nil || attempts == 1 {
+		return err
+	}
+
+	return errors.WrapPrefix(err, fmt.Sprintf("Gave up after %d attempts", attempts), 0)
+
+}
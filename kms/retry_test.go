@@ -0,0 +1,222 @@
+package kms
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	kms_mock "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/assert"
+)
+
+var errThrottling = awserr.New("ThrottlingException", "Rate exceeded", nil)
+
+// testRetryPolicy retries quickly, to keep the tests fast
+func testRetryPolicy(maxRetries int) RetryPolicy {
+	return RetryPolicy{MaxRetries: maxRetries, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+}
+
+func TestRetryPolicyFromEnv(t *testing.T) {
+
+	t.Run("defaults", func(t *testing.T) {
+
+		policy, err := RetryPolicyFromEnv()
+		assert.NoError(t, err)
+		assert.Equal(t, policy, DefaultRetryPolicy())
+
+	})
+
+	t.Run("overridden", func(t *testing.T) {
+
+		assert.NoError(t, os.Setenv(EnvMaxRetries, "0"))
+		defer os.Unsetenv(EnvMaxRetries) // nolint: errcheck
+		assert.NoError(t, os.Setenv(EnvRetryDeadline, "2m"))
+		defer os.Unsetenv(EnvRetryDeadline) // nolint: errcheck
+
+		policy, err := RetryPolicyFromEnv()
+		assert.NoError(t, err)
+		assert.Equal(t, policy.MaxRetries, 0)
+		assert.Equal(t, policy.Deadline, 2*time.Minute)
+		assert.Equal(t, policy.BaseDelay, DefaultRetryPolicy().BaseDelay)
+
+	})
+
+	t.Run("invalid max retries", func(t *testing.T) {
+
+		assert.NoError(t, os.Setenv(EnvMaxRetries, "-1"))
+		defer os.Unsetenv(EnvMaxRetries) // nolint: errcheck
+
+		_, err := RetryPolicyFromEnv()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid EJSON_KMS_MAX_RETRIES: expected a positive integer, got \"-1\"")
+		}
+
+	})
+
+	t.Run("invalid deadline", func(t *testing.T) {
+
+		assert.NoError(t, os.Setenv(EnvRetryDeadline, "30"))
+		defer os.Unsetenv(EnvRetryDeadline) // nolint: errcheck
+
+		_, err := RetryPolicyFromEnv()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid EJSON_KMS_RETRY_DEADLINE: expected a positive duration such as \"30s\", got \"30\"")
+		}
+
+	})
+
+}
+
+func TestBackoff(t *testing.T) {
+
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for i := 0; i < 100; i++ {
+		assert.True(t, policy.backoff(1) <= 100*time.Millisecond)
+		assert.True(t, policy.backoff(3) <= 400*time.Millisecond)
+		assert.True(t, policy.backoff(5) <= time.Second)
+		assert.True(t, policy.backoff(100) <= time.Second)
+		assert.True(t, policy.backoff(100) >= 0)
+	}
+
+	assert.Equal(t, RetryPolicy{}.backoff(1), time.Duration(0))
+
+}
+
+func TestIsRetryable(t *testing.T) {
+
+	retryable := []error{
+		errThrottling,
+		awserr.New("KMSInternalException", "internal error", nil),
+		awserr.New("DependencyTimeoutException", "timeout", nil),
+		awserr.New("KeyUnavailableException", "unavailable", nil),
+		awserr.New(request.ErrCodeRequestError, "send request failed", &url.Error{Op: "Post", URL: "https://kms", Err: errors.New("connection refused")}),
+	}
+
+	for _, err := range retryable {
+		assert.True(t, IsRetryable(err), err.Error())
+	}
+
+	fatal := []error{
+		nil,
+		awserr.New("AccessDeniedException", "denied", nil),
+		awserr.New("InvalidCiphertextException", "invalid", nil),
+		awserr.New("NotFoundException", "not found", nil),
+		awserr.New("LimitExceededException", "too many keys", nil),
+		awserr.New(request.CanceledErrorCode, "canceled", context.Canceled),
+		context.Canceled,
+		errors.New("testing errors"),
+	}
+
+	for _, err := range fatal {
+		assert.False(t, IsRetryable(err), "%v", err)
+	}
+
+}
+
+func TestRetryClient(t *testing.T) {
+
+	t.Run("retries throttled calls", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return("", "", errThrottling).Twice()
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		key, err := DecryptDataKey(NewRetryClient(client, testRetryPolicy(5)), []byte(testKeyCiphertext), testContext)
+		if assert.NoError(t, err) {
+			assert.Equal(t, key.Plaintext, []byte(testKeyPlaintext))
+		}
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("retries every call", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return("", "", errThrottling).Once()
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+		client.On("Encrypt", testKeyID, testKeyPlaintext, testContext).Return("", errThrottling).Once()
+		client.On("Encrypt", testKeyID, testKeyPlaintext, testContext).Return(testKeyCiphertext, nil).Once()
+
+		retryClient := NewRetryClient(client, testRetryPolicy(5))
+
+		_, err := GenerateDataKey(retryClient, testKeyID, testContext)
+		assert.NoError(t, err)
+
+		_, err = EncryptDataKey(retryClient, testKeyID, []byte(testKeyPlaintext), testContext)
+		assert.NoError(t, err)
+
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("does not retry fatal errors", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return("", "", awserr.New("AccessDeniedException", "denied", nil)).Once()
+
+		_, err := DecryptDataKey(NewRetryClient(client, testRetryPolicy(5)), []byte(testKeyCiphertext), testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt key ciphertext: AccessDeniedException: denied")
+		}
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return("", "", errThrottling).Times(3)
+
+		_, err := DecryptDataKey(NewRetryClient(client, testRetryPolicy(2)), []byte(testKeyCiphertext), testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt key ciphertext: Gave up after 3 attempts: ThrottlingException: Rate exceeded")
+		}
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("gives up at the deadline", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return("", "", errThrottling).Once()
+
+		policy := RetryPolicy{MaxRetries: 5, BaseDelay: time.Hour, MaxDelay: time.Hour, Deadline: time.Second}
+
+		start := time.Now()
+		_, err := DecryptDataKey(NewRetryClient(client, policy), []byte(testKeyCiphertext), testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt key ciphertext: ThrottlingException: Rate exceeded")
+		}
+		assert.True(t, time.Since(start) < time.Second)
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("stops when cancelled", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return("", "", errThrottling).Once()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		policy := RetryPolicy{MaxRetries: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+
+		_, err := DecryptDataKeyWithContext(ctx, NewRetryClient(client, policy), []byte(testKeyCiphertext), testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt key ciphertext: ThrottlingException: Rate exceeded")
+		}
+		client.AssertExpectations(t)
+
+	})
+
+}
@@ -0,0 +1,232 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+// SchemeVaultTransit is the scheme of key IDs pointing to a key of a
+// HashiCorp Vault transit engine, such as "vault-transit://transit/my-key"
+// for the key "my-key" of the engine mounted at "transit".
+const SchemeVaultTransit = "vault-transit"
+
+// VaultProvider implements KeyProvider using the transit secrets engine of
+// HashiCorp Vault.
+//
+// Data keys are generated by the "datakey/plaintext" endpoint, and unwrapped
+// by the "decrypt" endpoint. The encryption context is sent as the "context"
+// parameter, which Vault uses for key derivation: the transit key must be
+// created with derived=true for the context to be enforced.
+type VaultProvider struct {
+	// _hidden is a dummy hidden key to force the use of explicit keys when
+	// initializing the struct. Allows adding keys in the future without
+	// breaking code
+	_hidden struct{}
+
+	// Address is the address of the Vault server, such as
+	// "https://vault.example.com:8200"
+	Address string
+
+	// Token is the Vault token used to authenticate requests
+	Token string
+
+	// HTTPClient is the client used for requests to Vault. Defaults to
+	// http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// NewVaultProvider returns a KeyProvider backed by the Vault server at the
+// given address.
+func NewVaultProvider(address string, token string) *VaultProvider {
+	return &VaultProvider{Address: address, Token: token}
+}
+
+// DefaultVaultProvider returns a KeyProvider configured by the VAULT_ADDR and
+// VAULT_TOKEN environment variables.
+func DefaultVaultProvider() *VaultProvider {
+	return NewVaultProvider(os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN"))
+}
+
+type vaultResponse struct {
+	Errors []string `json:"errors"`
+	Data   struct {
+		Plaintext  string `json:"plaintext"`
+		Ciphertext string `json:"ciphertext"`
+	} `json:"data"`
+}
+
+// GenerateDataKey implements KeyProvider
+func (p *VaultProvider) GenerateDataKey(ctx context.Context, keyID string, encryptionContext map[string]*string) (DataKey, error) {
+
+	mount, name, err := vaultKey(keyID)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to generate data key", 0)
+	}
+
+	params, err := vaultParams(encryptionContext)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to generate data key", 0)
+	}
+	params["bits"] = 256
+
+	resp, err := p.post(ctx, fmt.Sprintf("%s/datakey/plaintext/%s", mount, name), params)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to generate data key", 0)
+	}
+
+	plaintext, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to generate data key: Invalid plaintext returned by Vault", 0)
+	}
+
+	return DataKey{Ciphertext: []byte(resp.Data.Ciphertext), Plaintext: plaintext}, nil
+
+}
+
+// EncryptDataKey implements KeyProvider
+func (p *VaultProvider) EncryptDataKey(ctx context.Context, keyID string, plaintext []byte, encryptionContext map[string]*string) (DataKey, error) {
+
+	mount, name, err := vaultKey(keyID)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to encrypt data key", 0)
+	}
+
+	params, err := vaultParams(encryptionContext)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to encrypt data key", 0)
+	}
+	params["plaintext"] = base64.StdEncoding.EncodeToString(plaintext)
+
+	resp, err := p.post(ctx, fmt.Sprintf("%s/encrypt/%s", mount, name), params)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to encrypt data key", 0)
+	}
+
+	return DataKey{Ciphertext: []byte(resp.Data.Ciphertext), Plaintext: plaintext}, nil
+
+}
+
+// DecryptDataKey implements KeyProvider
+func (p *VaultProvider) DecryptDataKey(ctx context.Context, keyID string, ciphertext []byte, encryptionContext map[string]*string) (DataKey, error) {
+
+	mount, name, err := vaultKey(keyID)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to decrypt key ciphertext", 0)
+	}
+
+	params, err := vaultParams(encryptionContext)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to decrypt key ciphertext", 0)
+	}
+	params["ciphertext"] = string(ciphertext)
+
+	resp, err := p.post(ctx, fmt.Sprintf("%s/decrypt/%s", mount, name), params)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to decrypt key ciphertext", 0)
+	}
+
+	plaintext, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return DataKey{}, errors.WrapPrefix(err, "Unable to decrypt key ciphertext: Invalid plaintext returned by Vault", 0)
+	}
+
+	return DataKey{Ciphertext: ciphertext, Plaintext: plaintext}, nil
+
+}
+
+// Handles implements KeyProvider. It handles key IDs with the "vault-transit"
+// scheme.
+func (p *VaultProvider) Handles(keyID string) bool {
+	return Scheme(keyID) == SchemeVaultTransit
+}
+
+// post sends a request to the given path of the Vault API, and decodes the
+// response.
+func (p *VaultProvider) post(ctx context.Context, path string, params map[string]interface{}) (*vaultResponse, error) {
+
+	if p.Address == "" {
+		return nil, errors.Errorf("No Vault address provided, set VAULT_ADDR")
+	}
+
+	if p.Token == "" {
+		return nil, errors.Errorf("No Vault token provided, set VAULT_TOKEN")
+	}
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to encode request", 0)
+	}
+
+	url := strings.TrimRight(p.Address, "/") + "/v1/" + path
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to create request", 0)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", p.Token)
+
+	client := p.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	httpResp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to contact Vault", 0)
+	}
+	defer httpResp.Body.Close() // nolint: errcheck
+
+	resp := &vaultResponse{}
+	err = json.NewDecoder(httpResp.Body).Decode(resp)
+	if err != nil && httpResp.StatusCode == http.StatusOK {
+		return nil, errors.WrapPrefix(err, "Unable to decode Vault response", 0)
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		if len(resp.Errors) > 0 {
+			return nil, errors.Errorf("Vault returned status %d: %s", httpResp.StatusCode, strings.Join(resp.Errors, ", "))
+		}
+		return nil, errors.Errorf("Vault returned status %d", httpResp.StatusCode)
+	}
+
+	return resp, nil
+
+}
+
+// vaultKey splits a key ID into the mount path of the transit engine and the
+// name of the key.
+func vaultKey(keyID string) (string, string, error) {
+
+	path := strings.Trim(trimScheme(keyID, SchemeVaultTransit), "/")
+
+	i := strings.LastIndex(path, "/")
+	if i <= 0 || i == len(path)-1 {
+		return "", "", errors.Errorf("Invalid Vault transit key ID %s: expected vault-transit://MOUNT/KEY_NAME", keyID)
+	}
+
+	return path[:i], path[i+1:], nil
+
+}
+
+// vaultParams returns the request parameters holding the encryption context.
+func vaultParams(encryptionContext map[string]*string) (map[string]interface{}, error) {
+
+	context, err := canonicalContext(encryptionContext)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"context": base64.StdEncoding.EncodeToString(context),
+	}, nil
+
+}
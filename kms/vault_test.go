@@ -0,0 +1,221 @@
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testVaultToken = "s.testingtoken"
+	testVaultKeyID = "vault-transit://transit/ejson-kms"
+)
+
+// newVaultStandIn returns a server mimicking the transit engine mounted at
+// "transit". The ciphertexts it returns embed the plaintext and the context,
+// so that decryption fails when the context does not match.
+func newVaultStandIn(t *testing.T) *httptest.Server {
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		fail := func(status int, msg string) {
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(map[string][]string{"errors": {msg}})
+		}
+
+		if r.Header.Get("X-Vault-Token") != testVaultToken {
+			fail(http.StatusForbidden, "permission denied")
+			return
+		}
+
+		params := map[string]interface{}{}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		assert.NoError(t, err)
+
+		context, _ := params["context"].(string)
+
+		switch r.URL.Path {
+
+		case "/v1/transit/datakey/plaintext/ejson-kms":
+			assert.Equal(t, params["bits"], float64(256))
+			plaintext := base64.StdEncoding.EncodeToString([]byte("-abcdefabcdefabcdefabcdefabcdef-"))
+			ciphertext := "vault:v1:" + context + ":" + plaintext
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"plaintext": plaintext, "ciphertext": ciphertext}})
+
+		case "/v1/transit/encrypt/ejson-kms":
+			ciphertext := "vault:v1:" + context + ":" + params["plaintext"].(string)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"ciphertext": ciphertext}})
+
+		case "/v1/transit/decrypt/ejson-kms":
+			parts := strings.Split(params["ciphertext"].(string), ":")
+			if len(parts) != 4 || parts[2] != context {
+				fail(http.StatusBadRequest, "cipher: message authentication failed")
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"plaintext": parts[3]}})
+
+		default:
+			fail(http.StatusNotFound, "no handler for route")
+
+		}
+
+	}))
+
+}
+
+func TestVaultProvider(t *testing.T) {
+
+	value := "production"
+	encryptionContext := map[string]*string{"ENV": &value}
+
+	t.Run("handles", func(t *testing.T) {
+
+		provider := NewVaultProvider("", "")
+
+		assert.True(t, provider.Handles(testVaultKeyID))
+		assert.False(t, provider.Handles("file://master.key"))
+		assert.False(t, provider.Handles(testKeyID))
+
+	})
+
+	t.Run("default", func(t *testing.T) {
+
+		assert.NoError(t, os.Setenv("VAULT_ADDR", "https://vault.example.com:8200"))
+		assert.NoError(t, os.Setenv("VAULT_TOKEN", testVaultToken))
+		defer os.Unsetenv("VAULT_ADDR")  // nolint: errcheck
+		defer os.Unsetenv("VAULT_TOKEN") // nolint: errcheck
+
+		provider := DefaultVaultProvider()
+		assert.Equal(t, provider.Address, "https://vault.example.com:8200")
+		assert.Equal(t, provider.Token, testVaultToken)
+
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+
+		server := newVaultStandIn(t)
+		defer server.Close()
+
+		provider := NewVaultProvider(server.URL, testVaultToken)
+
+		key, err := provider.GenerateDataKey(context.Background(), testVaultKeyID, encryptionContext)
+		assert.NoError(t, err)
+		assert.Equal(t, key.Plaintext, []byte("-abcdefabcdefabcdefabcdefabcdef-"))
+		assert.True(t, strings.HasPrefix(string(key.Ciphertext), "vault:v1:"))
+
+		decrypted, err := provider.DecryptDataKey(context.Background(), testVaultKeyID, key.Ciphertext, encryptionContext)
+		assert.NoError(t, err)
+		assert.Equal(t, decrypted.Plaintext, key.Plaintext)
+
+	})
+
+	t.Run("encrypt existing data key", func(t *testing.T) {
+
+		server := newVaultStandIn(t)
+		defer server.Close()
+
+		provider := NewVaultProvider(server.URL, testVaultToken)
+		plaintext := []byte("-012345678901234567890123456789-")
+
+		key, err := provider.EncryptDataKey(context.Background(), testVaultKeyID, plaintext, encryptionContext)
+		assert.NoError(t, err)
+
+		decrypted, err := provider.DecryptDataKey(context.Background(), testVaultKeyID, key.Ciphertext, encryptionContext)
+		assert.NoError(t, err)
+		assert.Equal(t, decrypted.Plaintext, plaintext)
+
+	})
+
+	t.Run("different encryption context", func(t *testing.T) {
+
+		server := newVaultStandIn(t)
+		defer server.Close()
+
+		provider := NewVaultProvider(server.URL, testVaultToken)
+
+		key, err := provider.GenerateDataKey(context.Background(), testVaultKeyID, encryptionContext)
+		assert.NoError(t, err)
+
+		_, err = provider.DecryptDataKey(context.Background(), testVaultKeyID, key.Ciphertext, map[string]*string{})
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt key ciphertext: Vault returned status 400: cipher: message authentication failed")
+		}
+
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+
+		server := newVaultStandIn(t)
+		defer server.Close()
+
+		_, err := NewVaultProvider(server.URL, "invalid").GenerateDataKey(context.Background(), testVaultKeyID, encryptionContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to generate data key: Vault returned status 403: permission denied")
+		}
+
+	})
+
+	t.Run("missing configuration", func(t *testing.T) {
+
+		_, err := NewVaultProvider("", testVaultToken).GenerateDataKey(context.Background(), testVaultKeyID, encryptionContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to generate data key: No Vault address provided, set VAULT_ADDR")
+		}
+
+		_, err = NewVaultProvider("https://vault.example.com:8200", "").DecryptDataKey(context.Background(), testVaultKeyID, []byte("vault:v1:abc"), encryptionContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt key ciphertext: No Vault token provided, set VAULT_TOKEN")
+		}
+
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+
+		server := newVaultStandIn(t)
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := NewVaultProvider(server.URL, testVaultToken).GenerateDataKey(ctx, testVaultKeyID, encryptionContext)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to generate data key: Unable to contact Vault")
+			assert.Contains(t, err.Error(), "context canceled")
+		}
+
+	})
+
+	t.Run("invalid key ID", func(t *testing.T) {
+
+		_, err := NewVaultProvider("https://vault.example.com:8200", testVaultToken).GenerateDataKey(context.Background(), "vault-transit://ejson-kms", encryptionContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to generate data key: Invalid Vault transit key ID vault-transit://ejson-kms: expected vault-transit://MOUNT/KEY_NAME")
+		}
+
+	})
+
+}
+
+func TestVaultKey(t *testing.T) {
+
+	mount, name, err := vaultKey("vault-transit://transit/ejson-kms")
+	assert.NoError(t, err)
+	assert.Equal(t, mount, "transit")
+	assert.Equal(t, name, "ejson-kms")
+
+	mount, name, err = vaultKey("vault-transit://teams/infra/transit/ejson-kms")
+	assert.NoError(t, err)
+	assert.Equal(t, mount, "teams/infra/transit")
+	assert.Equal(t, name, "ejson-kms")
+
+	_, _, err = vaultKey("vault-transit://transit/")
+	assert.Error(t, err)
+
+}
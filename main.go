@@ -15,6 +15,10 @@ func main() {
 
 		// Error contents is already printed out by cobra
 
+		if exitErr, ok := err.(*cli.ExitError); ok {
+			os.Exit(exitErr.Code)
+		}
+
 		enableDebug := os.Getenv("EJSON_KMS_DEBUG") == "1"
 		errStack, ok := err.(*errors.Error)
 
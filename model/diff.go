@@ -0,0 +1,122 @@
+package model
+
+import (
+	"context"
+	"sort"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	"github.com/go-errors/errors"
+)
+
+// Statuses of a secret compared by Diff.
+const (
+	// DiffAdded is the status of a secret only found in the new store.
+	DiffAdded = "added"
+	// DiffRemoved is the status of a secret only found in the old store.
+	DiffRemoved = "removed"
+	// DiffChanged is the status of a secret whose value differs.
+	DiffChanged = "changed"
+	// DiffUnchanged is the status of a secret whose value is the same, even
+	// though its ciphertext may differ.
+	DiffUnchanged = "unchanged"
+)
+
+// SecretDiff compares the values of a secret in two stores, see Diff.
+type SecretDiff struct {
+	// _hidden is a dummy hidden key to force the use of explicit keys when
+	// initializing the struct. Allows adding keys in the future without
+	// breaking code
+	_hidden struct{}
+
+	// Name is the name of the secret.
+	Name string
+
+	// Status is one of DiffAdded, DiffRemoved, DiffChanged or DiffUnchanged.
+	Status string
+
+	// OldPlaintext is the value of the secret in the old store, empty when it
+	// was added.
+	OldPlaintext string
+
+	// NewPlaintext is the value of the secret in the new store, empty when it
+	// was removed.
+	NewPlaintext string
+}
+
+// Diff decrypts the secrets of the store and of a newer version of it, and
+// compares their values by name. Every secret of both stores is returned,
+// sorted by name.
+//
+// Ciphertexts are never compared: encrypting the same value twice gives
+// different ciphertexts, and the stores may use different master keys.
+// Secrets are decrypted with up to concurrency parallel calls to the key
+// provider, see StreamPlaintext.
+func (s *Store) Diff(provider kms.KeyProvider, newStore *Store, concurrency int) ([]*SecretDiff, error) {
+	return s.DiffWithContext(context.Background(), provider, newStore, concurrency)
+}
+
+// DiffWithContext is the same as Diff, with the ability to cancel the calls to
+// the key provider or set a deadline with the given context.
+func (s *Store) DiffWithContext(ctx context.Context, provider kms.KeyProvider, newStore *Store, concurrency int) ([]*SecretDiff, error) {
+
+	err := s.verifyMAC(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	oldValues, err := s.plaintexts(ctx, provider, concurrency)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to decrypt the old secrets", 0)
+	}
+
+	newValues, err := newStore.plaintexts(ctx, provider, concurrency)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Unable to decrypt the new secrets", 0)
+	}
+
+	diff := make([]*SecretDiff, 0, len(newValues))
+
+	for name, oldPlaintext := range oldValues {
+
+		newPlaintext, ok := newValues[name]
+
+		status := DiffUnchanged
+		if !ok {
+			status = DiffRemoved
+		} else if newPlaintext != oldPlaintext {
+			status = DiffChanged
+		}
+
+		diff = append(diff, &SecretDiff{Name: name, Status: status, OldPlaintext: oldPlaintext, NewPlaintext: newPlaintext})
+
+	}
+
+	for name, newPlaintext := range newValues {
+		if _, ok := oldValues[name]; !ok {
+			diff = append(diff, &SecretDiff{Name: name, Status: DiffAdded, NewPlaintext: newPlaintext})
+		}
+	}
+
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Name < diff[j].Name })
+	return diff, nil
+
+}
+
+// plaintexts decrypts all the secrets of the store, by name.
+func (s *Store) plaintexts(ctx context.Context, provider kms.KeyProvider, concurrency int) (map[string]string, error) {
+
+	values := make(map[string]string, len(s.Secrets))
+
+	items, wait := s.StreamPlaintextWithContext(ctx, provider, concurrency)
+	for item := range items {
+		values[item.Name] = item.Plaintext
+	}
+
+	err := wait()
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	kms_mock "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretDiffDummy(t *testing.T) {
+	_ = SecretDiff{_hidden: struct{}{}}
+}
+
+func TestDiff(t *testing.T) {
+
+	testName3 := "my_third_cred"
+	testName4 := "my_fourth_cred"
+	testContext3 := map[string]*string{"ABC": nil, "Secret": &testName3}
+	testContext4 := map[string]*string{"ABC": nil, "Secret": &testName4}
+
+	client := &kms_mock.Client{}
+	for _, context := range []map[string]*string{testContext1, testContext2, testContext3, testContext4} {
+		client.On("GenerateDataKey", testKeyID, context).Return(testKeyCiphertext, testKeyPlaintext, nil)
+		client.On("Decrypt", testKeyCiphertext, context).Return(testKeyID, testKeyPlaintext, nil)
+	}
+	provider := kms.NewAWSProvider(client)
+
+	oldStore := NewStore(testKeyID, testContext)
+	assert.NoError(t, oldStore.Add(provider, testPlaintext, testName, ""))
+	assert.NoError(t, oldStore.Add(provider, testPlaintext, testName2, ""))
+	assert.NoError(t, oldStore.Add(provider, testPlaintext, testName3, ""))
+
+	newStore := NewStore(testKeyID, testContext)
+	assert.NoError(t, newStore.Add(provider, testPlaintext, testName, ""))
+	assert.NoError(t, newStore.Add(provider, testPlaintext2, testName2, ""))
+	assert.NoError(t, newStore.Add(provider, testPlaintext2, testName4, ""))
+
+	t.Run("working", func(t *testing.T) {
+
+		diff, err := oldStore.Diff(provider, newStore, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, diff, []*SecretDiff{
+			{Name: testName, Status: DiffUnchanged, OldPlaintext: testPlaintext, NewPlaintext: testPlaintext},
+			{Name: testName4, Status: DiffAdded, NewPlaintext: testPlaintext2},
+			{Name: testName2, Status: DiffChanged, OldPlaintext: testPlaintext, NewPlaintext: testPlaintext2},
+			{Name: testName3, Status: DiffRemoved, OldPlaintext: testPlaintext},
+		})
+
+	})
+
+	t.Run("same store", func(t *testing.T) {
+
+		diff, err := oldStore.Diff(provider, oldStore, 1)
+		assert.NoError(t, err)
+		for _, item := range diff {
+			assert.Equal(t, item.Status, DiffUnchanged)
+		}
+
+	})
+
+	t.Run("decrypt error", func(t *testing.T) {
+
+		failing := &kms_mock.Client{}
+		failing.On("Decrypt", testKeyCiphertext, testContext1).Return("", "", errors.New("testing errors"))
+		failing.On("Decrypt", testKeyCiphertext, testContext2).Return(testKeyID, testKeyPlaintext, nil)
+		failing.On("Decrypt", testKeyCiphertext, testContext3).Return(testKeyID, testKeyPlaintext, nil)
+
+		_, err := oldStore.Diff(kms.NewAWSProvider(failing), newStore, 1)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to decrypt the old secrets")
+		}
+
+		failing = &kms_mock.Client{}
+		failing.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil)
+		failing.On("Decrypt", testKeyCiphertext, testContext2).Return(testKeyID, testKeyPlaintext, nil)
+		failing.On("Decrypt", testKeyCiphertext, testContext3).Return(testKeyID, testKeyPlaintext, nil)
+		failing.On("Decrypt", testKeyCiphertext, testContext4).Return("", "", errors.New("testing errors"))
+
+		_, err = oldStore.Diff(kms.NewAWSProvider(failing), newStore, 1)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to decrypt the new secrets")
+		}
+
+	})
+
+}
@@ -8,19 +8,58 @@
 // Here are a few ways to use this package:
 //
 //   store := model.NewStore(kmsKeyID, encryptionContext)
+//   store.Author = "alice" // recorded in the metadata of the secrets
 //   store.Add(kmsClient, "secret", "password", "Password for nuclear launch")
 //   store.Save("mysecrets.json")
 //
 //   store := store.Load("mysecrets.json")
 //   store.Contains("secret") // true
+//   store.Decrypt(kmsClient, "secret") // "password"
+//   store.SetHistoryLimit(5) // keeps the previous values of rotated secrets
 //   store.Rotate(kmsClient, "secret", "new_password")
-//   store.Export(formatter.Bash) // "SECRET='new_password'"
+//   store.SetRotationPolicy("secret", "90d")
+//   store.Stale(time.Now()) // secrets not rotated for 90 days
+//   items, wait := store.StreamPlaintext(kmsClient, 10)
+//   formatter.Bash(os.Stdout, items) // "SECRET='new_password'"
+//   wait() // first decryption error, if any
+//   store.DecryptVersion(kmsClient, "secret", 1) // "password"
+//   store.Rollback(kmsClient, "secret", 1)
+//   store.Rename(kmsClient, "secret", "launch_code")
+//   store.Remove("launch_code")
 //   store.Save("mysecrets.json")
 //
 //   store := store.Load("mysecrets.json")
 //   store.RotateKMSKey(kmsClient, newKMSKeyID)
+//   store.RotateEncryptionContext(kmsClient, newEncryptionContext)
+//   store.AddKMSKey(kmsClient, otherKMSKeyID)
+//   store.RemoveKMSKey(kmsClient, kmsKeyID)
+//   store.RotateFileKey(kmsClient)
+//   store.Migrate(kmsClient, crypto.AlgorithmAES256GCM)
+//   store.SetPadding(kmsClient, crypto.PaddingPowerOfTwo)
+//   store.RotateMACKey(kmsClient)
 //   store.Save("mysecrets_rotated.json")
 //
+//   old, err := model.Parse(gitShowOutput, "HEAD~1:mysecrets.json")
+//   diff, err := old.Diff(kmsClient, store, 10)
+//   diff[0].Status // model.DiffChanged
+//
+//   merged, err := model.Merge(base, ours, theirs) // merges secrets by name
+//   merged.Save("mysecrets.json")
+//
+//   lock, err := model.Lock("mysecrets_rotated.json") // held until saved
+//   defer lock.Unlock()
+//   store := store.Load("mysecrets_rotated.json")
+//   store.Verify(kmsClient) // required before saving a store with a MAC
+//   store.Remove("secret")
+//   store.Save("mysecrets_rotated.json") // computes the MAC again
+//
+// Every method calling the key provider has a WithContext variant, to set a
+// deadline or cancel the calls:
+//
+//   ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+//   defer cancel()
+//   store.DecryptWithContext(ctx, kmsClient, "secret")
+//
 // Secret encryption
 //
 // For each secret, a data key is requested from AWS KMS.
@@ -37,7 +76,8 @@
 // A random nonce is generated and nacl/secretbox is used for encryption.
 //
 // Under the hood, secretbox uses XSalsa20 and Poly1305 to encrypt and
-// authenticate messages. The length of messages is not hidden.
+// authenticate messages. The length of messages is not hidden, unless the
+// store has a Padding.
 //
 // Finally, the encrypted key, the random nonce and the encrypted secret are
 // each stored in the model.
@@ -53,4 +93,28 @@
 //
 // Using the key plaintext and random nonce, the secret is decrypted using
 // nacl/secretbox.
+//
+// File key
+//
+// Once RotateFileKey has been called, all the secrets of the store share a
+// single data key, stored in the FileKey field. It is decrypted once per
+// operation, with the encryption context of the store. The name of each secret
+// is authenticated by the file key itself instead of the encryption context.
+//
+// File MAC
+//
+// Once RotateMACKey has been called, the whole store is authenticated by a MAC,
+// keyed by a data key stored in the MACKey field. It covers the JSON encoding
+// of the store: the master keys, encryption context and other settings, along
+// with the ordered list of names, descriptions and ciphertexts of the secrets.
+//
+// Verify decrypts the MAC key and checks the MAC, which detects deleted
+// secrets, secrets reverted to an older ciphertext, and modified settings.
+// Every method calling the key provider verifies the MAC first, once, so the
+// secrets of a loaded store are never used before it is checked. Save computes
+// the MAC again, and fails if the store has not been verified.
+//
+// Load fails if only one of the MAC and its key is present. Removing both
+// cannot be detected from the file alone: check that MACKey is set when a MAC
+// is expected.
 package model
@@ -0,0 +1,169 @@
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-errors/errors"
+)
+
+// FileLock is an exclusive advisory lock on a secrets file, see Lock.
+type FileLock struct {
+	file *os.File
+}
+
+// LockPath returns the path of the lock file used by Lock for the secrets
+// file at the given path.
+func LockPath(path string) string {
+	return path + ".lock"
+}
+
+// Lock takes an exclusive advisory lock on the secrets file at the given path,
+// waiting for any other process holding it to release it. Commands modifying a
+// secrets file hold the lock from Load to Save, so that concurrent invocations
+// do not overwrite each other's changes.
+//
+// The lock is taken on a separate file next to the secrets file, see LockPath,
+// rather than on the secrets file itself, for two reasons. Save atomically
+// renames a new file over the secrets file: a lock on the old file would not
+// stop another process from locking the new one, so both would proceed. And
+// Windows locks are mandatory: a lock on the secrets file would prevent Load
+// from reading it through another handle. The lock file is created if needed
+// and left in place afterwards, since removing it would race with processes
+// waiting for it. The init and git-setup commands add it to .gitignore.
+//
+// Symbolic links are followed, so that every link to a secrets file shares
+// its lock.
+//
+// The lock is advisory: it does not prevent reading or writing the file
+// without calling Lock first.
+func Lock(path string) (*FileLock, error) {
+
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to open file at %s", path), 0)
+	}
+
+	lockPath := LockPath(target)
+
+	for {
+
+		file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644) // nolint: gosec
+		if err != nil {
+			return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to open lock file at %s", lockPath), 0)
+		}
+
+		err = lockFile(file)
+		if err != nil {
+			_ = file.Close()
+			return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to lock file at %s", lockPath), 0)
+		}
+
+		// the lock file may have been removed while waiting for it, in which
+		// case another process can lock a new one
+		locked, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to lock file at %s", lockPath), 0)
+		}
+
+		current, err := os.Stat(lockPath)
+		if err == nil && os.SameFile(locked, current) {
+			return &FileLock{file: file}, nil
+		}
+
+		_ = file.Close()
+
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to lock file at %s", lockPath), 0)
+		}
+
+	}
+
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+
+	err := unlockFile(l.file)
+	if err != nil {
+		_ = l.file.Close()
+		return errors.WrapPrefix(err, "Unable to unlock file", 0)
+	}
+
+	return l.file.Close()
+
+}
+
+// writeFile atomically replaces the file at the given path with data. It is
+// written to a temporary file in the same directory, synced to disk, and
+// renamed over the original file, so that a crash cannot leave a truncated
+// file behind.
+//
+// The permissions of an existing file are kept, as well as its owner and
+// group when permitted. New files are created with 0644 permissions. Symbolic
+// links are followed, and the file they point to is replaced.
+func writeFile(path string, data []byte) (err error) {
+
+	target, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		path = target
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	mode := os.FileMode(0644)
+
+	info, err := os.Stat(path)
+	if err == nil {
+		mode = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), mode)
+	if err != nil {
+		return err
+	}
+
+	if info != nil {
+		copyOwner(tmp.Name(), info)
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+
+}
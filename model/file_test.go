@@ -0,0 +1,304 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withTempFile creates a file in a temporary directory, and removes the
+// directory afterwards.
+func withTempFile(t *testing.T, f func(path string)) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "file")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	path := filepath.Join(dir, ".secrets.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{}\n"), 0644))
+
+	f(path)
+
+}
+
+// lockAsync calls Lock in a goroutine, and returns a channel receiving the
+// lock once taken.
+func lockAsync(t *testing.T, path string) chan *FileLock {
+
+	locks := make(chan *FileLock, 1)
+
+	go func() {
+		lock, err := Lock(path)
+		assert.NoError(t, err)
+		locks <- lock
+	}()
+
+	return locks
+
+}
+
+func TestLock(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		withTempFile(t, func(path string) {
+
+			lock, err := Lock(path)
+			assert.NoError(t, err)
+
+			locks := lockAsync(t, path)
+
+			select {
+			case <-locks:
+				assert.Fail(t, "lock taken twice")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			assert.NoError(t, lock.Unlock())
+
+			select {
+			case other := <-locks:
+				assert.NoError(t, other.Unlock())
+			case <-time.After(5 * time.Second):
+				assert.Fail(t, "lock not released")
+			}
+
+		})
+
+	})
+
+	t.Run("load while locked", func(t *testing.T) {
+
+		withTempFile(t, func(path string) {
+
+			assert.NoError(t, NewStore(testKeyID, testContext).Save(path))
+
+			lock, err := Lock(path)
+			assert.NoError(t, err)
+
+			store, err := Load(path)
+			assert.NoError(t, err)
+			assert.Equal(t, store.KMSKeyID, testKeyID)
+
+			assert.NoError(t, store.Save(path))
+			assert.NoError(t, lock.Unlock())
+
+			_, err = os.Stat(LockPath(path))
+			assert.NoError(t, err)
+
+		})
+
+	})
+
+	t.Run("file replaced while locked", func(t *testing.T) {
+
+		withTempFile(t, func(path string) {
+
+			lock, err := Lock(path)
+			assert.NoError(t, err)
+
+			assert.NoError(t, NewStore(testKeyID, testContext).Save(path))
+
+			locks := lockAsync(t, path)
+
+			select {
+			case <-locks:
+				assert.Fail(t, "lock taken twice")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			assert.NoError(t, lock.Unlock())
+
+			select {
+			case other := <-locks:
+				assert.NoError(t, other.Unlock())
+			case <-time.After(5 * time.Second):
+				assert.Fail(t, "lock not released")
+			}
+
+		})
+
+	})
+
+	t.Run("lock file removed while waiting", func(t *testing.T) {
+
+		withTempFile(t, func(path string) {
+
+			lock, err := Lock(path)
+			assert.NoError(t, err)
+
+			locks := lockAsync(t, path)
+			time.Sleep(50 * time.Millisecond)
+
+			assert.NoError(t, os.Remove(LockPath(path)))
+
+			// a third process gets the lock on the new lock file
+			third, err := Lock(path)
+			assert.NoError(t, err)
+
+			assert.NoError(t, lock.Unlock())
+
+			select {
+			case <-locks:
+				assert.Fail(t, "lock taken twice")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			assert.NoError(t, third.Unlock())
+
+			select {
+			case other := <-locks:
+				locked, err := other.file.Stat()
+				assert.NoError(t, err)
+				current, err := os.Stat(LockPath(path))
+				assert.NoError(t, err)
+				assert.True(t, os.SameFile(locked, current))
+				assert.NoError(t, other.Unlock())
+			case <-time.After(5 * time.Second):
+				assert.Fail(t, "lock not released")
+			}
+
+		})
+
+	})
+
+	t.Run("symbolic links share the lock", func(t *testing.T) {
+
+		withTempFile(t, func(path string) {
+
+			link := filepath.Join(filepath.Dir(path), "link.json")
+			assert.NoError(t, os.Symlink(path, link))
+
+			lock, err := Lock(link)
+			assert.NoError(t, err)
+
+			_, err = os.Stat(LockPath(path))
+			assert.NoError(t, err)
+
+			locks := lockAsync(t, path)
+
+			select {
+			case <-locks:
+				assert.Fail(t, "lock taken twice")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			assert.NoError(t, lock.Unlock())
+
+			select {
+			case other := <-locks:
+				assert.NoError(t, other.Unlock())
+			case <-time.After(5 * time.Second):
+				assert.Fail(t, "lock not released")
+			}
+
+		})
+
+	})
+
+	t.Run("no file", func(t *testing.T) {
+
+		_, err := Lock("does-not-exist")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to open file at does-not-exist: lstat does-not-exist: no such file or directory")
+		}
+
+	})
+
+}
+
+func TestWriteFile(t *testing.T) {
+
+	t.Run("replaces the file", func(t *testing.T) {
+
+		withTempFile(t, func(path string) {
+
+			assert.NoError(t, writeFile(path, []byte("new")))
+
+			contents, err := ioutil.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, string(contents), "new")
+
+			// no temporary file is left behind
+			files, err := ioutil.ReadDir(filepath.Dir(path))
+			assert.NoError(t, err)
+			assert.Len(t, files, 1)
+
+		})
+
+	})
+
+	t.Run("keeps permissions", func(t *testing.T) {
+
+		withTempFile(t, func(path string) {
+
+			assert.NoError(t, os.Chmod(path, 0600))
+			assert.NoError(t, writeFile(path, []byte("new")))
+
+			info, err := os.Stat(path)
+			assert.NoError(t, err)
+			assert.Equal(t, info.Mode().Perm(), os.FileMode(0600))
+
+		})
+
+	})
+
+	t.Run("new file", func(t *testing.T) {
+
+		withTempFile(t, func(path string) {
+
+			newPath := filepath.Join(filepath.Dir(path), "new.json")
+			assert.NoError(t, writeFile(newPath, []byte("new")))
+
+			info, err := os.Stat(newPath)
+			assert.NoError(t, err)
+			assert.Equal(t, info.Mode().Perm(), os.FileMode(0644))
+
+		})
+
+	})
+
+	t.Run("follows symbolic links", func(t *testing.T) {
+
+		withTempFile(t, func(path string) {
+
+			link := filepath.Join(filepath.Dir(path), "link.json")
+			assert.NoError(t, os.Symlink(path, link))
+
+			assert.NoError(t, writeFile(link, []byte("new")))
+
+			info, err := os.Lstat(link)
+			assert.NoError(t, err)
+			assert.True(t, info.Mode()&os.ModeSymlink != 0)
+
+			contents, err := ioutil.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, string(contents), "new")
+
+		})
+
+	})
+
+	t.Run("write error leaves no temporary file", func(t *testing.T) {
+
+		withTempFile(t, func(path string) {
+
+			dir := filepath.Join(filepath.Dir(path), "dir")
+			assert.NoError(t, os.Mkdir(dir, 0755))
+
+			err := writeFile(dir, []byte("new"))
+			assert.Error(t, err)
+
+			files, err := ioutil.ReadDir(filepath.Dir(path))
+			assert.NoError(t, err)
+			assert.Len(t, files, 2)
+
+		})
+
+	})
+
+}
@@ -0,0 +1,59 @@
+//go:build !windows
+// +build !windows
+
+package model
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive flock on the file, waiting for it to be
+// available.
+func lockFile(file *os.File) error {
+
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+
+}
+
+// unlockFile releases the flock taken by lockFile.
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
+
+// copyOwner gives the file at the given path the owner and group of info.
+// Errors are ignored, since only privileged users can give a file away.
+func copyOwner(path string, info os.FileInfo) {
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+
+	_ = os.Chown(path, int(stat.Uid), int(stat.Gid))
+
+}
+
+// syncDir flushes the directory entries of the given directory to disk, so
+// that a renamed file survives a crash.
+func syncDir(dir string) error {
+
+	file, err := os.Open(dir) // nolint: gosec
+	if err != nil {
+		return err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+
+}
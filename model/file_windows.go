@@ -0,0 +1,54 @@
+//go:build windows
+// +build windows
+
+package model
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+// lockfileExclusiveLock is the LOCKFILE_EXCLUSIVE_LOCK flag of LockFileEx
+const lockfileExclusiveLock = 0x00000002
+
+// lockFile takes an exclusive lock on the first byte of the file, waiting for
+// it to be available.
+func lockFile(file *os.File) error {
+
+	overlapped := &syscall.Overlapped{}
+	r1, _, err := procLockFileEx.Call(file.Fd(), lockfileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r1 == 0 {
+		return err
+	}
+
+	return nil
+
+}
+
+// unlockFile releases the lock taken by lockFile.
+func unlockFile(file *os.File) error {
+
+	overlapped := &syscall.Overlapped{}
+	r1, _, err := procUnlockFileEx.Call(file.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r1 == 0 {
+		return err
+	}
+
+	return nil
+
+}
+
+// copyOwner is a no-op, files inherit the permissions of their directory.
+func copyOwner(path string, info os.FileInfo) {}
+
+// syncDir is a no-op, directories cannot be synced.
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,181 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	"github.com/go-errors/errors"
+)
+
+// SecretVersion is a previous value of a secret, see Secret.History.
+type SecretVersion struct {
+	// _hidden is a dummy hidden key to force the use of explicit keys when
+	// initializing the struct. Allows adding keys in the future without
+	// breaking code
+	_hidden struct{}
+
+	// Version is the number of this value: 1 for the value given to Add, and
+	// incremented by each rotation.
+	Version int `json:"version"`
+
+	// Ciphertext is the encrypted value, in the same format as
+	// Secret.Ciphertext.
+	Ciphertext string `json:"ciphertext"`
+
+	// UpdatedAt is the time at which this value was set, if known.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+
+	// UpdatedBy is the author of this value, if known.
+	UpdatedBy string `json:"updated_by,omitempty"`
+}
+
+// Version returns the number of the current value of the secret: 1 when it
+// was added, incremented by each rotation.
+func (s *Secret) Version() int {
+	return s.Rotations + 1
+}
+
+// Versions returns every known value of the secret, oldest first. The last
+// one is the current value.
+func (s *Secret) Versions() []*SecretVersion {
+
+	versions := make([]*SecretVersion, 0, len(s.History)+1)
+	versions = append(versions, s.History...)
+	versions = append(versions, &SecretVersion{
+		Version:    s.Version(),
+		Ciphertext: s.Ciphertext,
+		UpdatedAt:  s.UpdatedAt,
+		UpdatedBy:  s.UpdatedBy,
+	})
+
+	return versions
+
+}
+
+// findVersion returns the value of the secret with the given number, either
+// the current one or one of its history.
+func (s *Secret) findVersion(version int) *SecretVersion {
+
+	for _, item := range s.Versions() {
+		if item.Version == version {
+			return item
+		}
+	}
+
+	return nil
+
+}
+
+// SetHistoryLimit changes the number of previous values kept for each secret,
+// see HistoryLimit. Histories longer than the new limit are trimmed, oldest
+// values first. A limit of zero disables the history and removes it.
+func (s *Store) SetHistoryLimit(limit int) error {
+
+	if limit < 0 {
+		return errors.Errorf("Invalid history limit %d, expected a positive number", limit)
+	}
+
+	s.HistoryLimit = limit
+	for _, item := range s.Secrets {
+		item.History = trimHistory(item.History, limit)
+	}
+
+	return nil
+
+}
+
+// DecryptVersion deciphers the value of a secret with the given number,
+// either the current one or one of its history.
+func (s *Store) DecryptVersion(provider kms.KeyProvider, name string, version int) (string, error) {
+	return s.DecryptVersionWithContext(context.Background(), provider, name, version)
+}
+
+// DecryptVersionWithContext is the same as DecryptVersion, with the ability to
+// cancel the calls to the key provider or set a deadline with the given
+// context.
+func (s *Store) DecryptVersionWithContext(ctx context.Context, provider kms.KeyProvider, name string, version int) (string, error) {
+
+	err := s.verifyMAC(ctx, provider)
+	if err != nil {
+		return "", err
+	}
+
+	item := s.Find(name)
+	if item == nil {
+		return "", errors.Errorf("Unable to find %s", name)
+	}
+
+	value := item.findVersion(version)
+	if value == nil {
+		return "", errors.Errorf("Unable to find version %d of %s", version, name)
+	}
+
+	plaintext, err := s.secretCipher(provider).decrypt(ctx, item.Name, value.Ciphertext)
+	if err != nil {
+		return "", errors.WrapPrefix(err, "Unable to decrypt secret", 0)
+	}
+
+	return plaintext, nil
+
+}
+
+// Rollback restores a previous value of a secret from its history. The value
+// is encrypted again as a new version with a new data key, like Rotate does:
+// the history is kept, and the rollback itself can be undone. It fails when the
+// value of the version is the same as the current one.
+func (s *Store) Rollback(provider kms.KeyProvider, name string, version int) error {
+	return s.RollbackWithContext(context.Background(), provider, name, version)
+}
+
+// RollbackWithContext is the same as Rollback, with the ability to cancel the
+// calls to the key provider or set a deadline with the given context.
+func (s *Store) RollbackWithContext(ctx context.Context, provider kms.KeyProvider, name string, version int) error {
+
+	err := s.verifyMAC(ctx, provider)
+	if err != nil {
+		return err
+	}
+
+	item := s.Find(name)
+	if item == nil {
+		return errors.Errorf("Unable to find %s", name)
+	}
+
+	if version == item.Version() {
+		return errors.Errorf("Version %d is already the current version of %s", version, name)
+	}
+
+	plaintext, err := s.DecryptVersionWithContext(ctx, provider, name, version)
+	if err != nil {
+		return err
+	}
+
+	rotated, err := s.RotateIfChangedWithContext(ctx, provider, name, plaintext)
+	if err != nil {
+		return err
+	}
+
+	if !rotated {
+		return errors.Errorf("Version %d of %s has the same value as the current version", version, name)
+	}
+
+	return nil
+
+}
+
+// trimHistory removes the oldest values of a history to keep at most limit
+// values.
+func trimHistory(history []*SecretVersion, limit int) []*SecretVersion {
+
+	if len(history) <= limit {
+		return history
+	}
+
+	if limit == 0 {
+		return nil
+	}
+
+	return append([]*SecretVersion{}, history[len(history)-limit:]...)
+
+}
@@ -0,0 +1,385 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	crypto_mock "github.com/adrienkohlbecker/ejson-kms/crypto/mock"
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	kms_mock "github.com/adrienkohlbecker/ejson-kms/kms/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// withHistoryStore returns a store keeping a history, with a secret added by
+// alice and rotated once by bob, along with a client able to decrypt it.
+func withHistoryStore(t *testing.T, f func(store *Store, client *kms_mock.Client)) {
+
+	client := &kms_mock.Client{}
+	client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil)
+	client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil)
+
+	store := NewStore(testKeyID, testContext)
+	store.HistoryLimit = 2
+
+	crypto_mock.WithConstRandReader(testConstantNonce, func() {
+		store.Author = "alice"
+		withNow(testTime, func() {
+			assert.NoError(t, store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription))
+		})
+
+		store.Author = "bob"
+		withNow(testTime2, func() {
+			assert.NoError(t, store.Rotate(kms.NewAWSProvider(client), testName, testPlaintext2))
+		})
+	})
+
+	f(store, client)
+
+}
+
+func TestSecretVersionDummy(t *testing.T) {
+	_ = SecretVersion{_hidden: struct{}{}}
+}
+
+func TestHistory(t *testing.T) {
+
+	t.Run("rotate keeps the previous value", func(t *testing.T) {
+
+		withHistoryStore(t, func(store *Store, client *kms_mock.Client) {
+
+			item := store.Find(testName)
+			assert.Equal(t, item.Version(), 2)
+			assert.Equal(t, item.Ciphertext, testCiphertext2)
+
+			if assert.Len(t, item.History, 1) {
+				assert.Equal(t, item.History[0].Version, 1)
+				assert.Equal(t, item.History[0].Ciphertext, testCiphertext)
+				assert.Equal(t, *item.History[0].UpdatedAt, testTime)
+				assert.Equal(t, item.History[0].UpdatedBy, "alice")
+			}
+
+			versions := item.Versions()
+			if assert.Len(t, versions, 2) {
+				assert.Equal(t, versions[1].Version, 2)
+				assert.Equal(t, versions[1].Ciphertext, testCiphertext2)
+				assert.Equal(t, *versions[1].UpdatedAt, testTime2)
+				assert.Equal(t, versions[1].UpdatedBy, "bob")
+			}
+
+		})
+
+	})
+
+	t.Run("without history", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil)
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil)
+
+		store := NewStore(testKeyID, testContext)
+
+		crypto_mock.WithConstRandReader(testConstantNonce, func() {
+			assert.NoError(t, store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription))
+			assert.NoError(t, store.Rotate(kms.NewAWSProvider(client), testName, testPlaintext2))
+		})
+
+		item := store.Find(testName)
+		assert.Equal(t, item.Version(), 2)
+		assert.Len(t, item.History, 0)
+		assert.Len(t, item.Versions(), 1)
+
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+
+		withHistoryStore(t, func(store *Store, client *kms_mock.Client) {
+
+			crypto_mock.WithConstRandReader(testConstantNonce, func() {
+				assert.NoError(t, store.Rotate(kms.NewAWSProvider(client), testName, testPlaintext))
+				assert.NoError(t, store.Rotate(kms.NewAWSProvider(client), testName, testPlaintext2))
+			})
+
+			item := store.Find(testName)
+			assert.Equal(t, item.Version(), 4)
+			if assert.Len(t, item.History, 2) {
+				assert.Equal(t, item.History[0].Version, 2)
+				assert.Equal(t, item.History[1].Version, 3)
+			}
+
+		})
+
+	})
+
+}
+
+func TestSetHistoryLimit(t *testing.T) {
+
+	t.Run("trims the history", func(t *testing.T) {
+
+		withHistoryStore(t, func(store *Store, client *kms_mock.Client) {
+
+			assert.NoError(t, store.SetHistoryLimit(5))
+			assert.Len(t, store.Find(testName).History, 1)
+
+			assert.NoError(t, store.SetHistoryLimit(0))
+			assert.Equal(t, store.HistoryLimit, 0)
+			assert.Nil(t, store.Find(testName).History)
+
+		})
+
+	})
+
+	t.Run("negative", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.SetHistoryLimit(-1)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid history limit -1, expected a positive number")
+		}
+
+	})
+
+}
+
+func TestDecryptVersion(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		withHistoryStore(t, func(store *Store, client *kms_mock.Client) {
+
+			plaintext, err := store.DecryptVersion(kms.NewAWSProvider(client), testName, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, plaintext, testPlaintext)
+
+			plaintext, err = store.DecryptVersion(kms.NewAWSProvider(client), testName, 2)
+			assert.NoError(t, err)
+			assert.Equal(t, plaintext, testPlaintext2)
+
+		})
+
+	})
+
+	t.Run("cant find name", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+
+		_, err := store.DecryptVersion(kms.NewAWSProvider(&kms_mock.Client{}), testName, 1)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to find my_cred")
+		}
+
+	})
+
+	t.Run("cant find version", func(t *testing.T) {
+
+		withHistoryStore(t, func(store *Store, client *kms_mock.Client) {
+
+			_, err := store.DecryptVersion(kms.NewAWSProvider(client), testName, 3)
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Unable to find version 3 of my_cred")
+			}
+
+		})
+
+	})
+
+	t.Run("decrypt error", func(t *testing.T) {
+
+		withHistoryStore(t, func(store *Store, _ *kms_mock.Client) {
+
+			client := &kms_mock.Client{}
+			client.On("Decrypt", testKeyCiphertext, testContext1).Return("", "", errors.New("testing errors")).Once()
+
+			_, err := store.DecryptVersion(kms.NewAWSProvider(client), testName, 1)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "Unable to decrypt secret")
+			}
+
+		})
+
+	})
+
+}
+
+func TestRollback(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		withHistoryStore(t, func(store *Store, client *kms_mock.Client) {
+
+			store.Author = "carol"
+
+			crypto_mock.WithConstRandReader(testConstantNonce, func() {
+				withNow(testTime2, func() {
+					err := store.Rollback(kms.NewAWSProvider(client), testName, 1)
+					assert.NoError(t, err)
+				})
+			})
+
+			item := store.Find(testName)
+			assert.Equal(t, item.Version(), 3)
+			assert.Equal(t, item.Ciphertext, testCiphertext)
+			assert.Equal(t, item.UpdatedBy, "carol")
+
+			if assert.Len(t, item.History, 2) {
+				assert.Equal(t, item.History[1].Version, 2)
+				assert.Equal(t, item.History[1].Ciphertext, testCiphertext2)
+			}
+
+		})
+
+	})
+
+	t.Run("current version", func(t *testing.T) {
+
+		withHistoryStore(t, func(store *Store, client *kms_mock.Client) {
+
+			err := store.Rollback(kms.NewAWSProvider(client), testName, 2)
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Version 2 is already the current version of my_cred")
+			}
+
+		})
+
+	})
+
+	t.Run("same value as the current version", func(t *testing.T) {
+
+		withHistoryStore(t, func(store *Store, client *kms_mock.Client) {
+
+			assert.NoError(t, store.Rotate(kms.NewAWSProvider(client), testName, testPlaintext))
+			ciphertext := store.Find(testName).Ciphertext
+
+			err := store.Rollback(kms.NewAWSProvider(client), testName, 1)
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Version 1 of my_cred has the same value as the current version")
+			}
+
+			item := store.Find(testName)
+			assert.Equal(t, item.Version(), 3)
+			assert.Equal(t, item.Ciphertext, ciphertext)
+			assert.Len(t, item.History, 2)
+
+		})
+
+	})
+
+	t.Run("cant find name", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.Rollback(kms.NewAWSProvider(&kms_mock.Client{}), testName, 1)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to find my_cred")
+		}
+
+	})
+
+	t.Run("cant find version", func(t *testing.T) {
+
+		withHistoryStore(t, func(store *Store, client *kms_mock.Client) {
+
+			err := store.Rollback(kms.NewAWSProvider(client), testName, 5)
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Unable to find version 5 of my_cred")
+			}
+			assert.Equal(t, store.Find(testName).Version(), 2)
+
+		})
+
+	})
+
+}
+
+func TestHistoryReencrypt(t *testing.T) {
+
+	t.Run("rotate kms key", func(t *testing.T) {
+
+		withHistoryStore(t, func(store *Store, client *kms_mock.Client) {
+
+			client.On("GenerateDataKey", testKeyID2, testContext1).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Twice()
+
+			crypto_mock.WithConstRandReader(testConstantNonce, func() {
+				err := store.RotateKMSKey(kms.NewAWSProvider(client), testKeyID2)
+				assert.NoError(t, err)
+			})
+
+			item := store.Find(testName)
+			assert.Equal(t, item.History[0].Ciphertext, testCiphertextOtherKey)
+			assert.Equal(t, item.History[0].Version, 1)
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("rotate kms key with history error", func(t *testing.T) {
+
+		withHistoryStore(t, func(store *Store, _ *kms_mock.Client) {
+
+			client := &kms_mock.Client{}
+			client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+			client.On("Decrypt", testKeyCiphertext, testContext1).Return("", "", errors.New("testing errors")).Once()
+			client.On("GenerateDataKey", testKeyID2, testContext1).Return(testKeyCiphertext2, testKeyPlaintext2, nil)
+
+			err := store.RotateKMSKey(kms.NewAWSProvider(client), testKeyID2)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "Unable to decrypt version 1 of secret: my_cred")
+			}
+
+			item := store.Find(testName)
+			assert.Equal(t, item.Ciphertext, testCiphertext2)
+			assert.Equal(t, item.History[0].Ciphertext, testCiphertext)
+			assert.Equal(t, store.KMSKeyID, testKeyID)
+
+		})
+
+	})
+
+	t.Run("rename", func(t *testing.T) {
+
+		withHistoryStore(t, func(store *Store, client *kms_mock.Client) {
+
+			client.On("GenerateDataKey", testKeyID, testContext2).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Twice()
+
+			crypto_mock.WithConstRandReader(testConstantNonce, func() {
+				err := store.Rename(kms.NewAWSProvider(client), testName, testName2)
+				assert.NoError(t, err)
+			})
+
+			item := store.Find(testName2)
+			if assert.NotNil(t, item) && assert.Len(t, item.History, 1) {
+				assert.Equal(t, item.History[0].Ciphertext, testCiphertextOtherKey)
+			}
+			client.AssertExpectations(t)
+
+		})
+
+	})
+
+	t.Run("rename with history error", func(t *testing.T) {
+
+		withHistoryStore(t, func(store *Store, _ *kms_mock.Client) {
+
+			client := &kms_mock.Client{}
+			client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+			client.On("Decrypt", testKeyCiphertext, testContext1).Return("", "", errors.New("testing errors")).Once()
+			client.On("GenerateDataKey", testKeyID, testContext2).Return(testKeyCiphertext2, testKeyPlaintext2, nil)
+
+			err := store.Rename(kms.NewAWSProvider(client), testName, testName2)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "Unable to decrypt version 1 of secret")
+			}
+
+			item := store.Find(testName)
+			if assert.NotNil(t, item) {
+				assert.Equal(t, item.Ciphertext, testCiphertext2)
+				assert.Equal(t, item.History[0].Ciphertext, testCiphertext)
+			}
+
+		})
+
+	})
+
+}
@@ -0,0 +1,213 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+// Merge performs a three-way merge of two stores changed from a common base,
+// such as two branches of a git repository. Secrets are merged by name: a
+// secret added, changed or removed on a single side keeps that change, and
+// the merge fails only when a secret was changed differently on both sides.
+//
+// Changing a secret includes any change of its ciphertext or metadata: two
+// secrets added with the same name on both sides conflict, even with the same
+// value, since their ciphertexts differ.
+//
+// The settings of the files (master keys, encryption context, file key and
+// so on) are taken from the side that changed them. Since changing them
+// usually encrypts every secret again, the merge fails if the other side
+// changed any secret, or if both sides changed them differently.
+//
+// The merged store keeps the order of the secrets of ours, followed by the
+// secrets added by theirs. When the file has a MAC, it must have been
+// verified on the side whose settings are kept, so that the merged store can
+// be saved: see Verify.
+func Merge(base *Store, ours *Store, theirs *Store) (*Store, error) {
+
+	baseSettings, err := base.settings()
+	if err != nil {
+		return nil, err
+	}
+
+	oursSettings, err := ours.settings()
+	if err != nil {
+		return nil, err
+	}
+
+	theirsSettings, err := theirs.settings()
+	if err != nil {
+		return nil, err
+	}
+
+	// kept is the side whose settings are kept, and other the side that must
+	// not have changed any secret when only kept changed the settings.
+	var kept, other *Store
+
+	switch {
+	case oursSettings == theirsSettings:
+		kept = ours
+	case baseSettings == oursSettings:
+		kept, other = theirs, ours
+	case baseSettings == theirsSettings:
+		kept, other = ours, theirs
+	default:
+		return nil, errors.Errorf("Conflicting changes to the settings of the file")
+	}
+
+	if other != nil {
+
+		changed, err := secretsChanged(base.Secrets, other.Secrets)
+		if err != nil {
+			return nil, err
+		}
+
+		if changed {
+			return nil, errors.Errorf("The settings of the file were changed on one side, and its secrets on the other")
+		}
+
+	}
+
+	secrets, conflicts, err := mergeSecrets(base.Secrets, ours.Secrets, theirs.Secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conflicts) > 0 {
+		return nil, errors.Errorf("Conflicting changes to secrets: %s", strings.Join(conflicts, ", "))
+	}
+
+	merged := *kept
+	merged.Secrets = secrets
+
+	return &merged, nil
+
+}
+
+// settings returns the encoded settings of the store: all of its content,
+// but its secrets and MAC.
+func (s *Store) settings() (string, error) {
+
+	settings := *s
+	settings.Secrets = nil
+	settings.MAC = ""
+
+	b, err := json.Marshal(&settings)
+	if err != nil {
+		// Note: not covered by tests as no error can be hit with the current schema
+		return "", errors.WrapPrefix(err, "Unable to marshall Store", 0)
+	}
+
+	return string(b), nil
+
+}
+
+// encodeSecrets returns the encoded secrets by name, to compare them.
+func encodeSecrets(secrets []*Secret) (map[string]string, error) {
+
+	encoded := make(map[string]string, len(secrets))
+
+	for _, item := range secrets {
+
+		b, err := json.Marshal(item)
+		if err != nil {
+			// Note: not covered by tests as no error can be hit with the current schema
+			return nil, errors.WrapPrefix(err, "Unable to marshall Secret", 0)
+		}
+
+		encoded[item.Name] = string(b)
+
+	}
+
+	return encoded, nil
+
+}
+
+// secretsChanged returns whether any secret was added, changed or removed.
+func secretsChanged(base []*Secret, secrets []*Secret) (bool, error) {
+
+	encodedBase, err := encodeSecrets(base)
+	if err != nil {
+		return false, err
+	}
+
+	encoded, err := encodeSecrets(secrets)
+	if err != nil {
+		return false, err
+	}
+
+	if len(encodedBase) != len(encoded) {
+		return true, nil
+	}
+
+	for name, value := range encoded {
+		if encodedBase[name] != value {
+			return true, nil
+		}
+	}
+
+	return false, nil
+
+}
+
+// mergeSecrets merges the secrets of both sides by name, see Merge. It returns
+// the names of the secrets changed differently on both sides.
+func mergeSecrets(base []*Secret, ours []*Secret, theirs []*Secret) ([]*Secret, []string, error) {
+
+	encodedBase, err := encodeSecrets(base)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encodedOurs, err := encodeSecrets(ours)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encodedTheirs, err := encodeSecrets(theirs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	candidates := make([]*Secret, 0, len(ours)+len(theirs))
+	candidates = append(candidates, ours...)
+	candidates = append(candidates, theirs...)
+
+	merged := make([]*Secret, 0, len(ours)+len(theirs))
+	conflicts := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, candidate := range candidates {
+
+		name := candidate.Name
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		b, o, t := encodedBase[name], encodedOurs[name], encodedTheirs[name]
+
+		var side []*Secret
+		switch {
+		case o == t, b == t:
+			side = ours
+		case b == o:
+			side = theirs
+		default:
+			conflicts = append(conflicts, name)
+			continue
+		}
+
+		for _, item := range side {
+			if item.Name == name {
+				merged = append(merged, item)
+			}
+		}
+
+	}
+
+	return merged, conflicts, nil
+
+}
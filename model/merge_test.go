@@ -0,0 +1,171 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testMergeStore returns a store with a secret for each name and ciphertext
+// pair.
+func testMergeStore(pairs ...string) *Store {
+
+	store := NewStore(testKeyID, testContext)
+	for i := 0; i < len(pairs); i += 2 {
+		store.Secrets = append(store.Secrets, &Secret{Name: pairs[i], Ciphertext: pairs[i+1]})
+	}
+
+	return store
+
+}
+
+// secretPairs returns the name and ciphertext of each secret of a store.
+func secretPairs(store *Store) []string {
+
+	pairs := make([]string, 0, 2*len(store.Secrets))
+	for _, item := range store.Secrets {
+		pairs = append(pairs, item.Name, item.Ciphertext)
+	}
+
+	return pairs
+
+}
+
+func TestMerge(t *testing.T) {
+
+	t.Run("changes on both sides", func(t *testing.T) {
+
+		base := testMergeStore("a", "1", "b", "1", "c", "1", "d", "1")
+		ours := testMergeStore("a", "2", "b", "1", "d", "1", "e", "1")
+		theirs := testMergeStore("f", "1", "a", "1", "b", "2", "c", "1")
+
+		merged, err := Merge(base, ours, theirs)
+		if assert.NoError(t, err) {
+			// a changed by ours, b changed by theirs, c removed by ours, d removed
+			// by theirs, e added by ours, f added by theirs
+			assert.Equal(t, secretPairs(merged), []string{"a", "2", "b", "2", "e", "1", "f", "1"})
+		}
+
+	})
+
+	t.Run("same change on both sides", func(t *testing.T) {
+
+		base := testMergeStore("a", "1")
+		ours := testMergeStore("a", "2", "b", "1")
+		theirs := testMergeStore("b", "1", "a", "2")
+
+		merged, err := Merge(base, ours, theirs)
+		if assert.NoError(t, err) {
+			assert.Equal(t, secretPairs(merged), []string{"a", "2", "b", "1"})
+		}
+
+	})
+
+	t.Run("metadata changes", func(t *testing.T) {
+
+		base := testMergeStore("a", "1")
+		ours := testMergeStore("a", "1")
+		theirs := testMergeStore("a", "1")
+		theirs.Secrets[0].Description = "New description"
+
+		merged, err := Merge(base, ours, theirs)
+		if assert.NoError(t, err) {
+			assert.Equal(t, merged.Secrets[0].Description, "New description")
+		}
+
+	})
+
+	t.Run("conflicts", func(t *testing.T) {
+
+		base := testMergeStore("a", "1", "b", "1", "c", "1")
+		ours := testMergeStore("a", "2", "b", "2", "d", "1")
+		theirs := testMergeStore("a", "3", "c", "2", "d", "2")
+
+		_, err := Merge(base, ours, theirs)
+		if assert.Error(t, err) {
+			// a changed on both sides, b changed by ours and removed by theirs, c
+			// removed by ours and changed by theirs, d added on both sides
+			assert.Equal(t, err.Error(), "Conflicting changes to secrets: a, b, d, c")
+		}
+
+	})
+
+	t.Run("added without a base", func(t *testing.T) {
+
+		ours := testMergeStore("a", "1")
+		theirs := testMergeStore("b", "1")
+
+		merged, err := Merge(&Store{}, ours, theirs)
+		if assert.NoError(t, err) {
+			assert.Equal(t, secretPairs(merged), []string{"a", "1", "b", "1"})
+		}
+
+	})
+
+	t.Run("settings changed on one side", func(t *testing.T) {
+
+		base := testMergeStore("a", "1")
+		ours := testMergeStore("a", "1")
+		theirs := testMergeStore("a", "2")
+		theirs.KMSKeyID = testKeyID2
+
+		merged, err := Merge(base, ours, theirs)
+		if assert.NoError(t, err) {
+			assert.Equal(t, merged.KMSKeyID, testKeyID2)
+			assert.Equal(t, secretPairs(merged), []string{"a", "2"})
+		}
+
+		merged, err = Merge(base, theirs, ours)
+		if assert.NoError(t, err) {
+			assert.Equal(t, merged.KMSKeyID, testKeyID2)
+			assert.Equal(t, secretPairs(merged), []string{"a", "2"})
+		}
+
+	})
+
+	t.Run("settings and secrets changed on different sides", func(t *testing.T) {
+
+		base := testMergeStore("a", "1")
+		ours := testMergeStore("a", "1", "b", "1")
+		theirs := testMergeStore("a", "2")
+		theirs.KMSKeyID = testKeyID2
+
+		_, err := Merge(base, ours, theirs)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "The settings of the file were changed on one side, and its secrets on the other")
+		}
+
+	})
+
+	t.Run("settings changed on both sides", func(t *testing.T) {
+
+		base := testMergeStore("a", "1")
+		ours := testMergeStore("a", "1")
+		ours.HistoryLimit = 2
+		theirs := testMergeStore("a", "1")
+		theirs.HistoryLimit = 3
+
+		_, err := Merge(base, ours, theirs)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Conflicting changes to the settings of the file")
+		}
+
+	})
+
+	t.Run("MAC is not a setting", func(t *testing.T) {
+
+		base := testMergeStore("a", "1")
+		base.MAC = "base"
+		ours := testMergeStore("a", "1", "b", "1")
+		ours.MAC = "ours"
+		theirs := testMergeStore("a", "1", "c", "1")
+		theirs.MAC = "theirs"
+
+		merged, err := Merge(base, ours, theirs)
+		if assert.NoError(t, err) {
+			assert.Equal(t, secretPairs(merged), []string{"a", "1", "b", "1", "c", "1"})
+		}
+
+	})
+
+}
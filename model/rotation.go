@@ -0,0 +1,110 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+var rotationPeriodRegexp = regexp.MustCompile("^([1-9][0-9]*)([hdw])$")
+
+// rotationPeriodUnits are the units available for rotation periods
+var rotationPeriodUnits = map[string]time.Duration{
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// ParseRotationPeriod returns the duration of a rotation period, given as a
+// number of hours, days or weeks, such as "90d".
+func ParseRotationPeriod(period string) (time.Duration, error) {
+
+	matches := rotationPeriodRegexp.FindStringSubmatch(period)
+	if matches == nil {
+		return 0, errors.Errorf("Invalid rotation period %s, expected a number of hours, days or weeks such as 90d", period)
+	}
+
+	unit := rotationPeriodUnits[matches[2]]
+
+	count, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil || count > math.MaxInt64/int64(unit) {
+		return 0, errors.Errorf("Invalid rotation period %s, expected a number of hours, days or weeks such as 90d", period)
+	}
+
+	return time.Duration(count) * unit, nil
+
+}
+
+// NextRotation returns the time at which the secret must be rotated, according
+// to its RotateEvery policy. The returned boolean is false when the secret has
+// no policy.
+//
+// Secrets without metadata, added by older versions of ejson-kms, must be
+// rotated right away: the zero time is returned.
+func (s *Secret) NextRotation() (time.Time, bool, error) {
+
+	if s.RotateEvery == "" {
+		return time.Time{}, false, nil
+	}
+
+	period, err := ParseRotationPeriod(s.RotateEvery)
+	if err != nil {
+		return time.Time{}, false, errors.WrapPrefix(err, fmt.Sprintf("Invalid rotation policy for %s", s.Name), 0)
+	}
+
+	if s.UpdatedAt == nil {
+		return time.Time{}, true, nil
+	}
+
+	return s.UpdatedAt.Add(period), true, nil
+
+}
+
+// SetRotationPolicy sets how often the secret with the given name must be
+// rotated, as a period such as "90d", see ParseRotationPeriod. An empty period
+// removes the policy.
+func (s *Store) SetRotationPolicy(name string, period string) error {
+
+	item := s.Find(name)
+	if item == nil {
+		return errors.Errorf("Unable to find %s", name)
+	}
+
+	if period != "" {
+		_, err := ParseRotationPeriod(period)
+		if err != nil {
+			return err
+		}
+	}
+
+	item.RotateEvery = period
+	return nil
+
+}
+
+// Stale returns the secrets which have not been rotated as often as their
+// RotateEvery policy requires, at the given time, in the order of the file.
+func (s *Store) Stale(at time.Time) ([]*Secret, error) {
+
+	stale := make([]*Secret, 0)
+
+	for _, item := range s.Secrets {
+
+		next, ok, err := item.NextRotation()
+		if err != nil {
+			return nil, err
+		}
+
+		if ok && !next.After(at) {
+			stale = append(stale, item)
+		}
+
+	}
+
+	return stale, nil
+
+}
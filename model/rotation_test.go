@@ -0,0 +1,163 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRotationPeriod(t *testing.T) {
+
+	valid := map[string]time.Duration{
+		"12h": 12 * time.Hour,
+		"90d": 90 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+	}
+
+	for period, expected := range valid {
+		duration, err := ParseRotationPeriod(period)
+		assert.NoError(t, err)
+		assert.Equal(t, duration, expected)
+	}
+
+	for _, period := range []string{"", "90", "d", "0d", "-1d", "1.5d", "3m", "90 d", "99999999999999999999d", "99999w"} {
+		_, err := ParseRotationPeriod(period)
+		if assert.Error(t, err, period) {
+			assert.Equal(t, err.Error(), "Invalid rotation period "+period+", expected a number of hours, days or weeks such as 90d")
+		}
+	}
+
+}
+
+func TestNextRotation(t *testing.T) {
+
+	t.Run("no policy", func(t *testing.T) {
+
+		_, ok, err := (&Secret{UpdatedAt: &testTime}).NextRotation()
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+	})
+
+	t.Run("with policy", func(t *testing.T) {
+
+		next, ok, err := (&Secret{UpdatedAt: &testTime, RotateEvery: "2d"}).NextRotation()
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, next, testTime.Add(48*time.Hour))
+
+	})
+
+	t.Run("no metadata", func(t *testing.T) {
+
+		next, ok, err := (&Secret{RotateEvery: "2d"}).NextRotation()
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.True(t, next.IsZero())
+
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+
+		_, _, err := (&Secret{Name: testName, RotateEvery: "2y"}).NextRotation()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid rotation policy for my_cred: Invalid rotation period 2y, expected a number of hours, days or weeks such as 90d")
+		}
+
+	})
+
+}
+
+func TestSetRotationPolicy(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+		store.Secrets = []*Secret{&Secret{Name: testName}}
+
+		err := store.SetRotationPolicy(testName, "90d")
+		assert.NoError(t, err)
+		assert.Equal(t, store.Secrets[0].RotateEvery, "90d")
+
+		err = store.SetRotationPolicy(testName, "")
+		assert.NoError(t, err)
+		assert.Equal(t, store.Secrets[0].RotateEvery, "")
+
+	})
+
+	t.Run("cant find name", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.SetRotationPolicy(testName, "90d")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to find my_cred")
+		}
+
+	})
+
+	t.Run("invalid period", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+		store.Secrets = []*Secret{&Secret{Name: testName, RotateEvery: "90d"}}
+
+		err := store.SetRotationPolicy(testName, "90")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid rotation period 90, expected a number of hours, days or weeks such as 90d")
+		}
+		assert.Equal(t, store.Secrets[0].RotateEvery, "90d")
+
+	})
+
+}
+
+func TestStale(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+		store.Secrets = []*Secret{
+			&Secret{Name: "no_policy", UpdatedAt: &testTime},
+			&Secret{Name: "overdue", UpdatedAt: &testTime, RotateEvery: "30d"},
+			&Secret{Name: "rotated", UpdatedAt: &testTime2, RotateEvery: "30d"},
+			&Secret{Name: "no_metadata", RotateEvery: "30d"},
+			&Secret{Name: "due_now", UpdatedAt: &testTime, RotateEvery: "1w"},
+		}
+
+		stale, err := store.Stale(testTime.Add(7 * 24 * time.Hour))
+		assert.NoError(t, err)
+
+		names := make([]string, 0, len(stale))
+		for _, item := range stale {
+			names = append(names, item.Name)
+		}
+		assert.Equal(t, names, []string{"no_metadata", "due_now"})
+
+		stale, err = store.Stale(testTime2)
+		assert.NoError(t, err)
+		assert.Len(t, stale, 3)
+
+	})
+
+	t.Run("empty", func(t *testing.T) {
+
+		stale, err := NewStore(testKeyID, testContext).Stale(testTime)
+		assert.NoError(t, err)
+		assert.Len(t, stale, 0)
+
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+		store.Secrets = []*Secret{&Secret{Name: testName, RotateEvery: "2y"}}
+
+		_, err := store.Stale(testTime)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Invalid rotation policy for my_cred")
+		}
+
+	})
+
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 // Secret represents a given secret
 type Secret struct {
 	// _hidden is a dummy hidden key to force the use of explicit keys when
@@ -22,4 +24,31 @@ type Secret struct {
 	// it must be comprised of lowercase characters, digits and underscores only.
 	// Moreover, it cannot start with a number.
 	Name string `json:"name"`
+
+	// CreatedAt is the time at which the secret was added. It is empty for
+	// secrets added by older versions of ejson-kms.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	// UpdatedAt is the time at which the plaintext of the secret was last
+	// changed, by Add or Rotate. Re-encrypting the secret, for example with a
+	// new KMS key, does not change it.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+
+	// UpdatedBy is the author of the last change of the plaintext, see
+	// Store.Author.
+	UpdatedBy string `json:"updated_by,omitempty"`
+
+	// Rotations is the number of times the secret has been rotated since it
+	// was added.
+	Rotations int `json:"rotations,omitempty"`
+
+	// RotateEvery is how often the secret must be rotated, such as "90d" (see
+	// ParseRotationPeriod). It is empty when the secret has no rotation
+	// policy. See Store.Stale to find the secrets overdue for rotation.
+	RotateEvery string `json:"rotate_every,omitempty"`
+
+	// History holds the previous values of the secret, oldest first, when the
+	// store keeps a history (see Store.HistoryLimit). Each of them is encrypted
+	// like the current value, with its own data key.
+	History []*SecretVersion `json:"history,omitempty"`
 }
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"context"
+	"sync"
+
+	"github.com/adrienkohlbecker/ejson-kms/crypto"
+	"github.com/adrienkohlbecker/ejson-kms/kms"
+	"github.com/go-errors/errors"
+)
+
+// secretCipher encrypts and decrypts the secrets of a store.
+//
+// Without a file key, each secret has its own data key, and the name of the
+// secret is added to the encryption context under the key "Secret". In the
+// EJK2 format, the name is also authenticated with the ciphertext.
+//
+// With a file key, it is decrypted once and shared by all the secrets, or
+// generated on first use if fileKey is empty. The name of each secret is
+// then authenticated by the file key itself.
+type secretCipher struct {
+	cipher            *crypto.Cipher
+	encryptionContext map[string]*string
+	useFileKey        bool
+	fileKey           string
+
+	once   sync.Once
+	key    *crypto.FileKey
+	keyErr error
+}
+
+// secretCipher returns a secretCipher using the master keys, encryption
+// context and file key of the store.
+func (s *Store) secretCipher(provider kms.KeyProvider) *secretCipher {
+	return &secretCipher{
+		cipher:            s.cipher(provider),
+		encryptionContext: s.EncryptionContext,
+		useFileKey:        s.FileKey != "",
+		fileKey:           s.FileKey,
+	}
+}
+
+// encrypt returns the ciphertext of the secret with the given name.
+func (c *secretCipher) encrypt(ctx context.Context, name string, plaintext string) (string, error) {
+
+	if !c.useFileKey {
+		return c.cipher.EncryptSecretWithContext(ctx, name, plaintext, c.secretContext(name))
+	}
+
+	key, err := c.loadFileKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return key.Seal(plaintext, name)
+
+}
+
+// decrypt returns the plaintext of the secret with the given name.
+func (c *secretCipher) decrypt(ctx context.Context, name string, ciphertext string) (string, error) {
+
+	if !c.useFileKey {
+		return c.cipher.DecryptSecretWithContext(ctx, name, ciphertext, c.secretContext(name))
+	}
+
+	key, err := c.loadFileKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return key.Open(ciphertext, name)
+
+}
+
+// loadFileKey decrypts the file key, or generates a new one if there
+// is none yet. The key provider is only called once, and its result is
+// shared by concurrent callers.
+func (c *secretCipher) loadFileKey(ctx context.Context) (*crypto.FileKey, error) {
+
+	c.once.Do(func() {
+
+		if c.fileKey == "" {
+			c.key, c.fileKey, c.keyErr = c.cipher.GenerateFileKeyWithContext(ctx, c.encryptionContext)
+			if c.keyErr != nil {
+				c.keyErr = errors.WrapPrefix(c.keyErr, "Unable to generate file key", 0)
+				return
+			}
+			c.key.Padding = c.cipher.Padding
+			return
+		}
+
+		c.key, c.keyErr = c.cipher.DecryptFileKeyWithContext(ctx, c.fileKey, c.encryptionContext)
+		if c.keyErr != nil {
+			c.keyErr = errors.WrapPrefix(c.keyErr, "Unable to decrypt file key", 0)
+			return
+		}
+		c.key.Padding = c.cipher.Padding
+
+	})
+
+	return c.key, c.keyErr
+
+}
+
+// secretContext returns the encryption context of the secret with the given
+// name.
+func (c *secretCipher) secretContext(name string) map[string]*string {
+
+	context := make(map[string]*string)
+	for k, v := range c.encryptionContext {
+		context[k] = v
+	}
+	context["Secret"] = &name
+
+	return context
+
+}
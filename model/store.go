@@ -1,9 +1,12 @@
 package model
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"sync"
+	"time"
 
 	"github.com/adrienkohlbecker/ejson-kms/crypto"
 	"github.com/adrienkohlbecker/ejson-kms/formatter"
@@ -26,10 +29,13 @@ type Store struct {
 	// in the file, since KMS uses it as part of the decryption process.
 	EncryptionContext map[string]*string `json:"encryption_context"`
 
-	// KMSKeyID is an aws ID pointing to the master key used to encrypt the
+	// KMSKeyID is an ID pointing to the master key used to encrypt the
 	// secrets in this file.
 	//
-	// This value can be a globally
+	// Its scheme selects the key provider, see kms.KeyProvider. Without a
+	// scheme, or with the "awskms://" scheme, the ID is an AWS KMS key ID.
+	//
+	// For AWS KMS, this value can be a globally
 	// unique identifier, a fully specified ID to either an alias or a key, or
 	// an alias name prefixed by "alias/".
 	//
@@ -42,12 +48,89 @@ type Store struct {
 	//   Alias Name Example - alias/MyAliasName
 	KMSKeyID string `json:"kms_key_id"`
 
+	// AdditionalKMSKeyIDs are the IDs of other master keys wrapping the data
+	// key of each secret, along with KMSKeyID. Any of them can be used to
+	// decrypt the secrets, which protects against the outage or deletion of a
+	// single master key (for example, keys in two AWS regions given as ARNs,
+	// or an AWS key and a break-glass local key).
+	//
+	// Use AddKMSKey and RemoveKMSKey to change this list, since every secret
+	// must be encrypted again.
+	AdditionalKMSKeyIDs []string `json:"additional_kms_key_ids,omitempty"`
+
+	// FileKey is a data key shared by all the secrets of the file, wrapped by
+	// each master key, so that decrypting every secret only needs a single
+	// call to the key provider. It is empty when each secret has its own data
+	// key, which is the default.
+	//
+	// The encryption context is used for the wrapping of the file key, without
+	// the name of the secrets. Each secret is sealed with the file key and a
+	// random nonce, with its name authenticated as additional data.
+	//
+	// Use RotateFileKey to enable it, or to replace it with a new key.
+	FileKey string `json:"file_key,omitempty"`
+
+	// Algorithm is the algorithm used to encrypt new secrets in the EJK2
+	// format, such as "xchacha20-poly1305" or "aes-256-gcm". The EJK2 format
+	// authenticates the name of each secret and KMSKeyID along with its
+	// ciphertext. It is empty for files using the EJK1 format, which is the
+	// default, and for files using a file key.
+	//
+	// Use Migrate to change it, since every secret must be encrypted again.
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// Padding is the scheme used to pad new secrets before encryption, to hide
+	// their length, such as "pow2" (next power of two) or "block256"
+	// (multiple of 256 bytes). It is recorded in each ciphertext and removed
+	// on decryption. It is empty when secrets are not padded, which is the
+	// default.
+	//
+	// Use SetPadding to change it, since every secret must be encrypted again.
+	Padding string `json:"padding,omitempty"`
+
+	// MACKey is a key authenticating the whole file, wrapped by each master
+	// key with the encryption context. It is empty when the file is not
+	// authenticated, which is the default.
+	//
+	// Use RotateMACKey to enable it, or to replace it with a new key.
+	MACKey string `json:"mac_key,omitempty"`
+
+	// MAC authenticates the content of the file with MACKey: the master keys,
+	// encryption context and other settings, along with the ordered list of
+	// names, descriptions and ciphertexts of the secrets. It detects deleted
+	// secrets, secrets reverted to an older ciphertext, and modified settings.
+	//
+	// It is checked by Verify, or before the first use of the key provider,
+	// and computed again by Save.
+	MAC string `json:"mac,omitempty"`
+
+	// HistoryLimit is the number of previous values kept for each secret when
+	// it is rotated, see Secret.History. It is zero when no history is kept,
+	// which is the default.
+	//
+	// Use SetHistoryLimit to change it, since existing histories may need to
+	// be trimmed.
+	HistoryLimit int `json:"history_limit,omitempty"`
+
 	// Secrets is a list of secrets
 	Secrets []*Secret `json:"secrets"`
 
 	// Version is the version of the JSON schema to use. For now there is only
 	// version 1.
 	Version int `json:"version"`
+
+	// Author is recorded in the metadata of the secrets added or rotated, see
+	// Secret.UpdatedBy. It is not saved in the file.
+	Author string `json:"-"`
+
+	// macKey is the decrypted MACKey, once the MAC has been verified
+	macKey *crypto.MACKey
+}
+
+// now returns the time recorded in the metadata of the secrets, for mocking
+// in tests.
+var now = func() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
 }
 
 // NewStore returns a new empty store
@@ -64,6 +147,10 @@ func NewStore(kmsKeyID string, encryptionContext map[string]*string) *Store {
 
 // Load takes a path to a secrets file and returns the contents of the
 // file unmarshaled in the model.
+//
+// Loading fails if the file has a MAC without its key, or the reverse. The
+// MAC itself is checked by the first method calling the key provider, or by
+// Verify, which must be called before saving a file with a MAC otherwise.
 func Load(path string) (*Store, error) {
 
 	bytes, err := ioutil.ReadFile(path) // nolint: gosec
@@ -71,10 +158,30 @@ func Load(path string) (*Store, error) {
 		return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to read file at %s", path), 0)
 	}
 
+	return Parse(bytes, path)
+
+}
+
+// Parse returns the store found in the contents of a secrets file, such as
+// an older revision of it read from version control. source describes where
+// the contents come from, for error messages.
+//
+// As with Load, the MAC of the file is checked when the key provider is first
+// used.
+func Parse(data []byte, source string) (*Store, error) {
+
 	store := &Store{}
-	err = json.Unmarshal(bytes, store)
+	err := json.Unmarshal(data, store)
 	if err != nil {
-		return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to decode Store at %s", path), 0)
+		return nil, errors.WrapPrefix(err, fmt.Sprintf("Unable to decode Store at %s", source), 0)
+	}
+
+	// a MAC cannot be verified without its key, and the reverse
+	if store.MACKey == "" && store.MAC != "" {
+		return nil, errors.Errorf("Invalid Store at %s: the file has a MAC but no MAC key", source)
+	}
+	if store.MACKey != "" && store.MAC == "" {
+		return nil, errors.Errorf("Invalid Store at %s: the file has a MAC key but no MAC", source)
 	}
 
 	return store, nil
@@ -88,9 +195,29 @@ func (s *Store) Contains(name string) bool {
 }
 
 // Save takes a Store struct and writes it to disk to the given path.
-// The JSON is pretty-printed and file permissions are set to 0644.
+// The JSON is pretty-printed, and the file is replaced atomically: its
+// permissions are kept, and new files are created with 0644 permissions.
+//
+// When the store has a MAC, it is computed again, which requires the MAC to
+// have been verified first.
 func (s *Store) Save(path string) error {
 
+	if s.MACKey != "" {
+
+		key, err := s.verifiedMACKey()
+		if err != nil {
+			return err
+		}
+
+		data, err := s.macData()
+		if err != nil {
+			return err
+		}
+
+		s.MAC = key.Sum(data)
+
+	}
+
 	bytes, err := json.MarshalIndent(s, "", "  ")
 	if err != nil {
 		// Note: not covered by tests as no error can be hit with the current schema
@@ -99,7 +226,7 @@ func (s *Store) Save(path string) error {
 
 	bytes = append(bytes, []byte("\n")...)
 
-	err = ioutil.WriteFile(path, bytes, 0644)
+	err = writeFile(path, bytes)
 	if err != nil {
 		return errors.WrapPrefix(err, fmt.Sprintf("Unable to write file at path %s", path), 0)
 	}
@@ -112,25 +239,35 @@ func (s *Store) Save(path string) error {
 //
 // Note that the name of the secret is automatically added to the encryption
 // context under the key "Secret"
-func (s *Store) Add(client kms.Client, plaintext string, name string, description string) error {
+//
+// The time of creation and the Author of the store are recorded along with
+// the secret.
+func (s *Store) Add(provider kms.KeyProvider, plaintext string, name string, description string) error {
+	return s.AddWithContext(context.Background(), provider, plaintext, name, description)
+}
 
-	context := make(map[string]*string)
-	for k, v := range s.EncryptionContext {
-		context[k] = v
-	}
-	context["Secret"] = &name
+// AddWithContext is the same as Add, with the ability to cancel the calls to
+// the key provider or set a deadline with the given context.
+func (s *Store) AddWithContext(ctx context.Context, provider kms.KeyProvider, plaintext string, name string, description string) error {
 
-	cipher := crypto.NewCipher(client, s.KMSKeyID)
+	err := s.verifyMAC(ctx, provider)
+	if err != nil {
+		return err
+	}
 
-	ciphertext, err := cipher.Encrypt(plaintext, context)
+	ciphertext, err := s.secretCipher(provider).encrypt(ctx, name, plaintext)
 	if err != nil {
 		return err
 	}
 
+	createdAt := now()
 	cred := &Secret{
 		Name:        name,
 		Description: description,
 		Ciphertext:  ciphertext,
+		CreatedAt:   &createdAt,
+		UpdatedAt:   &createdAt,
+		UpdatedBy:   s.Author,
 	}
 
 	s.Secrets = append(s.Secrets, cred)
@@ -140,31 +277,196 @@ func (s *Store) Add(client kms.Client, plaintext string, name string, descriptio
 
 // ExportPlaintext deciphers all the secrets and publishes them to a channel
 // for formatting.
-func (s *Store) ExportPlaintext(client kms.Client) (chan formatter.Item, error) {
+//
+// Secrets are decrypted sequentially, and the channel is filled before
+// returning. See StreamPlaintext to decrypt them concurrently.
+func (s *Store) ExportPlaintext(provider kms.KeyProvider) (chan formatter.Item, error) {
+	return s.ExportPlaintextWithContext(context.Background(), provider)
+}
+
+// ExportPlaintextWithContext is the same as ExportPlaintext, with the ability
+// to cancel the calls to the key provider or set a deadline with the given
+// context.
+func (s *Store) ExportPlaintextWithContext(ctx context.Context, provider kms.KeyProvider) (chan formatter.Item, error) {
 
 	items := make(chan formatter.Item, len(s.Secrets))
-	cipher := crypto.NewCipher(client, s.KMSKeyID)
 
-	for _, item := range s.Secrets {
+	stream, wait := s.StreamPlaintextWithContext(ctx, provider, 1)
+	for item := range stream {
+		items <- item
+	}
+
+	close(items)
+	return items, wait()
+
+}
+
+// StreamPlaintext deciphers all the secrets with up to concurrency parallel
+// calls to the key provider, and publishes them to a channel as soon as they
+// are available, in the order of the file.
+//
+// The returned function must be called once the channel has been consumed,
+// or to stop early. It cancels outstanding work, and returns the first error
+// encountered, if any. Decryption stops on the first error, and the channel
+// is then closed without publishing the remaining secrets.
+func (s *Store) StreamPlaintext(provider kms.KeyProvider, concurrency int) (<-chan formatter.Item, func() error) {
+	return s.StreamPlaintextWithContext(context.Background(), provider, concurrency)
+}
+
+// StreamPlaintextWithContext is the same as StreamPlaintext, with the ability
+// to cancel the calls to the key provider or set a deadline with the given
+// context.
+func (s *Store) StreamPlaintextWithContext(parent context.Context, provider kms.KeyProvider, concurrency int) (<-chan formatter.Item, func() error) {
+
+	err := s.verifyMAC(parent, provider)
+	if err != nil {
+		items := make(chan formatter.Item)
+		close(items)
+		return items, func() error { return err }
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	type result struct {
+		index int
+		item  formatter.Item
+		err   error
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+
+	var (
+		items    = make(chan formatter.Item)
+		jobs     = make(chan int)
+		results  = make(chan result)
+		stopped  = make(chan struct{})
+		firstErr error
+		emitted  int
+	)
 
-		context := make(map[string]*string)
-		for k, v := range s.EncryptionContext {
-			context[k] = v
+	// with a file key, the first worker decrypts it for the others
+	cipher := s.secretCipher(provider)
+
+	go func() {
+		defer close(jobs)
+		for i := range s.Secrets {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
 		}
-		context["Secret"] = &item.Name
+	}()
+
+	var workers sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			for i := range jobs {
+
+				if ctx.Err() != nil {
+					return
+				}
+
+				item := s.Secrets[i]
+
+				plaintext, err := cipher.decrypt(ctx, item.Name, item.Ciphertext)
+				if err != nil {
+					// stop other workers before reporting the error
+					cancel()
+				}
+
+				// results are always drained, this cannot block forever
+				results <- result{index: i, item: formatter.Item{Name: item.Name, Plaintext: plaintext}, err: err}
+
+			}
+		}()
+
+	}
+
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	go func() {
+		defer close(stopped)
+		defer close(items)
+
+		pending := make(map[int]formatter.Item)
+
+		for r := range results {
+
+			if r.err != nil {
+				if firstErr == nil && parent.Err() == nil {
+					firstErr = r.err
+				}
+				cancel()
+				continue
+			}
+
+			pending[r.index] = r.item
+
+			for ctx.Err() == nil {
+				item, ok := pending[emitted]
+				if !ok {
+					break
+				}
+
+				select {
+				case items <- item:
+					delete(pending, emitted)
+					emitted++
+				case <-ctx.Done():
+				}
+			}
 
-		plaintext, err := cipher.Decrypt(item.Ciphertext, context)
-		if err != nil {
-			close(items)
-			return items, err
 		}
+	}()
 
-		items <- formatter.Item{Name: item.Name, Plaintext: plaintext}
+	wait := func() error {
+		cancel()
+		<-stopped
+		if firstErr == nil && emitted < len(s.Secrets) && parent.Err() != nil {
+			return errors.WrapPrefix(parent.Err(), "Unable to decrypt secrets", 0)
+		}
+		return firstErr
+	}
+
+	return items, wait
+
+}
+
+// Decrypt deciphers a single secret and returns its plaintext.
+func (s *Store) Decrypt(provider kms.KeyProvider, name string) (string, error) {
+	return s.DecryptWithContext(context.Background(), provider, name)
+}
 
+// DecryptWithContext is the same as Decrypt, with the ability to cancel the
+// calls to the key provider or set a deadline with the given context.
+func (s *Store) DecryptWithContext(ctx context.Context, provider kms.KeyProvider, name string) (string, error) {
+
+	err := s.verifyMAC(ctx, provider)
+	if err != nil {
+		return "", err
 	}
 
-	close(items)
-	return items, nil
+	item := s.Find(name)
+	if item == nil {
+		return "", errors.Errorf("Unable to find %s", name)
+	}
+
+	plaintext, err := s.secretCipher(provider).decrypt(ctx, item.Name, item.Ciphertext)
+	if err != nil {
+		return "", errors.WrapPrefix(err, "Unable to decrypt secret", 0)
+	}
+
+	return plaintext, nil
 
 }
 
@@ -183,35 +485,147 @@ func (s *Store) Find(name string) *Secret {
 
 }
 
-// RotateKMSKey re-encrypts all the secrets with the new given KMS key
-func (s *Store) RotateKMSKey(client kms.Client, newKMSKeyID string) error {
+// Remove deletes a secret from the store
+func (s *Store) Remove(name string) error {
 
-	oldCipher := crypto.NewCipher(client, s.KMSKeyID)
-	newCipher := crypto.NewCipher(client, newKMSKeyID)
+	for i, item := range s.Secrets {
 
-	for _, item := range s.Secrets {
-
-		context := make(map[string]*string)
-		for k, v := range s.EncryptionContext {
-			context[k] = v
+		if item.Name == name {
+			s.Secrets = append(s.Secrets[:i], s.Secrets[i+1:]...)
+			return nil
 		}
-		context["Secret"] = &item.Name
 
-		oldPlaintext, err := oldCipher.Decrypt(item.Ciphertext, context)
+	}
+
+	return errors.Errorf("Unable to find %s", name)
+
+}
+
+// RotateKMSKey re-encrypts all the secrets with the new given KMS key. The
+// additional KMS keys are kept.
+func (s *Store) RotateKMSKey(provider kms.KeyProvider, newKMSKeyID string) error {
+	return s.RotateKMSKeyWithContext(context.Background(), provider, newKMSKeyID)
+}
+
+// RotateKMSKeyWithContext is the same as RotateKMSKey, with the ability to
+// cancel the calls to the key provider or set a deadline with the given
+// context.
+func (s *Store) RotateKMSKeyWithContext(ctx context.Context, provider kms.KeyProvider, newKMSKeyID string) error {
+
+	err := s.verifyMAC(ctx, provider)
+	if err != nil {
+		return err
+	}
+
+	newCipher := &secretCipher{
+		cipher:            s.newCipher(provider, newKMSKeyID, s.AdditionalKMSKeyIDs, s.Algorithm),
+		encryptionContext: s.EncryptionContext,
+		useFileKey:        s.FileKey != "",
+	}
+
+	err = s.reencrypt(ctx, s.secretCipher(provider), newCipher)
+	if err != nil {
+		return err
+	}
+
+	s.KMSKeyID = newKMSKeyID
+	return nil
+
+}
+
+// RotateEncryptionContext re-encrypts all the secrets with the new given
+// encryption context.
+//
+// Every secret is decrypted and encrypted again before the store is modified,
+// so that the store is left untouched if any operation fails.
+func (s *Store) RotateEncryptionContext(provider kms.KeyProvider, newEncryptionContext map[string]*string) error {
+	return s.RotateEncryptionContextWithContext(context.Background(), provider, newEncryptionContext)
+}
+
+// RotateEncryptionContextWithContext is the same as RotateEncryptionContext,
+// with the ability to cancel the calls to the key provider or set a deadline
+// with the given context.
+func (s *Store) RotateEncryptionContextWithContext(ctx context.Context, provider kms.KeyProvider, newEncryptionContext map[string]*string) error {
+
+	err := s.verifyMAC(ctx, provider)
+	if err != nil {
+		return err
+	}
+
+	newCipher := &secretCipher{
+		cipher:            s.cipher(provider),
+		encryptionContext: newEncryptionContext,
+		useFileKey:        s.FileKey != "",
+	}
+
+	err = s.reencrypt(ctx, s.secretCipher(provider), newCipher)
+	if err != nil {
+		return err
+	}
+
+	s.EncryptionContext = newEncryptionContext
+	return nil
+
+}
+
+// Rename changes the name of a stored secret. Since the name is part of the
+// encryption context, the secret is decrypted and re-encrypted with a new data
+// key under its new name, along with its history. The description is kept.
+func (s *Store) Rename(provider kms.KeyProvider, name string, newName string) error {
+	return s.RenameWithContext(context.Background(), provider, name, newName)
+}
+
+// RenameWithContext is the same as Rename, with the ability to cancel the calls
+// to the key provider or set a deadline with the given context.
+func (s *Store) RenameWithContext(ctx context.Context, provider kms.KeyProvider, name string, newName string) error {
+
+	err := s.verifyMAC(ctx, provider)
+	if err != nil {
+		return err
+	}
+
+	item := s.Find(name)
+	if item == nil {
+		return errors.Errorf("Unable to find %s", name)
+	}
+
+	if s.Contains(newName) {
+		return errors.Errorf("A secret named %s already exists", newName)
+	}
+
+	cipher := s.secretCipher(provider)
+
+	plaintext, err := cipher.decrypt(ctx, item.Name, item.Ciphertext)
+	if err != nil {
+		return errors.WrapPrefix(err, "Unable to decrypt secret", 0)
+	}
+
+	newCiphertext, err := cipher.encrypt(ctx, newName, plaintext)
+	if err != nil {
+		return errors.WrapPrefix(err, "Unable to encrypt secret", 0)
+	}
+
+	newHistory := make([]string, len(item.History))
+	for i, version := range item.History {
+
+		plaintext, err := cipher.decrypt(ctx, item.Name, version.Ciphertext)
 		if err != nil {
-			return errors.WrapPrefix(err, fmt.Sprintf("Unable to decrypt secret: %s", item.Name), 0)
+			return errors.WrapPrefix(err, fmt.Sprintf("Unable to decrypt version %d of secret", version.Version), 0)
 		}
 
-		newCiphertext, err := newCipher.Encrypt(oldPlaintext, context)
+		newHistory[i], err = cipher.encrypt(ctx, newName, plaintext)
 		if err != nil {
-			return errors.WrapPrefix(err, "Unable to encrypt secret", 0)
+			return errors.WrapPrefix(err, fmt.Sprintf("Unable to encrypt version %d of secret", version.Version), 0)
 		}
 
-		item.Ciphertext = newCiphertext
+	}
 
+	item.Name = newName
+	item.Ciphertext = newCiphertext
+	for i, version := range item.History {
+		version.Ciphertext = newHistory[i]
 	}
 
-	s.KMSKeyID = newKMSKeyID
 	return nil
 
 }
@@ -220,36 +634,530 @@ func (s *Store) RotateKMSKey(client kms.Client, newKMSKeyID string) error {
 //
 // Note that the name of the secret is automatically added to the encryption
 // context under the key "Secret"
-func (s *Store) Rotate(client kms.Client, name string, newPlaintext string) error {
+//
+// The time of the rotation and the Author of the store are recorded along
+// with the secret, and its rotation counter is incremented. When the store
+// keeps a history, the previous value is added to it, see HistoryLimit.
+func (s *Store) Rotate(provider kms.KeyProvider, name string, newPlaintext string) error {
+	return s.RotateWithContext(context.Background(), provider, name, newPlaintext)
+}
 
-	item := s.Find(name)
-	if item == nil {
-		return errors.Errorf("Unable to find %s", name)
+// RotateWithContext is the same as Rotate, with the ability to cancel the calls
+// to the key provider or set a deadline with the given context.
+func (s *Store) RotateWithContext(ctx context.Context, provider kms.KeyProvider, name string, newPlaintext string) error {
+
+	rotated, err := s.rotate(ctx, provider, name, newPlaintext)
+	if err != nil {
+		return err
 	}
 
-	context := make(map[string]*string)
-	for k, v := range s.EncryptionContext {
-		context[k] = v
+	if !rotated {
+		return errors.Errorf("Trying to rotate a secret and giving the same value")
 	}
-	context["Secret"] = &item.Name
 
-	cipher := crypto.NewCipher(client, s.KMSKeyID)
+	return nil
+
+}
 
-	oldPlaintext, err := cipher.Decrypt(item.Ciphertext, context)
+// RotateIfChanged is the same as Rotate, except that the secret is left
+// untouched when it already has the given value. It returns whether the secret
+// was rotated, decrypting it only once.
+func (s *Store) RotateIfChanged(provider kms.KeyProvider, name string, newPlaintext string) (bool, error) {
+	return s.RotateIfChangedWithContext(context.Background(), provider, name, newPlaintext)
+}
+
+// RotateIfChangedWithContext is the same as RotateIfChanged, with the ability
+// to cancel the calls to the key provider or set a deadline with the given
+// context.
+func (s *Store) RotateIfChangedWithContext(ctx context.Context, provider kms.KeyProvider, name string, newPlaintext string) (bool, error) {
+	return s.rotate(ctx, provider, name, newPlaintext)
+}
+
+// rotate changes the plaintext of a stored secret, see Rotate, and returns
+// false without changing anything if it already has the given value.
+func (s *Store) rotate(ctx context.Context, provider kms.KeyProvider, name string, newPlaintext string) (bool, error) {
+
+	err := s.verifyMAC(ctx, provider)
 	if err != nil {
-		return errors.WrapPrefix(err, "Unable to decrypt secret", 0)
+		return false, err
+	}
+
+	item := s.Find(name)
+	if item == nil {
+		return false, errors.Errorf("Unable to find %s", name)
+	}
+
+	cipher := s.secretCipher(provider)
+
+	oldPlaintext, err := cipher.decrypt(ctx, item.Name, item.Ciphertext)
+	if err != nil {
+		return false, errors.WrapPrefix(err, "Unable to decrypt secret", 0)
 	}
 
 	if oldPlaintext == newPlaintext {
-		return errors.Errorf("Trying to rotate a secret and giving the same value")
+		return false, nil
 	}
 
-	newCiphertext, err := cipher.Encrypt(newPlaintext, context)
+	newCiphertext, err := cipher.encrypt(ctx, item.Name, newPlaintext)
 	if err != nil {
-		return errors.WrapPrefix(err, "Unable to encrypt secret", 0)
+		return false, errors.WrapPrefix(err, "Unable to encrypt secret", 0)
 	}
 
+	if s.HistoryLimit > 0 {
+		item.History = append(item.History, &SecretVersion{
+			Version:    item.Version(),
+			Ciphertext: item.Ciphertext,
+			UpdatedAt:  item.UpdatedAt,
+			UpdatedBy:  item.UpdatedBy,
+		})
+	}
+
+	updatedAt := now()
+	item.History = trimHistory(item.History, s.HistoryLimit)
 	item.Ciphertext = newCiphertext
+	item.UpdatedAt = &updatedAt
+	item.UpdatedBy = s.Author
+	item.Rotations++
+	return true, nil
+
+}
+
+// AddKMSKey adds a master key wrapping the data key of every secret. All the
+// secrets are decrypted and encrypted again with new data keys, and the store
+// is left untouched if any operation fails.
+func (s *Store) AddKMSKey(provider kms.KeyProvider, kmsKeyID string) error {
+	return s.AddKMSKeyWithContext(context.Background(), provider, kmsKeyID)
+}
+
+// AddKMSKeyWithContext is the same as AddKMSKey, with the ability to cancel the
+// calls to the key provider or set a deadline with the given context.
+func (s *Store) AddKMSKeyWithContext(ctx context.Context, provider kms.KeyProvider, kmsKeyID string) error {
+
+	err := s.verifyMAC(ctx, provider)
+	if err != nil {
+		return err
+	}
+
+	if s.hasKMSKey(kmsKeyID) {
+		return errors.Errorf("The KMS key %s is already used", kmsKeyID)
+	}
+
+	additional := append(append([]string{}, s.AdditionalKMSKeyIDs...), kmsKeyID)
+	newCipher := &secretCipher{
+		cipher:            s.newCipher(provider, s.KMSKeyID, additional, s.Algorithm),
+		encryptionContext: s.EncryptionContext,
+		useFileKey:        s.FileKey != "",
+	}
+
+	err = s.reencrypt(ctx, s.secretCipher(provider), newCipher)
+	if err != nil {
+		return err
+	}
+
+	s.AdditionalKMSKeyIDs = additional
+	return nil
+
+}
+
+// RemoveKMSKey removes a master key from the store. All the secrets are
+// decrypted and encrypted again with new data keys, so that the removed key
+// cannot be used to decrypt them anymore. If the removed key is KMSKeyID, the
+// first additional key takes its place.
+//
+// The last master key of a store cannot be removed.
+func (s *Store) RemoveKMSKey(provider kms.KeyProvider, kmsKeyID string) error {
+	return s.RemoveKMSKeyWithContext(context.Background(), provider, kmsKeyID)
+}
+
+// RemoveKMSKeyWithContext is the same as RemoveKMSKey, with the ability to
+// cancel the calls to the key provider or set a deadline with the given
+// context.
+func (s *Store) RemoveKMSKeyWithContext(ctx context.Context, provider kms.KeyProvider, kmsKeyID string) error {
+
+	err := s.verifyMAC(ctx, provider)
+	if err != nil {
+		return err
+	}
+
+	if !s.hasKMSKey(kmsKeyID) {
+		return errors.Errorf("The KMS key %s is not used", kmsKeyID)
+	}
+
+	if len(s.AdditionalKMSKeyIDs) == 0 {
+		return errors.Errorf("Unable to remove the only KMS key")
+	}
+
+	keys := make([]string, 0, len(s.AdditionalKMSKeyIDs))
+	for _, keyID := range append([]string{s.KMSKeyID}, s.AdditionalKMSKeyIDs...) {
+		if keyID != kmsKeyID {
+			keys = append(keys, keyID)
+		}
+	}
+
+	newCipher := &secretCipher{
+		cipher:            s.newCipher(provider, keys[0], keys[1:], s.Algorithm),
+		encryptionContext: s.EncryptionContext,
+		useFileKey:        s.FileKey != "",
+	}
+
+	err = s.reencrypt(ctx, s.secretCipher(provider), newCipher)
+	if err != nil {
+		return err
+	}
+
+	s.KMSKeyID = keys[0]
+	s.AdditionalKMSKeyIDs = keys[1:]
+	if len(s.AdditionalKMSKeyIDs) == 0 {
+		s.AdditionalKMSKeyIDs = nil
+	}
+
+	return nil
+
+}
+
+// RotateFileKey generates a new file key, and seals every secret with it. On a
+// store where each secret has its own data key, this switches it to a single
+// data key for the whole file, see FileKey. The Algorithm of a store in the
+// EJK2 format is cleared, since secrets sealed with a file key do not use it.
+//
+// Every secret is decrypted and encrypted again before the store is modified,
+// so that the store is left untouched if any operation fails.
+func (s *Store) RotateFileKey(provider kms.KeyProvider) error {
+	return s.RotateFileKeyWithContext(context.Background(), provider)
+}
+
+// RotateFileKeyWithContext is the same as RotateFileKey, with the ability to
+// cancel the calls to the key provider or set a deadline with the given
+// context.
+func (s *Store) RotateFileKeyWithContext(ctx context.Context, provider kms.KeyProvider) error {
+
+	err := s.verifyMAC(ctx, provider)
+	if err != nil {
+		return err
+	}
+
+	newCipher := &secretCipher{
+		cipher:            s.cipher(provider),
+		encryptionContext: s.EncryptionContext,
+		useFileKey:        true,
+	}
+
+	err = s.reencrypt(ctx, s.secretCipher(provider), newCipher)
+	if err != nil {
+		return err
+	}
+
+	s.Algorithm = ""
+	return nil
+
+}
+
+// SetPadding re-encrypts all the secrets with the given padding scheme, such
+// as crypto.PaddingPowerOfTwo, or without padding if it is empty.
+//
+// Every secret is decrypted and encrypted again before the store is modified,
+// so that the store is left untouched if any operation fails.
+func (s *Store) SetPadding(provider kms.KeyProvider, padding string) error {
+	return s.SetPaddingWithContext(context.Background(), provider, padding)
+}
+
+// SetPaddingWithContext is the same as SetPadding, with the ability to cancel
+// the calls to the key provider or set a deadline with the given context.
+func (s *Store) SetPaddingWithContext(ctx context.Context, provider kms.KeyProvider, padding string) error {
+
+	err := crypto.ValidPadding(padding)
+	if err != nil {
+		return err
+	}
+
+	err = s.verifyMAC(ctx, provider)
+	if err != nil {
+		return err
+	}
+
+	cipher := s.cipher(provider)
+	cipher.Padding = padding
+
+	newCipher := &secretCipher{
+		cipher:            cipher,
+		encryptionContext: s.EncryptionContext,
+		useFileKey:        s.FileKey != "",
+	}
+
+	err = s.reencrypt(ctx, s.secretCipher(provider), newCipher)
+	if err != nil {
+		return err
+	}
+
+	s.Padding = padding
+	return nil
+
+}
+
+// Migrate re-encrypts all the secrets in the EJK2 format, with the given
+// algorithm. It can also be used to switch a file already in the EJK2 format
+// to another algorithm.
+//
+// Every secret is decrypted and encrypted again before the store is modified,
+// so that the store is left untouched if any operation fails. Stores with a
+// file key cannot be migrated, since their secrets already authenticate their
+// name.
+func (s *Store) Migrate(provider kms.KeyProvider, algorithm string) error {
+	return s.MigrateWithContext(context.Background(), provider, algorithm)
+}
+
+// MigrateWithContext is the same as Migrate, with the ability to cancel the
+// calls to the key provider or set a deadline with the given context.
+func (s *Store) MigrateWithContext(ctx context.Context, provider kms.KeyProvider, algorithm string) error {
+
+	err := crypto.ValidAlgorithm(algorithm)
+	if err != nil {
+		return err
+	}
+
+	if s.FileKey != "" {
+		return errors.Errorf("Unable to migrate a file using a file key")
+	}
+
+	err = s.verifyMAC(ctx, provider)
+	if err != nil {
+		return err
+	}
+
+	newCipher := &secretCipher{
+		cipher:            s.newCipher(provider, s.KMSKeyID, s.AdditionalKMSKeyIDs, algorithm),
+		encryptionContext: s.EncryptionContext,
+	}
+
+	err = s.reencrypt(ctx, s.secretCipher(provider), newCipher)
+	if err != nil {
+		return err
+	}
+
+	s.Algorithm = algorithm
+	return nil
+
+}
+
+// Verify checks the MAC of the store, to detect deleted secrets, secrets
+// reverted to an older ciphertext, or modified settings. The MAC key is
+// decrypted with the key provider, and kept to compute the MAC again on Save.
+//
+// An error is returned if the store has no MAC.
+func (s *Store) Verify(provider kms.KeyProvider) error {
+	return s.VerifyWithContext(context.Background(), provider)
+}
+
+// VerifyWithContext is the same as Verify, with the ability to cancel the
+// calls to the key provider or set a deadline with the given context.
+func (s *Store) VerifyWithContext(ctx context.Context, provider kms.KeyProvider) error {
+
+	if s.MACKey == "" {
+		return errors.Errorf("The file has no MAC")
+	}
+
+	key, err := s.cipher(provider).DecryptMACKeyWithContext(ctx, s.MACKey, s.EncryptionContext)
+	if err != nil {
+		return errors.WrapPrefix(err, "Unable to decrypt MAC key", 0)
+	}
+
+	data, err := s.macData()
+	if err != nil {
+		return err
+	}
+
+	err = key.Verify(data, s.MAC)
+	if err != nil {
+		return errors.WrapPrefix(err, "The file has been modified since it was last saved", 0)
+	}
+
+	s.macKey = key
+	return nil
+
+}
+
+// RotateMACKey generates a new MAC key. On a store without a MAC, this enables
+// it, otherwise the current MAC must have been verified first. The MAC itself
+// is computed on Save.
+func (s *Store) RotateMACKey(provider kms.KeyProvider) error {
+	return s.RotateMACKeyWithContext(context.Background(), provider)
+}
+
+// RotateMACKeyWithContext is the same as RotateMACKey, with the ability to
+// cancel the calls to the key provider or set a deadline with the given
+// context.
+func (s *Store) RotateMACKeyWithContext(ctx context.Context, provider kms.KeyProvider) error {
+
+	err := s.verifyMAC(ctx, provider)
+	if err != nil {
+		return err
+	}
+
+	key, encoded, err := s.cipher(provider).GenerateMACKeyWithContext(ctx, s.EncryptionContext)
+	if err != nil {
+		return errors.WrapPrefix(err, "Unable to generate MAC key", 0)
+	}
+
+	s.MACKey = encoded
+	s.macKey = key
+	return nil
+
+}
+
+// verifyMAC checks the MAC of the store with Verify, if it has one that has not
+// been verified yet. It is called by every method using the key provider, so
+// that the secrets of a loaded store are never used before its MAC is checked.
+func (s *Store) verifyMAC(ctx context.Context, provider kms.KeyProvider) error {
+
+	if s.MACKey == "" || s.macKey != nil {
+		return nil
+	}
+
+	return s.VerifyWithContext(ctx, provider)
+
+}
+
+// verifiedMACKey returns the MAC key decrypted by Verify.
+func (s *Store) verifiedMACKey() (*crypto.MACKey, error) {
+
+	if s.macKey == nil {
+		return nil, errors.Errorf("The MAC of the file must be verified first")
+	}
+
+	return s.macKey, nil
+
+}
+
+// macData returns the data authenticated by the MAC: the JSON encoding of the
+// store, without the MAC itself.
+func (s *Store) macData() ([]byte, error) {
+
+	unsigned := *s
+	unsigned.MAC = ""
+
+	bytes, err := json.Marshal(&unsigned)
+	if err != nil {
+		// Note: not covered by tests as no error can be hit with the current schema
+		return nil, errors.WrapPrefix(err, "Unable to marshall Store", 0)
+	}
+
+	return bytes, nil
+
+}
+
+// cipher returns a Cipher using the master keys and algorithm of the store.
+func (s *Store) cipher(provider kms.KeyProvider) *crypto.Cipher {
+	return s.newCipher(provider, s.KMSKeyID, s.AdditionalKMSKeyIDs, s.Algorithm)
+}
+
+// newCipher returns a Cipher using the given master keys and algorithm, and
+// the padding of the store.
+func (s *Store) newCipher(provider kms.KeyProvider, kmsKeyID string, additionalKMSKeyIDs []string, algorithm string) *crypto.Cipher {
+
+	cipher := crypto.NewCipher(provider, kmsKeyID, additionalKMSKeyIDs...)
+	cipher.Algorithm = algorithm
+	cipher.Padding = s.Padding
+
+	return cipher
+
+}
+
+// hasKMSKey reports whether the given key ID is one of the master keys.
+func (s *Store) hasKMSKey(kmsKeyID string) bool {
+
+	if kmsKeyID == s.KMSKeyID {
+		return true
+	}
+
+	for _, keyID := range s.AdditionalKMSKeyIDs {
+		if keyID == kmsKeyID {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+// reencrypt decrypts every secret and its history with oldCipher, and encrypts
+// them again with newCipher. The secrets are only modified once all of them
+// succeeded. When newCipher uses a file key, a new one is generated and
+// stored. When the store has a MAC, a new MAC key is generated with newCipher,
+// which requires the MAC to have been verified first.
+func (s *Store) reencrypt(ctx context.Context, oldCipher *secretCipher, newCipher *secretCipher) error {
+
+	if s.MACKey != "" {
+		_, err := s.verifiedMACKey()
+		if err != nil {
+			return err
+		}
+	}
+
+	newCiphertexts := make([]string, len(s.Secrets))
+	newHistories := make([][]string, len(s.Secrets))
+
+	for i, item := range s.Secrets {
+
+		plaintext, err := oldCipher.decrypt(ctx, item.Name, item.Ciphertext)
+		if err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("Unable to decrypt secret: %s", item.Name), 0)
+		}
+
+		newCiphertexts[i], err = newCipher.encrypt(ctx, item.Name, plaintext)
+		if err != nil {
+			return errors.WrapPrefix(err, fmt.Sprintf("Unable to encrypt secret: %s", item.Name), 0)
+		}
+
+		newHistories[i] = make([]string, len(item.History))
+		for j, version := range item.History {
+
+			plaintext, err := oldCipher.decrypt(ctx, item.Name, version.Ciphertext)
+			if err != nil {
+				return errors.WrapPrefix(err, fmt.Sprintf("Unable to decrypt version %d of secret: %s", version.Version, item.Name), 0)
+			}
+
+			newHistories[i][j], err = newCipher.encrypt(ctx, item.Name, plaintext)
+			if err != nil {
+				return errors.WrapPrefix(err, fmt.Sprintf("Unable to encrypt version %d of secret: %s", version.Version, item.Name), 0)
+			}
+
+		}
+
+	}
+
+	newFileKey := ""
+	if newCipher.useFileKey {
+
+		// generates the file key if there are no secrets
+		_, err := newCipher.loadFileKey(ctx)
+		if err != nil {
+			return err
+		}
+
+		newFileKey = newCipher.fileKey
+
+	}
+
+	newMACKey, newEncodedMACKey := s.macKey, s.MACKey
+	if s.MACKey != "" {
+
+		var err error
+		newMACKey, newEncodedMACKey, err = newCipher.cipher.GenerateMACKeyWithContext(ctx, newCipher.encryptionContext)
+		if err != nil {
+			return errors.WrapPrefix(err, "Unable to generate MAC key", 0)
+		}
+
+	}
+
+	for i, item := range s.Secrets {
+		item.Ciphertext = newCiphertexts[i]
+		for j, version := range item.History {
+			version.Ciphertext = newHistories[i][j]
+		}
+	}
+
+	s.FileKey = newFileKey
+	s.MACKey, s.macKey = newEncodedMACKey, newMACKey
 	return nil
 
 }
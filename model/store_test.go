@@ -1,12 +1,18 @@
 package model
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	crypto_mock "github.com/adrienkohlbecker/ejson-kms/crypto/mock"
+	"github.com/adrienkohlbecker/ejson-kms/kms"
 	kms_mock "github.com/adrienkohlbecker/ejson-kms/kms/mock"
 	"github.com/stretchr/testify/assert"
 )
@@ -37,6 +43,23 @@ var (
 	testContext2 = map[string]*string{"ABC": nil, "Secret": &testName2}
 )
 
+var (
+	testTime  = time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	testTime2 = time.Date(2018, 6, 7, 8, 9, 10, 0, time.UTC)
+)
+
+// withNow sets the time recorded in the metadata of the secrets.
+func withNow(at time.Time, f func()) {
+
+	original := now
+	now = func() time.Time { return at }
+
+	f()
+
+	now = original
+
+}
+
 func TestDummy(t *testing.T) {
 	_ = Store{_hidden: struct{}{}}
 	_ = Secret{_hidden: struct{}{}}
@@ -94,6 +117,30 @@ func TestLoad(t *testing.T) {
 
 }
 
+func TestParse(t *testing.T) {
+
+	t.Run("valid", func(t *testing.T) {
+
+		j, err := Parse([]byte(`{"kms_key_id": "my-key-id", "secrets": [{"name": "test_cred"}]}`), "HEAD:.secrets.json")
+		assert.NoError(t, err)
+		if assert.NotNil(t, j) && assert.Len(t, j.Secrets, 1) {
+			assert.Equal(t, j.KMSKeyID, "my-key-id")
+			assert.Equal(t, j.Secrets[0].Name, "test_cred")
+		}
+
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+
+		_, err := Parse([]byte("{"), "HEAD:.secrets.json")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decode Store at HEAD:.secrets.json: unexpected end of JSON input")
+		}
+
+	})
+
+}
+
 func TestContains(t *testing.T) {
 
 	j := &Store{Secrets: []*Secret{
@@ -152,10 +199,13 @@ func TestAdd(t *testing.T) {
 		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
 
 		store := NewStore(testKeyID, testContext)
+		store.Author = "alice"
 
-		crypto_mock.WithConstRandReader(testConstantNonce, func() {
-			err := store.Add(client, testPlaintext, testName, testDescription)
-			assert.NoError(t, err)
+		withNow(testTime, func() {
+			crypto_mock.WithConstRandReader(testConstantNonce, func() {
+				err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+				assert.NoError(t, err)
+			})
 		})
 
 		if assert.Len(t, store.Secrets, 1) {
@@ -163,6 +213,10 @@ func TestAdd(t *testing.T) {
 			assert.Equal(t, cred.Name, testName)
 			assert.Equal(t, cred.Description, testDescription)
 			assert.Equal(t, cred.Ciphertext, testCiphertext)
+			assert.Equal(t, *cred.CreatedAt, testTime)
+			assert.Equal(t, *cred.UpdatedAt, testTime)
+			assert.Equal(t, cred.UpdatedBy, "alice")
+			assert.Equal(t, cred.Rotations, 0)
 		}
 
 	})
@@ -173,7 +227,7 @@ func TestAdd(t *testing.T) {
 		client.On("GenerateDataKey", testKeyID, testContext1).Return("", "", errors.New("testing errors")).Once()
 		store := NewStore(testKeyID, testContext)
 
-		err := store.Add(client, testPlaintext, testName, testDescription)
+		err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "Unable to generate data key")
 		}
@@ -190,7 +244,7 @@ func TestExportPlaintext(t *testing.T) {
 
 		client := &kms_mock.Client{}
 
-		items, err := store.ExportPlaintext(client)
+		items, err := store.ExportPlaintext(kms.NewAWSProvider(client))
 		assert.NoError(t, err)
 
 		_, open := <-items
@@ -206,13 +260,13 @@ func TestExportPlaintext(t *testing.T) {
 		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
 		client.On("GenerateDataKey", testKeyID, testContext2).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
 
-		err := store.Add(client, testPlaintext, testName, testDescription)
+		err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
 		assert.NoError(t, err)
 
-		err = store.Add(client, testPlaintext2, testName2, testDescription2)
+		err = store.Add(kms.NewAWSProvider(client), testPlaintext2, testName2, testDescription2)
 		assert.NoError(t, err)
 
-		items, err := store.ExportPlaintext(client)
+		items, err := store.ExportPlaintext(kms.NewAWSProvider(client))
 		assert.NoError(t, err)
 
 		item, open := <-items
@@ -236,10 +290,10 @@ func TestExportPlaintext(t *testing.T) {
 		client.On("Decrypt", testKeyCiphertext, testContext1).Return("", "", errors.New("testing errors")).Once()
 		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
 
-		err := store.Add(client, testPlaintext, testName, testDescription)
+		err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
 		assert.NoError(t, err)
 
-		items, err := store.ExportPlaintext(client)
+		items, err := store.ExportPlaintext(kms.NewAWSProvider(client))
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "Unable to decrypt key ciphertext")
 		}
@@ -251,6 +305,252 @@ func TestExportPlaintext(t *testing.T) {
 
 }
 
+// slowProvider is a KeyProvider returning testKeyPlaintext after calling
+// decrypt with the name of the secret.
+type slowProvider struct {
+	decrypt func(name string) error
+}
+
+func (p *slowProvider) GenerateDataKey(ctx context.Context, keyID string, encryptionContext map[string]*string) (kms.DataKey, error) {
+	return kms.DataKey{}, errors.New("not implemented")
+}
+
+func (p *slowProvider) EncryptDataKey(ctx context.Context, keyID string, plaintext []byte, encryptionContext map[string]*string) (kms.DataKey, error) {
+	return kms.DataKey{}, errors.New("not implemented")
+}
+
+func (p *slowProvider) DecryptDataKey(ctx context.Context, keyID string, ciphertext []byte, encryptionContext map[string]*string) (kms.DataKey, error) {
+	err := p.decrypt(*encryptionContext["Secret"])
+	if err == nil {
+		err = ctx.Err()
+	}
+	return kms.DataKey{Ciphertext: ciphertext, Plaintext: []byte(testKeyPlaintext)}, err
+}
+
+func (p *slowProvider) Handles(keyID string) bool {
+	return true
+}
+
+func storeWithSecrets(count int) *Store {
+
+	store := NewStore(testKeyID, testContext)
+	for i := 0; i < count; i++ {
+		store.Secrets = append(store.Secrets, &Secret{Name: fmt.Sprintf("secret_%d", i), Ciphertext: testCiphertext})
+	}
+
+	return store
+
+}
+
+func TestStreamPlaintext(t *testing.T) {
+
+	t.Run("preserves order", func(t *testing.T) {
+
+		store := storeWithSecrets(20)
+
+		var inFlight, maxInFlight int32
+		provider := &slowProvider{decrypt: func(name string) error {
+			current := atomic.AddInt32(&inFlight, 1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+					break
+				}
+			}
+
+			// earlier secrets are slower
+			var i int
+			fmt.Sscanf(name, "secret_%d", &i) // nolint: errcheck
+			time.Sleep(time.Duration(20-i) * time.Millisecond)
+
+			atomic.AddInt32(&inFlight, -1)
+			return nil
+		}}
+
+		items, wait := store.StreamPlaintext(provider, 4)
+
+		i := 0
+		for item := range items {
+			assert.Equal(t, item.Name, fmt.Sprintf("secret_%d", i))
+			assert.Equal(t, item.Plaintext, testPlaintext)
+			i++
+		}
+
+		assert.NoError(t, wait())
+		assert.Equal(t, i, 20)
+		assert.True(t, maxInFlight > 1)
+		assert.True(t, maxInFlight <= 4)
+
+	})
+
+	t.Run("streams items", func(t *testing.T) {
+
+		store := storeWithSecrets(3)
+
+		release := make(chan struct{})
+		provider := &slowProvider{decrypt: func(name string) error {
+			if name == "secret_2" {
+				<-release
+			}
+			return nil
+		}}
+
+		items, wait := store.StreamPlaintext(provider, 2)
+
+		// the first secrets are published while the last one is pending
+		item := <-items
+		assert.Equal(t, item.Name, "secret_0")
+		item = <-items
+		assert.Equal(t, item.Name, "secret_1")
+
+		close(release)
+
+		item = <-items
+		assert.Equal(t, item.Name, "secret_2")
+
+		_, open := <-items
+		assert.False(t, open)
+		assert.NoError(t, wait())
+
+	})
+
+	t.Run("cancels on first error", func(t *testing.T) {
+
+		store := storeWithSecrets(50)
+
+		var calls int32
+		provider := &slowProvider{decrypt: func(name string) error {
+			atomic.AddInt32(&calls, 1)
+			if name == "secret_1" {
+				return errors.New("testing errors")
+			}
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		}}
+
+		items, wait := store.StreamPlaintext(provider, 4)
+
+		for range items {
+		}
+
+		err := wait()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "testing errors")
+		}
+		assert.True(t, atomic.LoadInt32(&calls) < 50)
+
+	})
+
+	t.Run("stopped early", func(t *testing.T) {
+
+		store := storeWithSecrets(10)
+		provider := &slowProvider{decrypt: func(name string) error { return nil }}
+
+		items, wait := store.StreamPlaintext(provider, 2)
+
+		<-items
+		assert.NoError(t, wait())
+
+	})
+
+	t.Run("cancelled by the caller", func(t *testing.T) {
+
+		store := storeWithSecrets(5)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		provider := &slowProvider{decrypt: func(name string) error {
+			if name == "secret_1" {
+				cancel()
+			}
+			return nil
+		}}
+
+		items, wait := store.StreamPlaintextWithContext(ctx, provider, 1)
+
+		count := 0
+		for range items {
+			count++
+		}
+
+		err := wait()
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt secrets: context canceled")
+		}
+		assert.True(t, count < 5)
+
+	})
+
+}
+
+func TestDecrypt(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext2).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		store := NewStore(testKeyID, testContext)
+		store.Secrets = []*Secret{
+			&Secret{Name: testName, Ciphertext: testCiphertext},
+			&Secret{Name: testName2, Ciphertext: testCiphertext2},
+		}
+
+		plaintext, err := store.Decrypt(kms.NewAWSProvider(client), testName2)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, testPlaintext2)
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		store := NewStore(testKeyID, testContext)
+		store.Secrets = []*Secret{&Secret{Name: testName, Ciphertext: testCiphertext}}
+
+		_, err := store.DecryptWithContext(ctx, kms.NewAWSProvider(client), testName)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "context canceled")
+		}
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("cant find name", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+
+		store := NewStore(testKeyID, testContext)
+		_, err := store.Decrypt(kms.NewAWSProvider(client), testName)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to find")
+		}
+
+	})
+
+	t.Run("decrypt error", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return("", "", errors.New("testing errors")).Once()
+
+		store := NewStore(testKeyID, testContext)
+		store.Secrets = []*Secret{&Secret{Name: testName, Ciphertext: testCiphertext}}
+
+		_, err := store.Decrypt(kms.NewAWSProvider(client), testName)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to decrypt secret")
+		}
+
+	})
+
+}
+
 func TestFind(t *testing.T) {
 
 	cred := &Secret{Name: "my_cred"}
@@ -261,6 +561,34 @@ func TestFind(t *testing.T) {
 
 }
 
+func TestRemove(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		cred := &Secret{Name: "my_cred"}
+		other := &Secret{Name: "my_other_cred"}
+		store := &Store{Secrets: []*Secret{cred, other}}
+
+		err := store.Remove("my_cred")
+		assert.NoError(t, err)
+		assert.Equal(t, []*Secret{other}, store.Secrets)
+
+	})
+
+	t.Run("cant find name", func(t *testing.T) {
+
+		store := &Store{Secrets: []*Secret{&Secret{Name: "my_cred"}}}
+
+		err := store.Remove("other")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to find")
+		}
+		assert.Len(t, store.Secrets, 1)
+
+	})
+
+}
+
 func TestRotateKMSKey(t *testing.T) {
 
 	t.Run("working", func(t *testing.T) {
@@ -271,19 +599,32 @@ func TestRotateKMSKey(t *testing.T) {
 		client.On("GenerateDataKey", testKeyID2, testContext1).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
 
 		store := NewStore(testKeyID, testContext)
+		store.Author = "alice"
 
 		crypto_mock.WithConstRandReader(testConstantNonce, func() {
-			err := store.Add(client, testPlaintext, testName, testDescription)
-			assert.NoError(t, err)
+			withNow(testTime, func() {
+				err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+				assert.NoError(t, err)
+			})
 
-			err = store.RotateKMSKey(client, testKeyID2)
-			assert.NoError(t, err)
+			store.Author = "bob"
+
+			withNow(testTime2, func() {
+				err := store.RotateKMSKey(kms.NewAWSProvider(client), testKeyID2)
+				assert.NoError(t, err)
+			})
 		})
 
 		item := store.Find(testName)
 		assert.Equal(t, item.Ciphertext, testCiphertextOtherKey)
 		assert.Equal(t, store.KMSKeyID, testKeyID2)
 
+		// the metadata is kept, since the plaintext did not change
+		assert.Equal(t, *item.CreatedAt, testTime)
+		assert.Equal(t, *item.UpdatedAt, testTime)
+		assert.Equal(t, item.UpdatedBy, "alice")
+		assert.Equal(t, item.Rotations, 0)
+
 	})
 
 	t.Run("decrypt error", func(t *testing.T) {
@@ -294,10 +635,10 @@ func TestRotateKMSKey(t *testing.T) {
 
 		store := NewStore(testKeyID, testContext)
 
-		err := store.Add(client, testPlaintext, testName, testDescription)
+		err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
 		assert.NoError(t, err)
 
-		err = store.RotateKMSKey(client, testKeyID2)
+		err = store.RotateKMSKey(kms.NewAWSProvider(client), testKeyID2)
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "Unable to decrypt secret")
 		}
@@ -313,10 +654,10 @@ func TestRotateKMSKey(t *testing.T) {
 
 		store := NewStore(testKeyID, testContext)
 
-		err := store.Add(client, testPlaintext, testName, testDescription)
+		err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
 		assert.NoError(t, err)
 
-		err = store.RotateKMSKey(client, testKeyID2)
+		err = store.RotateKMSKey(kms.NewAWSProvider(client), testKeyID2)
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "Unable to encrypt secret")
 		}
@@ -325,55 +666,138 @@ func TestRotateKMSKey(t *testing.T) {
 
 }
 
-func TestRotate(t *testing.T) {
+func TestRotateEncryptionContext(t *testing.T) {
+
+	value := "DEF"
+	newContext := map[string]*string{"ABC": &value}
+	newContext1 := map[string]*string{"ABC": &value, "Secret": &testName}
+	newContext2 := map[string]*string{"ABC": &value, "Secret": &testName2}
 
 	t.Run("working", func(t *testing.T) {
 
 		client := &kms_mock.Client{}
 		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
-		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Twice()
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, newContext1).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
 
 		store := NewStore(testKeyID, testContext)
 
 		crypto_mock.WithConstRandReader(testConstantNonce, func() {
-			err := store.Add(client, testPlaintext, testName, testDescription)
+			err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
 			assert.NoError(t, err)
 
-			err = store.Rotate(client, testName, testPlaintext2)
+			err = store.RotateEncryptionContext(kms.NewAWSProvider(client), newContext)
 			assert.NoError(t, err)
 		})
 
 		item := store.Find(testName)
-		assert.Equal(t, item.Ciphertext, testCiphertext2)
+		assert.Equal(t, item.Ciphertext, testCiphertextOtherKey)
+		assert.Equal(t, store.EncryptionContext, newContext)
+		client.AssertExpectations(t)
 
 	})
 
-	t.Run("cant find name", func(t *testing.T) {
+	t.Run("decrypt error", func(t *testing.T) {
 
 		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return("", "", errors.New("testing errors")).Once()
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
 
 		store := NewStore(testKeyID, testContext)
-		err := store.Rotate(client, testName, testPlaintext)
+
+		err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+		assert.NoError(t, err)
+
+		err = store.RotateEncryptionContext(kms.NewAWSProvider(client), newContext)
 		if assert.Error(t, err) {
-			assert.Contains(t, err.Error(), "Unable to find")
+			assert.Contains(t, err.Error(), "Unable to decrypt secret")
 		}
+		assert.Equal(t, store.EncryptionContext, testContext)
 
 	})
 
-	t.Run("same value", func(t *testing.T) {
+	t.Run("encrypt error leaves store untouched", func(t *testing.T) {
 
 		client := &kms_mock.Client{}
 		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("Decrypt", testKeyCiphertext, testContext2).Return(testKeyID, testKeyPlaintext, nil).Once()
 		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext2).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, newContext1).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+		client.On("GenerateDataKey", testKeyID, newContext2).Return("", "", errors.New("testing errors")).Once()
 
 		store := NewStore(testKeyID, testContext)
 
-		err := store.Add(client, testPlaintext, testName, testDescription)
-		assert.NoError(t, err)
+		crypto_mock.WithConstRandReader(testConstantNonce, func() {
+			err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+			assert.NoError(t, err)
+
+			err = store.Add(kms.NewAWSProvider(client), testPlaintext2, testName2, testDescription2)
+			assert.NoError(t, err)
+
+			err = store.RotateEncryptionContext(kms.NewAWSProvider(client), newContext)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "Unable to encrypt secret")
+			}
+		})
+
+		assert.Equal(t, store.Find(testName).Ciphertext, testCiphertext)
+		assert.Equal(t, store.Find(testName2).Ciphertext, testCiphertext2)
+		assert.Equal(t, store.EncryptionContext, testContext)
+
+	})
+
+}
+
+func TestRename(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext2).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+
+		store := NewStore(testKeyID, testContext)
+
+		crypto_mock.WithConstRandReader(testConstantNonce, func() {
+			err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+			assert.NoError(t, err)
+
+			err = store.Rename(kms.NewAWSProvider(client), testName, testName2)
+			assert.NoError(t, err)
+		})
+
+		assert.False(t, store.Contains(testName))
+		item := store.Find(testName2)
+		if assert.NotNil(t, item) {
+			assert.Equal(t, item.Ciphertext, testCiphertextOtherKey)
+			assert.Equal(t, item.Description, testDescription)
+		}
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("cant find name", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
 
-		err = store.Rotate(client, testName, testPlaintext)
+		store := NewStore(testKeyID, testContext)
+		err := store.Rename(kms.NewAWSProvider(client), testName, testName2)
 		if assert.Error(t, err) {
-			assert.Contains(t, err.Error(), "Trying to rotate a secret and giving the same value")
+			assert.Contains(t, err.Error(), "Unable to find")
+		}
+
+	})
+
+	t.Run("new name exists", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+
+		store := &Store{Secrets: []*Secret{&Secret{Name: testName}, &Secret{Name: testName2}}}
+		err := store.Rename(kms.NewAWSProvider(client), testName, testName2)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "already exists")
 		}
 
 	})
@@ -386,13 +810,14 @@ func TestRotate(t *testing.T) {
 
 		store := NewStore(testKeyID, testContext)
 
-		err := store.Add(client, testPlaintext, testName, testDescription)
+		err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
 		assert.NoError(t, err)
 
-		err = store.Rotate(client, testName, testPlaintext2)
+		err = store.Rename(kms.NewAWSProvider(client), testName, testName2)
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "Unable to decrypt secret")
 		}
+		assert.True(t, store.Contains(testName))
 
 	})
 
@@ -401,17 +826,1050 @@ func TestRotate(t *testing.T) {
 		client := &kms_mock.Client{}
 		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
 		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
-		client.On("GenerateDataKey", testKeyID, testContext1).Return("", "", errors.New("testing errors")).Once()
+		client.On("GenerateDataKey", testKeyID, testContext2).Return("", "", errors.New("testing errors")).Once()
 
 		store := NewStore(testKeyID, testContext)
 
-		err := store.Add(client, testPlaintext, testName, testDescription)
+		err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
 		assert.NoError(t, err)
 
-		err = store.Rotate(client, testName, testPlaintext2)
+		err = store.Rename(kms.NewAWSProvider(client), testName, testName2)
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "Unable to encrypt secret")
 		}
+		assert.True(t, store.Contains(testName))
 
 	})
+
+}
+
+func TestRotate(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Twice()
+
+		store := NewStore(testKeyID, testContext)
+		store.Author = "alice"
+
+		crypto_mock.WithConstRandReader(testConstantNonce, func() {
+			withNow(testTime, func() {
+				err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+				assert.NoError(t, err)
+			})
+
+			store.Author = "bob"
+
+			withNow(testTime2, func() {
+				err := store.Rotate(kms.NewAWSProvider(client), testName, testPlaintext2)
+				assert.NoError(t, err)
+			})
+		})
+
+		item := store.Find(testName)
+		assert.Equal(t, item.Ciphertext, testCiphertext2)
+		assert.Equal(t, *item.CreatedAt, testTime)
+		assert.Equal(t, *item.UpdatedAt, testTime2)
+		assert.Equal(t, item.UpdatedBy, "bob")
+		assert.Equal(t, item.Rotations, 1)
+
+	})
+
+	t.Run("cant find name", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+
+		store := NewStore(testKeyID, testContext)
+		err := store.Rotate(kms.NewAWSProvider(client), testName, testPlaintext)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to find")
+		}
+
+	})
+
+	t.Run("same value", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+		assert.NoError(t, err)
+
+		err = store.Rotate(kms.NewAWSProvider(client), testName, testPlaintext)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Trying to rotate a secret and giving the same value")
+		}
+
+	})
+
+	t.Run("decrypt error", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return("", "", errors.New("testing errors")).Once()
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+		assert.NoError(t, err)
+
+		err = store.Rotate(kms.NewAWSProvider(client), testName, testPlaintext2)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to decrypt secret")
+		}
+
+	})
+
+	t.Run("encrypt error", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext1).Return("", "", errors.New("testing errors")).Once()
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+		assert.NoError(t, err)
+
+		err = store.Rotate(kms.NewAWSProvider(client), testName, testPlaintext2)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to encrypt secret")
+		}
+
+	})
+}
+
+func TestRotateIfChanged(t *testing.T) {
+
+	t.Run("changed", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Twice()
+
+		store := NewStore(testKeyID, testContext)
+
+		crypto_mock.WithConstRandReader(testConstantNonce, func() {
+			err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+			assert.NoError(t, err)
+
+			rotated, err := store.RotateIfChanged(kms.NewAWSProvider(client), testName, testPlaintext2)
+			assert.NoError(t, err)
+			assert.True(t, rotated)
+		})
+
+		item := store.Find(testName)
+		assert.Equal(t, item.Ciphertext, testCiphertext2)
+		assert.Equal(t, item.Rotations, 1)
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("same value", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+		assert.NoError(t, err)
+		ciphertext := store.Find(testName).Ciphertext
+
+		rotated, err := store.RotateIfChanged(kms.NewAWSProvider(client), testName, testPlaintext)
+		assert.NoError(t, err)
+		assert.False(t, rotated)
+
+		item := store.Find(testName)
+		assert.Equal(t, item.Ciphertext, ciphertext)
+		assert.Equal(t, item.Rotations, 0)
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("cant find name", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+		_, err := store.RotateIfChanged(kms.NewAWSProvider(&kms_mock.Client{}), testName, testPlaintext)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Unable to find")
+		}
+
+	})
+
+}
+
+func TestAddKMSKey(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Twice()
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("Encrypt", testKeyID2, testKeyPlaintext, testContext1).Return(testKeyCiphertext2, nil).Once()
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+		assert.NoError(t, err)
+
+		err = store.AddKMSKey(kms.NewAWSProvider(client), testKeyID2)
+		assert.NoError(t, err)
+		assert.Equal(t, store.AdditionalKMSKeyIDs, []string{testKeyID2})
+
+		item := store.Find(testName)
+		assert.True(t, strings.HasPrefix(item.Ciphertext, "EJM1;"))
+
+		// the first master key is unavailable, the second one is used
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return("", "", errors.New("testing errors")).Once()
+		client.On("Decrypt", testKeyCiphertext2, testContext1).Return(testKeyID2, testKeyPlaintext, nil).Once()
+
+		plaintext, err := store.Decrypt(kms.NewAWSProvider(client), testName)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, testPlaintext)
+
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("already used", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.AddKMSKey(kms.NewAWSProvider(&kms_mock.Client{}), testKeyID)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "The KMS key my-key-id is already used")
+		}
+
+	})
+
+	t.Run("encrypt error leaves store untouched", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Twice()
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("Encrypt", testKeyID2, testKeyPlaintext, testContext1).Return("", errors.New("testing errors")).Once()
+
+		store := NewStore(testKeyID, testContext)
+
+		crypto_mock.WithConstRandReader(testConstantNonce, func() {
+			err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+			assert.NoError(t, err)
+		})
+
+		err := store.AddKMSKey(kms.NewAWSProvider(client), testKeyID2)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to encrypt secret: my_cred: my-other-key: Unable to encrypt data key: testing errors")
+		}
+
+		assert.Nil(t, store.AdditionalKMSKeyIDs)
+		assert.Equal(t, store.Find(testName).Ciphertext, testCiphertext)
+
+	})
+
+}
+
+func TestRemoveKMSKey(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+		client.On("Encrypt", testKeyID2, testKeyPlaintext, testContext1).Return(testKeyCiphertext2, nil).Once()
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID2, testContext1).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+
+		store := NewStore(testKeyID, testContext)
+		store.AdditionalKMSKeyIDs = []string{testKeyID2}
+
+		crypto_mock.WithConstRandReader(testConstantNonce, func() {
+			err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+			assert.NoError(t, err)
+
+			err = store.RemoveKMSKey(kms.NewAWSProvider(client), testKeyID)
+			assert.NoError(t, err)
+		})
+
+		assert.Equal(t, store.KMSKeyID, testKeyID2)
+		assert.Nil(t, store.AdditionalKMSKeyIDs)
+		assert.Equal(t, store.Find(testName).Ciphertext, testCiphertextOtherKey)
+
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("not used", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.RemoveKMSKey(kms.NewAWSProvider(&kms_mock.Client{}), testKeyID2)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "The KMS key my-other-key is not used")
+		}
+
+	})
+
+	t.Run("only key", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.RemoveKMSKey(kms.NewAWSProvider(&kms_mock.Client{}), testKeyID)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to remove the only KMS key")
+		}
+
+	})
+
+}
+
+func TestRotateFileKey(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("Decrypt", testKeyCiphertext, testContext2).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+
+		store := NewStore(testKeyID, testContext)
+		store.Secrets = []*Secret{
+			&Secret{Name: testName, Ciphertext: testCiphertext},
+			&Secret{Name: testName2, Ciphertext: testCiphertext2},
+		}
+
+		err := store.RotateFileKey(kms.NewAWSProvider(client))
+		assert.NoError(t, err)
+		assert.Equal(t, store.FileKey, "EJF1;bXkta2V5LWlk:YW5vdGhlcmNpcGhlcnRleHRibG9i")
+		assert.True(t, strings.HasPrefix(store.Secrets[0].Ciphertext, "EJS1;"))
+		assert.True(t, strings.HasPrefix(store.Secrets[1].Ciphertext, "EJS1;"))
+		client.AssertExpectations(t)
+
+		// a single call decrypts every secret
+		client.On("Decrypt", testKeyCiphertext2, testContext).Return(testKeyID, testKeyPlaintext2, nil).Once()
+
+		items, err := store.ExportPlaintext(kms.NewAWSProvider(client))
+		assert.NoError(t, err)
+
+		item := <-items
+		assert.Equal(t, item.Name, testName)
+		assert.Equal(t, item.Plaintext, testPlaintext)
+		item = <-items
+		assert.Equal(t, item.Name, testName2)
+		assert.Equal(t, item.Plaintext, testPlaintext2)
+
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("clears the algorithm", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+
+		store := NewStore(testKeyID, testContext)
+		store.Algorithm = "aes-256-gcm"
+		store.Secrets = []*Secret{
+			&Secret{Name: testName, Ciphertext: testCiphertext},
+		}
+
+		err := store.RotateFileKey(kms.NewAWSProvider(client))
+		assert.NoError(t, err)
+		assert.Equal(t, store.Algorithm, "")
+		assert.True(t, strings.HasPrefix(store.Secrets[0].Ciphertext, "EJS1;"))
+		client.AssertExpectations(t)
+
+		withTempFile(t, func(path string) {
+
+			assert.NoError(t, store.Save(path))
+
+			contents, err := ioutil.ReadFile(path)
+			assert.NoError(t, err)
+			assert.NotContains(t, string(contents), `"algorithm"`)
+
+			loaded, err := Load(path)
+			assert.NoError(t, err)
+			assert.Equal(t, loaded.Algorithm, "")
+
+		})
+
+	})
+
+	t.Run("empty store", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.RotateFileKey(kms.NewAWSProvider(client))
+		assert.NoError(t, err)
+		assert.Equal(t, store.FileKey, "EJF1;bXkta2V5LWlk:Y2lwaGVydGV4dGJsb2I=")
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("rotates the file key", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+		store := NewStore(testKeyID, testContext)
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Twice()
+		assert.NoError(t, store.RotateFileKey(kms.NewAWSProvider(client)))
+		assert.NoError(t, store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription))
+
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+
+		err := store.RotateFileKey(kms.NewAWSProvider(client))
+		assert.NoError(t, err)
+		assert.Equal(t, store.FileKey, "EJF1;bXkta2V5LWlk:YW5vdGhlcmNpcGhlcnRleHRibG9i")
+
+		client.On("Decrypt", testKeyCiphertext2, testContext).Return(testKeyID, testKeyPlaintext2, nil).Once()
+
+		plaintext, err := store.Decrypt(kms.NewAWSProvider(client), testName)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, testPlaintext)
+
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("error leaves store untouched", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext).Return("", "", errors.New("testing errors")).Once()
+
+		store := NewStore(testKeyID, testContext)
+		store.Secrets = []*Secret{&Secret{Name: testName, Ciphertext: testCiphertext}}
+
+		err := store.RotateFileKey(kms.NewAWSProvider(client))
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to encrypt secret: my_cred: Unable to generate file key: Unable to generate data key: testing errors")
+		}
+		assert.Equal(t, store.FileKey, "")
+		assert.Equal(t, store.Secrets[0].Ciphertext, testCiphertext)
+
+	})
+
+}
+
+func TestFileKey(t *testing.T) {
+
+	// withFileKeyStore returns a store with a file key and the given secrets,
+	// and a client expecting a single call to decrypt the file key.
+	withFileKeyStore := func(t *testing.T, names ...string) (*Store, *kms_mock.Client) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+		if len(names) > 0 {
+			client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Times(len(names))
+		}
+
+		store := NewStore(testKeyID, testContext)
+		assert.NoError(t, store.RotateFileKey(kms.NewAWSProvider(client)))
+
+		for _, name := range names {
+			assert.NoError(t, store.Add(kms.NewAWSProvider(client), testPlaintext+name, name, ""))
+		}
+
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+		return store, client
+
+	}
+
+	t.Run("add", func(t *testing.T) {
+
+		store, client := withFileKeyStore(t)
+
+		err := store.Add(kms.NewAWSProvider(client), testPlaintext, testName, testDescription)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(store.Secrets[0].Ciphertext, "EJS1;"))
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("stream makes a single call", func(t *testing.T) {
+
+		names := make([]string, 20)
+		for i := range names {
+			names[i] = fmt.Sprintf("secret_%d", i)
+		}
+
+		store, client := withFileKeyStore(t, names...)
+
+		items, wait := store.StreamPlaintext(kms.NewAWSProvider(client), 4)
+
+		i := 0
+		for item := range items {
+			assert.Equal(t, item.Name, names[i])
+			assert.Equal(t, item.Plaintext, testPlaintext+names[i])
+			i++
+		}
+
+		assert.NoError(t, wait())
+		assert.Equal(t, i, 20)
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("rename", func(t *testing.T) {
+
+		store, client := withFileKeyStore(t, testName)
+
+		err := store.Rename(kms.NewAWSProvider(client), testName, testName2)
+		assert.NoError(t, err)
+		client.AssertExpectations(t)
+
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		plaintext, err := store.Decrypt(kms.NewAWSProvider(client), testName2)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, testPlaintext+testName)
+
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+
+		store, client := withFileKeyStore(t, testName)
+
+		err := store.Rotate(kms.NewAWSProvider(client), testName, testPlaintext2)
+		assert.NoError(t, err)
+		client.AssertExpectations(t)
+
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		plaintext, err := store.Decrypt(kms.NewAWSProvider(client), testName)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, testPlaintext2)
+
+	})
+
+	t.Run("swapped ciphertexts", func(t *testing.T) {
+
+		store, client := withFileKeyStore(t, testName, testName2)
+		store.Secrets[0].Ciphertext = store.Secrets[1].Ciphertext
+
+		_, err := store.Decrypt(kms.NewAWSProvider(client), testName)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt secret: Unable to decrypt ciphertext")
+		}
+
+	})
+
+	t.Run("decrypt error", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext).Return("", "", errors.New("testing errors")).Once()
+
+		store := NewStore(testKeyID, testContext)
+		store.FileKey = "EJF1;bXkta2V5LWlk:Y2lwaGVydGV4dGJsb2I="
+		store.Secrets = []*Secret{&Secret{Name: testName, Ciphertext: "EJS1;YWJj"}}
+
+		_, err := store.Decrypt(kms.NewAWSProvider(client), testName)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt secret: Unable to decrypt file key: Unable to decrypt data key with any master key: my-key-id: Unable to decrypt key ciphertext: testing errors")
+		}
+
+	})
+
+	t.Run("rotate encryption context", func(t *testing.T) {
+
+		store, client := withFileKeyStore(t, testName)
+
+		value := "value"
+		newContext := map[string]*string{"ABC": &value}
+		client.On("GenerateDataKey", testKeyID, newContext).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+
+		err := store.RotateEncryptionContext(kms.NewAWSProvider(client), newContext)
+		assert.NoError(t, err)
+		assert.Equal(t, store.FileKey, "EJF1;bXkta2V5LWlk:YW5vdGhlcmNpcGhlcnRleHRibG9i")
+		client.AssertExpectations(t)
+
+		client.On("Decrypt", testKeyCiphertext2, newContext).Return(testKeyID, testKeyPlaintext2, nil).Once()
+
+		plaintext, err := store.Decrypt(kms.NewAWSProvider(client), testName)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, testPlaintext+testName)
+
+	})
+
+	t.Run("add kms key", func(t *testing.T) {
+
+		store, client := withFileKeyStore(t, testName)
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+		client.On("Encrypt", testKeyID2, testKeyPlaintext2, testContext).Return(testKeyCiphertext2, nil).Once()
+
+		err := store.AddKMSKey(kms.NewAWSProvider(client), testKeyID2)
+		assert.NoError(t, err)
+		assert.Equal(t, store.FileKey, "EJF1;bXkta2V5LWlk:YW5vdGhlcmNpcGhlcnRleHRibG9i,bXktb3RoZXIta2V5:YW5vdGhlcmNpcGhlcnRleHRibG9i")
+		client.AssertExpectations(t)
+
+	})
+
+}
+
+func TestMigrate(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("Decrypt", testKeyCiphertext, testContext2).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext2).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+
+		store := NewStore(testKeyID, testContext)
+		store.Secrets = []*Secret{
+			&Secret{Name: testName, Ciphertext: testCiphertext},
+			&Secret{Name: testName2, Ciphertext: testCiphertext2},
+		}
+
+		err := store.Migrate(kms.NewAWSProvider(client), "aes-256-gcm")
+		assert.NoError(t, err)
+		assert.Equal(t, store.Algorithm, "aes-256-gcm")
+		assert.True(t, strings.HasPrefix(store.Secrets[0].Ciphertext, "EJK2;aes-256-gcm;bXkta2V5LWlk:YW5vdGhlcmNpcGhlcnRleHRibG9i;"))
+		assert.True(t, strings.HasPrefix(store.Secrets[1].Ciphertext, "EJK2;aes-256-gcm;bXkta2V5LWlk:YW5vdGhlcmNpcGhlcnRleHRibG9i;"))
+		client.AssertExpectations(t)
+
+		client.On("Decrypt", testKeyCiphertext2, testContext1).Return(testKeyID, testKeyPlaintext2, nil).Once()
+
+		plaintext, err := store.Decrypt(kms.NewAWSProvider(client), testName)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, testPlaintext)
+
+		// new secrets use the same algorithm
+		name := "my_new_cred"
+		client.On("GenerateDataKey", testKeyID, map[string]*string{"ABC": nil, "Secret": &name}).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+		err = store.Add(kms.NewAWSProvider(client), testPlaintext, name, "")
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(store.Secrets[2].Ciphertext, "EJK2;aes-256-gcm;"))
+
+	})
+
+	t.Run("swapped ciphertexts", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Twice()
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Once()
+
+		// the encryption context is the same for both secrets, only the
+		// additional data binds the ciphertext to its name
+		store := NewStore(testKeyID, testContext)
+		store.Algorithm = "xchacha20-poly1305"
+		cipher := store.cipher(kms.NewAWSProvider(client))
+
+		first, err := cipher.EncryptSecret(testName, testPlaintext, testContext)
+		assert.NoError(t, err)
+		second, err := cipher.EncryptSecret(testName2, testPlaintext2, testContext)
+		assert.NoError(t, err)
+
+		_, err = cipher.DecryptSecret(testName, second, testContext)
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt ciphertext")
+		}
+		assert.NotEqual(t, first, second)
+
+	})
+
+	t.Run("unknown algorithm", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.Migrate(kms.NewAWSProvider(&kms_mock.Client{}), "rot13")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unknown algorithm rot13, expected xchacha20-poly1305 or aes-256-gcm")
+		}
+		assert.Equal(t, store.Algorithm, "")
+
+	})
+
+	t.Run("with file key", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+		store.FileKey = "EJF1;bXkta2V5LWlk:Y2lwaGVydGV4dGJsb2I="
+
+		err := store.Migrate(kms.NewAWSProvider(&kms_mock.Client{}), "aes-256-gcm")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to migrate a file using a file key")
+		}
+
+	})
+
+	t.Run("error leaves store untouched", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+		client.On("Decrypt", testKeyCiphertext, testContext2).Return("", "", errors.New("testing errors")).Once()
+
+		store := NewStore(testKeyID, testContext)
+		store.Secrets = []*Secret{
+			&Secret{Name: testName, Ciphertext: testCiphertext},
+			&Secret{Name: testName2, Ciphertext: testCiphertext2},
+		}
+
+		err := store.Migrate(kms.NewAWSProvider(client), "xchacha20-poly1305")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt secret: my_other_cred: Unable to decrypt key ciphertext: testing errors")
+		}
+		assert.Equal(t, store.Algorithm, "")
+		assert.Equal(t, store.Secrets[0].Ciphertext, testCiphertext)
+
+	})
+
+}
+
+func TestSetPadding(t *testing.T) {
+
+	t.Run("working", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+		client.On("GenerateDataKey", testKeyID, testContext1).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+
+		store := NewStore(testKeyID, testContext)
+		store.Secrets = []*Secret{&Secret{Name: testName, Ciphertext: testCiphertext}}
+
+		err := store.SetPadding(kms.NewAWSProvider(client), "pow2")
+		assert.NoError(t, err)
+		assert.Equal(t, store.Padding, "pow2")
+		assert.True(t, strings.HasPrefix(store.Secrets[0].Ciphertext, "EJK1+pow2;YW5vdGhlcmNpcGhlcnRleHRibG9i;"))
+		client.AssertExpectations(t)
+
+		client.On("Decrypt", testKeyCiphertext2, testContext1).Return(testKeyID, testKeyPlaintext2, nil).Once()
+
+		plaintext, err := store.Decrypt(kms.NewAWSProvider(client), testName)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, testPlaintext)
+
+		// new secrets are padded too
+		client.On("GenerateDataKey", testKeyID, testContext2).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+
+		err = store.Add(kms.NewAWSProvider(client), testPlaintext2, testName2, "")
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(store.Secrets[1].Ciphertext, "EJK1+pow2;"))
+		assert.Equal(t, len(store.Secrets[1].Ciphertext), len(store.Secrets[0].Ciphertext))
+
+	})
+
+	t.Run("with file key", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil).Twice()
+
+		store := NewStore(testKeyID, testContext)
+		assert.NoError(t, store.RotateFileKey(kms.NewAWSProvider(client)))
+		assert.NoError(t, store.Add(kms.NewAWSProvider(client), testPlaintext, testName, ""))
+
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+
+		err := store.SetPadding(kms.NewAWSProvider(client), "block256")
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(store.Secrets[0].Ciphertext, "EJS1+block256;"))
+		client.AssertExpectations(t)
+
+	})
+
+	t.Run("unknown padding", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.SetPadding(kms.NewAWSProvider(&kms_mock.Client{}), "pow3")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unknown padding pow3, expected pow2 or block256")
+		}
+		assert.Equal(t, store.Padding, "")
+
+	})
+
+	t.Run("error leaves store untouched", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("Decrypt", testKeyCiphertext, testContext1).Return("", "", errors.New("testing errors")).Once()
+
+		store := NewStore(testKeyID, testContext)
+		store.Secrets = []*Secret{&Secret{Name: testName, Ciphertext: testCiphertext}}
+
+		err := store.SetPadding(kms.NewAWSProvider(client), "pow2")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to decrypt secret: my_cred: Unable to decrypt key ciphertext: testing errors")
+		}
+		assert.Equal(t, store.Padding, "")
+		assert.Equal(t, store.Secrets[0].Ciphertext, testCiphertext)
+
+	})
+
+}
+
+func TestMAC(t *testing.T) {
+
+	const testMACKey = "EJH1;bXkta2V5LWlk:Y2lwaGVydGV4dGJsb2I="
+
+	// withMACStore saves a store with a MAC and the given secrets, and returns
+	// its path along with a client able to decrypt its MAC key.
+	withMACStore := func(t *testing.T, secrets []*Secret, fn func(path string, client *kms_mock.Client)) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+
+		store := NewStore(testKeyID, testContext)
+		store.Secrets = secrets
+
+		err := store.RotateMACKey(kms.NewAWSProvider(client))
+		assert.NoError(t, err)
+		assert.Equal(t, store.MACKey, testMACKey)
+		client.AssertExpectations(t)
+
+		tmpfile, goErr := ioutil.TempFile(os.TempDir(), "mac")
+		assert.NoError(t, goErr)
+		assert.NoError(t, tmpfile.Close())
+		defer os.Remove(tmpfile.Name())
+
+		err = store.Save(tmpfile.Name())
+		assert.NoError(t, err)
+		assert.NotEmpty(t, store.MAC)
+
+		client.On("Decrypt", testKeyCiphertext, testContext).Return(testKeyID, testKeyPlaintext, nil)
+		fn(tmpfile.Name(), client)
+
+	}
+
+	secrets := func() []*Secret {
+		return []*Secret{
+			&Secret{Name: testName, Description: testDescription, Ciphertext: testCiphertext},
+			&Secret{Name: testName2, Description: testDescription2, Ciphertext: testCiphertext2},
+		}
+	}
+
+	t.Run("working", func(t *testing.T) {
+
+		withMACStore(t, secrets(), func(path string, client *kms_mock.Client) {
+
+			store, err := Load(path)
+			assert.NoError(t, err)
+
+			err = store.Verify(kms.NewAWSProvider(client))
+			assert.NoError(t, err)
+
+			// the MAC is computed again on save
+			mac := store.MAC
+			store.Secrets[0].Description = "New description."
+			assert.NoError(t, store.Save(path))
+			assert.NotEqual(t, store.MAC, mac)
+
+			store, err = Load(path)
+			assert.NoError(t, err)
+			assert.NoError(t, store.Verify(kms.NewAWSProvider(client)))
+
+		})
+
+	})
+
+	tampered := map[string]func(store *Store){
+		"deleted secret":      func(store *Store) { store.Secrets = store.Secrets[1:] },
+		"reordered secrets":   func(store *Store) { store.Secrets[0], store.Secrets[1] = store.Secrets[1], store.Secrets[0] },
+		"reverted ciphertext": func(store *Store) { store.Secrets[0].Ciphertext = testCiphertextOtherKey },
+		"changed description": func(store *Store) { store.Secrets[0].Description = "" },
+		"changed key ID":      func(store *Store) { store.AdditionalKMSKeyIDs = []string{testKeyID2} },
+		"changed algorithm":   func(store *Store) { store.Algorithm = "aes-256-gcm" },
+		"changed padding":     func(store *Store) { store.Padding = "pow2" },
+		"removed MAC":         func(store *Store) { store.MAC = "" },
+	}
+
+	for name, tamper := range tampered {
+
+		tamper := tamper
+		t.Run(name, func(t *testing.T) {
+
+			withMACStore(t, secrets(), func(path string, client *kms_mock.Client) {
+
+				store, err := Load(path)
+				assert.NoError(t, err)
+
+				tamper(store)
+
+				err = store.Verify(kms.NewAWSProvider(client))
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "The file has been modified since it was last saved: Invalid MAC")
+				}
+
+				err = store.Save(path)
+				if assert.Error(t, err) {
+					assert.Equal(t, err.Error(), "The MAC of the file must be verified first")
+				}
+
+			})
+
+		})
+
+	}
+
+	t.Run("save without verification", func(t *testing.T) {
+
+		withMACStore(t, secrets(), func(path string, client *kms_mock.Client) {
+
+			store, err := Load(path)
+			assert.NoError(t, err)
+
+			err = store.Save(path)
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "The MAC of the file must be verified first")
+			}
+
+		})
+
+	})
+
+	t.Run("verified before use", func(t *testing.T) {
+
+		withMACStore(t, secrets(), func(path string, client *kms_mock.Client) {
+
+			store, err := Load(path)
+			assert.NoError(t, err)
+
+			client.On("GenerateDataKey", testKeyID, testContext).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+
+			err = store.RotateMACKey(kms.NewAWSProvider(client))
+			assert.NoError(t, err)
+			assert.NoError(t, store.Save(path))
+
+		})
+
+	})
+
+	t.Run("tampered before use", func(t *testing.T) {
+
+		withMACStore(t, secrets(), func(path string, client *kms_mock.Client) {
+
+			store, err := Load(path)
+			assert.NoError(t, err)
+
+			store.Secrets = store.Secrets[1:]
+
+			_, err = store.Decrypt(kms.NewAWSProvider(client), testName2)
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "The file has been modified since it was last saved: Invalid MAC")
+			}
+
+			items, wait := store.StreamPlaintext(kms.NewAWSProvider(client), 1)
+			for range items {
+				assert.Fail(t, "no secret should be published")
+			}
+			err = wait()
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "The file has been modified since it was last saved: Invalid MAC")
+			}
+
+			err = store.RotateFileKey(kms.NewAWSProvider(client))
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "The file has been modified since it was last saved: Invalid MAC")
+			}
+
+		})
+
+	})
+
+	t.Run("partially removed", func(t *testing.T) {
+
+		_, err := Parse([]byte(`{"kms_key_id": "my-key-id", "mac": "abcdef", "secrets": [], "version": 1}`), "stripped.json")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid Store at stripped.json: the file has a MAC but no MAC key")
+		}
+
+		_, err = Parse([]byte(`{"kms_key_id": "my-key-id", "mac_key": "`+testMACKey+`", "secrets": [], "version": 1}`), "stripped.json")
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Invalid Store at stripped.json: the file has a MAC key but no MAC")
+		}
+
+	})
+
+	t.Run("no MAC", func(t *testing.T) {
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.Verify(kms.NewAWSProvider(&kms_mock.Client{}))
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "The file has no MAC")
+		}
+
+	})
+
+	t.Run("decrypt error", func(t *testing.T) {
+
+		withMACStore(t, secrets(), func(path string, _ *kms_mock.Client) {
+
+			client := &kms_mock.Client{}
+			client.On("Decrypt", testKeyCiphertext, testContext).Return("", "", errors.New("testing errors")).Once()
+
+			store, err := Load(path)
+			assert.NoError(t, err)
+
+			err = store.Verify(kms.NewAWSProvider(client))
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), "Unable to decrypt MAC key: Unable to decrypt data key with any master key: my-key-id: Unable to decrypt key ciphertext: testing errors")
+			}
+
+		})
+
+	})
+
+	t.Run("generate error", func(t *testing.T) {
+
+		client := &kms_mock.Client{}
+		client.On("GenerateDataKey", testKeyID, testContext).Return("", "", errors.New("testing errors")).Once()
+
+		store := NewStore(testKeyID, testContext)
+
+		err := store.RotateMACKey(kms.NewAWSProvider(client))
+		if assert.Error(t, err) {
+			assert.Equal(t, err.Error(), "Unable to generate MAC key: Unable to generate data key: testing errors")
+		}
+		assert.Equal(t, store.MACKey, "")
+
+	})
+
+	t.Run("rewrapped with the new encryption context", func(t *testing.T) {
+
+		value := "DEF"
+		newContext := map[string]*string{"ABC": &value}
+		newContext1 := map[string]*string{"ABC": &value, "Secret": &testName}
+
+		withMACStore(t, secrets()[:1], func(path string, client *kms_mock.Client) {
+
+			store, err := Load(path)
+			assert.NoError(t, err)
+			assert.NoError(t, store.Verify(kms.NewAWSProvider(client)))
+
+			client.On("Decrypt", testKeyCiphertext, testContext1).Return(testKeyID, testKeyPlaintext, nil).Once()
+			client.On("GenerateDataKey", testKeyID, newContext1).Return(testKeyCiphertext, testKeyPlaintext, nil).Once()
+			client.On("GenerateDataKey", testKeyID, newContext).Return(testKeyCiphertext2, testKeyPlaintext2, nil).Once()
+
+			err = store.RotateEncryptionContext(kms.NewAWSProvider(client), newContext)
+			assert.NoError(t, err)
+			assert.Equal(t, store.MACKey, "EJH1;bXkta2V5LWlk:YW5vdGhlcmNpcGhlcnRleHRibG9i")
+			assert.NoError(t, store.Save(path))
+			client.AssertExpectations(t)
+
+			client.On("Decrypt", testKeyCiphertext2, newContext).Return(testKeyID, testKeyPlaintext2, nil).Once()
+
+			store, err = Load(path)
+			assert.NoError(t, err)
+			assert.NoError(t, store.Verify(kms.NewAWSProvider(client)))
+
+		})
+
+	})
+
 }
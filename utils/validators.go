@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/adrienkohlbecker/ejson-kms/formatter"
@@ -81,6 +82,40 @@ func HasOneArgument(args []string) (string, error) {
 	return value, nil
 }
 
+// HasTwoArguments checks that the provided string slice has two (and only two)
+// values that are not empty, and returns them.
+func HasTwoArguments(args []string) (string, string, error) {
+
+	if len(args) < 2 {
+		return "", "", errors.Errorf("Expected two arguments, got %d", len(args))
+	} else if len(args) > 2 {
+		return "", "", errors.Errorf("More than two arguments provided")
+	}
+
+	if args[0] == "" || args[1] == "" {
+		return "", "", errors.Errorf("Empty argument")
+	}
+
+	return args[0], args[1], nil
+}
+
+// HasArguments checks that the provided string slice has at least one value,
+// and that none of the values are empty.
+func HasArguments(args []string) error {
+
+	if len(args) == 0 {
+		return errors.Errorf("No argument provided")
+	}
+
+	for _, value := range args {
+		if value == "" {
+			return errors.Errorf("Empty argument")
+		}
+	}
+
+	return nil
+}
+
 // ValidEncryptionContext parses the CLI form of key-value pairs used for
 // encryption contexts.
 // The format must be key1=value1. Keys and values are not checked for
@@ -126,3 +161,16 @@ func ValidFormatter(format string) (formatter.Formatter, error) {
 	return ret, nil
 
 }
+
+// ValidHistoryLimit parses the CLI form of a history limit: the number of
+// previous values kept for each secret, or zero to disable the history.
+func ValidHistoryLimit(raw string) (int, error) {
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 0 {
+		return 0, errors.Errorf("Invalid history limit %s, expected a positive number", raw)
+	}
+
+	return limit, nil
+
+}
@@ -168,6 +168,75 @@ func TestHasOneArgument(t *testing.T) {
 
 }
 
+func TestHasTwoArguments(t *testing.T) {
+
+	t.Run("valid", func(t *testing.T) {
+
+		first, second, err := HasTwoArguments([]string{"abc", "def"})
+		assert.NoError(t, err)
+		assert.Equal(t, first, "abc")
+		assert.Equal(t, second, "def")
+
+	})
+
+	t.Run("empty value", func(t *testing.T) {
+
+		_, _, err := HasTwoArguments([]string{"abc", ""})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Empty argument")
+		}
+
+	})
+
+	t.Run("only one", func(t *testing.T) {
+
+		_, _, err := HasTwoArguments([]string{"abc"})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Expected two arguments, got 1")
+		}
+
+	})
+
+	t.Run("more than two", func(t *testing.T) {
+
+		_, _, err := HasTwoArguments([]string{"abc", "def", "ghi"})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "More than two arguments provided")
+		}
+
+	})
+
+}
+
+func TestHasArguments(t *testing.T) {
+
+	t.Run("valid", func(t *testing.T) {
+
+		err := HasArguments([]string{"abc", "def"})
+		assert.NoError(t, err)
+
+	})
+
+	t.Run("empty value", func(t *testing.T) {
+
+		err := HasArguments([]string{"abc", ""})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Empty argument")
+		}
+
+	})
+
+	t.Run("empty", func(t *testing.T) {
+
+		err := HasArguments([]string{})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "No argument provided")
+		}
+
+	})
+
+}
+
 func TestValidEncryptionContext(t *testing.T) {
 
 	t.Run("valid", func(t *testing.T) {
@@ -230,3 +299,38 @@ func TestValidFormatter(t *testing.T) {
 	})
 
 }
+
+func TestValidHistoryLimit(t *testing.T) {
+
+	valid := map[string]int{
+		"0":  0,
+		"1":  1,
+		"10": 10,
+	}
+
+	for value, expected := range valid {
+
+		t.Run(fmt.Sprintf("valid %s", value), func(t *testing.T) {
+
+			ret, err := ValidHistoryLimit(value)
+			assert.NoError(t, err)
+			assert.Equal(t, ret, expected)
+
+		})
+
+	}
+
+	for _, value := range []string{"", "-1", "abc", "1.5"} {
+
+		t.Run(fmt.Sprintf("invalid %q", value), func(t *testing.T) {
+
+			_, err := ValidHistoryLimit(value)
+			if assert.Error(t, err) {
+				assert.Equal(t, err.Error(), fmt.Sprintf("Invalid history limit %s, expected a positive number", value))
+			}
+
+		})
+
+	}
+
+}